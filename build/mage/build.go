@@ -92,22 +92,12 @@ var binaries = map[string]binaryConfig{
 		configFiles: map[string]string{
 			"internal/plugins/yum/pkg/config/default/beskar-yum.yaml": "/etc/beskar/beskar-yum.yaml",
 		},
-		execStmts: [][]string{
-			{
-				"apk", "add", "createrepo_c", "--repository=http://dl-cdn.alpinelinux.org/alpine/edge/testing/",
-				// NOTE: restore in case alpine createrepo_c package is broken again
-				//"sh", "-c", "apt-get update -y && apt-get install -y --no-install-recommends ca-certificates createrepo-c && " +
-				//	"rm -rf /var/lib/apt/lists/* && rm -Rf /usr/share/doc && rm -Rf /usr/share/man && apt-get clean",
-			},
-		},
 		genAPI: &genAPI{
 			path:          "pkg/plugins/yum/api/v1",
 			filename:      "api.go",
 			interfaceName: "YUM",
 		},
 		useProto: true,
-		// NOTE: restore in case alpine createrepo_c package is broken again
-		// baseImage: "debian:bullseye-slim",
 		integrationTest: &integrationTest{
 			isPlugin: true,
 			envs: map[string]string{
@@ -38,7 +38,7 @@ func serve(beskarCmd *flag.FlagSet) error {
 		return err
 	}
 
-	ctx, beskarRegistry, err := beskar.New(beskarConfig)
+	ctx, beskarRegistry, err := beskar.New(beskarConfig, configDir)
 	if err != nil {
 		return fmt.Errorf("while initializing server: %w", err)
 	}
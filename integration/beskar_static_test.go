@@ -37,6 +37,10 @@ func getBeskarStaticFileURL(repository, filename string) string {
 func beskarStaticClient() *staticv1.HTTPClient {
 	httpClient := &http.Client{
 		Timeout: 20 * time.Second,
+		Transport: &util.BasicAuthTransport{
+			Username: BeskarUsername,
+			Password: BeskarPassword,
+		},
 	}
 
 	client, err := staticv1.NewHTTPClient(httpcodec.JSONCodec, httpClient, getBeskarStaticURL("api/v1"))
@@ -37,6 +37,10 @@ func getBeskarYUMRPMURL(repository, filename string) string {
 func beskarYUMClient() *yumv1.HTTPClient {
 	httpClient := &http.Client{
 		Timeout: 20 * time.Second,
+		Transport: &util.BasicAuthTransport{
+			Username: BeskarUsername,
+			Password: BeskarPassword,
+		},
 	}
 
 	client, err := yumv1.NewHTTPClient(httpcodec.JSONCodec, httpClient, getBeskarYUMURL("api/v1"))
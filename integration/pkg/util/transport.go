@@ -0,0 +1,25 @@
+package util
+
+import (
+	"net/http"
+)
+
+// BasicAuthTransport sets basic authentication credentials
+// on every request sent by the underlying transport.
+type BasicAuthTransport struct {
+	Username  string
+	Password  string
+	Transport http.RoundTripper
+}
+
+func (t *BasicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.Username, t.Password)
+
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return transport.RoundTrip(req)
+}
@@ -4,11 +4,14 @@
 package beskar
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/distribution/distribution/v3/registry/auth"
+	"go.ciq.dev/beskar/internal/pkg/config"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -16,38 +19,112 @@ import (
 // that simply checks for a non-empty Authorization header. It is useful for
 // demonstration and testing.
 type accessController struct {
-	hashPassword   []byte
-	hashedHostname string
+	// account is replaced when the account is changed
+	// on configuration reload.
+	account            atomic.Pointer[registryAccount]
+	hashedHostname     string
+	tokenAuthenticator *tokenAuthenticator
+	policy             *authorizationPolicy
 }
 
 var _ auth.AccessController = &accessController{}
 
-func newAccessController(hashedHostname string) auth.InitFunc {
+type accessControllerCallbackFunc func(*accessController)
+
+func newAccessController(hashedHostname string, authConfig config.Auth, callbackFn accessControllerCallbackFunc) auth.InitFunc {
 	return func(options map[string]interface{}) (auth.AccessController, error) {
-		account, ok := options["account"]
-		if !ok {
-			return nil, fmt.Errorf("account with hashed password is missing: htpasswd bcrypt format expected")
+		account, err := parseAccount(options)
+		if err != nil {
+			return nil, err
 		}
-		htpasswdEntry, ok := account.(string)
-		if !ok || htpasswdEntry == "" {
-			return nil, fmt.Errorf("account with hashed password is missing or badly formatted: htpasswd bcrypt format expected")
+
+		ac := &accessController{
+			hashedHostname: hashedHostname,
 		}
+		ac.account.Store(account)
 
-		idx := strings.Index(htpasswdEntry, ":")
-		if idx == -1 || idx >= len(htpasswdEntry) {
-			return nil, fmt.Errorf("account with hashed password is missing or badly formatted: htpasswd bcrypt format expected")
+		if authConfig.Token.Enabled {
+			ta, err := newTokenAuthenticator(authConfig.Token)
+			if err != nil {
+				return nil, err
+			}
+			ac.tokenAuthenticator = ta
 		}
 
-		return &accessController{
-			hashPassword:   []byte(htpasswdEntry[idx+1:]),
-			hashedHostname: hashedHostname,
-		}, nil
+		if authConfig.Policy.Rego != "" {
+			policy, err := newAuthorizationPolicy(authConfig.Policy)
+			if err != nil {
+				return nil, err
+			}
+			ac.policy = policy
+		}
+
+		if callbackFn != nil {
+			callbackFn(ac)
+		}
+
+		return ac, nil
+	}
+}
+
+// registryAccount is the registry htpasswd account.
+type registryAccount struct {
+	username     string
+	hashPassword []byte
+}
+
+// parseAccount returns the username and hashed password of the account option.
+func parseAccount(options map[string]interface{}) (*registryAccount, error) {
+	account, ok := options["account"]
+	if !ok {
+		return nil, fmt.Errorf("account with hashed password is missing: htpasswd bcrypt format expected")
+	}
+	htpasswdEntry, ok := account.(string)
+	if !ok || htpasswdEntry == "" {
+		return nil, fmt.Errorf("account with hashed password is missing or badly formatted: htpasswd bcrypt format expected")
+	}
+
+	idx := strings.Index(htpasswdEntry, ":")
+	if idx == -1 || idx >= len(htpasswdEntry) {
+		return nil, fmt.Errorf("account with hashed password is missing or badly formatted: htpasswd bcrypt format expected")
+	}
+
+	return &registryAccount{
+		username:     htpasswdEntry[:idx],
+		hashPassword: []byte(htpasswdEntry[idx+1:]),
+	}, nil
+}
+
+// setAccount replaces the account from the access controller options.
+func (ac *accessController) setAccount(options map[string]interface{}) error {
+	account, err := parseAccount(options)
+	if err != nil {
+		return err
 	}
+	ac.account.Store(account)
+	return nil
 }
 
-// Authorized simply checks for the existence of the authorization header,
-// responding with a bearer challenge if it doesn't exist.
+// Authorized authenticates the request when required by the access records
+// and then evaluates the authorization policy if any.
 func (ac *accessController) Authorized(req *http.Request, accessRecords ...auth.Access) (*auth.Grant, error) {
+	grant, err := ac.authenticate(req, accessRecords)
+	if err != nil {
+		return nil, err
+	} else if ac.policy == nil || isPluginRequest(req) {
+		return grant, nil
+	}
+
+	if err := ac.authorizePolicy(req, grant, accessRecords); err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+// authenticate simply checks for the existence of the authorization header,
+// responding with a challenge if it doesn't exist.
+func (ac *accessController) authenticate(req *http.Request, accessRecords []auth.Access) (*auth.Grant, error) {
 	requireAuthentication := false
 
 	for _, record := range accessRecords {
@@ -67,40 +144,144 @@ func (ac *accessController) Authorized(req *http.Request, accessRecords ...auth.
 		}
 	}
 
-	if !requireAuthentication {
+	if !requireAuthentication || isPluginRequest(req) {
 		return &auth.Grant{}, nil
-	} else if req.TLS != nil {
-		isPlugin, ok := req.Context().Value(&serverPluginContextKey).(bool)
-		if ok && isPlugin {
-			return &auth.Grant{}, nil
+	}
+
+	if ac.tokenAuthenticator != nil {
+		if bearer, ok := bearerToken(req); ok {
+			return ac.authorizeToken(req, bearer, accessRecords)
 		}
 	}
 
 	username, password, ok := req.BasicAuth()
 	if !ok {
-		return nil, &challenge{
-			err: auth.ErrInvalidCredential,
-		}
+		return nil, ac.challenge(req, auth.ErrInvalidCredential, accessRecords)
 	}
 
-	if err := bcrypt.CompareHashAndPassword(ac.hashPassword, []byte(password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword(ac.account.Load().hashPassword, []byte(password)); err != nil {
 		return nil, auth.ErrAuthenticationFailure
 	}
 
 	return &auth.Grant{User: auth.UserInfo{Name: username}}, nil
 }
 
+// authorizePolicy evaluates the authorization policy for each access record,
+// the policy is evaluated once with an empty repository and action for
+// requests without access records.
+func (ac *accessController) authorizePolicy(req *http.Request, grant *auth.Grant, accessRecords []auth.Access) error {
+	if len(accessRecords) == 0 {
+		accessRecords = []auth.Access{{}}
+	}
+
+	for _, record := range accessRecords {
+		allowed, err := ac.policy.allow(req.Context(), policyInput{
+			user:         grant.User.Name,
+			method:       req.Method,
+			path:         req.URL.Path,
+			resourceType: record.Type,
+			repository:   record.Name,
+			action:       record.Action,
+		})
+		if err != nil {
+			return fmt.Errorf("authorization policy evaluation error: %w", err)
+		} else if !allowed {
+			return ac.challenge(req, errPolicyDenied, accessRecords)
+		}
+	}
+
+	return nil
+}
+
+// isPluginRequest returns true for requests originating from plugins
+// authenticated with mutual TLS.
+func isPluginRequest(req *http.Request) bool {
+	if req.TLS == nil {
+		return false
+	}
+	isPlugin, ok := req.Context().Value(&serverPluginContextKey).(bool)
+	return ok && isPlugin
+}
+
+// authorizeToken verifies the bearer token and ensures that all requested
+// access records are covered by the token access claims.
+func (ac *accessController) authorizeToken(req *http.Request, bearer string, accessRecords []auth.Access) (*auth.Grant, error) {
+	claims, err := ac.tokenAuthenticator.verify(bearer)
+	if err != nil {
+		return nil, ac.challenge(req, fmt.Errorf("%w: %s", errInvalidToken, err), accessRecords)
+	}
+
+	resources := make([]auth.Resource, 0, len(accessRecords))
+
+	for _, record := range accessRecords {
+		if !claims.allow(record) {
+			return nil, ac.challenge(req, errInsufficientScope, accessRecords)
+		}
+		resources = append(resources, record.Resource)
+	}
+
+	return &auth.Grant{
+		User:      auth.UserInfo{Name: claims.Subject},
+		Resources: resources,
+	}, nil
+}
+
+func (ac *accessController) challenge(req *http.Request, err error, accessRecords []auth.Access) *challenge {
+	ch := &challenge{
+		err: err,
+	}
+	if ac.tokenAuthenticator != nil {
+		ch.realm = ac.tokenAuthenticator.realm(req)
+		ch.service = ac.tokenAuthenticator.config.Service
+		ch.scope = challengeScope(accessRecords)
+	}
+	return ch
+}
+
+func bearerToken(req *http.Request) (string, bool) {
+	authorization := req.Header.Get("Authorization")
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[7:]), true
+}
+
 type challenge struct {
-	err error
+	err     error
+	realm   string
+	service string
+	scope   string
 }
 
 var _ auth.Challenge = challenge{}
 
-// SetHeaders sets a simple bearer challenge on the response.
+// SetHeaders sets a basic challenge on the response or a bearer
+// challenge when token authentication is enabled.
 func (ch challenge) SetHeaders(_ *http.Request, w http.ResponseWriter) {
-	w.Header().Set("WWW-Authenticate", "Basic realm=beskar")
+	if ch.realm == "" {
+		w.Header().Set("WWW-Authenticate", "Basic realm=beskar")
+		return
+	}
+
+	header := fmt.Sprintf("Bearer realm=%q,service=%q", ch.realm, ch.service)
+	if ch.scope != "" {
+		header += fmt.Sprintf(",scope=%q", ch.scope)
+	}
+	if errors.Is(ch.err, errInsufficientScope) {
+		header += `,error="insufficient_scope"`
+	} else if errors.Is(ch.err, errInvalidToken) {
+		header += `,error="invalid_token"`
+	}
+	w.Header().Set("WWW-Authenticate", header)
+}
+
+func (ch challenge) Unwrap() error {
+	return ch.err
 }
 
 func (ch challenge) Error() string {
+	if ch.realm != "" {
+		return fmt.Sprintf("bearer authentication challenge for realm %s: %s", ch.realm, ch.err)
+	}
 	return fmt.Sprintf("basic authentication challenge for realm beskar: %s", ch.err)
 }
@@ -0,0 +1,476 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/gorilla/mux"
+	"go.ciq.dev/beskar/internal/pkg/maintenance"
+)
+
+const adminPath = "/admin/v1"
+
+// adminAccess is the access record required to use the admin API.
+var adminAccess = auth.Access{
+	Resource: auth.Resource{
+		Type: "registry",
+		Name: "admin",
+	},
+	Action: "*",
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// initAdminRouter registers the admin API routes.
+func (br *Registry) initAdminRouter() {
+	router := br.router.PathPrefix(adminPath).Subrouter()
+	router.Use(br.adminMiddleware)
+
+	router.HandleFunc("/outbox", br.adminListOutbox).Methods(http.MethodGet)
+	router.HandleFunc("/outbox/{node}/{plugin}/{id}", br.adminGetOutboxEntry).Methods(http.MethodGet)
+	router.HandleFunc("/outbox/{node}/{plugin}/{id}", br.adminDropOutboxEntry).Methods(http.MethodDelete)
+	router.HandleFunc("/outbox/{node}/{plugin}/{id}/replay", br.adminReplayOutboxEntry).Methods(http.MethodPost)
+
+	router.HandleFunc("/gc", br.adminGCStatus).Methods(http.MethodGet)
+	router.HandleFunc("/gc", br.adminStartGC).Methods(http.MethodPost)
+
+	router.HandleFunc("/usage", br.adminUsage).Methods(http.MethodGet)
+
+	router.HandleFunc("/audit", br.adminAudit).Methods(http.MethodGet)
+
+	router.HandleFunc("/config/reload", br.adminConfigReloadStatus).Methods(http.MethodGet)
+	router.HandleFunc("/config/reload", br.adminConfigReload).Methods(http.MethodPost)
+
+	router.HandleFunc("/maintenance", br.adminMaintenance).Methods(http.MethodGet)
+	router.HandleFunc("/maintenance", br.adminSetMaintenance).Methods(http.MethodPut)
+
+	router.HandleFunc("/replication", br.adminReplication).Methods(http.MethodGet)
+	router.HandleFunc("/replication/{target}/retry", br.adminRetryReplication).Methods(http.MethodPost)
+
+	router.HandleFunc("/members", br.adminMembers).Methods(http.MethodGet)
+	router.HandleFunc("/plugins", br.adminPlugins).Methods(http.MethodGet)
+	router.HandleFunc("/plugins/health", br.adminPluginsHealth).Methods(http.MethodGet)
+	router.HandleFunc("/plugins/{plugin}/router/explain", br.adminExplainRoute).Methods(http.MethodPost)
+	router.HandleFunc("/cache/peers", br.adminCachePeers).Methods(http.MethodGet)
+	router.HandleFunc("/cache/blobs", br.adminBlobCache).Methods(http.MethodGet)
+	router.HandleFunc("/route", br.adminRoute).Methods(http.MethodGet)
+}
+
+// adminMiddleware authenticates admin API requests with the registry access controller.
+func (br *Registry) adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if br.accessController == nil {
+			writeAdminError(w, http.StatusServiceUnavailable, fmt.Errorf("access controller not initialized"))
+			return
+		}
+
+		if _, err := br.accessController.Authorized(r, adminAccess); err != nil {
+			br.logger.Debugf("unauthorized admin request %s %s: %s", r.Method, r.URL.Path, err)
+
+			if errors.Is(err, errPolicyDenied) {
+				writeAdminError(w, http.StatusForbidden, err)
+				return
+			} else if challenge, ok := err.(auth.Challenge); ok {
+				challenge.SetHeaders(r, w)
+			}
+			writeAdminError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, statusCode int, err error) {
+	writeAdminJSON(w, statusCode, &adminError{Error: err.Error()})
+}
+
+func (br *Registry) adminListOutbox(w http.ResponseWriter, r *http.Request) {
+	entries, err := br.outbox.list(r.Context(), r.URL.Query().Get("plugin"))
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// don't return event payloads with the list
+	for _, entry := range entries {
+		entry.Event = nil
+	}
+	if entries == nil {
+		entries = []*outboxEntry{}
+	}
+
+	writeAdminJSON(w, http.StatusOK, entries)
+}
+
+func (br *Registry) adminOutboxEntry(w http.ResponseWriter, r *http.Request) (*outboxEntry, bool) {
+	vars := mux.Vars(r)
+
+	entry, err := br.outbox.get(r.Context(), vars["node"], vars["plugin"], vars["id"])
+	if errors.Is(err, errOutboxEntryNotFound) {
+		writeAdminError(w, http.StatusNotFound, err)
+		return nil, false
+	} else if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	return entry, true
+}
+
+func (br *Registry) adminGetOutboxEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := br.adminOutboxEntry(w, r)
+	if !ok {
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, entry)
+}
+
+func (br *Registry) adminDropOutboxEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := br.adminOutboxEntry(w, r)
+	if !ok {
+		return
+	}
+
+	if err := br.outbox.remove(r.Context(), entry); err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	br.logger.Warnf("Dropped %s event for %s from outbox of plugin %s", entry.Action, entry.Repository, entry.Plugin)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminReplayOutboxEntry delivers the event immediately regardless of its
+// scheduled delivery time.
+func (br *Registry) adminReplayOutboxEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := br.adminOutboxEntry(w, r)
+	if !ok {
+		return
+	}
+
+	if err := br.outbox.deliver(r.Context(), br.pluginManager, entry); err != nil {
+		writeAdminError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (br *Registry) adminGCStatus(w http.ResponseWriter, _ *http.Request) {
+	report := br.gcStatus()
+	if report == nil {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("no garbage collection has been run"))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, report)
+}
+
+// adminStartGC starts an online garbage collection, it runs in dry-run mode
+// unless the dryrun query parameter is false. The grace period can be set
+// with the grace query parameter (eg: grace=2h).
+func (br *Registry) adminStartGC(w http.ResponseWriter, r *http.Request) {
+	opts := gcOptions{
+		dryRun:      true,
+		gracePeriod: DefaultGCGracePeriod,
+	}
+
+	query := r.URL.Query()
+
+	if v := query.Get("dryrun"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("bad dryrun parameter: %w", err))
+			return
+		}
+		opts.dryRun = dryRun
+	}
+	if v := query.Get("grace"); v != "" {
+		gracePeriod, err := time.ParseDuration(v)
+		if err != nil || gracePeriod < 0 {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("bad grace parameter %q", v))
+			return
+		}
+		opts.gracePeriod = gracePeriod
+	}
+
+	report, err := br.startGC(context.WithoutCancel(r.Context()), opts)
+	if errors.Is(err, errGCRunning) {
+		writeAdminError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeAdminJSON(w, http.StatusAccepted, report)
+}
+
+// adminUsage reports the storage usage of the namespaces with a quota, or
+// of the namespace query parameter when set (eg: namespace=artifacts/static/team-x).
+func (br *Registry) adminUsage(w http.ResponseWriter, r *http.Request) {
+	namespace := strings.Trim(r.URL.Query().Get("namespace"), "/")
+
+	if namespace == "" {
+		usage, err := br.quotas.usage(r.Context())
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, usage)
+		return
+	}
+
+	usage, err := computeNamespaceUsage(r.Context(), br.driver, namespace)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, quotaUsage := range br.quotas.match(namespace) {
+		if quotaUsage.quota.Namespace == namespace {
+			usage.MaxBytes = quotaUsage.quota.MaxBytes
+			usage.MaxArtifacts = quotaUsage.quota.MaxArtifacts
+		}
+	}
+
+	writeAdminJSON(w, http.StatusOK, usage)
+}
+
+// adminMembers lists the gossip members, beskar and plugin instances.
+func (br *Registry) adminMembers(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, br.clusterMembers())
+}
+
+// adminPlugins lists the registered plugins with their version,
+// media types and nodes.
+func (br *Registry) adminPlugins(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, br.pluginManager.describe())
+}
+
+// adminCachePeers lists the groupcache peers.
+func (br *Registry) adminCachePeers(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, br.cachePeers())
+}
+
+// adminBlobCache reports the local blob cache statistics.
+func (br *Registry) adminBlobCache(w http.ResponseWriter, _ *http.Request) {
+	stats := br.blobCache.stats()
+	if stats == nil {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("blob cache is disabled"))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, stats)
+}
+
+// adminRoute reports the plugin node handling the repository query
+// parameter (eg: repository=artifacts/yum/rocky-9).
+func (br *Registry) adminRoute(w http.ResponseWriter, r *http.Request) {
+	repository := strings.Trim(r.URL.Query().Get("repository"), "/")
+	if repository == "" {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("missing repository parameter"))
+		return
+	}
+
+	route, err := br.pluginManager.route(repository)
+	if errors.Is(err, errPluginNotFound) {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, route)
+}
+
+// explainRouteRequest is the plugin request to evaluate with the plugin router.
+type explainRouteRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// adminExplainRoute runs the plugin router decision for a request method, path
+// and optional JSON body against the registry, without forwarding the request
+// to the plugin. It returns the decision result, the oci.blob_digest lookups
+// performed and the evaluation trace.
+func (br *Registry) adminExplainRoute(w http.ResponseWriter, r *http.Request) {
+	explainReq := new(explainRouteRequest)
+	if err := json.NewDecoder(r.Body).Decode(explainReq); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("bad request body: %w", err))
+		return
+	} else if explainReq.Method == "" || explainReq.Path == "" {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("method and path are required"))
+		return
+	}
+
+	var body io.Reader = http.NoBody
+	if len(explainReq.Body) > 0 {
+		body = bytes.NewReader(explainReq.Body)
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), strings.ToUpper(explainReq.Method), explainReq.Path, body)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	explanation, err := br.pluginManager.explainRoute(mux.Vars(r)["plugin"], req)
+	if errors.Is(err, errPluginNotFound) {
+		writeAdminError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, explanation)
+}
+
+// adminMaintenance reports the read-only maintenance state of the cluster.
+func (br *Registry) adminMaintenance(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, newMaintenanceStatus(br.maintenance.Get()))
+}
+
+type maintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// adminSetMaintenance enables or disables the read-only maintenance mode
+// of the cluster (eg: {"enabled": true, "reason": "storage migration"}).
+func (br *Registry) adminSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	maintenanceReq := new(maintenanceRequest)
+	if err := json.NewDecoder(r.Body).Decode(maintenanceReq); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("bad request body: %w", err))
+		return
+	} else if len(maintenanceReq.Reason) > maintenance.MaxReasonLength {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("reason exceeds %d characters", maintenance.MaxReasonLength))
+		return
+	}
+
+	state, err := br.setMaintenance(r.Context(), maintenanceReq.Enabled, maintenanceReq.Reason)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, newMaintenanceStatus(state))
+}
+
+// adminReplication reports the replication status of each target: pending
+// events and lag, the failures are those of the events replicated by this instance.
+func (br *Registry) adminReplication(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, br.replicator.status())
+}
+
+type replicationRetryResponse struct {
+	Queued int `json:"queued"`
+}
+
+// adminRetryReplication queues the failed events of the target again.
+func (br *Registry) adminRetryReplication(w http.ResponseWriter, r *http.Request) {
+	target, ok := br.replicator.target(mux.Vars(r)["target"])
+	if !ok {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("unknown replication target %s", mux.Vars(r)["target"]))
+		return
+	}
+
+	queued := target.retry(r.Context())
+
+	br.logger.Infof("Queued %d failed events again for replication target %s", queued, target.name)
+
+	writeAdminJSON(w, http.StatusOK, &replicationRetryResponse{Queued: queued})
+}
+
+// adminPluginsHealth reports the health of the plugin nodes and whether they
+// are ejected from the plugin node hash.
+func (br *Registry) adminPluginsHealth(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, br.pluginManager.health.list())
+}
+
+// adminAudit returns the audit log entries, entries can be filtered with the
+// user, repository, from and to query parameters (eg: user=admin&from=2024-01-02T15:04:05Z),
+// the repository parameter also matches the repositories below it. Without time range
+// the last 24 hours are returned, the number of entries is bounded by the limit parameter.
+func (br *Registry) adminAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := auditFilter{
+		User:       query.Get("user"),
+		Repository: strings.Trim(query.Get("repository"), "/"),
+	}
+
+	for param, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := query.Get(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeAdminError(w, http.StatusBadRequest, fmt.Errorf("bad %s parameter: %w", param, err))
+				return
+			}
+			*t = parsed
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("to parameter is before from parameter"))
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeAdminError(w, http.StatusBadRequest, fmt.Errorf("bad limit parameter %q", v))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := br.audit.query(r.Context(), filter)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, entries)
+}
+
+// adminConfigReloadStatus returns the report of the last configuration reload.
+func (br *Registry) adminConfigReloadStatus(w http.ResponseWriter, _ *http.Request) {
+	report := br.lastConfigReload()
+	if report == nil {
+		writeAdminError(w, http.StatusNotFound, fmt.Errorf("configuration not reloaded yet"))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, report)
+}
+
+// adminConfigReload reloads the configuration like on SIGHUP and reports the
+// settings applied and the settings requiring a restart.
+func (br *Registry) adminConfigReload(w http.ResponseWriter, _ *http.Request) {
+	report := br.reloadConfig()
+	if report.Error != "" {
+		writeAdminJSON(w, http.StatusUnprocessableEntity, report)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, report)
+}
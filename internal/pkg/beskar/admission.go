@@ -0,0 +1,267 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/util"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"go.ciq.dev/beskar/internal/pkg/config"
+	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
+)
+
+const (
+	admissionPolicyQuery = "data.beskar.admission.deny"
+
+	// maxAdmissionConfigSize is the maximum size of a JSON manifest
+	// config decoded for the admission policy input.
+	maxAdmissionConfigSize = 64 * 1024
+
+	admissionSourcePolicy = "policy"
+	admissionSourcePlugin = "plugin"
+)
+
+// admissionPolicy evaluates an operator supplied Rego admission policy,
+// the policy receives the following input:
+//
+//	{
+//	  "user": "username or empty for anonymous and plugin pushes",
+//	  "origin": "plugin for manifests pushed by plugins, external otherwise",
+//	  "repository": "repository name",
+//	  "tag": "tag or empty for pushes by digest",
+//	  "digest": "manifest digest",
+//	  "mediaType": "manifest media type",
+//	  "manifest": {decoded manifest},
+//	  "config": {decoded manifest config if it's a JSON document, null otherwise}
+//	}
+//
+// and must define the set data.beskar.admission.deny containing the messages
+// explaining why the manifest is rejected, the push is admitted if the set is
+// empty or undefined.
+type admissionPolicy struct {
+	peq rego.PreparedEvalQuery
+}
+
+func newAdmissionPolicy(admissionConfig config.Admission) (*admissionPolicy, error) {
+	peq, err := prepareRegoQuery(admissionPolicyQuery, admissionConfig.Rego, admissionConfig.Data)
+	if err != nil {
+		return nil, fmt.Errorf("admission policy: %w", err)
+	}
+
+	return &admissionPolicy{
+		peq: peq,
+	}, nil
+}
+
+// deny returns the sorted rejection messages of the policy.
+func (ap *admissionPolicy) deny(ctx context.Context, input map[string]any) ([]string, error) {
+	rs, err := ap.peq.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []string
+
+	for _, result := range rs {
+		for _, expression := range result.Expressions {
+			values, ok := expression.Value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a set, got %T", admissionPolicyQuery, expression.Value)
+			}
+			for _, value := range values {
+				messages = append(messages, fmt.Sprint(value))
+			}
+		}
+	}
+
+	sort.Strings(messages)
+
+	return messages, nil
+}
+
+// admissionController validates pushed manifests before they are committed
+// with the admission policy first, and then with the plugin owning the
+// artifact if enabled. Manifests pushed by plugins aren't submitted to plugins.
+type admissionController struct {
+	policy        *admissionPolicy
+	pluginManager *pluginManager
+	plugins       map[string]struct{}
+	failClosed    bool
+	logger        *logrus.Entry
+}
+
+func newAdmissionController(admissionConfig config.Admission, logger *logrus.Entry) (*admissionController, error) {
+	ac := &admissionController{
+		plugins:    make(map[string]struct{}),
+		failClosed: admissionConfig.FailurePolicy == config.AdmissionFailurePolicyFail,
+		logger:     logger,
+	}
+
+	for _, plugin := range admissionConfig.Plugins {
+		ac.plugins[plugin] = struct{}{}
+	}
+
+	if admissionConfig.Rego != "" {
+		policy, err := newAdmissionPolicy(admissionConfig)
+		if err != nil {
+			return nil, err
+		}
+		ac.policy = policy
+	}
+
+	return ac, nil
+}
+
+// admit returns a DENIED error with the rejection messages if the manifest is rejected.
+func (ac *admissionController) admit(ctx context.Context, repository distribution.Repository, tag string, dgst digest.Digest, mediaType string, payload []byte) error {
+	if ac == nil {
+		return nil
+	}
+
+	repositoryName := repository.Named().Name()
+
+	if ac.policy != nil {
+		input := ac.policyInput(ctx, repository, tag, dgst, mediaType, payload)
+
+		messages, err := ac.policy.deny(ctx, input)
+		if err != nil {
+			return fmt.Errorf("while evaluating admission policy: %w", err)
+		} else if len(messages) > 0 {
+			admissionRejections.WithLabelValues(admissionSourcePolicy).Inc()
+			return errcode.ErrorCodeDenied.WithMessage(
+				fmt.Sprintf("%s@%s rejected by admission policy: %s", repositoryName, dgst, strings.Join(messages, "; ")),
+			)
+		}
+	}
+
+	if isPluginContext(ctx) {
+		return nil
+	}
+
+	message, err := ac.admitPlugin(ctx, repositoryName, dgst, mediaType, payload)
+	if err != nil {
+		if ac.failClosed {
+			return errcode.ErrorCodeUnavailable.WithMessage(fmt.Sprintf("plugin admission check failed: %s", err))
+		}
+		admissionPluginErrors.Inc()
+		ac.logger.Warnf("Admitting %s@%s without plugin admission check: %s", repositoryName, dgst, err)
+		return nil
+	} else if message != "" {
+		admissionRejections.WithLabelValues(admissionSourcePlugin).Inc()
+		return errcode.ErrorCodeDenied.WithMessage(
+			fmt.Sprintf("%s@%s rejected by plugin: %s", repositoryName, dgst, message),
+		)
+	}
+
+	return nil
+}
+
+func (ac *admissionController) policyInput(ctx context.Context, repository distribution.Repository, tag string, dgst digest.Digest, mediaType string, payload []byte) map[string]any {
+	input := map[string]any{
+		"user":       "",
+		"origin":     "external",
+		"repository": repository.Named().Name(),
+		"tag":        tag,
+		"digest":     dgst.String(),
+		"mediaType":  mediaType,
+		"manifest":   nil,
+		"config":     nil,
+	}
+
+	if isPluginContext(ctx) {
+		input["origin"] = "plugin"
+	} else if user, ok := ctx.Value("auth.user.name").(string); ok {
+		input["user"] = user
+	}
+
+	var manifest any
+	if err := util.UnmarshalJSON(payload, &manifest); err == nil {
+		input["manifest"] = manifest
+	}
+
+	if !isImageManifest(mediaType) {
+		return input
+	}
+
+	ociManifest, err := v1.ParseManifest(bytes.NewReader(payload))
+	if err != nil {
+		return input
+	}
+
+	configDesc := ociManifest.Config
+	if configDesc.Size > maxAdmissionConfigSize || !strings.HasSuffix(string(configDesc.MediaType), "json") {
+		return input
+	}
+
+	// the push fails later if the config blob is missing
+	configBlob, err := repository.Blobs(ctx).Get(ctx, digest.Digest(configDesc.Digest.String()))
+	if err != nil {
+		return input
+	}
+
+	var manifestConfig any
+	if err := util.UnmarshalJSON(configBlob, &manifestConfig); err == nil {
+		input["config"] = manifestConfig
+	}
+
+	return input
+}
+
+// admitPlugin submits the manifest to the plugin owning the artifact if the plugin is
+// enabled, it returns the rejection message of the plugin if the manifest is rejected.
+func (ac *admissionController) admitPlugin(ctx context.Context, repositoryName string, dgst digest.Digest, mediaType string, payload []byte) (string, error) {
+	if ac.pluginManager == nil || len(ac.plugins) == 0 {
+		return "", nil
+	} else if !artifactsMatch.MatchString(repositoryName) || !isImageManifest(mediaType) {
+		return "", nil
+	}
+
+	ociManifest, err := v1.ParseManifest(bytes.NewReader(payload))
+	if err != nil {
+		return "", nil
+	}
+
+	plugin, ok := ac.pluginManager.getPlugin(string(ociManifest.Config.MediaType))
+	if !ok {
+		return "", nil
+	} else if _, enabled := ac.plugins[plugin.name]; !enabled {
+		return "", nil
+	}
+
+	return plugin.admit(ctx, &eventv1.EventPayload{
+		Repository: repositoryName,
+		Digest:     dgst.String(),
+		Mediatype:  string(ociManifest.Config.MediaType),
+		Payload:    payload,
+		Action:     eventv1.Action_ACTION_PUT,
+		Origin:     eventv1.Origin_ORIGIN_EXTERNAL,
+	})
+}
+
+func isImageManifest(mediaType string) bool {
+	switch mediaType {
+	case "application/vnd.oci.image.manifest.v1+json",
+		"application/vnd.docker.distribution.manifest.v1+json",
+		"application/vnd.docker.distribution.manifest.v2+json":
+		return true
+	}
+	return false
+}
+
+// isPluginContext returns true for requests sent by plugins, plugins
+// connections are identified within server ConnContext.
+func isPluginContext(ctx context.Context) bool {
+	isPlugin, ok := ctx.Value(&serverPluginContextKey).(bool)
+	return ok && isPlugin
+}
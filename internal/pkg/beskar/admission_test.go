@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/reference"
+	"github.com/open-policy-agent/opa/util"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/pkg/config"
+	"go.ciq.dev/beskar/pkg/rv"
+)
+
+const testAdmissionPolicy = `
+package beskar.admission
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+deny contains msg if {
+	startswith(input.repository, "artifacts/static/")
+	some layer in input.manifest.layers
+	layer.size > data.limits.static
+	msg := sprintf("file %s exceeds %d bytes", [layer.annotations["org.opencontainers.image.title"], data.limits.static])
+}
+
+deny contains "missing tag" if {
+	input.origin == "external"
+	input.tag == ""
+}
+`
+
+const testAdmissionManifest = `{
+	"schemaVersion": 2,
+	"mediaType": "application/vnd.oci.image.manifest.v1+json",
+	"config": {
+		"mediaType": "application/vnd.ciq.static.file.v1.config+json",
+		"digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+		"size": 2
+	},
+	"layers": [
+		{
+			"mediaType": "application/vnd.ciq.static.v1.file",
+			"digest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+			"size": 2048,
+			"annotations": {
+				"org.opencontainers.image.title": "file.iso"
+			}
+		}
+	]
+}`
+
+func TestAdmissionPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	regoFile := filepath.Join(dir, "admission.rego")
+	dataFile := filepath.Join(dir, "data.json")
+
+	require.NoError(t, os.WriteFile(regoFile, []byte(testAdmissionPolicy), 0o600))
+	require.NoError(t, os.WriteFile(dataFile, []byte(`{"limits": {"static": 1024}}`), 0o600))
+
+	policy, err := newAdmissionPolicy(config.Admission{
+		Rego: regoFile,
+		Data: dataFile,
+	})
+	require.NoError(t, err)
+
+	var manifest any
+	require.NoError(t, util.UnmarshalJSON([]byte(testAdmissionManifest), &manifest))
+
+	for _, tc := range []struct {
+		name       string
+		repository string
+		origin     string
+		tag        string
+		messages   []string
+	}{
+		{name: "admitted", repository: "artifacts/yum/rocky/packages", origin: "external", tag: "latest"},
+		{name: "plugin push without tag", repository: "artifacts/yum/rocky/packages", origin: "plugin"},
+		{name: "too large", repository: "artifacts/static/files/files", origin: "external", tag: "latest", messages: []string{
+			"file file.iso exceeds 1024 bytes",
+		}},
+		{name: "too large without tag", repository: "artifacts/static/files/files", origin: "external", messages: []string{
+			"file file.iso exceeds 1024 bytes",
+			"missing tag",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			messages, err := policy.deny(context.Background(), map[string]any{
+				"repository": tc.repository,
+				"origin":     tc.origin,
+				"tag":        tc.tag,
+				"manifest":   manifest,
+				"config":     nil,
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.messages, messages)
+		})
+	}
+
+	_, err = newAdmissionPolicy(config.Admission{Rego: filepath.Join(dir, "missing.rego")})
+	require.Error(t, err)
+}
+
+func TestAdmissionPlugins(t *testing.T) {
+	ctx := context.Background()
+	logger := logrus.NewEntry(logrus.New())
+
+	registry, err := storage.NewRegistry(ctx, inmemory.New())
+	require.NoError(t, err)
+	named, err := reference.WithName("artifacts/static/files/files")
+	require.NoError(t, err)
+	repo, err := registry.Repository(ctx, named)
+	require.NoError(t, err)
+
+	// the plugin has no node, asking it fails
+	pm := newPluginManager(nil, logger)
+	pm.plugins["static"] = &plugin{
+		name:       "static",
+		nodeHash:   rv.NewNodeHash(nil),
+		mediaTypes: map[string]struct{}{"application/vnd.ciq.static.file.v1.config+json": {}},
+	}
+
+	payload := []byte(testAdmissionManifest)
+	dgst := digest.FromBytes(payload)
+	mediaType := "application/vnd.oci.image.manifest.v1+json"
+
+	for _, tc := range []struct {
+		name      string
+		admission config.Admission
+		err       errcode.ErrorCode
+	}{
+		{name: "plugin not enabled", admission: config.Admission{}},
+		{name: "fail open", admission: config.Admission{
+			Plugins:       []string{"static"},
+			FailurePolicy: config.AdmissionFailurePolicyIgnore,
+		}},
+		{name: "fail closed", admission: config.Admission{
+			Plugins:       []string{"static"},
+			FailurePolicy: config.AdmissionFailurePolicyFail,
+		}, err: errcode.ErrorCodeUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ac, err := newAdmissionController(tc.admission, logger)
+			require.NoError(t, err)
+			ac.pluginManager = pm
+
+			err = ac.admit(ctx, repo, "latest", dgst, mediaType, payload)
+			if tc.err == 0 {
+				require.NoError(t, err)
+			} else {
+				var ecErr errcode.Error
+				require.ErrorAs(t, err, &ecErr)
+				require.Equal(t, tc.err, ecErr.Code)
+			}
+		})
+	}
+}
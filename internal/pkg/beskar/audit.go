@@ -0,0 +1,401 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/sirupsen/logrus"
+	"go.ciq.dev/beskar/internal/pkg/config"
+)
+
+const (
+	auditStorageRoot = "/beskar/audit"
+	auditDayLayout   = "2006-01-02"
+
+	auditFlushInterval = 5 * time.Second
+	auditFlushSize     = 256
+	// maximum number of entries kept in memory when the storage is failing
+	auditMaxPending = 100000
+
+	auditDefaultRange = 24 * time.Hour
+	auditDefaultLimit = 1000
+
+	auditResultSuccess = "success"
+	auditResultFailure = "failure"
+
+	auditOperationPutManifest    = "PutManifest"
+	auditOperationDeleteManifest = "DeleteManifest"
+
+	// auditPluginUser is the user recorded for operations done by plugins
+	// authenticated with mutual TLS.
+	auditPluginUser = "beskar-plugin"
+)
+
+// auditEntry records a mutating operation done through the registry or
+// a plugin API.
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	Node       string    `json:"node"`
+	User       string    `json:"user"`
+	ClientIP   string    `json:"clientIP"`
+	Operation  string    `json:"operation"`
+	Plugin     string    `json:"plugin,omitempty"`
+	Repository string    `json:"repository"`
+	Digest     string    `json:"digest,omitempty"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func (e *auditEntry) setResult(err error) {
+	e.Result = auditResultSuccess
+	if err != nil {
+		e.Result = auditResultFailure
+		e.Error = err.Error()
+	}
+}
+
+// auditFilter selects audit entries, the repository matches
+// the repository and all repositories below it.
+type auditFilter struct {
+	User       string
+	Repository string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+func (f *auditFilter) match(entry *auditEntry) bool {
+	if f.User != "" && entry.User != f.User {
+		return false
+	} else if f.Repository != "" && !inNamespace(f.Repository, entry.Repository) {
+		return false
+	} else if entry.Time.Before(f.From) || entry.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// auditLog stores audit entries in the registry storage, entries are
+// buffered and periodically written by batch in JSON lines files, one
+// file per flush under a directory per day:
+// /beskar/audit/<day>/<node>-<flush time>.jsonl
+type auditLog struct {
+	driver         storagedriver.StorageDriver
+	node           string
+	trustedProxies []netip.Prefix
+	logger         *logrus.Entry
+
+	pendingMutex sync.Mutex
+	pending      []*auditEntry
+
+	flushMutex sync.Mutex
+	flushCh    chan struct{}
+}
+
+func newAuditLog(driver storagedriver.StorageDriver, node string, trustedProxies []netip.Prefix, logger *logrus.Entry) *auditLog {
+	return &auditLog{
+		driver:         driver,
+		node:           node,
+		trustedProxies: trustedProxies,
+		logger:         logger,
+		flushCh:        make(chan struct{}, 1),
+	}
+}
+
+// parseTrustedProxies parses the IP addresses and CIDR ranges of the trusted proxies.
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+
+	for _, proxy := range proxies {
+		prefix, err := config.ParseTrustedProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes, nil
+}
+
+// record queues the entry for storage.
+func (al *auditLog) record(entry *auditEntry) {
+	if al == nil {
+		return
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.Node = al.node
+
+	al.pendingMutex.Lock()
+	al.pending = append(al.pending, entry)
+	if len(al.pending) > auditMaxPending {
+		al.logger.Errorf("audit log: dropping %d entries not yet stored", len(al.pending)-auditMaxPending)
+		al.pending = al.pending[len(al.pending)-auditMaxPending:]
+	}
+	flush := len(al.pending) >= auditFlushSize
+	al.pendingMutex.Unlock()
+
+	if flush {
+		select {
+		case al.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// recordManifest records a manifest push or deletion from the request
+// context of the registry manifest handler.
+func (al *auditLog) recordManifest(ctx context.Context, operation, repository, dgst string, err error) {
+	if al == nil {
+		return
+	}
+
+	entry := &auditEntry{
+		Operation:  operation,
+		Repository: repository,
+		Digest:     dgst,
+	}
+	entry.setResult(err)
+
+	req, _ := ctx.Value("http.request").(*http.Request)
+	if req != nil && isPluginRequest(req) {
+		entry.User = auditPluginUser
+	} else if user, ok := ctx.Value("auth.user.name").(string); ok {
+		entry.User = user
+	}
+	if req != nil {
+		entry.ClientIP = al.clientIP(req)
+	}
+
+	al.record(entry)
+}
+
+func (al *auditLog) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range al.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the client IP address of the request, the X-Forwarded-For
+// and X-Real-Ip headers are only honored when the request comes from a trusted
+// proxy. X-Forwarded-For is read from right to left and the first address not
+// belonging to a trusted proxy is returned, so addresses prepended by clients
+// are ignored.
+func (al *auditLog) clientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	if !al.trustedProxy(ip) {
+		return ip
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		addrs := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if addr == "" {
+				continue
+			}
+			ip = addr
+			if !al.trustedProxy(addr) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-Ip")); realIP != "" {
+		return realIP
+	}
+
+	return ip
+}
+
+// run periodically flushes the pending entries until the context is canceled.
+func (al *auditLog) run(ctx context.Context) {
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := al.flush(context.Background()); err != nil {
+				al.logger.Errorf("audit log flush error: %s", err)
+			}
+			return
+		case <-ticker.C:
+		case <-al.flushCh:
+		}
+
+		if err := al.flush(ctx); err != nil {
+			al.logger.Errorf("audit log flush error: %s", err)
+		}
+	}
+}
+
+// flush writes the pending entries to storage, entries are kept
+// in memory and retried on the next flush when it fails.
+func (al *auditLog) flush(ctx context.Context) error {
+	al.flushMutex.Lock()
+	defer al.flushMutex.Unlock()
+
+	al.pendingMutex.Lock()
+	entries := al.pending
+	al.pending = nil
+	al.pendingMutex.Unlock()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	days := make(map[string]*bytes.Buffer)
+	var dayOrder []string
+
+	for _, entry := range entries {
+		day := entry.Time.UTC().Format(auditDayLayout)
+		buf, ok := days[day]
+		if !ok {
+			buf = new(bytes.Buffer)
+			days[day] = buf
+			dayOrder = append(dayOrder, day)
+		}
+		if err := json.NewEncoder(buf).Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	flushTime := time.Now().UTC().UnixNano()
+
+	for i, day := range dayOrder {
+		filename := path.Join(auditStorageRoot, day, fmt.Sprintf("%s-%020d.jsonl", al.node, flushTime))
+
+		if err := al.driver.PutContent(ctx, filename, days[day].Bytes()); err != nil {
+			// put back the entries of the days not stored
+			remaining := make(map[string]struct{})
+			for _, d := range dayOrder[i:] {
+				remaining[d] = struct{}{}
+			}
+
+			var failed []*auditEntry
+			for _, entry := range entries {
+				if _, ok := remaining[entry.Time.UTC().Format(auditDayLayout)]; ok {
+					failed = append(failed, entry)
+				}
+			}
+
+			al.pendingMutex.Lock()
+			al.pending = append(failed, al.pending...)
+			al.pendingMutex.Unlock()
+
+			return fmt.Errorf("while writing %s: %w", filename, err)
+		}
+	}
+
+	return nil
+}
+
+// query returns the entries matching the filter sorted by time, including
+// the entries of this node not yet stored. When more entries than the limit
+// match, the most recent ones are returned.
+func (al *auditLog) query(ctx context.Context, filter auditFilter) ([]*auditEntry, error) {
+	if filter.To.IsZero() {
+		filter.To = time.Now().UTC()
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.Add(-auditDefaultRange)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = auditDefaultLimit
+	}
+
+	entries := make([]*auditEntry, 0)
+
+	firstDay := filter.From.UTC().Truncate(24 * time.Hour)
+
+	for day := firstDay; !day.After(filter.To); day = day.Add(24 * time.Hour) {
+		dayDir := path.Join(auditStorageRoot, day.Format(auditDayLayout))
+
+		files, err := al.driver.List(ctx, dayDir)
+		if err != nil {
+			if errors.As(err, &storagedriver.PathNotFoundError{}) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, file := range files {
+			content, err := al.driver.GetContent(ctx, file)
+			if err != nil {
+				if errors.As(err, &storagedriver.PathNotFoundError{}) {
+					continue
+				}
+				return nil, err
+			}
+
+			scanner := bufio.NewScanner(bytes.NewReader(content))
+			scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+			for scanner.Scan() {
+				entry := new(auditEntry)
+				if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+					al.logger.Warnf("audit log: skipping corrupted entry in %s: %s", file, err)
+					continue
+				}
+				if filter.match(entry) {
+					entries = append(entries, entry)
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, fmt.Errorf("while reading %s: %w", file, err)
+			}
+		}
+	}
+
+	al.pendingMutex.Lock()
+	for _, entry := range al.pending {
+		if filter.match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	al.pendingMutex.Unlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	if len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	al := newAuditLog(inmemory.New(), "node1", nil, logrus.NewEntry(logrus.New()))
+
+	al.record(&auditEntry{
+		Time:       now.Add(-48 * time.Hour),
+		User:       "alice",
+		Operation:  auditOperationPutManifest,
+		Repository: "artifacts/static/repo1/file1",
+		Result:     auditResultSuccess,
+	})
+	al.record(&auditEntry{
+		Time:       now.Add(-time.Hour),
+		User:       "bob",
+		Operation:  "DELETE /api/v1/repository",
+		Plugin:     "yum",
+		Repository: "artifacts/yum/repo1",
+		Result:     auditResultSuccess,
+	})
+
+	// not yet stored entries are returned too
+	entries, err := al.query(ctx, auditFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "node1", entries[0].Node)
+
+	require.NoError(t, al.flush(ctx))
+
+	entry := &auditEntry{
+		User:       "alice",
+		Operation:  auditOperationDeleteManifest,
+		Repository: "artifacts/yum/repo1/pkg1",
+	}
+	entry.setResult(errors.New("manifest unknown"))
+	al.record(entry)
+
+	entries, err = al.query(ctx, auditFilter{From: now.Add(-72 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, "alice", entries[0].User)
+	require.Equal(t, "bob", entries[1].User)
+	require.Equal(t, auditResultFailure, entries[2].Result)
+
+	entries, err = al.query(ctx, auditFilter{User: "alice", From: now.Add(-72 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	entries, err = al.query(ctx, auditFilter{Repository: "artifacts/yum/repo1"})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	entries, err = al.query(ctx, auditFilter{Repository: "artifacts/yum/repo"})
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	entries, err = al.query(ctx, auditFilter{From: now.Add(-72 * time.Hour), Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, auditOperationDeleteManifest, entries[0].Operation)
+}
+
+func TestClientIP(t *testing.T) {
+	trustedProxies, err := parseTrustedProxies([]string{"10.0.0.0/24", "172.16.0.1"})
+	require.NoError(t, err)
+
+	_, err = parseTrustedProxies([]string{"10.0.0.0/33"})
+	require.Error(t, err)
+
+	al := newAuditLog(inmemory.New(), "node1", trustedProxies, logrus.NewEntry(logrus.New()))
+
+	req := httptest.NewRequest(http.MethodGet, "/artifacts/yum/api/v1/repository/sync:status", nil)
+
+	req.RemoteAddr = "10.0.0.1:1234"
+	require.Equal(t, "10.0.0.1", al.clientIP(req))
+
+	// the proxy headers are honored from trusted proxies only
+	req.Header.Set("X-Forwarded-For", "192.168.0.1, 172.16.0.1")
+	require.Equal(t, "192.168.0.1", al.clientIP(req))
+
+	req.RemoteAddr = "10.0.1.1:1234"
+	require.Equal(t, "10.0.1.1", al.clientIP(req))
+
+	// addresses prepended by the client are ignored
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 192.168.0.1, 172.16.0.1")
+	require.Equal(t, "192.168.0.1", al.clientIP(req))
+
+	req.Header.Del("X-Forwarded-For")
+	req.Header.Set("X-Real-Ip", "192.168.0.2")
+	require.Equal(t, "192.168.0.2", al.clientIP(req))
+
+	// no trusted proxy configured
+	req.Header.Set("X-Forwarded-For", "192.168.0.1")
+	require.Equal(t, "10.0.0.1", newAuditLog(inmemory.New(), "node1", nil, logrus.NewEntry(logrus.New())).clientIP(req))
+}
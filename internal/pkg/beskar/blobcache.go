@@ -0,0 +1,320 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"go.ciq.dev/beskar/internal/pkg/cache"
+	"go.ciq.dev/beskar/internal/pkg/config"
+	"go.ciq.dev/beskar/internal/pkg/diskcache"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// blobCachePath is the cache server path serving the blobs
+	// owned by the instance to the other beskar instances.
+	blobCachePath = "/_blobcache/"
+
+	// blobCachePeerTimeout is the time a peer has to fetch a
+	// blob missing from its cache before returning it.
+	blobCachePeerTimeout = 2 * time.Minute
+
+	blobCacheResultHit    = "hit"
+	blobCacheResultMiss   = "miss"
+	blobCacheResultPeer   = "peer"
+	blobCacheResultBypass = "bypass"
+)
+
+var blobCachePeerKey int
+
+// blobCacheHeaders are the response headers of blobs served by peers.
+var blobCacheHeaders = []string{
+	"Accept-Ranges",
+	"Cache-Control",
+	"Content-Length",
+	"Content-Range",
+	"Content-Type",
+	"Docker-Content-Digest",
+	"ETag",
+	"Location",
+}
+
+type blobCachePeers struct {
+	cache  *cache.GroupCache
+	client *http.Client
+}
+
+// blobCache serves the blobs from a local disk cache in front of the
+// storage, blobs are spread across the beskar instances with the same
+// consistent hashing than the manifest cache, instances not owning a
+// blob get it from the owner.
+type blobCache struct {
+	disk        *diskcache.Cache
+	maxBlobSize int64
+	registry    distribution.Namespace
+	peers       atomic.Pointer[blobCachePeers]
+	fills       singleflight.Group
+	logger      *logrus.Entry
+}
+
+// newBlobCache returns the blob cache, it returns nil if the cache is disabled.
+func newBlobCache(blobCacheConfig config.BlobCache, logger *logrus.Entry) (*blobCache, error) {
+	if blobCacheConfig.Dir == "" {
+		return nil, nil
+	}
+
+	disk, err := diskcache.New(blobCacheConfig.Dir, cacheSize(blobCacheConfig.Size))
+	if err != nil {
+		return nil, fmt.Errorf("while initializing blob cache: %w", err)
+	}
+
+	bc := &blobCache{
+		disk:        disk,
+		maxBlobSize: cacheSize(blobCacheConfig.MaxBlobSize),
+		logger:      logger.WithField("cache", "blobs"),
+	}
+	blobCacheSize.Set(float64(disk.Stats().Size))
+
+	return bc, nil
+}
+
+// setPeers enables the blob distribution across the cache peers, blobs
+// are served from the local cache until then.
+func (bc *blobCache) setPeers(gc *cache.GroupCache, transport http.RoundTripper) {
+	if bc == nil {
+		return
+	}
+
+	gc.Handle(blobCachePath, bc)
+
+	bc.peers.Store(&blobCachePeers{
+		cache: gc,
+		client: &http.Client{
+			Transport: transport,
+		},
+	})
+}
+
+func (bc *blobCache) stats() *diskcache.Stats {
+	if bc == nil {
+		return nil
+	}
+	stats := bc.disk.Stats()
+	return &stats
+}
+
+// serveBlob serves the blob from the instance owning it, blobs too large
+// for the cache and HEAD requests are served from the storage.
+func (bc *blobCache) serveBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, repository string, blobs distribution.BlobStore, dgst digest.Digest) error {
+	desc, err := blobs.Stat(ctx, dgst)
+	if err != nil {
+		return err
+	}
+
+	if r.Method != http.MethodGet || desc.Size > bc.maxBlobSize {
+		blobCacheRequests.WithLabelValues(blobCacheResultBypass).Inc()
+		return blobs.ServeBlob(ctx, w, r, dgst)
+	}
+
+	_, fromPeer := ctx.Value(&blobCachePeerKey).(*int)
+
+	if peers := bc.peers.Load(); peers != nil && !fromPeer {
+		if peer, self := peers.cache.PickPeer(desc.Digest.String()); !self {
+			served, err := bc.servePeer(ctx, w, r, peers.client, peer, repository, desc)
+			if served {
+				return err
+			}
+			bc.logger.Warnf("blob %s not served by cache peer %s, serving it locally: %s", desc.Digest, peer, err)
+		}
+	}
+
+	return bc.serveLocal(ctx, w, r, blobs, desc)
+}
+
+// serveLocal serves the blob from the local cache, the blob is
+// fetched from the storage first if it's not cached yet.
+func (bc *blobCache) serveLocal(ctx context.Context, w http.ResponseWriter, r *http.Request, blobs distribution.BlobStore, desc distribution.Descriptor) error {
+	result := blobCacheResultHit
+
+	f, err := bc.disk.Open(desc.Digest)
+	if err != nil {
+		result = blobCacheResultMiss
+
+		// concurrent requests wait for the same fill
+		_, err, _ = bc.fills.Do(desc.Digest.String(), func() (any, error) {
+			rc, err := blobs.Open(ctx, desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+
+			err = bc.disk.Put(desc.Digest, rc)
+			blobCacheSize.Set(float64(bc.disk.Stats().Size))
+
+			return nil, err
+		})
+		if err == nil {
+			f, err = bc.disk.Open(desc.Digest)
+		}
+		if err != nil {
+			bc.logger.Errorf("blob %s not cached, serving it from storage: %s", desc.Digest, err)
+			blobCacheRequests.WithLabelValues(blobCacheResultBypass).Inc()
+			return blobs.ServeBlob(ctx, w, r, desc.Digest)
+		}
+	}
+	defer f.Close()
+
+	blobCacheRequests.WithLabelValues(result).Inc()
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, desc.Digest)) // If-None-Match handled by ServeContent
+	w.Header().Set("Cache-Control", "max-age=31536000")
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	if desc.MediaType != "" {
+		w.Header().Set("Content-Type", desc.MediaType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+
+	http.ServeContent(w, r, desc.Digest.String(), time.Time{}, f)
+
+	return nil
+}
+
+// servePeer proxies the request to the peer owning the blob, it returns
+// false if nothing was written and the blob must be served locally.
+func (bc *blobCache) servePeer(ctx context.Context, w http.ResponseWriter, r *http.Request, client *http.Client, peer, repository string, desc distribution.Descriptor) (bool, error) {
+	query := url.Values{
+		"repository": []string{repository},
+		"digest":     []string{desc.Digest.String()},
+		"size":       []string{strconv.FormatInt(desc.Size, 10)},
+		"mediatype":  []string{desc.MediaType},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, blobCachePeerTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+blobCachePath+"?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	for _, header := range []string{"Range", "If-Range", "If-None-Match"} {
+		if value := r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		return false, fmt.Errorf("cache peer has returned status %d", resp.StatusCode)
+	}
+
+	for _, header := range blobCacheHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	blobCacheRequests.WithLabelValues(blobCacheResultPeer).Inc()
+
+	_, err = io.Copy(w, resp.Body)
+
+	return true, err
+}
+
+// ServeHTTP serves the blobs requested by the other beskar instances.
+func (bc *blobCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	} else if bc.registry == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+
+	named, err := reference.WithName(query.Get("repository"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dgst, err := digest.Parse(query.Get("digest"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	size, err := strconv.ParseInt(query.Get("size"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the requesting instance has already checked the blob is
+	// linked to the repository, don't send the request back
+	ctx := context.WithValue(r.Context(), &blobCachePeerKey, &blobCachePeerKey)
+
+	repository, err := bc.registry.Repository(ctx, named)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	blobs := repository.Blobs(ctx)
+	if bcs, ok := blobs.(*blobCacheStore); ok {
+		blobs = bcs.BlobStore
+	}
+
+	err = bc.serveLocal(ctx, w, r, blobs, distribution.Descriptor{
+		MediaType: query.Get("mediatype"),
+		Digest:    dgst,
+		Size:      size,
+	})
+	if errors.Is(err, distribution.ErrBlobUnknown) {
+		w.WriteHeader(http.StatusNotFound)
+	} else if err != nil {
+		bc.logger.Errorf("blob %s not served to cache peer: %s", dgst, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// blobCacheStore serves the repository blobs through the blob cache.
+type blobCacheStore struct {
+	distribution.BlobStore
+	repository string
+	cache      *blobCache
+}
+
+// ServeBlob serves the blob from the blob cache.
+func (bs *blobCacheStore) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
+	return bs.cache.serveBlob(ctx, w, r, bs.repository, bs.BlobStore, dgst)
+}
+
+// Delete removes the blob from the local cache as well, the blob may
+// remain cached by the instance owning it until it's evicted but it's
+// not served for repositories not linking it anymore.
+func (bs *blobCacheStore) Delete(ctx context.Context, dgst digest.Digest) error {
+	if err := bs.BlobStore.Delete(ctx, dgst); err != nil {
+		return err
+	}
+	return bs.cache.disk.Delete(dgst)
+}
@@ -0,0 +1,235 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/hashicorp/memberlist"
+	"go.ciq.dev/beskar/internal/pkg/gossip"
+	"go.ciq.dev/beskar/internal/pkg/router"
+)
+
+var errPluginNotFound = errors.New("plugin not found")
+
+// clusterMember describes a gossip member as seen by this beskar instance.
+type clusterMember struct {
+	Name         string `json:"name"`
+	Address      string `json:"address"`
+	State        string `json:"state"`
+	Type         string `json:"type"`
+	Hostname     string `json:"hostname,omitempty"`
+	Ready        bool   `json:"ready"`
+	ServicePort  uint16 `json:"servicePort,omitempty"`
+	RegistryPort uint16 `json:"registryPort,omitempty"`
+	Local        bool   `json:"local"`
+}
+
+// pluginNode describes a registered plugin node.
+type pluginNode struct {
+	Hostname string `json:"hostname"`
+	Hostport string `json:"hostport"`
+	NodeName string `json:"nodeName"`
+	Ejected  bool   `json:"ejected"`
+}
+
+// pluginDescription describes a registered plugin.
+type pluginDescription struct {
+	Name       string        `json:"name"`
+	Version    string        `json:"version"`
+	MediaTypes []string      `json:"mediaTypes"`
+	Nodes      []*pluginNode `json:"nodes"`
+}
+
+// repositoryRoute reports the plugin node handling a repository.
+type repositoryRoute struct {
+	Plugin     string `json:"plugin"`
+	Repository string `json:"repository"`
+	Hostname   string `json:"hostname"`
+	Hostport   string `json:"hostport"`
+}
+
+// cachePeer describes a groupcache peer.
+type cachePeer struct {
+	URL      string `json:"url"`
+	NodeName string `json:"nodeName,omitempty"`
+	Local    bool   `json:"local"`
+}
+
+func memberState(state memberlist.NodeStateType) string {
+	switch state {
+	case memberlist.StateAlive:
+		return "alive"
+	case memberlist.StateSuspect:
+		return "suspect"
+	case memberlist.StateDead:
+		return "dead"
+	case memberlist.StateLeft:
+		return "left"
+	default:
+		return "unknown"
+	}
+}
+
+func instanceType(t gossip.InstanceType) string {
+	switch t {
+	case gossip.BeskarInstance:
+		return "beskar"
+	case gossip.PluginInstance:
+		return "plugin"
+	default:
+		return "unknown"
+	}
+}
+
+// clusterMembers returns the gossip members sorted by type and hostname.
+func (br *Registry) clusterMembers() []*clusterMember {
+	members := make([]*clusterMember, 0)
+
+	if br.member == nil {
+		return members
+	}
+
+	self := br.member.LocalNode()
+
+	for _, node := range br.member.Nodes() {
+		member := &clusterMember{
+			Name:    node.Name,
+			Address: node.Address(),
+			State:   memberState(node.State),
+			Type:    instanceType(0),
+			Local:   node.Name == self.Name,
+		}
+
+		meta := gossip.NewBeskarMeta()
+		if err := meta.Decode(node.Meta); err == nil {
+			member.Type = instanceType(meta.InstanceType)
+			member.Hostname = meta.Hostname
+			member.Ready = meta.Ready
+			member.ServicePort = meta.ServicePort
+			member.RegistryPort = meta.RegistryPort
+		}
+
+		members = append(members, member)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Type != members[j].Type {
+			return members[i].Type < members[j].Type
+		}
+		return members[i].Hostname < members[j].Hostname
+	})
+
+	return members
+}
+
+// cachePeers returns the groupcache peers sorted by URL.
+func (br *Registry) cachePeers() []*cachePeer {
+	peers := make([]*cachePeer, 0)
+
+	for url, nodeName := range br.manifestCache.Peers() {
+		peers = append(peers, &cachePeer{
+			URL:      url,
+			NodeName: nodeName,
+			Local:    nodeName == "",
+		})
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].URL < peers[j].URL
+	})
+
+	return peers
+}
+
+// describe returns the registered plugins sorted by name.
+func (pm *pluginManager) describe() []*pluginDescription {
+	pm.pluginsMutex.RLock()
+	defer pm.pluginsMutex.RUnlock()
+
+	plugins := make([]*pluginDescription, 0, len(pm.plugins))
+
+	for name, pl := range pm.plugins {
+		desc := &pluginDescription{
+			Name:       name,
+			Version:    pl.version,
+			MediaTypes: make([]string, 0, len(pl.mediaTypes)),
+			Nodes:      make([]*pluginNode, 0),
+		}
+		for mediaType := range pl.mediaTypes {
+			desc.MediaTypes = append(desc.MediaTypes, mediaType)
+		}
+		sort.Strings(desc.MediaTypes)
+
+		for hostport, info := range pm.nodesInfo {
+			if info.pluginName != name {
+				continue
+			}
+			desc.Nodes = append(desc.Nodes, &pluginNode{
+				Hostname: info.hostname,
+				Hostport: hostport,
+				NodeName: info.nodeName,
+				Ejected:  pm.health.isEjected(hostport),
+			})
+		}
+		sort.Slice(desc.Nodes, func(i, j int) bool {
+			return desc.Nodes[i].Hostname < desc.Nodes[j].Hostname
+		})
+
+		plugins = append(plugins, desc)
+	}
+
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+
+	return plugins
+}
+
+// route returns the plugin node the repository hashes to, the plugin
+// is determined from the repository name (eg: artifacts/yum/rocky-9).
+// Ejected nodes are not taken into account.
+func (pm *pluginManager) route(repository string) (*repositoryRoute, error) {
+	matches := artifactsMatch.FindStringSubmatch(repository)
+	if len(matches) < 2 {
+		return nil, fmt.Errorf("%s is not a plugin repository", repository)
+	}
+	pluginName := matches[1]
+
+	pl, ok := pm.getPluginByName(pluginName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errPluginNotFound, pluginName)
+	}
+
+	node := pl.nodeHash.Get(repository)
+	if node == nil {
+		return nil, fmt.Errorf("no node available for plugin %s", pluginName)
+	}
+
+	return &repositoryRoute{
+		Plugin:     pluginName,
+		Repository: repository,
+		Hostname:   node.Hostname(),
+		Hostport:   node.Hostport(),
+	}, nil
+}
+
+// explainRoute evaluates the plugin router decision for the request
+// against the registry and explains it.
+func (pm *pluginManager) explainRoute(pluginName string, req *http.Request) (*router.Explanation, error) {
+	pl, ok := pm.getPluginByName(pluginName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errPluginNotFound, pluginName)
+	}
+
+	rr := pl.router.Load()
+	if rr == nil {
+		return nil, fmt.Errorf("plugin %s has no router", pluginName)
+	}
+
+	return rr.Explain(req, pm.registry), nil
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/pkg/rv"
+)
+
+func TestPluginManagerDescribe(t *testing.T) {
+	pm := newPluginManager(nil, logrus.NewEntry(logrus.New()))
+
+	pl := &plugin{
+		name:    "yum",
+		version: "v0.1.0",
+		mediaTypes: map[string]struct{}{
+			"application/vnd.ciq.rpm.package.v1.config+json": {},
+		},
+		nodeHash: rv.NewNodeHash(nil),
+	}
+	pm.plugins[pl.name] = pl
+
+	pm.nodesInfo["10.0.0.1:5200"] = nodeInfo{pluginName: "yum", nodeName: "node1", hostname: "host1"}
+	pm.health.add("yum", "host1", "10.0.0.1:5200")
+	pl.nodeHash.Add("host1", "10.0.0.1:5200")
+
+	plugins := pm.describe()
+	require.Len(t, plugins, 1)
+	require.Equal(t, "yum", plugins[0].Name)
+	require.Equal(t, "v0.1.0", plugins[0].Version)
+	require.Equal(t, []string{"application/vnd.ciq.rpm.package.v1.config+json"}, plugins[0].MediaTypes)
+	require.Len(t, plugins[0].Nodes, 1)
+	require.Equal(t, "10.0.0.1:5200", plugins[0].Nodes[0].Hostport)
+	require.False(t, plugins[0].Nodes[0].Ejected)
+
+	route, err := pm.route("artifacts/yum/rocky-9")
+	require.NoError(t, err)
+	require.Equal(t, "yum", route.Plugin)
+	require.Equal(t, "host1", route.Hostname)
+
+	_, err = pm.route("artifacts/static/files")
+	require.ErrorIs(t, err, errPluginNotFound)
+
+	_, err = pm.route("library/alpine")
+	require.Error(t, err)
+}
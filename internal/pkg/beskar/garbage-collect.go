@@ -5,11 +5,21 @@ package beskar
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/registry/storage"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/distribution/v3/registry/storage/driver/factory"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
 	"go.ciq.dev/beskar/internal/pkg/config"
+	"go.ciq.dev/beskar/internal/pkg/repository"
 )
 
 func RunGC(ctx context.Context, beskarConfig *config.BeskarConfig, dryRun, removeUntagged bool) error {
@@ -35,3 +45,523 @@ func RunGC(ctx context.Context, beskarConfig *config.BeskarConfig, dryRun, remov
 
 	return nil
 }
+
+const (
+	registryStorageRoot = "/docker/registry/v2"
+
+	// DefaultGCGracePeriod is the default minimum age of tags, manifests
+	// and blobs considered by the online garbage collection, it protects
+	// artifacts being pushed while the garbage collection runs.
+	DefaultGCGracePeriod = time.Hour
+)
+
+var errGCRunning = errors.New("garbage collection already running")
+
+type gcOptions struct {
+	dryRun      bool
+	gracePeriod time.Duration
+}
+
+type gcManifest struct {
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest"`
+}
+
+// gcReport reports the result of an online garbage collection, in dry-run
+// mode it reports what would have been removed and the reclaimable bytes.
+type gcReport struct {
+	DryRun              bool          `json:"dryRun"`
+	Running             bool          `json:"running"`
+	GracePeriod         string        `json:"gracePeriod"`
+	StartTime           time.Time     `json:"startTime"`
+	EndTime             *time.Time    `json:"endTime,omitempty"`
+	Error               string        `json:"error,omitempty"`
+	SkippedRepositories []string      `json:"skippedRepositories"`
+	UntaggedManifests   []*gcManifest `json:"untaggedManifests"`
+	DeletedManifests    []*gcManifest `json:"deletedManifests"`
+	MarkedBlobs         int           `json:"markedBlobs"`
+	SweptBlobs          int           `json:"sweptBlobs"`
+	ReclaimableBytes    int64         `json:"reclaimableBytes"`
+}
+
+func tagLinkPath(repository, tag string) string {
+	return path.Join(registryStorageRoot, "repositories", repository, "_manifests/tags", tag, "current/link")
+}
+
+func manifestRevisionLinkPath(repository string, dgst digest.Digest) string {
+	return path.Join(registryStorageRoot, "repositories", repository, "_manifests/revisions", dgst.Algorithm().String(), dgst.Hex(), "link")
+}
+
+func blobDataPath(dgst digest.Digest) string {
+	return path.Join(registryStorageRoot, "blobs", dgst.Algorithm().String(), dgst.Hex()[:2], dgst.Hex(), "data")
+}
+
+// startGC starts an online garbage collection in background, the
+// report is available with gcStatus.
+func (br *Registry) startGC(ctx context.Context, opts gcOptions) (*gcReport, error) {
+	if !br.gcMutex.TryLock() {
+		return nil, errGCRunning
+	}
+
+	report := &gcReport{
+		DryRun:      opts.dryRun,
+		Running:     true,
+		GracePeriod: opts.gracePeriod.String(),
+		StartTime:   time.Now().UTC(),
+	}
+	br.gcReport.Store(report)
+
+	go func() {
+		defer br.gcMutex.Unlock()
+
+		final := &gcReport{
+			DryRun:      report.DryRun,
+			GracePeriod: report.GracePeriod,
+			StartTime:   report.StartTime,
+		}
+
+		if err := br.runOnlineGC(ctx, opts, final); err != nil {
+			br.logger.Errorf("online garbage collection failed: %s", err)
+			final.Error = err.Error()
+		}
+
+		endTime := time.Now().UTC()
+		final.EndTime = &endTime
+
+		br.logger.Infof(
+			"online garbage collection done (dry-run: %t): %d manifests untagged, %d manifests deleted, %d blobs swept, %d bytes reclaimable",
+			final.DryRun, len(final.UntaggedManifests), len(final.DeletedManifests), final.SweptBlobs, final.ReclaimableBytes,
+		)
+
+		br.gcReport.Store(final)
+	}()
+
+	return report, nil
+}
+
+// gcStatus returns the report of the running or last garbage collection.
+func (br *Registry) gcStatus() *gcReport {
+	return br.gcReport.Load()
+}
+
+// runOnlineGC performs a plugin aware mark and sweep while the registry is serving requests:
+//   - tags of plugin repositories not referenced anymore by the plugin are untagged
+//   - untagged manifests of plugin repositories are deleted
+//   - blobs not referenced by any manifest are deleted
+//
+// Tags, manifests and blobs younger than the grace period are never removed to not
+// interfere with concurrent pushes. Once the unmarked blobs are enumerated, the links
+// created since the grace period before the mark phase are walked in all repositories
+// to also mark old blobs referenced again by repositories created or already marked
+// during the garbage collection. Repositories of plugins not reporting their references are only marked.
+func (br *Registry) runOnlineGC(ctx context.Context, opts gcOptions, report *gcReport) error {
+	markStart := time.Now()
+
+	registry, err := storage.NewRegistry(ctx, br.driver)
+	if err != nil {
+		return fmt.Errorf("failed to construct registry: %w", err)
+	}
+
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	var repositories []string
+
+	err = repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		repositories = append(repositories, repoName)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enumerate repositories: %w", err)
+	}
+
+	pendingRepositories, err := br.gcPendingRepositories(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list outbox events: %w", err)
+	}
+
+	references := br.gcReferences(ctx, repositories, pendingRepositories, report)
+
+	markSet := make(map[digest.Digest]struct{})
+	vacuum := storage.NewVacuum(ctx, br.driver)
+
+	for _, repoName := range repositories {
+		if err := br.gcRepository(ctx, registry, vacuum, repoName, references[repoName], opts, markSet, report); err != nil {
+			return err
+		}
+	}
+
+	var candidates []digest.Digest
+
+	err = registry.Blobs().Enumerate(ctx, func(dgst digest.Digest) error {
+		if _, ok := markSet[dgst]; !ok {
+			candidates = append(candidates, dgst)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enumerate blobs: %w", err)
+	}
+
+	// pushes may have linked blobs to any repository since the
+	// mark phase started, those blobs are marked before sweeping
+	if err := br.gcMarkRecentLinks(ctx, registry, markStart.Add(-opts.gracePeriod), markSet); err != nil {
+		return fmt.Errorf("failed to mark recently linked blobs: %w", err)
+	}
+
+	report.MarkedBlobs = len(markSet)
+
+	for _, dgst := range candidates {
+		if _, ok := markSet[dgst]; ok {
+			continue
+		}
+
+		fi, err := br.driver.Stat(ctx, blobDataPath(dgst))
+		if err != nil {
+			if errors.As(err, &storagedriver.PathNotFoundError{}) {
+				continue
+			}
+			return fmt.Errorf("failed to sweep blobs: %w", err)
+		} else if time.Since(fi.ModTime()) < opts.gracePeriod {
+			continue
+		}
+
+		report.SweptBlobs++
+		report.ReclaimableBytes += fi.Size()
+
+		if opts.dryRun {
+			continue
+		}
+
+		br.logger.Debugf("garbage collection: deleting blob %s", dgst)
+
+		if err := vacuum.RemoveBlob(dgst.String()); err != nil {
+			return fmt.Errorf("failed to sweep blobs: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// gcPendingRepositories returns the plugin repositories with events pending
+// in the outbox of any beskar node.
+func (br *Registry) gcPendingRepositories(ctx context.Context) (map[string]struct{}, error) {
+	entries, err := br.outbox.list(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	pendingRepositories := make(map[string]struct{})
+	for _, entry := range entries {
+		pendingRepositories[entry.pluginRepository()] = struct{}{}
+	}
+
+	return pendingRepositories, nil
+}
+
+// gcReferences returns the references reported by plugins indexed by the
+// registry repositories they manage. Plugin repositories with events not
+// processed yet, either pending in the outbox or queued by the plugin, are
+// skipped as their references don't include the artifacts of those events.
+func (br *Registry) gcReferences(ctx context.Context, repositories []string, pendingRepositories map[string]struct{}, report *gcReport) map[string]*repository.References {
+	pluginRepositories := make(map[string]struct{})
+
+	for _, repoName := range repositories {
+		matches := artifactsMatch.FindStringSubmatch(repoName)
+		if len(matches) < 2 {
+			continue
+		}
+		pluginRepositories[path.Dir(repoName)] = struct{}{}
+	}
+
+	references := make(map[string]*repository.References)
+
+	for pluginRepository := range pluginRepositories {
+		matches := artifactsMatch.FindStringSubmatch(pluginRepository)
+		if len(matches) < 2 {
+			continue
+		}
+
+		if _, ok := pendingRepositories[pluginRepository]; ok {
+			br.logger.Infof("garbage collection: skipping repository %s: events pending in outbox", pluginRepository)
+			report.SkippedRepositories = append(report.SkippedRepositories, pluginRepository)
+			continue
+		}
+
+		pl, ok := br.pluginManager.getPluginByName(matches[1])
+		if !ok {
+			report.SkippedRepositories = append(report.SkippedRepositories, pluginRepository)
+			continue
+		}
+
+		refs, err := pl.references(ctx, pluginRepository)
+		if err != nil {
+			if errors.Is(err, errReferencesPendingEvents) {
+				br.logger.Infof("garbage collection: skipping repository %s: %s", pluginRepository, err)
+				report.SkippedRepositories = append(report.SkippedRepositories, pluginRepository)
+			} else if !errors.Is(err, errReferencesNotSupported) {
+				br.logger.Warnf("garbage collection: skipping repository %s: %s", pluginRepository, err)
+				report.SkippedRepositories = append(report.SkippedRepositories, pluginRepository)
+			}
+			continue
+		}
+
+		for _, repoName := range refs.Repositories {
+			references[repoName] = refs
+		}
+	}
+
+	sort.Strings(report.SkippedRepositories)
+
+	return references
+}
+
+// gcMarkRecentLinks walks all repositories and marks the blobs and manifests linked
+// since the given time as well as the blobs referenced by those manifests.
+func (br *Registry) gcMarkRecentLinks(ctx context.Context, registry distribution.Namespace, since time.Time, markSet map[digest.Digest]struct{}) error {
+	repositoriesRoot := path.Join(registryStorageRoot, "repositories")
+
+	err := br.driver.Walk(ctx, repositoriesRoot, func(fi storagedriver.FileInfo) error {
+		if fi.IsDir() {
+			if path.Base(fi.Path()) == "_uploads" || strings.HasSuffix(fi.Path(), "/_manifests/tags") {
+				return storagedriver.ErrSkipDir
+			}
+			return nil
+		} else if path.Base(fi.Path()) != "link" || fi.ModTime().Before(since) {
+			return nil
+		}
+
+		// <repository>/_layers/<algorithm>/<hex>/link
+		// <repository>/_manifests/revisions/<algorithm>/<hex>/link
+		linkPath := strings.TrimPrefix(fi.Path(), repositoriesRoot+"/")
+
+		repoName, linked, isLayer := strings.Cut(linkPath, "/_layers/")
+		if !isLayer {
+			var isManifest bool
+			repoName, linked, isManifest = strings.Cut(linkPath, "/_manifests/revisions/")
+			if !isManifest {
+				return nil
+			}
+		}
+
+		algorithm, encoded, _ := strings.Cut(path.Dir(linked), "/")
+		dgst := digest.NewDigestFromEncoded(digest.Algorithm(algorithm), encoded)
+		if err := dgst.Validate(); err != nil {
+			return nil
+		}
+
+		markSet[dgst] = struct{}{}
+
+		if isLayer {
+			return nil
+		}
+
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repository name %s: %w", repoName, err)
+		}
+		repo, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository %s: %w", repoName, err)
+		}
+		manifestService, err := repo.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service: %w", err)
+		}
+
+		manifest, err := manifestService.Get(ctx, dgst)
+		if err != nil {
+			if errors.As(err, &distribution.ErrManifestUnknownRevision{}) {
+				return nil
+			}
+			return fmt.Errorf("failed to retrieve manifest %s@%s: %w", repoName, dgst, err)
+		}
+		for _, descriptor := range manifest.References() {
+			markSet[descriptor.Digest] = struct{}{}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.As(err, &storagedriver.PathNotFoundError{}) {
+		return err
+	}
+
+	return nil
+}
+
+func (br *Registry) olderThan(ctx context.Context, storagePath string, gracePeriod time.Duration) (bool, error) {
+	fi, err := br.driver.Stat(ctx, storagePath)
+	if err != nil {
+		if errors.As(err, &storagedriver.PathNotFoundError{}) {
+			return false, nil
+		}
+		return false, err
+	}
+	return time.Since(fi.ModTime()) >= gracePeriod, nil
+}
+
+// gcRepository untags orphaned tags and deletes untagged manifests of plugin managed
+// repositories, it marks the blobs referenced by the remaining manifests.
+func (br *Registry) gcRepository(
+	ctx context.Context,
+	registry distribution.Namespace,
+	vacuum storage.Vacuum,
+	repoName string,
+	references *repository.References,
+	opts gcOptions,
+	markSet map[digest.Digest]struct{},
+	report *gcReport,
+) error {
+	named, err := reference.WithName(repoName)
+	if err != nil {
+		return fmt.Errorf("failed to parse repository name %s: %w", repoName, err)
+	}
+	repo, err := registry.Repository(ctx, named)
+	if err != nil {
+		return fmt.Errorf("failed to construct repository %s: %w", repoName, err)
+	}
+
+	tagService := repo.Tags(ctx)
+
+	allTags, err := tagService.All(ctx)
+	if err != nil && !errors.As(err, &distribution.ErrRepositoryUnknown{}) {
+		return fmt.Errorf("failed to retrieve tags of %s: %w", repoName, err)
+	}
+
+	referencedTags := make(map[string]struct{})
+	referencedDigests := make(map[digest.Digest]struct{})
+	if references != nil {
+		for _, tag := range references.Tags[repoName] {
+			referencedTags[tag] = struct{}{}
+		}
+		for _, dgst := range references.Digests[repoName] {
+			referencedDigests[digest.Digest(dgst)] = struct{}{}
+		}
+	}
+
+	taggedDigests := make(map[digest.Digest]struct{})
+	remainingTags := make([]string, 0, len(allTags))
+
+	for _, tag := range allTags {
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			if errors.As(err, &distribution.ErrTagUnknown{}) {
+				continue
+			}
+			return fmt.Errorf("failed to retrieve tag %s of %s: %w", tag, repoName, err)
+		}
+
+		orphaned := false
+
+		if references != nil {
+			_, tagReferenced := referencedTags[tag]
+			_, digestReferenced := referencedDigests[desc.Digest]
+
+			if !tagReferenced && !digestReferenced {
+				orphaned, err = br.olderThan(ctx, tagLinkPath(repoName, tag), opts.gracePeriod)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if !orphaned {
+			taggedDigests[desc.Digest] = struct{}{}
+			remainingTags = append(remainingTags, tag)
+			continue
+		}
+
+		report.UntaggedManifests = append(report.UntaggedManifests, &gcManifest{
+			Repository: repoName,
+			Tag:        tag,
+			Digest:     desc.Digest.String(),
+		})
+
+		if opts.dryRun {
+			continue
+		}
+
+		br.logger.Debugf("garbage collection: untagging %s:%s", repoName, tag)
+
+		if err := tagService.Untag(ctx, tag); err != nil {
+			return fmt.Errorf("failed to untag %s:%s: %w", repoName, tag, err)
+		}
+	}
+
+	manifestService, err := repo.Manifests(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to construct manifest service: %w", err)
+	}
+
+	manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+	}
+
+	err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+		if _, tagged := taggedDigests[dgst]; !tagged && references != nil {
+			if _, referenced := referencedDigests[dgst]; !referenced {
+				old, err := br.olderThan(ctx, manifestRevisionLinkPath(repoName, dgst), opts.gracePeriod)
+				if err != nil {
+					return err
+				} else if old {
+					return br.gcDeleteManifest(ctx, vacuum, repoName, dgst, remainingTags, opts, report)
+				}
+			}
+		}
+
+		markSet[dgst] = struct{}{}
+
+		manifest, err := manifestService.Get(ctx, dgst)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve manifest %s@%s: %w", repoName, dgst, err)
+		}
+		for _, descriptor := range manifest.References() {
+			markSet[descriptor.Digest] = struct{}{}
+		}
+
+		return nil
+	})
+	// the manifests directory may not exist for repositories with unfinished uploads only
+	if err != nil && !errors.As(err, &storagedriver.PathNotFoundError{}) {
+		return fmt.Errorf("failed to mark %s manifests: %w", repoName, err)
+	}
+
+	return nil
+}
+
+func (br *Registry) gcDeleteManifest(
+	ctx context.Context,
+	vacuum storage.Vacuum,
+	repoName string,
+	dgst digest.Digest,
+	tags []string,
+	opts gcOptions,
+	report *gcReport,
+) error {
+	report.DeletedManifests = append(report.DeletedManifests, &gcManifest{
+		Repository: repoName,
+		Digest:     dgst.String(),
+	})
+
+	if opts.dryRun {
+		return nil
+	}
+
+	br.logger.Debugf("garbage collection: deleting manifest %s@%s", repoName, dgst)
+
+	if err := vacuum.RemoveManifest(repoName, dgst, tags); err != nil {
+		return fmt.Errorf("failed to delete manifest %s@%s: %w", repoName, dgst, err)
+	}
+
+	if group := br.manifestGroup.load(); group != nil {
+		if err := group.Remove(ctx, fmt.Sprintf("%s@%s", repoName, dgst)); err != nil {
+			br.logger.Warnf("garbage collection: failed to remove manifest %s@%s from cache: %s", repoName, dgst, err)
+		}
+	}
+
+	return nil
+}
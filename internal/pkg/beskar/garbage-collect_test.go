@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/testutil"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/pkg/repository"
+	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
+	"go.ciq.dev/beskar/pkg/rv"
+)
+
+func TestGCRepository(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+
+	registry, err := storage.NewRegistry(ctx, driver)
+	require.NoError(t, err)
+
+	named, err := reference.WithName("artifacts/static/repo/files")
+	require.NoError(t, err)
+
+	repo, err := registry.Repository(ctx, named)
+	require.NoError(t, err)
+
+	manifestService, err := repo.Manifests(ctx)
+	require.NoError(t, err)
+
+	digests := make(map[string]digest.Digest)
+
+	for _, tag := range []string{"keep", "orphan"} {
+		layers, err := testutil.CreateRandomLayers(1)
+		require.NoError(t, err)
+		require.NoError(t, testutil.UploadBlobs(repo, layers))
+
+		layerDigests := make([]digest.Digest, 0, len(layers))
+		for dgst := range layers {
+			layerDigests = append(layerDigests, dgst)
+		}
+
+		manifest, err := testutil.MakeSchema2Manifest(repo, layerDigests)
+		require.NoError(t, err)
+
+		digests[tag], err = manifestService.Put(ctx, manifest)
+		require.NoError(t, err)
+		require.NoError(t, repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: digests[tag]}))
+	}
+
+	br := &Registry{
+		driver: driver,
+		logger: logrus.NewEntry(logrus.New()),
+	}
+
+	references := repository.NewReferences()
+	references.AddRepository(named.Name())
+	references.AddTag(named.Name(), "keep")
+
+	for _, dryRun := range []bool{true, false} {
+		report := new(gcReport)
+		markSet := make(map[digest.Digest]struct{})
+
+		err := br.gcRepository(ctx, registry, storage.NewVacuum(ctx, driver), named.Name(), references, gcOptions{dryRun: dryRun}, markSet, report)
+		require.NoError(t, err)
+
+		require.Len(t, report.UntaggedManifests, 1)
+		require.Equal(t, "orphan", report.UntaggedManifests[0].Tag)
+		require.Len(t, report.DeletedManifests, 1)
+		require.Equal(t, digests["orphan"].String(), report.DeletedManifests[0].Digest)
+
+		require.Contains(t, markSet, digests["keep"])
+		require.NotContains(t, markSet, digests["orphan"])
+	}
+
+	tags, err := repo.Tags(ctx).All(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"keep"}, tags)
+
+	exists, err := manifestService.Exists(ctx, digests["orphan"])
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// repositories without references are only marked
+	report := new(gcReport)
+	markSet := make(map[digest.Digest]struct{})
+
+	err = br.gcRepository(ctx, registry, storage.NewVacuum(ctx, driver), named.Name(), nil, gcOptions{}, markSet, report)
+	require.NoError(t, err)
+	require.Empty(t, report.UntaggedManifests)
+	require.Empty(t, report.DeletedManifests)
+	require.Contains(t, markSet, digests["keep"])
+}
+
+func TestGCMarkRecentLinks(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+
+	registry, err := storage.NewRegistry(ctx, driver)
+	require.NoError(t, err)
+
+	named, err := reference.WithName("artifacts/static/repo/files")
+	require.NoError(t, err)
+
+	repo, err := registry.Repository(ctx, named)
+	require.NoError(t, err)
+
+	manifestService, err := repo.Manifests(ctx)
+	require.NoError(t, err)
+
+	layers, err := testutil.CreateRandomLayers(2)
+	require.NoError(t, err)
+	require.NoError(t, testutil.UploadBlobs(repo, layers))
+
+	layerDigests := make([]digest.Digest, 0, len(layers))
+	for dgst := range layers {
+		layerDigests = append(layerDigests, dgst)
+	}
+
+	// only the first layer is referenced by a manifest
+	manifest, err := testutil.MakeSchema2Manifest(repo, layerDigests[:1])
+	require.NoError(t, err)
+
+	manifestDigest, err := manifestService.Put(ctx, manifest)
+	require.NoError(t, err)
+
+	br := &Registry{
+		driver: driver,
+		logger: logrus.NewEntry(logrus.New()),
+	}
+
+	markSet := make(map[digest.Digest]struct{})
+
+	err = br.gcMarkRecentLinks(ctx, registry, time.Now().Add(time.Hour), markSet)
+	require.NoError(t, err)
+	require.Empty(t, markSet)
+
+	err = br.gcMarkRecentLinks(ctx, registry, time.Now().Add(-time.Hour), markSet)
+	require.NoError(t, err)
+	require.Contains(t, markSet, manifestDigest)
+	require.Contains(t, markSet, layerDigests[0])
+	require.Contains(t, markSet, layerDigests[1])
+}
+
+func TestGCReferences(t *testing.T) {
+	ctx := context.Background()
+	logger := logrus.NewEntry(logrus.New())
+
+	// repo2 events are queued by the plugin, references are reported for the others
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repositoryName := r.URL.Query().Get("repository")
+		if repositoryName == "artifacts/static/repo2" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		references := repository.NewReferences()
+		references.AddRepository(repositoryName + "/files")
+		require.NoError(t, json.NewEncoder(w).Encode(references))
+	}))
+	defer server.Close()
+
+	pl := &plugin{
+		name:       "static",
+		nodeHash:   rv.NewNodeHash(nil),
+		httpClient: server.Client(),
+		logger:     logger,
+	}
+	pl.nodeHash.Add("plugin1", server.Listener.Addr().String())
+
+	br := &Registry{
+		pluginManager: newPluginManager(nil, logger),
+		outbox:        newOutbox(inmemory.New(), "node1", logger),
+		logger:        logger,
+	}
+	br.pluginManager.plugins["static"] = pl
+
+	// repo1 events are pending in the outbox
+	err := br.outbox.add(ctx, "static", &eventv1.EventPayload{
+		Repository: "artifacts/static/repo1/files:file1",
+		Digest:     "sha256:0123",
+		Action:     eventv1.Action_ACTION_PUT,
+	}, errors.New("connection refused"))
+	require.NoError(t, err)
+
+	pendingRepositories, err := br.gcPendingRepositories(ctx)
+	require.NoError(t, err)
+
+	report := new(gcReport)
+	references := br.gcReferences(ctx, []string{
+		"artifacts/static/repo1/files",
+		"artifacts/static/repo2/files",
+		"artifacts/static/repo3/files",
+	}, pendingRepositories, report)
+
+	require.Equal(t, []string{"artifacts/static/repo1", "artifacts/static/repo2"}, report.SkippedRepositories)
+	require.Len(t, references, 1)
+	require.Contains(t, references, "artifacts/static/repo3/files")
+}
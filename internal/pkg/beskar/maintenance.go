@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+	"go.ciq.dev/beskar/internal/pkg/gossip"
+	"go.ciq.dev/beskar/internal/pkg/maintenance"
+)
+
+// maintenanceStatePath is the path of the last maintenance state set with
+// the admin API, it's restored on startup so the cluster stays read-only
+// across restarts.
+const maintenanceStatePath = "/beskar/maintenance.json"
+
+// maintenanceStatus is the maintenance state reported by the admin API.
+type maintenanceStatus struct {
+	maintenance.State
+	Since time.Time `json:"since,omitempty"`
+}
+
+func newMaintenanceStatus(state maintenance.State) *maintenanceStatus {
+	return &maintenanceStatus{
+		State: state,
+		Since: state.Since(),
+	}
+}
+
+// maintenanceError returns the registry error for write operations
+// rejected while in maintenance mode.
+func maintenanceError(state maintenance.State) error {
+	return errcode.ErrorCodeUnavailable.WithMessage(state.Message())
+}
+
+// loadMaintenance restores the persisted maintenance state.
+func (br *Registry) loadMaintenance(ctx context.Context) error {
+	content, err := br.driver.GetContent(ctx, maintenanceStatePath)
+	if err != nil {
+		if errors.As(err, &storagedriver.PathNotFoundError{}) {
+			return nil
+		}
+		return fmt.Errorf("while reading maintenance state: %w", err)
+	}
+
+	state := maintenance.State{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return fmt.Errorf("while decoding maintenance state: %w", err)
+	}
+
+	if br.maintenance.Merge(state) && state.Enabled {
+		br.logger.Warnf("read-only maintenance mode restored: %s", state.Message())
+	}
+
+	return nil
+}
+
+// setMaintenance changes the maintenance state of the cluster, the state is
+// persisted and advertised to the other instances through gossip.
+func (br *Registry) setMaintenance(ctx context.Context, enabled bool, reason string) (maintenance.State, error) {
+	state, err := br.maintenance.Next(enabled, reason)
+	if err != nil {
+		return state, err
+	}
+
+	content, err := json.Marshal(state)
+	if err != nil {
+		return state, err
+	}
+	if err := br.driver.PutContent(ctx, maintenanceStatePath, content); err != nil {
+		return state, fmt.Errorf("while writing maintenance state: %w", err)
+	}
+
+	br.applyMaintenance(state)
+
+	// the node metadata is updated even if the advertisement times out,
+	// other instances get it with the next gossip state synchronization
+	if err := br.advertiseMaintenance(); err != nil {
+		br.logger.Errorf("maintenance state advertisement error: %s", err)
+	}
+
+	return state, nil
+}
+
+// mergeMaintenance merges the maintenance state advertised by another
+// beskar instance and advertises it if it's more recent.
+func (br *Registry) mergeMaintenance(state maintenance.State) {
+	if !br.applyMaintenance(state) {
+		return
+	}
+
+	go func() {
+		if err := br.advertiseMaintenance(); err != nil {
+			br.logger.Errorf("maintenance state advertisement error: %s", err)
+		}
+	}()
+}
+
+func (br *Registry) applyMaintenance(state maintenance.State) bool {
+	if !br.maintenance.Merge(state) {
+		return false
+	}
+
+	if state.Enabled {
+		br.logger.Warnf("read-only maintenance mode enabled: %s", state.Message())
+	} else {
+		br.logger.Info("read-only maintenance mode disabled")
+	}
+
+	return true
+}
+
+// advertiseMaintenance advertises the current maintenance state with the
+// node metadata, instances joining the cluster later get it from there.
+func (br *Registry) advertiseMaintenance() error {
+	if br.member == nil {
+		return nil
+	}
+
+	br.maintenanceMutex.Lock()
+	defer br.maintenanceMutex.Unlock()
+
+	return br.member.SetMaintenance(br.maintenance.Get(), gossip.DefaultReadyTimeout)
+}
+
+// maintenanceBlobStore rejects blob uploads and deletions while in maintenance mode.
+type maintenanceBlobStore struct {
+	distribution.BlobStore
+	maintenance *maintenance.Mode
+}
+
+// Put rejects the blob while in maintenance mode.
+func (bs *maintenanceBlobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
+	if state := bs.maintenance.Get(); state.Enabled {
+		return distribution.Descriptor{}, maintenanceError(state)
+	}
+	return bs.BlobStore.Put(ctx, mediaType, p)
+}
+
+// Create rejects new uploads while in maintenance mode.
+func (bs *maintenanceBlobStore) Create(ctx context.Context, options ...distribution.BlobCreateOption) (distribution.BlobWriter, error) {
+	if state := bs.maintenance.Get(); state.Enabled {
+		return nil, maintenanceError(state)
+	}
+	return bs.BlobStore.Create(ctx, options...)
+}
+
+// Resume rejects uploads in progress while in maintenance mode.
+func (bs *maintenanceBlobStore) Resume(ctx context.Context, id string) (distribution.BlobWriter, error) {
+	if state := bs.maintenance.Get(); state.Enabled {
+		return nil, maintenanceError(state)
+	}
+	return bs.BlobStore.Resume(ctx, id)
+}
+
+// Delete rejects blob deletions while in maintenance mode.
+func (bs *maintenanceBlobStore) Delete(ctx context.Context, dgst digest.Digest) error {
+	if state := bs.maintenance.Get(); state.Enabled {
+		return maintenanceError(state)
+	}
+	return bs.BlobStore.Delete(ctx, dgst)
+}
@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.ciq.dev/beskar/internal/pkg/metrics"
+)
+
+var (
+	routerDecisionDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "router",
+			Name:      "decision_duration_seconds",
+			Help:      "Duration of plugin router decisions.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 12),
+		},
+		[]string{"plugin"},
+	)
+	proxyResponses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "plugin",
+			Name:      "responses_total",
+			Help:      "Total number of responses returned for plugin requests by status code.",
+		},
+		[]string{"plugin", "code"},
+	)
+	eventDeliveries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "plugin",
+			Name:      "event_deliveries_total",
+			Help:      "Total number of events delivered to plugins.",
+		},
+		[]string{"plugin"},
+	)
+	eventDeliveryRetries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "plugin",
+			Name:      "event_delivery_retries_total",
+			Help:      "Total number of event delivery retries.",
+		},
+		[]string{"plugin"},
+	)
+	eventDeliveryFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "plugin",
+			Name:      "event_delivery_failures_total",
+			Help:      "Total number of events which couldn't be delivered to plugins.",
+		},
+		[]string{"plugin"},
+	)
+	pluginEjectedNodes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "plugin",
+			Name:      "ejected_nodes",
+			Help:      "Number of plugin nodes currently ejected for failing health checks or requests.",
+		},
+		[]string{"plugin"},
+	)
+	pluginNodeEjections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "plugin",
+			Name:      "node_ejections_total",
+			Help:      "Total number of plugin node ejections.",
+		},
+		[]string{"plugin"},
+	)
+	outboxPendingEvents = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "outbox",
+			Name:      "pending_events",
+			Help:      "Number of undelivered events pending in the node outbox.",
+		},
+		[]string{"plugin"},
+	)
+	outboxStoredEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "outbox",
+			Name:      "stored_events_total",
+			Help:      "Total number of undelivered events stored in the outbox.",
+		},
+		[]string{"plugin"},
+	)
+	outboxRedeliveredEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "outbox",
+			Name:      "redelivered_events_total",
+			Help:      "Total number of events delivered from the outbox.",
+		},
+		[]string{"plugin"},
+	)
+	outboxDroppedEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "outbox",
+			Name:      "dropped_events_total",
+			Help:      "Total number of outbox events dropped after being rejected by plugins.",
+		},
+		[]string{"plugin"},
+	)
+	proxyRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "proxy",
+			Name:      "requests_total",
+			Help:      "Total number of pull-through cache lookups by upstream, content type and result (hit, miss or stale).",
+		},
+		[]string{"upstream", "type", "result"},
+	)
+	blobCacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "blob_cache",
+			Name:      "requests_total",
+			Help:      "Total number of blob requests by result (hit, miss, peer or bypass).",
+		},
+		[]string{"result"},
+	)
+	blobCacheSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "blob_cache",
+			Name:      "size_bytes",
+			Help:      "Size of the blobs stored in the local disk cache.",
+		},
+	)
+	admissionRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "admission",
+			Name:      "rejections_total",
+			Help:      "Total number of manifest pushes rejected by the admission policy or by plugins.",
+		},
+		[]string{"source"},
+	)
+	admissionPluginErrors = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "admission",
+			Name:      "plugin_errors_total",
+			Help:      "Total number of manifest pushes admitted without plugin check because the plugin couldn't be asked.",
+		},
+	)
+	replicationEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "replication",
+			Name:      "events_total",
+			Help:      "Total number of manifest events replicated by target, action and result.",
+		},
+		[]string{"target", "action", "result"},
+	)
+	replicationPendingEvents = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "replication",
+			Name:      "pending_events",
+			Help:      "Number of manifest events queued for replication.",
+		},
+		[]string{"target"},
+	)
+	replicationLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "replication",
+			Name:      "lag_seconds",
+			Help:      "Time between the last replicated manifest event and its replication.",
+		},
+		[]string{"target"},
+	)
+)
+
+// statusRecorder records the status code written to the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	if sr.statusCode == 0 {
+		sr.statusCode = statusCode
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.statusCode == 0 {
+		sr.statusCode = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Unwrap is used by http.ResponseController to access
+// the underlying response writer.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+func (sr *statusRecorder) code() string {
+	if sr.statusCode == 0 {
+		return strconv.Itoa(http.StatusOK)
+	}
+	return strconv.Itoa(sr.statusCode)
+}
@@ -0,0 +1,621 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// outboxRootPath is the storage driver path where undelivered events
+	// are persisted, events are stored per beskar node and per plugin:
+	// /beskar/outbox/<node>/<plugin>/<id>.json
+	outboxRootPath = "/beskar/outbox"
+
+	// outboxLeasePath is the storage driver path of the node outbox leases,
+	// a node renews the lease of its outbox while running, outboxes with an
+	// expired lease are claimed and drained by another node:
+	// /beskar/outbox-leases/<node>.json
+	outboxLeasePath     = "/beskar/outbox-leases"
+	outboxLeaseDuration = time.Minute
+
+	outboxScanInterval = 10 * time.Second
+	outboxMinBackoff   = 30 * time.Second
+	outboxMaxBackoff   = 30 * time.Minute
+)
+
+var (
+	errOutboxPending       = errors.New("previous events are pending in outbox")
+	errOutboxEntryNotFound = errors.New("outbox entry not found")
+	errOutboxNoPlugin      = errors.New("plugin not registered")
+)
+
+// outboxEntry is an undelivered event persisted in the outbox.
+type outboxEntry struct {
+	ID          string    `json:"id"`
+	Node        string    `json:"node"`
+	Plugin      string    `json:"plugin"`
+	Repository  string    `json:"repository"`
+	Digest      string    `json:"digest"`
+	Action      string    `json:"action"`
+	Created     time.Time `json:"created"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt"`
+	// Event is the protobuf encoded event payload.
+	Event []byte `json:"event,omitempty"`
+}
+
+// outboxLease is the lease of a node outbox held by the node delivering its events.
+type outboxLease struct {
+	Node    string    `json:"node"`
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+func outboxLeaseFile(node string) string {
+	return path.Join(outboxLeasePath, node+".json")
+}
+
+func (e *outboxEntry) path() string {
+	return outboxEntryPath(e.Node, e.Plugin, e.ID)
+}
+
+// pluginRepository returns the plugin repository of the event.
+func (e *outboxEntry) pluginRepository() string {
+	return path.Dir(e.Repository)
+}
+
+func outboxEntryPath(node, plugin, id string) string {
+	return path.Join(outboxRootPath, node, plugin, id+".json")
+}
+
+// outboxBackoff returns the delay before the next delivery attempt.
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxMinBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return delay
+}
+
+// outbox persists events which couldn't be delivered to plugins in the
+// registry storage driver and redelivers them in order per plugin
+// repository once the plugin is reachable again.
+type outbox struct {
+	driver storagedriver.StorageDriver
+	node   string
+	logger *logrus.Entry
+
+	// pending tracks the number of pending entries per plugin and plugin
+	// repository for this node, new events are queued behind pending ones
+	// of the same repository to preserve their delivery order.
+	pendingMutex sync.Mutex
+	pending      map[string]map[string]int
+
+	deliverMutex sync.Mutex
+	wakeCh       chan struct{}
+
+	// leases are the expiration times of the outbox leases held
+	// by this node, only accessed by the redelivery loop.
+	leases map[string]time.Time
+}
+
+func newOutbox(driver storagedriver.StorageDriver, node string, logger *logrus.Entry) *outbox {
+	return &outbox{
+		driver:  driver,
+		node:    node,
+		logger:  logger,
+		pending: make(map[string]map[string]int),
+		wakeCh:  make(chan struct{}, 1),
+		leases:  make(map[string]time.Time),
+	}
+}
+
+// hasPending returns true if events of the plugin repository are pending.
+func (o *outbox) hasPending(plugin, repository string) bool {
+	o.pendingMutex.Lock()
+	defer o.pendingMutex.Unlock()
+
+	return o.pending[plugin][repository] > 0
+}
+
+func (o *outbox) updatePending(plugin, repository string, delta int) {
+	o.pendingMutex.Lock()
+	defer o.pendingMutex.Unlock()
+
+	repositories := o.pending[plugin]
+	if repositories == nil {
+		repositories = make(map[string]int)
+		o.pending[plugin] = repositories
+	}
+
+	if count := repositories[repository] + delta; count > 0 {
+		repositories[repository] = count
+	} else {
+		delete(repositories, repository)
+	}
+
+	o.updatePendingMetricLocked(plugin)
+}
+
+// setPending sets the pending counters of the plugin from its entries.
+func (o *outbox) setPending(plugin string, entries []*outboxEntry) {
+	o.pendingMutex.Lock()
+	defer o.pendingMutex.Unlock()
+
+	repositories := make(map[string]int)
+	for _, entry := range entries {
+		repositories[entry.pluginRepository()]++
+	}
+	o.pending[plugin] = repositories
+
+	o.updatePendingMetricLocked(plugin)
+}
+
+func (o *outbox) updatePendingMetricLocked(plugin string) {
+	count := 0
+	for _, repositoryCount := range o.pending[plugin] {
+		count += repositoryCount
+	}
+	if count == 0 {
+		delete(o.pending, plugin)
+	}
+	outboxPendingEvents.WithLabelValues(plugin).Set(float64(count))
+}
+
+// add persists the event for later delivery to the plugin.
+func (o *outbox) add(ctx context.Context, plugin string, event *eventv1.EventPayload, deliveryErr error) error {
+	data, err := proto.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	entry := &outboxEntry{
+		ID:          fmt.Sprintf("%020d-%s", now.UnixNano(), uuid.NewString()[:8]),
+		Node:        o.node,
+		Plugin:      plugin,
+		Repository:  event.Repository,
+		Digest:      event.Digest,
+		Action:      event.Action.String(),
+		Created:     now,
+		NextAttempt: now,
+		Event:       data,
+	}
+	if deliveryErr != nil {
+		entry.LastError = deliveryErr.Error()
+	}
+
+	if err := o.put(ctx, entry); err != nil {
+		return err
+	}
+
+	o.updatePending(plugin, entry.pluginRepository(), 1)
+	outboxStoredEvents.WithLabelValues(plugin).Inc()
+
+	return nil
+}
+
+func (o *outbox) put(ctx context.Context, entry *outboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := o.driver.PutContent(ctx, entry.path(), data); err != nil {
+		return fmt.Errorf("while storing outbox entry %s: %w", entry.ID, err)
+	}
+	return nil
+}
+
+func (o *outbox) get(ctx context.Context, node, plugin, id string) (*outboxEntry, error) {
+	data, err := o.driver.GetContent(ctx, outboxEntryPath(node, plugin, id))
+	if err != nil {
+		if errors.As(err, &storagedriver.PathNotFoundError{}) {
+			return nil, errOutboxEntryNotFound
+		}
+		return nil, err
+	}
+
+	entry := new(outboxEntry)
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("while decoding outbox entry %s: %w", id, err)
+	}
+
+	return entry, nil
+}
+
+// remove deletes the entry from the outbox.
+func (o *outbox) remove(ctx context.Context, entry *outboxEntry) error {
+	if err := o.driver.Delete(ctx, entry.path()); err != nil {
+		if errors.As(err, &storagedriver.PathNotFoundError{}) {
+			return errOutboxEntryNotFound
+		}
+		return err
+	}
+	if entry.Node == o.node {
+		o.updatePending(entry.Plugin, entry.pluginRepository(), -1)
+	}
+	return nil
+}
+
+// listDir returns the sorted base names of the directory entries or
+// an empty list if the directory doesn't exist.
+func (o *outbox) listDir(ctx context.Context, dir string) ([]string, error) {
+	children, err := o.driver.List(ctx, dir)
+	if err != nil {
+		if errors.As(err, &storagedriver.PathNotFoundError{}) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(children))
+	for _, child := range children {
+		names = append(names, path.Base(child))
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// entries returns the entries stored for the node and plugin ordered
+// by creation time.
+func (o *outbox) entries(ctx context.Context, node, plugin string) ([]*outboxEntry, error) {
+	names, err := o.listDir(ctx, path.Join(outboxRootPath, node, plugin))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*outboxEntry, 0, len(names))
+
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		entry, err := o.get(ctx, node, plugin, strings.TrimSuffix(name, ".json"))
+		if errors.Is(err, errOutboxEntryNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// list returns the entries of all beskar nodes, optionally filtered by plugin.
+func (o *outbox) list(ctx context.Context, plugin string) ([]*outboxEntry, error) {
+	nodes, err := o.listDir(ctx, outboxRootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*outboxEntry
+
+	for _, node := range nodes {
+		plugins, err := o.listDir(ctx, path.Join(outboxRootPath, node))
+		if err != nil {
+			return nil, err
+		}
+		for _, pluginName := range plugins {
+			if plugin != "" && plugin != pluginName {
+				continue
+			}
+			pluginEntries, err := o.entries(ctx, node, pluginName)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, pluginEntries...)
+		}
+	}
+
+	return entries, nil
+}
+
+// load initializes pending counters from the entries stored for this node.
+func (o *outbox) load(ctx context.Context) error {
+	plugins, err := o.listDir(ctx, path.Join(outboxRootPath, o.node))
+	if err != nil {
+		return err
+	}
+
+	for _, plugin := range plugins {
+		entries, err := o.entries(ctx, o.node, plugin)
+		if err != nil {
+			return err
+		} else if len(entries) > 0 {
+			o.setPending(plugin, entries)
+			o.logger.Infof("Found %d undelivered events for plugin %s in outbox", len(entries), plugin)
+		}
+	}
+
+	return nil
+}
+
+func (o *outbox) getLease(ctx context.Context, node string) (*outboxLease, error) {
+	data, err := o.driver.GetContent(ctx, outboxLeaseFile(node))
+	if err != nil {
+		if errors.As(err, &storagedriver.PathNotFoundError{}) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	lease := new(outboxLease)
+	if err := json.Unmarshal(data, lease); err != nil {
+		return nil, fmt.Errorf("while decoding outbox lease of node %s: %w", node, err)
+	}
+
+	return lease, nil
+}
+
+func (o *outbox) putLease(ctx context.Context, lease *outboxLease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	if err := o.driver.PutContent(ctx, outboxLeaseFile(lease.Node), data); err != nil {
+		return fmt.Errorf("while storing outbox lease of node %s: %w", lease.Node, err)
+	}
+	return nil
+}
+
+// claim acquires or renews the lease of the node outbox and reports whether
+// this node delivers its events. A node always owns its outbox, outboxes of
+// other nodes are claimed once their lease expired. An outbox without lease
+// gets one without owner first, so a node which didn't write its lease yet
+// has a lease duration to do so. The storage driver doesn't provide atomic
+// operations, two nodes may both deliver the events of a stale outbox in the
+// rare case of concurrent claims, events are then delivered more than once.
+func (o *outbox) claim(ctx context.Context, node string) (bool, error) {
+	now := time.Now().UTC()
+
+	if expires, ok := o.leases[node]; ok && expires.Sub(now) > outboxLeaseDuration/2 {
+		return true, nil
+	}
+
+	if node != o.node {
+		lease, err := o.getLease(ctx, node)
+		if err != nil {
+			return false, err
+		} else if lease == nil {
+			delete(o.leases, node)
+			return false, o.putLease(ctx, &outboxLease{Node: node, Expires: now.Add(outboxLeaseDuration)})
+		} else if lease.Owner != o.node && lease.Expires.After(now) {
+			delete(o.leases, node)
+			return false, nil
+		}
+	}
+
+	lease := &outboxLease{
+		Node:    node,
+		Owner:   o.node,
+		Expires: now.Add(outboxLeaseDuration),
+	}
+	if err := o.putLease(ctx, lease); err != nil {
+		return false, err
+	}
+
+	if node != o.node {
+		// read the lease back to detect a concurrent claim
+		current, err := o.getLease(ctx, node)
+		if err != nil {
+			return false, err
+		} else if current == nil || current.Owner != o.node {
+			delete(o.leases, node)
+			return false, nil
+		}
+		if _, ok := o.leases[node]; !ok {
+			o.logger.Warnf("Claimed outbox of stale node %s", node)
+		}
+	}
+
+	o.leases[node] = lease.Expires
+
+	return true, nil
+}
+
+// release removes the outbox and the lease of a stale node once drained.
+func (o *outbox) release(ctx context.Context, node string) error {
+	delete(o.leases, node)
+
+	if err := o.driver.Delete(ctx, path.Join(outboxRootPath, node)); err != nil && !errors.As(err, &storagedriver.PathNotFoundError{}) {
+		return err
+	}
+	if err := o.driver.Delete(ctx, outboxLeaseFile(node)); err != nil && !errors.As(err, &storagedriver.PathNotFoundError{}) {
+		return err
+	}
+
+	o.logger.Infof("Drained outbox of stale node %s", node)
+
+	return nil
+}
+
+// wake triggers a redelivery pass.
+func (o *outbox) wake() {
+	select {
+	case o.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// run periodically redelivers events stored for this node and for stale
+// nodes until the context is canceled.
+func (o *outbox) run(ctx context.Context, pm *pluginManager) {
+	if err := o.load(ctx); err != nil {
+		o.logger.Errorf("outbox load error: %s", err)
+	}
+
+	ticker := time.NewTicker(outboxScanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wakeCh:
+		}
+
+		o.redeliver(ctx, pm)
+	}
+}
+
+func (o *outbox) redeliver(ctx context.Context, pm *pluginManager) {
+	nodes, err := o.listDir(ctx, outboxRootPath)
+	if err != nil {
+		o.logger.Errorf("outbox list error: %s", err)
+		return
+	}
+
+	// the lease of this node is renewed even without stored events
+	if !slices.Contains(nodes, o.node) {
+		nodes = append(nodes, o.node)
+	}
+
+	for _, node := range nodes {
+		owned, err := o.claim(ctx, node)
+		if err != nil {
+			o.logger.Errorf("outbox lease error for node %s: %s", node, err)
+			continue
+		} else if !owned {
+			continue
+		}
+
+		remaining := o.redeliverNode(ctx, pm, node)
+
+		if node != o.node && remaining == 0 {
+			if err := o.release(ctx, node); err != nil {
+				o.logger.Errorf("outbox release error for node %s: %s", node, err)
+			}
+		}
+	}
+}
+
+// redeliverNode delivers the events stored for the node, it returns
+// the number of remaining entries or -1 if they couldn't be listed.
+func (o *outbox) redeliverNode(ctx context.Context, pm *pluginManager, node string) int {
+	plugins, err := o.listDir(ctx, path.Join(outboxRootPath, node))
+	if err != nil {
+		o.logger.Errorf("outbox list error for node %s: %s", node, err)
+		return -1
+	}
+
+	remaining := 0
+
+	for _, plugin := range plugins {
+		entries, err := o.entries(ctx, node, plugin)
+		if err != nil {
+			o.logger.Errorf("outbox list error for plugin %s: %s", plugin, err)
+			remaining = -1
+			continue
+		}
+
+		if node == o.node {
+			// entries may have been dropped or replayed from another node
+			o.setPending(plugin, entries)
+		}
+
+		now := time.Now()
+		removed := 0
+
+		// deliver in order and skip the next events of a repository after
+		// its first undelivered event to not reorder events per repository,
+		// events rejected by the plugin are dropped
+		blocked := make(map[string]struct{})
+
+		for _, entry := range entries {
+			repository := entry.pluginRepository()
+			if _, ok := blocked[repository]; ok {
+				continue
+			} else if entry.NextAttempt.After(now) {
+				blocked[repository] = struct{}{}
+				continue
+			} else if err := o.deliver(ctx, pm, entry); err != nil && !isEventRejected(err) {
+				blocked[repository] = struct{}{}
+				continue
+			}
+			removed++
+		}
+
+		if remaining >= 0 {
+			remaining += len(entries) - removed
+		}
+	}
+
+	return remaining
+}
+
+// deliver sends the stored event to the plugin, the entry is removed
+// on success or when the plugin rejects the event, otherwise the next
+// attempt is rescheduled with backoff.
+func (o *outbox) deliver(ctx context.Context, pm *pluginManager, entry *outboxEntry) error {
+	o.deliverMutex.Lock()
+	defer o.deliverMutex.Unlock()
+
+	event := new(eventv1.EventPayload)
+	if err := proto.Unmarshal(entry.Event, event); err != nil {
+		return fmt.Errorf("while decoding outbox event %s: %w", entry.ID, err)
+	}
+
+	var deliveryErr error
+
+	if pl, ok := pm.getPluginByName(entry.Plugin); ok {
+		deliveryErr = pl.sendEvent(ctx, event, nil)
+	} else {
+		deliveryErr = errOutboxNoPlugin
+	}
+
+	if deliveryErr == nil {
+		o.logger.Infof("Delivered %s event for %s from outbox to plugin %s", entry.Action, entry.Repository, entry.Plugin)
+		outboxRedeliveredEvents.WithLabelValues(entry.Plugin).Inc()
+		if err := o.remove(ctx, entry); err != nil && !errors.Is(err, errOutboxEntryNotFound) {
+			return err
+		}
+		return nil
+	} else if isEventRejected(deliveryErr) {
+		o.logger.Errorf("Dropped %s event for %s from outbox, %s", entry.Action, entry.Repository, deliveryErr)
+		outboxDroppedEvents.WithLabelValues(entry.Plugin).Inc()
+		if err := o.remove(ctx, entry); err != nil && !errors.Is(err, errOutboxEntryNotFound) {
+			o.logger.Errorf("outbox remove error: %s", err)
+		}
+		return deliveryErr
+	}
+
+	entry.Attempts++
+	entry.LastError = deliveryErr.Error()
+	entry.NextAttempt = time.Now().UTC().Add(outboxBackoff(entry.Attempts))
+
+	o.logger.Warnf(
+		"outbox delivery of %s event for %s to plugin %s failed (attempt %d, next attempt at %s): %s",
+		entry.Action, entry.Repository, entry.Plugin, entry.Attempts, entry.NextAttempt.Format(time.RFC3339), deliveryErr,
+	)
+
+	if err := o.put(ctx, entry); err != nil {
+		o.logger.Errorf("outbox update error: %s", err)
+	}
+
+	return deliveryErr
+}
@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
+	"go.ciq.dev/beskar/pkg/rv"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	logger := logrus.NewEntry(logrus.New())
+
+	ob := newOutbox(inmemory.New(), "node1", logger)
+
+	entries, err := ob.list(ctx, "")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	require.False(t, ob.hasPending("yum", "artifacts/yum/repo1"))
+
+	for _, repository := range []string{"artifacts/yum/repo1/pkg1", "artifacts/yum/repo1/pkg2"} {
+		err := ob.add(ctx, "yum", &eventv1.EventPayload{
+			Repository: repository,
+			Digest:     "sha256:0123",
+			Action:     eventv1.Action_ACTION_PUT,
+		}, errors.New("connection refused"))
+		require.NoError(t, err)
+	}
+	require.True(t, ob.hasPending("yum", "artifacts/yum/repo1"))
+	require.False(t, ob.hasPending("yum", "artifacts/yum/repo2"))
+
+	entries, err = ob.list(ctx, "static")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	entries, err = ob.list(ctx, "yum")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "artifacts/yum/repo1/pkg1", entries[0].Repository)
+	require.Equal(t, "artifacts/yum/repo1/pkg2", entries[1].Repository)
+	require.Equal(t, "connection refused", entries[0].LastError)
+	require.False(t, entries[0].NextAttempt.After(time.Now()))
+
+	// no plugin registered, delivery fails and is rescheduled
+	pm := newPluginManager(nil, logger)
+	err = ob.deliver(ctx, pm, entries[0])
+	require.ErrorIs(t, err, errOutboxNoPlugin)
+
+	entry, err := ob.get(ctx, "node1", "yum", entries[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, 1, entry.Attempts)
+	require.True(t, entry.NextAttempt.After(time.Now()))
+
+	require.NoError(t, ob.remove(ctx, entry))
+	require.ErrorIs(t, ob.remove(ctx, entry), errOutboxEntryNotFound)
+	require.True(t, ob.hasPending("yum", "artifacts/yum/repo1"))
+
+	require.NoError(t, ob.remove(ctx, entries[1]))
+	require.False(t, ob.hasPending("yum", "artifacts/yum/repo1"))
+}
+
+func TestOutboxStaleNode(t *testing.T) {
+	ctx := context.Background()
+	logger := logrus.NewEntry(logrus.New())
+	driver := inmemory.New()
+	pm := newPluginManager(nil, logger)
+
+	ob1 := newOutbox(driver, "node1", logger)
+	ob2 := newOutbox(driver, "node2", logger)
+
+	err := ob1.add(ctx, "yum", &eventv1.EventPayload{
+		Repository: "artifacts/yum/repo1/pkg1",
+		Digest:     "sha256:0123",
+		Action:     eventv1.Action_ACTION_PUT,
+	}, errors.New("connection refused"))
+	require.NoError(t, err)
+
+	// node1 never wrote its lease, node2 gives it a lease duration
+	ob2.redeliver(ctx, pm)
+
+	lease, err := ob2.getLease(ctx, "node1")
+	require.NoError(t, err)
+	require.NotNil(t, lease)
+	require.Empty(t, lease.Owner)
+
+	owned, err := ob2.claim(ctx, "node1")
+	require.NoError(t, err)
+	require.False(t, owned)
+
+	// a running node1 keeps its outbox
+	owned, err = ob1.claim(ctx, "node1")
+	require.NoError(t, err)
+	require.True(t, owned)
+
+	owned, err = ob2.claim(ctx, "node1")
+	require.NoError(t, err)
+	require.False(t, owned)
+
+	// node1 is gone, node2 claims its outbox once the lease expired
+	lease.Owner = "node1"
+	lease.Expires = time.Now().Add(-time.Second)
+	require.NoError(t, ob2.putLease(ctx, lease))
+
+	ob2.redeliver(ctx, pm)
+
+	entries, err := ob2.list(ctx, "yum")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "node1", entries[0].Node)
+	require.Equal(t, 1, entries[0].Attempts)
+
+	lease, err = ob2.getLease(ctx, "node1")
+	require.NoError(t, err)
+	require.Equal(t, "node2", lease.Owner)
+
+	// drained outbox and lease of node1 are removed
+	require.NoError(t, ob2.remove(ctx, entries[0]))
+	ob2.redeliver(ctx, pm)
+
+	nodes, err := ob2.listDir(ctx, outboxRootPath)
+	require.NoError(t, err)
+	require.NotContains(t, nodes, "node1")
+
+	lease, err = ob2.getLease(ctx, "node1")
+	require.NoError(t, err)
+	require.Nil(t, lease)
+}
+
+func TestOutboxRepositoryOrder(t *testing.T) {
+	ctx := context.Background()
+	logger := logrus.NewEntry(logrus.New())
+
+	// the plugin rejects the events of repo1 and accepts the others
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		event := new(eventv1.EventPayload)
+		require.NoError(t, proto.Unmarshal(data, event))
+
+		if path.Dir(event.Repository) == "artifacts/yum/repo1" {
+			http.Error(w, "operation not supported for repository configured as mirror", http.StatusUnprocessableEntity)
+		}
+	}))
+	defer server.Close()
+
+	pl := &plugin{
+		name:       "yum",
+		nodeHash:   rv.NewNodeHash(nil),
+		httpClient: server.Client(),
+		logger:     logger,
+	}
+	pl.nodeHash.Add("plugin1", server.Listener.Addr().String())
+
+	pm := newPluginManager(nil, logger)
+	ob := newOutbox(inmemory.New(), "node1", logger)
+
+	for _, repository := range []string{"artifacts/yum/repo1/pkg1", "artifacts/yum/repo2/pkg1", "artifacts/yum/repo2/pkg2", "artifacts/yum/repo3/pkg1"} {
+		err := ob.add(ctx, "yum", &eventv1.EventPayload{
+			Repository: repository,
+			Digest:     "sha256:0123",
+			Action:     eventv1.Action_ACTION_PUT,
+		}, errors.New("connection refused"))
+		require.NoError(t, err)
+	}
+
+	entries, err := ob.list(ctx, "yum")
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+
+	// repo2 events are scheduled later, the repo3 event is still delivered
+	entries[1].NextAttempt = time.Now().Add(time.Hour)
+	require.NoError(t, ob.put(ctx, entries[1]))
+
+	pm.plugins["yum"] = pl
+	require.Equal(t, 2, ob.redeliverNode(ctx, pm, "node1"))
+
+	entries, err = ob.list(ctx, "yum")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "artifacts/yum/repo2/pkg1", entries[0].Repository)
+	require.Equal(t, "artifacts/yum/repo2/pkg2", entries[1].Repository)
+	require.Zero(t, entries[1].Attempts)
+
+	require.False(t, ob.hasPending("yum", "artifacts/yum/repo1"))
+	require.True(t, ob.hasPending("yum", "artifacts/yum/repo2"))
+	require.False(t, ob.hasPending("yum", "artifacts/yum/repo3"))
+
+	// rejected events are returned to the caller
+	err = pl.sendEvent(ctx, &eventv1.EventPayload{
+		Repository: "artifacts/yum/repo1/pkg2",
+		Action:     eventv1.Action_ACTION_PUT,
+	}, nil)
+	require.True(t, isEventRejected(err))
+	require.ErrorContains(t, err, "operation not supported for repository configured as mirror")
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	require.Equal(t, outboxMinBackoff, outboxBackoff(1))
+	require.Equal(t, 2*outboxMinBackoff, outboxBackoff(2))
+	require.Equal(t, 4*outboxMinBackoff, outboxBackoff(3))
+	require.Equal(t, outboxMaxBackoff, outboxBackoff(100))
+}
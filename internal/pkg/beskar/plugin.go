@@ -7,6 +7,8 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -15,6 +17,7 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -26,14 +29,19 @@ import (
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/auth"
 	"github.com/hashicorp/memberlist"
 	"github.com/sirupsen/logrus"
-	"go.ciq.dev/beskar/internal/pkg/config"
 	"go.ciq.dev/beskar/internal/pkg/gossip"
+	"go.ciq.dev/beskar/internal/pkg/maintenance"
+	"go.ciq.dev/beskar/internal/pkg/repository"
 	"go.ciq.dev/beskar/internal/pkg/router"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
 	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
 	pluginv1 "go.ciq.dev/beskar/pkg/api/plugin/v1"
 	"go.ciq.dev/beskar/pkg/rv"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/mod/semver"
 	"google.golang.org/protobuf/proto"
 )
@@ -41,21 +49,31 @@ import (
 var (
 	artifactsMatch = regexp.MustCompile(`^/?artifacts/([[:alnum:]]+)/?`)
 	artifactsPath  = "/artifacts"
+
+	errReferencesNotSupported  = errors.New("plugin doesn't report repository references")
+	errReferencesPendingEvents = errors.New("plugin repository has events not processed yet")
 )
 
 type nodeInfo struct {
 	pluginName string
 	nodeName   string
+	hostname   string
 }
 
 type pluginManager struct {
-	pluginsMutex sync.RWMutex
-	plugins      map[string]*plugin
-	registry     distribution.Namespace
-	reverseProxy *httputil.ReverseProxy
-	nodesInfo    map[string]nodeInfo
-	httpClient   *http.Client
-	logger       *logrus.Entry
+	pluginsMutex     sync.RWMutex
+	plugins          map[string]*plugin
+	registry         distribution.Namespace
+	reverseProxy     *httputil.ReverseProxy
+	nodesInfo        map[string]nodeInfo
+	httpClient       *http.Client
+	transport        *http.Transport
+	accessController auth.AccessController
+	audit            *auditLog
+	maintenance      *maintenance.Mode
+	health           *pluginHealth
+	bodyLimit        atomic.Int64
+	logger           *logrus.Entry
 }
 
 func newPluginManager(registry distribution.Namespace, logger *logrus.Entry) *pluginManager {
@@ -65,7 +83,7 @@ func newPluginManager(registry distribution.Namespace, logger *logrus.Entry) *pl
 	transport.MaxIdleConnsPerHost = 16
 
 	reverseProxy := &httputil.ReverseProxy{
-		Transport: transport,
+		Transport: tracing.Transport(transport),
 		Rewrite: func(pr *httputil.ProxyRequest) {
 			target := new(url.URL)
 			*target = *pr.In.URL
@@ -83,22 +101,103 @@ func newPluginManager(registry distribution.Namespace, logger *logrus.Entry) *pl
 		},
 	}
 
-	return &pluginManager{
+	pm := &pluginManager{
 		plugins:      make(map[string]*plugin),
 		registry:     registry,
 		reverseProxy: reverseProxy,
 		nodesInfo:    make(map[string]nodeInfo),
+		transport:    transport,
+		health:       newPluginHealth(),
 		logger:       logger,
 		httpClient: &http.Client{
 			Transport: reverseProxy.Transport,
 			Timeout:   5 * time.Second,
 		},
 	}
+
+	reverseProxy.ModifyResponse = pm.proxyResponse
+	reverseProxy.ErrorHandler = pm.proxyError
+
+	return pm
+}
+
+// proxyResponse resets the failure count of the plugin node which has answered
+// the request. Any status returned by the plugin, including the 503 returned in
+// maintenance mode, means the node is reachable, only the transport errors and
+// timeouts handled by proxyError count as node failures.
+func (pm *pluginManager) proxyResponse(resp *http.Response) error {
+	if hostport, ok := getReverseProxyHostport(resp.Request.Context()); ok {
+		pm.health.reset(hostport)
+	}
+	return nil
+}
+
+// proxyError records a failure for the plugin node which couldn't be reached
+// or didn't answer in time, the client gets a 502 generated by the proxy.
+func (pm *pluginManager) proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	if hostport, ok := getReverseProxyHostport(r.Context()); ok && !errors.Is(err, context.Canceled) {
+		pm.nodeFailure(hostport, err)
+	}
+
+	pm.logger.Errorf("plugin proxy error for %s %s: %s", r.Method, r.URL.Path, err)
+	w.WriteHeader(http.StatusBadGateway)
 }
 
 func (pm *pluginManager) setClientTLSConfig(tlsConfig *tls.Config) {
-	transport := pm.reverseProxy.Transport.(*http.Transport)
-	transport.TLSClientConfig = tlsConfig
+	pm.transport.TLSClientConfig = tlsConfig
+}
+
+// setAccessController sets the registry access controller used to
+// authenticate plugin management API calls.
+func (pm *pluginManager) setAccessController(accessController auth.AccessController) {
+	pm.pluginsMutex.Lock()
+	defer pm.pluginsMutex.Unlock()
+
+	pm.accessController = accessController
+
+	for _, pl := range pm.plugins {
+		pl.accessController = accessController
+	}
+}
+
+// setBodyLimit sets the request body size limit of the plugin routers,
+// the routers of the registered plugins are re-initialized.
+func (pm *pluginManager) setBodyLimit(bodyLimit int64) {
+	pm.pluginsMutex.Lock()
+	defer pm.pluginsMutex.Unlock()
+
+	pm.bodyLimit.Store(bodyLimit)
+
+	for _, pl := range pm.plugins {
+		if err := pl.initRouter(pl.info, bodyLimit); err != nil {
+			pm.logger.Errorf("plugin %s router initialization error: %s", pl.name, err)
+		}
+	}
+}
+
+// setAuditLog sets the audit log recording plugin management API calls.
+func (pm *pluginManager) setAuditLog(audit *auditLog) {
+	pm.pluginsMutex.Lock()
+	defer pm.pluginsMutex.Unlock()
+
+	pm.audit = audit
+
+	for _, pl := range pm.plugins {
+		pl.audit = audit
+	}
+}
+
+// setMaintenanceMode sets the maintenance mode rejecting plugin API calls
+// modifying repositories while enabled.
+func (pm *pluginManager) setMaintenanceMode(mode *maintenance.Mode) {
+	pm.pluginsMutex.Lock()
+	defer pm.pluginsMutex.Unlock()
+
+	pm.maintenance = mode
+
+	for _, pl := range pm.plugins {
+		pl.maintenance = mode
+	}
 }
 
 func (pm *pluginManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -125,7 +224,7 @@ func (pm *pluginManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	pl.ServeHTTP(w, r)
 }
 
-func (pm *pluginManager) register(node *memberlist.Node, meta *gossip.BeskarMeta, beskarConfig *config.BeskarConfig) error {
+func (pm *pluginManager) register(node *memberlist.Node, meta *gossip.BeskarMeta) error {
 	hostport := net.JoinHostPort(node.Addr.String(), strconv.Itoa(int(meta.ServicePort)))
 	info, err := pm.getPluginInfo(hostport)
 	if err != nil {
@@ -143,17 +242,21 @@ func (pm *pluginManager) register(node *memberlist.Node, meta *gossip.BeskarMeta
 		}
 
 		pl = &plugin{
-			nodeHash:     rv.NewNodeHash(nil),
-			version:      info.Version,
-			name:         info.Name,
-			mediaTypes:   mediaTypes,
-			registry:     pm.registry,
-			httpClient:   pm.httpClient,
-			reverseProxy: pm.reverseProxy,
-			logger:       pm.logger,
+			nodeHash:         rv.NewNodeHash(nil),
+			version:          info.Version,
+			name:             info.Name,
+			info:             info,
+			mediaTypes:       mediaTypes,
+			registry:         pm.registry,
+			httpClient:       pm.httpClient,
+			reverseProxy:     pm.reverseProxy,
+			accessController: pm.accessController,
+			audit:            pm.audit,
+			maintenance:      pm.maintenance,
+			logger:           pm.logger,
 		}
 
-		if err := pl.initRouter(info, beskarConfig.Router.BodyLimit); err != nil {
+		if err := pl.initRouter(info, pm.bodyLimit.Load()); err != nil {
 			return err
 		}
 
@@ -165,9 +268,10 @@ func (pm *pluginManager) register(node *memberlist.Node, meta *gossip.BeskarMeta
 			mediaTypes[mediaType] = struct{}{}
 		}
 		pl.version = info.Version
+		pl.info = info
 		pl.mediaTypes = mediaTypes
 
-		if err := pl.initRouter(info, beskarConfig.Router.BodyLimit); err != nil {
+		if err := pl.initRouter(info, pm.bodyLimit.Load()); err != nil {
 			return err
 		}
 	}
@@ -175,9 +279,15 @@ func (pm *pluginManager) register(node *memberlist.Node, meta *gossip.BeskarMeta
 	pm.nodesInfo[hostport] = nodeInfo{
 		pluginName: info.Name,
 		nodeName:   node.Name,
+		hostname:   meta.Hostname,
 	}
 
-	pl.nodeHash.Add(meta.Hostname, hostport)
+	pm.health.add(info.Name, meta.Hostname, hostport)
+
+	// ejected nodes are re-admitted by health checks only
+	if !pm.health.isEjected(hostport) {
+		pl.nodeHash.Add(meta.Hostname, hostport)
+	}
 
 	return nil
 }
@@ -194,6 +304,7 @@ func (pm *pluginManager) unregister(node *memberlist.Node, meta *gossip.BeskarMe
 	if ok && nodeInfo.nodeName == node.Name {
 		pl.nodeHash.Remove(meta.Hostname)
 		delete(pm.nodesInfo, hostport)
+		pm.health.remove(hostport)
 	}
 }
 
@@ -256,6 +367,14 @@ func (pm *pluginManager) getPlugin(mediaType string) (*plugin, bool) {
 	return nil, false
 }
 
+func (pm *pluginManager) getPluginByName(name string) (*plugin, bool) {
+	pm.pluginsMutex.RLock()
+	defer pm.pluginsMutex.RUnlock()
+
+	pl, ok := pm.plugins[name]
+	return pl, ok
+}
+
 func (pm *pluginManager) hasPlugin(name string) bool {
 	pm.pluginsMutex.RLock()
 	_, has := pm.plugins[name]
@@ -264,24 +383,36 @@ func (pm *pluginManager) hasPlugin(name string) bool {
 }
 
 type plugin struct {
-	nodeHash     *rv.NodeHash
-	name         string
-	version      string
-	registry     distribution.Namespace
-	mediaTypes   map[string]struct{}
-	httpClient   *http.Client
-	reverseProxy *httputil.ReverseProxy
-	router       atomic.Pointer[router.RegoRouter]
-	logger       *logrus.Entry
+	nodeHash         *rv.NodeHash
+	name             string
+	version          string
+	info             *pluginv1.Info
+	registry         distribution.Namespace
+	mediaTypes       map[string]struct{}
+	httpClient       *http.Client
+	reverseProxy     *httputil.ReverseProxy
+	router           atomic.Pointer[router.RegoRouter]
+	accessController auth.AccessController
+	audit            *auditLog
+	maintenance      *maintenance.Mode
+	logger           *logrus.Entry
 }
 
 func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	key := r.RemoteAddr
 
+	sr := &statusRecorder{ResponseWriter: w}
+	defer func() {
+		proxyResponses.WithLabelValues(p.name, sr.code()).Inc()
+	}()
+	w = sr
+
 	// If the request is for a repository, we need to check if the router has a decision for it.
 	// If it does, we need to redirect the request to the appropriate location.
 	// If it does not, we need to use the node hash to find the appropriate node to forward the request to.
+	decisionStart := time.Now()
 	result, err := p.router.Load().Decision(r, p.registry)
+	routerDecisionDuration.WithLabelValues(p.name).Observe(time.Since(decisionStart).Seconds())
 	if err != nil {
 		p.logger.Errorf("%s router decision error: %s", p.name, err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -296,16 +427,128 @@ func (p *plugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		key = result.Repository
 	}
 
+	user, ok := p.authorized(w, r, result.Repository)
+	if !ok {
+		return
+	}
+
+	if maintenance.IsMutatingRequest(r) {
+		if p.audit != nil {
+			defer p.recordAudit(r, sr, user, result.Repository)
+		}
+		if state := p.maintenance.Get(); state.Enabled {
+			maintenance.WriteError(w, state)
+			return
+		}
+	}
+
 	node := p.nodeHash.Get(key)
 	if node == nil {
-		w.WriteHeader(http.StatusBadGateway)
+		// no node registered or all nodes have been ejected
+		w.Header().Set("Retry-After", strconv.Itoa(int(healthCheckInterval.Seconds())))
+		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
 
 	p.reverseProxy.ServeHTTP(w, setReverseProxyHostport(r, node.Hostport()))
 }
 
-func (p *plugin) sendEvent(ctx context.Context, event *eventv1.EventPayload, node *rv.Node) error {
+// recordAudit records the plugin API call in the audit log once the
+// plugin response has been sent.
+func (p *plugin) recordAudit(r *http.Request, sr *statusRecorder, user, repository string) {
+	entry := &auditEntry{
+		User:       user,
+		ClientIP:   p.audit.clientIP(r),
+		Operation:  r.Method + " " + strings.TrimPrefix(r.URL.Path, path.Join(artifactsPath, p.name)),
+		Plugin:     p.name,
+		Repository: repository,
+		StatusCode: sr.statusCode,
+		Result:     auditResultSuccess,
+	}
+	if entry.StatusCode == 0 {
+		entry.StatusCode = http.StatusOK
+	}
+	if entry.StatusCode >= http.StatusBadRequest {
+		entry.Result = auditResultFailure
+	}
+	if entry.Repository == "" {
+		entry.Repository = r.URL.Query().Get("repository")
+	}
+
+	p.audit.record(entry)
+}
+
+// authorized authenticates plugin management API calls with the registry
+// access controller, read-only requests are pull actions not requiring
+// authentication but still subject to the authorization policy. It returns
+// the authenticated user name, or false when the request was rejected and the
+// response has already been written. Without access controller, only read-only
+// requests and requests from plugins are allowed.
+func (p *plugin) authorized(w http.ResponseWriter, r *http.Request, repository string) (string, bool) {
+	if p.accessController == nil {
+		if !maintenance.IsMutatingRequest(r) {
+			return "", true
+		} else if isPluginRequest(r) {
+			return auditPluginUser, true
+		}
+		p.logger.Debugf("%s %s request on %s denied, no access controller configured", p.name, r.Method, repository)
+		w.WriteHeader(http.StatusForbidden)
+		return "", false
+	}
+
+	if repository == "" {
+		repository = path.Join(strings.TrimPrefix(artifactsPath, "/"), p.name)
+	}
+
+	// GET requests triggering a repository synchronization are push actions
+	action := "pull"
+	switch {
+	case r.Method == http.MethodDelete:
+		action = "delete"
+	case maintenance.IsMutatingRequest(r):
+		action = "push"
+	}
+
+	grant, err := p.accessController.Authorized(r, auth.Access{
+		Resource: auth.Resource{
+			Type: "repository",
+			Name: repository,
+		},
+		Action: action,
+	})
+	if err != nil {
+		p.logger.Debugf("%s unauthorized %s request on %s: %s", p.name, r.Method, repository, err)
+
+		if errors.Is(err, errPolicyDenied) {
+			w.WriteHeader(http.StatusForbidden)
+			return "", false
+		} else if challenge, ok := err.(auth.Challenge); ok {
+			challenge.SetHeaders(r, w)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return "", false
+	}
+
+	if isPluginRequest(r) {
+		return auditPluginUser, true
+	} else if grant != nil {
+		return grant.User.Name, true
+	}
+
+	return "", true
+}
+
+func (p *plugin) sendEvent(ctx context.Context, event *eventv1.EventPayload, node *rv.Node) (errFn error) {
+	ctx, span := tracing.Start(ctx, "plugin.sendEvent", trace.WithAttributes(
+		attribute.String("plugin", p.name),
+		attribute.String("repository", event.Repository),
+		attribute.String("action", event.Action.String()),
+		attribute.String("digest", event.Digest),
+	))
+	defer func() {
+		tracing.End(span, errFn)
+	}()
+
 	data, err := proto.Marshal(event)
 	if err != nil {
 		return err
@@ -317,7 +560,22 @@ func (p *plugin) sendEvent(ctx context.Context, event *eventv1.EventPayload, nod
 
 	repository := filepath.Dir(event.Repository)
 
+	attempts := 0
+
+	defer func() {
+		if errFn != nil {
+			eventDeliveryFailures.WithLabelValues(p.name).Inc()
+		} else {
+			eventDeliveries.WithLabelValues(p.name).Inc()
+		}
+	}()
+
 	return backoff.Retry(func() error {
+		attempts++
+		if attempts > 1 {
+			eventDeliveryRetries.WithLabelValues(p.name).Inc()
+		}
+
 		destNode := node
 		if destNode == nil {
 			destNode = p.nodeHash.Get(repository)
@@ -345,14 +603,157 @@ func (p *plugin) sendEvent(ctx context.Context, event *eventv1.EventPayload, nod
 		}
 		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("plugin backend has returned an unknown status %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		} else if isEventRejectedStatus(resp.StatusCode) {
+			message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return backoff.Permanent(&eventRejectedError{
+				plugin:     p.name,
+				statusCode: resp.StatusCode,
+				message:    strings.TrimSpace(string(message)),
+			})
 		}
 
-		return nil
+		return fmt.Errorf("plugin backend has returned an unknown status %d", resp.StatusCode)
 	}, backoff.WithContext(eb, ctx))
 }
 
+// eventRejectedError is returned when the plugin rejected an event, those
+// events are not retried and not stored in the outbox.
+type eventRejectedError struct {
+	plugin     string
+	statusCode int
+	message    string
+}
+
+func (e *eventRejectedError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("plugin %s has rejected the event with status %d", e.plugin, e.statusCode)
+	}
+	return fmt.Sprintf("plugin %s has rejected the event: %s", e.plugin, e.message)
+}
+
+// isEventRejectedStatus returns true for the plugin response status codes
+// reporting an event the plugin won't ever process.
+func isEventRejectedStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	case http.StatusNotImplemented:
+		return true
+	}
+	return statusCode >= http.StatusBadRequest && statusCode < http.StatusInternalServerError
+}
+
+// isEventRejected returns true if the event delivery error is a plugin rejection.
+func isEventRejected(err error) bool {
+	var rejectedErr *eventRejectedError
+	return errors.As(err, &rejectedErr)
+}
+
+// references returns the artifacts referenced by the plugin repository, the request is
+// sent to the plugin node handling the repository.
+func (p *plugin) references(ctx context.Context, repositoryName string) (*repository.References, error) {
+	node := p.nodeHash.Get(repositoryName)
+	if node == nil {
+		return nil, fmt.Errorf("no node found for repository %s", repositoryName)
+	}
+
+	pluginURL := url.URL{
+		Scheme:   "https",
+		Host:     node.Hostport(),
+		Path:     "/references",
+		RawQuery: url.Values{"repository": []string{repositoryName}}.Encode(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pluginURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// repository databases may have to be fetched by the plugin, use the
+	// context timeout instead of the default client timeout
+	client := &http.Client{
+		Transport: p.httpClient.Transport,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotImplemented:
+		return nil, errReferencesNotSupported
+	case http.StatusConflict:
+		return nil, errReferencesPendingEvents
+	default:
+		return nil, fmt.Errorf("plugin backend has returned an unknown status %d", resp.StatusCode)
+	}
+
+	references := repository.NewReferences()
+	if err := json.NewDecoder(resp.Body).Decode(references); err != nil {
+		return nil, fmt.Errorf("while decoding %s references: %w", repositoryName, err)
+	}
+
+	return references, nil
+}
+
+// admit submits a pushed manifest to the plugin node handling the repository before
+// it's committed, it returns the plugin rejection message if the manifest is rejected.
+// Manifests are admitted by plugins not implementing admission checks.
+func (p *plugin) admit(ctx context.Context, event *eventv1.EventPayload) (string, error) {
+	repositoryName := filepath.Dir(event.Repository)
+
+	node := p.nodeHash.Get(repositoryName)
+	if node == nil {
+		return "", fmt.Errorf("no node found for repository %s", repositoryName)
+	}
+
+	data, err := proto.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	pluginURL := url.URL{
+		Scheme: "https",
+		Host:   node.Hostport(),
+		Path:   "/admit",
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pluginURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotImplemented:
+		return "", nil
+	case http.StatusForbidden:
+		message, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if err != nil {
+			return "", err
+		} else if len(message) == 0 {
+			return "rejected without reason", nil
+		}
+		return strings.TrimSpace(string(message)), nil
+	default:
+		return "", fmt.Errorf("plugin backend has returned an unknown status %d", resp.StatusCode)
+	}
+}
+
 func (p *plugin) initRouter(info *pluginv1.Info, bodyLimit int64) error {
 	var routerOptions []router.RegoRouterOption
 
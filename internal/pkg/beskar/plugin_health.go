@@ -0,0 +1,294 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// healthCheckInterval is the interval between two health checks of a plugin node.
+	healthCheckInterval = 10 * time.Second
+	// healthCheckTimeout is the time a plugin node has to answer a health check.
+	healthCheckTimeout = 3 * time.Second
+	// unhealthyThreshold is the number of consecutive failures, either health
+	// checks or proxied requests, after which a plugin node is ejected.
+	unhealthyThreshold = 3
+	// healthyThreshold is the number of consecutive successful health checks
+	// after which an ejected plugin node is re-admitted.
+	healthyThreshold = 2
+)
+
+// nodeHealth tracks the health of a plugin node. A node failing consecutively
+// is ejected from the plugin node hash and doesn't receive requests and
+// events anymore, it's re-admitted once health checks are passing again.
+type nodeHealth struct {
+	Plugin         string    `json:"plugin"`
+	Hostname       string    `json:"hostname"`
+	Hostport       string    `json:"hostport"`
+	Ejected        bool      `json:"ejected"`
+	EjectionTime   time.Time `json:"ejectionTime,omitempty"`
+	Ejections      int       `json:"ejections"`
+	Failures       int       `json:"failures"`
+	Successes      int       `json:"successes"`
+	LastError      string    `json:"lastError,omitempty"`
+	LastCheckTime  time.Time `json:"lastCheckTime,omitempty"`
+	LastChangeTime time.Time `json:"lastChangeTime,omitempty"`
+}
+
+type pluginHealth struct {
+	sync.Mutex
+	nodes map[string]*nodeHealth
+}
+
+func newPluginHealth() *pluginHealth {
+	return &pluginHealth{
+		nodes: make(map[string]*nodeHealth),
+	}
+}
+
+// add starts tracking the health of a plugin node, it's a no-op if the node is
+// already tracked.
+func (ph *pluginHealth) add(pluginName, hostname, hostport string) {
+	ph.Lock()
+	defer ph.Unlock()
+
+	if _, ok := ph.nodes[hostport]; ok {
+		return
+	}
+
+	ph.nodes[hostport] = &nodeHealth{
+		Plugin:   pluginName,
+		Hostname: hostname,
+		Hostport: hostport,
+	}
+}
+
+func (ph *pluginHealth) remove(hostport string) {
+	ph.Lock()
+	defer ph.Unlock()
+
+	if nh, ok := ph.nodes[hostport]; ok && nh.Ejected {
+		pluginEjectedNodes.WithLabelValues(nh.Plugin).Dec()
+	}
+
+	delete(ph.nodes, hostport)
+}
+
+func (ph *pluginHealth) isEjected(hostport string) bool {
+	ph.Lock()
+	defer ph.Unlock()
+
+	nh, ok := ph.nodes[hostport]
+	return ok && nh.Ejected
+}
+
+// failure records a failure for the node, it returns true when the node
+// must be ejected.
+func (ph *pluginHealth) failure(hostport string, err error) bool {
+	ph.Lock()
+	defer ph.Unlock()
+
+	nh, ok := ph.nodes[hostport]
+	if !ok {
+		return false
+	}
+
+	nh.Successes = 0
+	nh.Failures++
+	nh.LastError = err.Error()
+
+	if nh.Ejected || nh.Failures < unhealthyThreshold {
+		return false
+	}
+
+	nh.Ejected = true
+	nh.Ejections++
+	nh.EjectionTime = time.Now().UTC()
+	nh.LastChangeTime = nh.EjectionTime
+
+	pluginEjectedNodes.WithLabelValues(nh.Plugin).Inc()
+	pluginNodeEjections.WithLabelValues(nh.Plugin).Inc()
+
+	return true
+}
+
+// success records a success for the node, it returns true when the node
+// must be re-admitted.
+func (ph *pluginHealth) success(hostport string) bool {
+	ph.Lock()
+	defer ph.Unlock()
+
+	nh, ok := ph.nodes[hostport]
+	if !ok {
+		return false
+	}
+
+	nh.Failures = 0
+	nh.Successes++
+
+	if !nh.Ejected || nh.Successes < healthyThreshold {
+		return false
+	}
+
+	nh.Ejected = false
+	nh.LastError = ""
+	nh.LastChangeTime = time.Now().UTC()
+
+	pluginEjectedNodes.WithLabelValues(nh.Plugin).Dec()
+
+	return true
+}
+
+// reset resets the consecutive failures of a node which is not ejected.
+func (ph *pluginHealth) reset(hostport string) {
+	ph.Lock()
+	defer ph.Unlock()
+
+	if nh, ok := ph.nodes[hostport]; ok && !nh.Ejected {
+		nh.Failures = 0
+	}
+}
+
+func (ph *pluginHealth) checked(hostport string) {
+	ph.Lock()
+	defer ph.Unlock()
+
+	if nh, ok := ph.nodes[hostport]; ok {
+		nh.LastCheckTime = time.Now().UTC()
+	}
+}
+
+// list returns a copy of the plugin nodes health sorted by plugin and hostname.
+func (ph *pluginHealth) list() []nodeHealth {
+	ph.Lock()
+	defer ph.Unlock()
+
+	nodes := make([]nodeHealth, 0, len(ph.nodes))
+	for _, nh := range ph.nodes {
+		nodes = append(nodes, *nh)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Plugin != nodes[j].Plugin {
+			return nodes[i].Plugin < nodes[j].Plugin
+		}
+		return nodes[i].Hostname < nodes[j].Hostname
+	})
+
+	return nodes
+}
+
+// runHealthChecks periodically checks the health of all plugin nodes
+// until the context is canceled.
+func (pm *pluginManager) runHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		wg := sync.WaitGroup{}
+
+		for _, nh := range pm.health.list() {
+			wg.Add(1)
+
+			go func(hostport string) {
+				defer wg.Done()
+
+				if err := pm.checkNode(ctx, hostport); err != nil {
+					pm.nodeFailure(hostport, err)
+				} else {
+					pm.nodeSuccess(hostport)
+				}
+			}(nh.Hostport)
+		}
+
+		wg.Wait()
+	}
+}
+
+// checkNode queries the plugin node info endpoint.
+func (pm *pluginManager) checkNode(ctx context.Context, hostport string) error {
+	defer pm.health.checked(hostport)
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	pluginURL := url.URL{
+		Scheme: "https",
+		Host:   hostport,
+		Path:   "/info",
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pluginURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := pm.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("plugin backend has returned an unknown status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// nodeFailure records a plugin node failure and ejects the node from the
+// plugin node hash once it has failed too many times in a row.
+func (pm *pluginManager) nodeFailure(hostport string, err error) {
+	if !pm.health.failure(hostport, err) {
+		return
+	}
+
+	pm.pluginsMutex.Lock()
+	defer pm.pluginsMutex.Unlock()
+
+	nodeInfo, ok := pm.nodesInfo[hostport]
+	if !ok {
+		return
+	}
+	if pl, ok := pm.plugins[nodeInfo.pluginName]; ok {
+		pl.nodeHash.Remove(nodeInfo.hostname)
+	}
+
+	pm.logger.Warnf("plugin %s node %s (%s) ejected after %d consecutive failures: %s", nodeInfo.pluginName, nodeInfo.hostname, hostport, unhealthyThreshold, err)
+}
+
+// nodeSuccess records a plugin node success and re-admits the node
+// in the plugin node hash if it was ejected.
+func (pm *pluginManager) nodeSuccess(hostport string) {
+	if !pm.health.success(hostport) {
+		return
+	}
+
+	pm.pluginsMutex.Lock()
+	defer pm.pluginsMutex.Unlock()
+
+	nodeInfo, ok := pm.nodesInfo[hostport]
+	if !ok {
+		return
+	}
+	if pl, ok := pm.plugins[nodeInfo.pluginName]; ok {
+		pl.nodeHash.Add(nodeInfo.hostname, hostport)
+	}
+
+	pm.logger.Infof("plugin %s node %s (%s) re-admitted after %d successful health checks", nodeInfo.pluginName, nodeInfo.hostname, hostport, healthyThreshold)
+}
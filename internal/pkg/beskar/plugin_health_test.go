@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/pkg/rv"
+)
+
+func TestPluginHealth(t *testing.T) {
+	pm := newPluginManager(nil, logrus.NewEntry(logrus.New()))
+
+	pl := &plugin{
+		name:     "yum",
+		nodeHash: rv.NewNodeHash(nil),
+	}
+	pm.plugins[pl.name] = pl
+
+	for _, node := range []nodeInfo{
+		{pluginName: "yum", nodeName: "node1", hostname: "host1"},
+		{pluginName: "yum", nodeName: "node2", hostname: "host2"},
+	} {
+		hostport := node.hostname + ":5200"
+		pm.nodesInfo[hostport] = node
+		pm.health.add(node.pluginName, node.hostname, hostport)
+		pl.nodeHash.Add(node.hostname, hostport)
+	}
+
+	nodeErr := errors.New("connection refused")
+
+	for i := 0; i < unhealthyThreshold-1; i++ {
+		pm.nodeFailure("host1:5200", nodeErr)
+	}
+	require.False(t, pm.health.isEjected("host1:5200"))
+
+	// a response of the plugin, even in maintenance mode, resets the failures
+	req := setReverseProxyHostport(httptest.NewRequest(http.MethodPut, "/artifacts/yum/api/v1/repository", nil), "host1:5200")
+	require.NoError(t, pm.proxyResponse(&http.Response{StatusCode: http.StatusServiceUnavailable, Request: req}))
+
+	for i := 0; i < unhealthyThreshold-1; i++ {
+		pm.nodeFailure("host1:5200", nodeErr)
+	}
+	require.False(t, pm.health.isEjected("host1:5200"))
+
+	pm.nodeFailure("host1:5200", nodeErr)
+	require.True(t, pm.health.isEjected("host1:5200"))
+
+	for _, key := range []string{"repo1", "repo2", "repo3", "repo4"} {
+		require.Equal(t, "host2:5200", pl.nodeHash.Get(key).Hostport())
+	}
+
+	// ejected nodes are not re-admitted by a successful proxied response
+	pm.health.reset("host1:5200")
+	require.True(t, pm.health.isEjected("host1:5200"))
+
+	for i := 0; i < healthyThreshold; i++ {
+		pm.nodeSuccess("host1:5200")
+	}
+	require.False(t, pm.health.isEjected("host1:5200"))
+
+	hostports := make(map[string]struct{})
+	for _, key := range []string{"repo1", "repo2", "repo3", "repo4", "repo5", "repo6", "repo7", "repo8"} {
+		hostports[pl.nodeHash.Get(key).Hostport()] = struct{}{}
+	}
+	require.Len(t, hostports, 2)
+
+	health := pm.health.list()
+	require.Len(t, health, 2)
+	require.Equal(t, "host1", health[0].Hostname)
+	require.Equal(t, 1, health[0].Ejections)
+}
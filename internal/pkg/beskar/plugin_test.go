@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/pkg/config"
+)
+
+func TestPluginAuthorizedWithoutAccessController(t *testing.T) {
+	pl := &plugin{
+		name:   "yum",
+		logger: logrus.NewEntry(logrus.New()),
+	}
+
+	for method, allowed := range map[string]bool{
+		http.MethodGet:    true,
+		http.MethodHead:   true,
+		http.MethodPost:   false,
+		http.MethodPut:    false,
+		http.MethodDelete: false,
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/artifacts/yum/api/v1/repository", nil)
+
+		_, ok := pl.authorized(w, r, "artifacts/yum/test")
+		require.Equal(t, allowed, ok, method)
+		if !allowed {
+			require.Equal(t, http.StatusForbidden, w.Code, method)
+		}
+	}
+
+	// sync requests are mutating
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/artifacts/yum/api/v1/repository/sync", nil)
+	_, ok := pl.authorized(w, r, "artifacts/yum/test")
+	require.False(t, ok)
+}
+
+func TestPluginAuthorizedWithPullToken(t *testing.T) {
+	ta, err := newTokenAuthenticator(config.TokenAuth{
+		Enabled:    true,
+		Service:    "beskar",
+		Issuer:     "beskar",
+		Secret:     "secret",
+		Expiration: time.Minute,
+	})
+	require.NoError(t, err)
+
+	pull, err := parseTokenScope("repository:artifacts/yum/test:pull")
+	require.NoError(t, err)
+
+	token, _, err := ta.issue("team-a", grantedAccess([]string{"repository:artifacts/yum/test:pull,push"}, []*tokenScope{pull}))
+	require.NoError(t, err)
+
+	pl := &plugin{
+		name:             "yum",
+		accessController: &accessController{tokenAuthenticator: ta},
+		logger:           logrus.NewEntry(logrus.New()),
+	}
+
+	for url, allowed := range map[string]bool{
+		"/artifacts/yum/api/v1/repository":             true,
+		"/artifacts/yum/api/v1/repository/sync:status": true,
+		"/artifacts/yum/api/v1/repository/sync":        false,
+		"/artifacts/yum/api/v1/repository/sync:url":    false,
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		_, ok := pl.authorized(w, r, "artifacts/yum/test")
+		require.Equal(t, allowed, ok, url)
+		if !allowed {
+			require.Equal(t, http.StatusUnauthorized, w.Code, url)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/util"
+	"go.ciq.dev/beskar/internal/pkg/config"
+)
+
+const authorizationPolicyQuery = "data.beskar.authz.allow"
+
+var errPolicyDenied = errors.New("denied by authorization policy")
+
+// authorizationPolicy evaluates an operator supplied Rego policy, the
+// policy receives the following input:
+//
+//	{
+//	  "user": "username or empty for anonymous requests",
+//	  "method": "HTTP request method",
+//	  "path": "HTTP request path",
+//	  "type": "resource type (repository, registry)",
+//	  "repository": "repository name",
+//	  "action": "pull, push, delete or *"
+//	}
+//
+// and must return a boolean for data.beskar.authz.allow, an undefined
+// result denies the request.
+type authorizationPolicy struct {
+	peq rego.PreparedEvalQuery
+}
+
+func newAuthorizationPolicy(policyConfig config.AuthPolicy) (*authorizationPolicy, error) {
+	peq, err := prepareRegoQuery(authorizationPolicyQuery, policyConfig.Rego, policyConfig.Data)
+	if err != nil {
+		return nil, fmt.Errorf("authorization policy: %w", err)
+	}
+
+	return &authorizationPolicy{
+		peq: peq,
+	}, nil
+}
+
+// prepareRegoQuery prepares the query of a Rego policy file with the
+// optional JSON file loaded as policy data.
+func prepareRegoQuery(query, regoPath, dataPath string) (rego.PreparedEvalQuery, error) {
+	module, err := os.ReadFile(regoPath)
+	if err != nil {
+		return rego.PreparedEvalQuery{}, fmt.Errorf("while reading policy: %w", err)
+	}
+
+	options := []func(*rego.Rego){
+		rego.Query(query),
+		rego.Module(filepath.Base(regoPath), string(module)),
+	}
+
+	if dataPath != "" {
+		var json map[string]interface{}
+
+		data, err := os.ReadFile(dataPath)
+		if err != nil {
+			return rego.PreparedEvalQuery{}, fmt.Errorf("while reading policy data: %w", err)
+		} else if err := util.UnmarshalJSON(data, &json); err != nil {
+			return rego.PreparedEvalQuery{}, fmt.Errorf("while decoding policy data: %w", err)
+		}
+
+		options = append(options, rego.Store(inmem.NewFromObject(json)))
+	}
+
+	peq, err := rego.New(options...).PrepareForEval(context.Background())
+	if err != nil {
+		return rego.PreparedEvalQuery{}, fmt.Errorf("while preparing policy: %w", err)
+	}
+
+	return peq, nil
+}
+
+type policyInput struct {
+	user         string
+	method       string
+	path         string
+	resourceType string
+	repository   string
+	action       string
+}
+
+func (ap *authorizationPolicy) allow(ctx context.Context, input policyInput) (bool, error) {
+	rs, err := ap.peq.Eval(ctx, rego.EvalInput(map[string]string{
+		"user":       input.user,
+		"method":     input.method,
+		"path":       input.path,
+		"type":       input.resourceType,
+		"repository": input.repository,
+		"action":     input.action,
+	}))
+	if err != nil {
+		return false, err
+	} else if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return false, nil
+	}
+
+	allowed, ok := rs[0].Expressions[0].Value.(bool)
+
+	return ok && allowed, nil
+}
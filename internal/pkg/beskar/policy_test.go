@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/pkg/config"
+)
+
+const testPolicy = `
+package beskar.authz
+
+import future.keywords.if
+import future.keywords.in
+
+default allow := false
+
+allow if {
+	input.action != "delete"
+}
+
+allow if {
+	input.action == "delete"
+	input.user in data.groups.release
+	glob.match("artifacts/yum/prod/*", ["/"], input.repository)
+}
+`
+
+func TestAuthorizationPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	regoFile := filepath.Join(dir, "policy.rego")
+	dataFile := filepath.Join(dir, "data.json")
+
+	require.NoError(t, os.WriteFile(regoFile, []byte(testPolicy), 0o600))
+	require.NoError(t, os.WriteFile(dataFile, []byte(`{"groups": {"release": ["alice"]}}`), 0o600))
+
+	policy, err := newAuthorizationPolicy(config.AuthPolicy{
+		Rego: regoFile,
+		Data: dataFile,
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		input   policyInput
+		allowed bool
+	}{
+		{
+			input:   policyInput{user: "bob", repository: "artifacts/yum/prod/repo", action: "push"},
+			allowed: true,
+		},
+		{
+			input:   policyInput{user: "bob", repository: "artifacts/yum/prod/repo", action: "delete"},
+			allowed: false,
+		},
+		{
+			input:   policyInput{user: "alice", repository: "artifacts/yum/prod/repo", action: "delete"},
+			allowed: true,
+		},
+		{
+			input:   policyInput{user: "alice", repository: "artifacts/yum/dev/repo", action: "delete"},
+			allowed: false,
+		},
+	} {
+		allowed, err := policy.allow(context.Background(), tc.input)
+		require.NoError(t, err)
+		require.Equal(t, tc.allowed, allowed, "%+v", tc.input)
+	}
+}
@@ -0,0 +1,575 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"go.ciq.dev/beskar/internal/pkg/config"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
+)
+
+const (
+	proxyResultHit   = "hit"
+	proxyResultMiss  = "miss"
+	proxyResultStale = "stale"
+)
+
+// proxyUpstream is an upstream OCI registry whose repositories are
+// pulled through and cached under a namespace.
+type proxyUpstream struct {
+	namespace string
+	url       string
+	registry  name.Registry
+	auth      authn.Authenticator
+	transport http.RoundTripper
+	ttl       time.Duration
+	logger    *logrus.Entry
+
+	refreshMutex sync.Mutex
+	// refreshed holds the last time tags were resolved from the
+	// upstream registry, keyed by repository and tag.
+	refreshed map[string]time.Time
+
+	inflightMutex sync.Mutex
+	// inflight holds the blobs being cached.
+	inflight map[digest.Digest]struct{}
+}
+
+func (pu *proxyUpstream) remoteOptions(ctx context.Context) []remote.Option {
+	return []remote.Option{
+		remote.WithAuth(pu.auth),
+		remote.WithTransport(pu.transport),
+		remote.WithContext(ctx),
+	}
+}
+
+// fresh returns true if the tag was resolved from the upstream registry
+// less than TTL ago.
+func (pu *proxyUpstream) fresh(repository, tag string) bool {
+	pu.refreshMutex.Lock()
+	defer pu.refreshMutex.Unlock()
+
+	refreshed, ok := pu.refreshed[repository+":"+tag]
+	return ok && time.Since(refreshed) < pu.ttl
+}
+
+func (pu *proxyUpstream) markRefreshed(repository, tag string) {
+	pu.refreshMutex.Lock()
+	defer pu.refreshMutex.Unlock()
+
+	pu.refreshed[repository+":"+tag] = time.Now()
+}
+
+// startCaching returns true if the blob is not already being cached
+// by a concurrent download.
+func (pu *proxyUpstream) startCaching(dgst digest.Digest) bool {
+	pu.inflightMutex.Lock()
+	defer pu.inflightMutex.Unlock()
+
+	if _, ok := pu.inflight[dgst]; ok {
+		return false
+	}
+	pu.inflight[dgst] = struct{}{}
+
+	return true
+}
+
+func (pu *proxyUpstream) doneCaching(dgst digest.Digest) {
+	pu.inflightMutex.Lock()
+	defer pu.inflightMutex.Unlock()
+
+	delete(pu.inflight, dgst)
+}
+
+// proxyManager maps repository namespaces to upstream registries.
+type proxyManager struct {
+	upstreams []*proxyUpstream
+}
+
+func newProxyManager(proxyConfig config.Proxy, logger *logrus.Entry) (*proxyManager, error) {
+	px := &proxyManager{
+		upstreams: make([]*proxyUpstream, 0, len(proxyConfig.Upstreams)),
+	}
+
+	for _, upstream := range proxyConfig.Upstreams {
+		u, err := url.Parse(upstream.URL)
+		if err != nil {
+			return nil, fmt.Errorf("proxy upstream %s: bad URL: %w", upstream.Namespace, err)
+		}
+
+		var nameOptions []name.Option
+		if u.Scheme == "http" {
+			nameOptions = append(nameOptions, name.Insecure)
+		}
+
+		registry, err := name.NewRegistry(u.Host, nameOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("proxy upstream %s: %w", upstream.Namespace, err)
+		}
+
+		auth := authn.Anonymous
+		if upstream.Username != "" || upstream.Password != "" {
+			auth = &authn.Basic{
+				Username: upstream.Username,
+				Password: upstream.Password,
+			}
+		}
+
+		px.upstreams = append(px.upstreams, &proxyUpstream{
+			namespace: upstream.Namespace,
+			url:       upstream.URL,
+			registry:  registry,
+			auth:      auth,
+			transport: tracing.Transport(http.DefaultTransport),
+			ttl:       upstream.TTL,
+			logger:    logger.WithField("upstream", upstream.Namespace),
+			refreshed: make(map[string]time.Time),
+			inflight:  make(map[digest.Digest]struct{}),
+		})
+	}
+
+	// nested namespaces must match first
+	sort.Slice(px.upstreams, func(i, j int) bool {
+		return len(px.upstreams[i].namespace) > len(px.upstreams[j].namespace)
+	})
+
+	return px, nil
+}
+
+// match returns the upstream registry the repository is pulled from
+// along with the upstream repository name.
+func (px *proxyManager) match(repository string) (*proxyUpstream, string) {
+	if px == nil {
+		return nil, ""
+	}
+
+	for _, upstream := range px.upstreams {
+		remoteName, ok := strings.CutPrefix(repository, upstream.namespace+"/")
+		if ok && remoteName != "" {
+			return upstream, remoteName
+		}
+	}
+
+	return nil, ""
+}
+
+func isUpstreamNotFound(err error) bool {
+	var transportErr *transport.Error
+	return errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound
+}
+
+// proxyRepository serves a repository cached from an upstream registry,
+// manifests and blobs missing locally are pulled through the upstream
+// registry and cached, except in maintenance mode where they are served
+// without being stored.
+type proxyRepository struct {
+	local    *RepositoryMiddleware
+	upstream *proxyUpstream
+	remote   name.Repository
+}
+
+func newProxyRepository(local *RepositoryMiddleware, upstream *proxyUpstream, remoteName string) *proxyRepository {
+	return &proxyRepository{
+		local:    local,
+		upstream: upstream,
+		remote:   upstream.registry.Repo(remoteName),
+	}
+}
+
+func (r *proxyRepository) readOnlyError() error {
+	return errcode.ErrorCodeDenied.WithMessage(
+		fmt.Sprintf("%s is a pull-through cache of %s and is read-only", r.Named().Name(), r.upstream.url),
+	)
+}
+
+// cacheable returns true if the content pulled from the upstream registry can be stored.
+func (r *proxyRepository) cacheable() bool {
+	return !r.local.maintenance.Enabled()
+}
+
+// Named returns the name of the repository.
+func (r *proxyRepository) Named() reference.Named {
+	return r.local.Named()
+}
+
+// Manifests returns the manifest service pulling missing manifests from the upstream registry.
+func (r *proxyRepository) Manifests(ctx context.Context, options ...distribution.ManifestServiceOption) (distribution.ManifestService, error) {
+	// manifests are cached before their layers
+	options = append(options, storage.SkipLayerVerification())
+
+	manifests, err := r.local.repository.Manifests(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxyManifestService{
+		ManifestService: manifests,
+		repository:      r,
+	}, nil
+}
+
+// Blobs returns the blob store pulling missing blobs from the upstream registry.
+func (r *proxyRepository) Blobs(ctx context.Context) distribution.BlobStore {
+	return &proxyBlobStore{
+		BlobStore:  r.local.Blobs(ctx),
+		repository: r,
+	}
+}
+
+// Tags returns the tag service resolving expired tags from the upstream registry.
+func (r *proxyRepository) Tags(ctx context.Context) distribution.TagService {
+	return &proxyTagService{
+		TagService: r.local.repository.Tags(ctx),
+		repository: r,
+	}
+}
+
+type proxyManifestService struct {
+	distribution.ManifestService
+	repository *proxyRepository
+}
+
+// Exists returns true if the manifest exists locally or in the upstream registry.
+func (ms *proxyManifestService) Exists(ctx context.Context, dgst digest.Digest) (bool, error) {
+	exists, err := ms.ManifestService.Exists(ctx, dgst)
+	if err != nil || exists {
+		return exists, err
+	}
+
+	r := ms.repository
+
+	_, err = remote.Head(r.remote.Digest(dgst.String()), r.upstream.remoteOptions(ctx)...)
+	if isUpstreamNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("while checking manifest %s from upstream: %w", dgst, err)
+	}
+
+	return true, nil
+}
+
+// Get returns the local manifest or pulls it from the upstream registry.
+func (ms *proxyManifestService) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
+	r := ms.repository
+
+	manifest, err := ms.ManifestService.Get(ctx, dgst, options...)
+	if err == nil {
+		proxyRequests.WithLabelValues(r.upstream.namespace, "manifest", proxyResultHit).Inc()
+		return manifest, nil
+	} else if !errors.As(err, &distribution.ErrManifestUnknownRevision{}) {
+		return nil, err
+	}
+
+	desc, err := remote.Get(r.remote.Digest(dgst.String()), r.upstream.remoteOptions(ctx)...)
+	if isUpstreamNotFound(err) {
+		return nil, distribution.ErrManifestUnknownRevision{
+			Name:     r.Named().Name(),
+			Revision: dgst,
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("while fetching manifest %s from upstream: %w", dgst, err)
+	}
+
+	proxyRequests.WithLabelValues(r.upstream.namespace, "manifest", proxyResultMiss).Inc()
+
+	manifest, _, err = distribution.UnmarshalManifest(string(desc.MediaType), desc.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("while decoding upstream manifest %s: %w", dgst, err)
+	}
+
+	if !r.cacheable() {
+		return manifest, nil
+	}
+
+	if _, err := ms.ManifestService.Put(ctx, manifest); err != nil {
+		r.upstream.logger.Errorf("failed to cache manifest %s@%s: %s", r.Named().Name(), dgst, err)
+		return manifest, nil
+	}
+
+	for _, option := range options {
+		if tagOption, ok := option.(distribution.WithTagOption); ok {
+			err := r.local.repository.Tags(ctx).Tag(ctx, tagOption.Tag, distribution.Descriptor{
+				MediaType: string(desc.MediaType),
+				Size:      desc.Size,
+				Digest:    dgst,
+			})
+			if err != nil {
+				r.upstream.logger.Errorf("failed to cache tag %s:%s: %s", r.Named().Name(), tagOption.Tag, err)
+			}
+		}
+	}
+
+	return manifest, nil
+}
+
+// Put rejects manifest pushes.
+func (ms *proxyManifestService) Put(context.Context, distribution.Manifest, ...distribution.ManifestServiceOption) (digest.Digest, error) {
+	return "", ms.repository.readOnlyError()
+}
+
+// Delete removes the manifest from the cache.
+func (ms *proxyManifestService) Delete(ctx context.Context, dgst digest.Digest) error {
+	if state := ms.repository.local.maintenance.Get(); state.Enabled {
+		return maintenanceError(state)
+	}
+	return ms.ManifestService.Delete(ctx, dgst)
+}
+
+type proxyTagService struct {
+	distribution.TagService
+	repository *proxyRepository
+}
+
+// Get resolves the tag from the upstream registry once the local tag
+// has expired, the local tag is served if the upstream registry fails.
+func (ts *proxyTagService) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
+	r := ts.repository
+	repository := r.Named().Name()
+
+	if r.upstream.fresh(repository, tag) {
+		if desc, err := ts.TagService.Get(ctx, tag); err == nil {
+			proxyRequests.WithLabelValues(r.upstream.namespace, "tag", proxyResultHit).Inc()
+			return desc, nil
+		}
+	}
+
+	upstreamDesc, err := remote.Head(r.remote.Tag(tag), r.upstream.remoteOptions(ctx)...)
+	if isUpstreamNotFound(err) {
+		return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
+	} else if err != nil {
+		desc, localErr := ts.TagService.Get(ctx, tag)
+		if localErr != nil {
+			return distribution.Descriptor{}, fmt.Errorf("while resolving tag %s from upstream: %w", tag, err)
+		}
+		r.upstream.logger.Warnf("serving cached tag %s:%s, upstream error: %s", repository, tag, err)
+		proxyRequests.WithLabelValues(r.upstream.namespace, "tag", proxyResultStale).Inc()
+		return desc, nil
+	}
+
+	r.upstream.markRefreshed(repository, tag)
+	proxyRequests.WithLabelValues(r.upstream.namespace, "tag", proxyResultMiss).Inc()
+
+	desc := distribution.Descriptor{
+		MediaType: string(upstreamDesc.MediaType),
+		Size:      upstreamDesc.Size,
+		Digest:    digest.Digest(upstreamDesc.Digest.String()),
+	}
+
+	// tags of manifests not cached yet are cached along with the manifest
+	if r.cacheable() {
+		manifests, err := r.local.repository.Manifests(ctx)
+		if err != nil {
+			return distribution.Descriptor{}, err
+		}
+		if exists, err := manifests.Exists(ctx, desc.Digest); err == nil && exists {
+			if err := ts.TagService.Tag(ctx, tag, desc); err != nil {
+				r.upstream.logger.Errorf("failed to cache tag %s:%s: %s", repository, tag, err)
+			}
+		}
+	}
+
+	return desc, nil
+}
+
+// Tag rejects tag pushes.
+func (ts *proxyTagService) Tag(context.Context, string, distribution.Descriptor) error {
+	return ts.repository.readOnlyError()
+}
+
+type proxyBlobStore struct {
+	distribution.BlobStore
+	repository *proxyRepository
+}
+
+// Stat returns the local blob descriptor or the upstream blob descriptor.
+func (bs *proxyBlobStore) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	desc, err := bs.BlobStore.Stat(ctx, dgst)
+	if !errors.Is(err, distribution.ErrBlobUnknown) {
+		return desc, err
+	}
+
+	r := bs.repository
+
+	layer, err := remote.Layer(r.remote.Digest(dgst.String()), r.upstream.remoteOptions(ctx)...)
+	if err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("while fetching blob %s from upstream: %w", dgst, err)
+	}
+	size, err := layer.Size()
+	if isUpstreamNotFound(err) {
+		return distribution.Descriptor{}, distribution.ErrBlobUnknown
+	} else if err != nil {
+		return distribution.Descriptor{}, fmt.Errorf("while checking blob %s from upstream: %w", dgst, err)
+	}
+
+	return distribution.Descriptor{
+		MediaType: "application/octet-stream",
+		Size:      size,
+		Digest:    dgst,
+	}, nil
+}
+
+// Get returns the local blob content or the upstream blob content, the
+// upstream blob is not cached.
+func (bs *proxyBlobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	p, err := bs.BlobStore.Get(ctx, dgst)
+	if !errors.Is(err, distribution.ErrBlobUnknown) {
+		return p, err
+	}
+
+	r := bs.repository
+
+	layer, err := remote.Layer(r.remote.Digest(dgst.String()), r.upstream.remoteOptions(ctx)...)
+	if err != nil {
+		return nil, fmt.Errorf("while fetching blob %s from upstream: %w", dgst, err)
+	}
+	rc, err := layer.Compressed()
+	if isUpstreamNotFound(err) {
+		return nil, distribution.ErrBlobUnknown
+	} else if err != nil {
+		return nil, fmt.Errorf("while fetching blob %s from upstream: %w", dgst, err)
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// ServeBlob serves the local blob or streams the upstream blob to the
+// client while caching it.
+func (bs *proxyBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter, req *http.Request, dgst digest.Digest) error {
+	r := bs.repository
+
+	if _, err := bs.BlobStore.Stat(ctx, dgst); err == nil {
+		proxyRequests.WithLabelValues(r.upstream.namespace, "blob", proxyResultHit).Inc()
+		return bs.BlobStore.ServeBlob(ctx, w, req, dgst)
+	} else if !errors.Is(err, distribution.ErrBlobUnknown) {
+		return err
+	}
+
+	layer, err := remote.Layer(r.remote.Digest(dgst.String()), r.upstream.remoteOptions(ctx)...)
+	if err != nil {
+		return fmt.Errorf("while fetching blob %s from upstream: %w", dgst, err)
+	}
+	size, err := layer.Size()
+	if isUpstreamNotFound(err) {
+		return distribution.ErrBlobUnknown
+	} else if err != nil {
+		return fmt.Errorf("while checking blob %s from upstream: %w", dgst, err)
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.Header().Set("Etag", dgst.String())
+
+	if req.Method == http.MethodHead {
+		return nil
+	}
+
+	rc, err := layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("while fetching blob %s from upstream: %w", dgst, err)
+	}
+	defer rc.Close()
+
+	proxyRequests.WithLabelValues(r.upstream.namespace, "blob", proxyResultMiss).Inc()
+
+	cw := bs.cacheWriter(ctx, dgst)
+	if cw == nil {
+		_, err := io.Copy(w, rc)
+		return err
+	}
+	defer r.upstream.doneCaching(dgst)
+
+	n, err := io.Copy(io.MultiWriter(w, cw), rc)
+	if err != nil || cw.err != nil {
+		if cancelErr := cw.Cancel(ctx); cancelErr != nil {
+			r.upstream.logger.Errorf("failed to cancel blob %s@%s caching: %s", r.Named().Name(), dgst, cancelErr)
+		}
+		if err == nil {
+			r.upstream.logger.Errorf("failed to cache blob %s@%s: %s", r.Named().Name(), dgst, cw.err)
+		}
+		return err
+	}
+
+	_, err = cw.Commit(ctx, distribution.Descriptor{
+		MediaType: "application/octet-stream",
+		Size:      n,
+		Digest:    dgst,
+	})
+	if err != nil {
+		r.upstream.logger.Errorf("failed to cache blob %s@%s: %s", r.Named().Name(), dgst, err)
+	}
+
+	return nil
+}
+
+// cacheWriter returns the writer caching the blob, it returns nil if the
+// blob can't be cached or is already being cached by another download.
+func (bs *proxyBlobStore) cacheWriter(ctx context.Context, dgst digest.Digest) *blobCacheWriter {
+	r := bs.repository
+
+	if !r.cacheable() || !r.upstream.startCaching(dgst) {
+		return nil
+	}
+
+	bw, err := bs.BlobStore.Create(ctx)
+	if err != nil {
+		r.upstream.doneCaching(dgst)
+		r.upstream.logger.Errorf("failed to cache blob %s@%s: %s", r.Named().Name(), dgst, err)
+		return nil
+	}
+
+	return &blobCacheWriter{BlobWriter: bw}
+}
+
+// Put rejects blob pushes.
+func (bs *proxyBlobStore) Put(context.Context, string, []byte) (distribution.Descriptor, error) {
+	return distribution.Descriptor{}, bs.repository.readOnlyError()
+}
+
+// Create rejects blob uploads.
+func (bs *proxyBlobStore) Create(context.Context, ...distribution.BlobCreateOption) (distribution.BlobWriter, error) {
+	return nil, bs.repository.readOnlyError()
+}
+
+// Resume rejects blob uploads.
+func (bs *proxyBlobStore) Resume(context.Context, string) (distribution.BlobWriter, error) {
+	return nil, bs.repository.readOnlyError()
+}
+
+// blobCacheWriter writes a blob pulled from an upstream registry to the
+// local storage, a write failure stops caching without interrupting the
+// download.
+type blobCacheWriter struct {
+	distribution.BlobWriter
+	err error
+}
+
+func (cw *blobCacheWriter) Write(p []byte) (int, error) {
+	if cw.err == nil {
+		_, cw.err = cw.BlobWriter.Write(p)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/pkg/config"
+)
+
+func TestProxyManagerMatch(t *testing.T) {
+	px, err := newProxyManager(config.Proxy{
+		Upstreams: []config.ProxyUpstream{
+			{Namespace: "proxy", URL: "https://registry.example.com", TTL: time.Hour},
+			{Namespace: "proxy/docker.io", URL: "https://registry-1.docker.io", TTL: time.Hour},
+			{Namespace: "proxy/local", URL: "http://127.0.0.1:5000", TTL: time.Hour},
+		},
+	}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+
+	upstream, remoteName := px.match("proxy/docker.io/library/alpine")
+	require.NotNil(t, upstream)
+	require.Equal(t, "proxy/docker.io", upstream.namespace)
+	require.Equal(t, "library/alpine", remoteName)
+	require.Equal(t, "registry-1.docker.io/library/alpine", upstream.registry.Repo(remoteName).String())
+
+	upstream, remoteName = px.match("proxy/quay/coreos/etcd")
+	require.NotNil(t, upstream)
+	require.Equal(t, "proxy", upstream.namespace)
+	require.Equal(t, "quay/coreos/etcd", remoteName)
+
+	upstream, _ = px.match("proxy/local/app")
+	require.NotNil(t, upstream)
+	require.Equal(t, "http", upstream.registry.Scheme())
+
+	upstream, _ = px.match("proxy/docker.io")
+	require.Equal(t, "proxy", upstream.namespace)
+
+	upstream, _ = px.match("artifacts/yum/rocky")
+	require.Nil(t, upstream)
+
+	var nilProxies *proxyManager
+	upstream, _ = nilProxies.match("proxy/docker.io/library/alpine")
+	require.Nil(t, upstream)
+}
+
+func TestProxyUpstreamFresh(t *testing.T) {
+	upstream := &proxyUpstream{
+		ttl:       time.Hour,
+		refreshed: make(map[string]time.Time),
+	}
+
+	require.False(t, upstream.fresh("proxy/docker.io/library/alpine", "latest"))
+	upstream.markRefreshed("proxy/docker.io/library/alpine", "latest")
+	require.True(t, upstream.fresh("proxy/docker.io/library/alpine", "latest"))
+	require.False(t, upstream.fresh("proxy/docker.io/library/alpine", "3.19"))
+
+	upstream.ttl = 0
+	require.False(t, upstream.fresh("proxy/docker.io/library/alpine", "latest"))
+}
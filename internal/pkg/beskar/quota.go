@@ -0,0 +1,461 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/registry/storage"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"go.ciq.dev/beskar/internal/pkg/config"
+)
+
+// quotaUsageTTL is the duration after which the namespace usage is
+// recomputed from storage, in between the usage is updated locally with
+// the manifests pushed and deleted through this instance.
+const quotaUsageTTL = 5 * time.Minute
+
+// quotaReservationTTL is the duration after which the bytes reserved for
+// a committed blob are released if no manifest referencing it was pushed.
+const quotaReservationTTL = time.Hour
+
+// namespaceUsage reports the storage usage of a repository namespace.
+type namespaceUsage struct {
+	Namespace     string    `json:"namespace"`
+	Bytes         int64     `json:"bytes"`
+	ReservedBytes int64     `json:"reservedBytes,omitempty"`
+	Artifacts     int64     `json:"artifacts"`
+	MaxBytes      int64     `json:"maxBytes,omitempty"`
+	MaxArtifacts  int64     `json:"maxArtifacts,omitempty"`
+	UpdateTime    time.Time `json:"updateTime"`
+}
+
+// blobReservation holds the bytes reserved for a committed blob until a
+// manifest referencing it is pushed.
+type blobReservation struct {
+	size       int64
+	expiration time.Time
+}
+
+type quotaUsage struct {
+	sync.Mutex
+	quota      config.Quota
+	bytes      int64
+	artifacts  int64
+	updateTime time.Time
+
+	// reservations are not part of the usage computed from storage
+	// which only accounts for the blobs referenced by manifests
+	reserved     int64
+	reservations map[digest.Digest]blobReservation
+}
+
+func (qu *quotaUsage) report() *namespaceUsage {
+	return &namespaceUsage{
+		Namespace:     qu.quota.Namespace,
+		Bytes:         qu.bytes,
+		ReservedBytes: qu.reserved,
+		Artifacts:     qu.artifacts,
+		MaxBytes:      qu.quota.MaxBytes,
+		MaxArtifacts:  qu.quota.MaxArtifacts,
+		UpdateTime:    qu.updateTime,
+	}
+}
+
+// quotaManager enforces the per namespace quotas. The size of committed
+// blobs is reserved until a manifest referencing them is pushed, then the
+// manifest size and artifact replace the reservations. Limits are checked
+// and usages updated under the usage locks, concurrent pushes can't exceed
+// the quotas of the namespaces.
+type quotaManager struct {
+	driver storagedriver.StorageDriver
+	logger *logrus.Entry
+	usages []*quotaUsage
+}
+
+// newQuotaManager returns a quota manager for the configured quotas, it
+// returns nil if there is no quota configured.
+func newQuotaManager(quotas []config.Quota, driver storagedriver.StorageDriver, logger *logrus.Entry) *quotaManager {
+	if len(quotas) == 0 {
+		return nil
+	}
+
+	qm := &quotaManager{
+		driver: driver,
+		logger: logger,
+	}
+	for _, quota := range quotas {
+		qm.usages = append(qm.usages, &quotaUsage{
+			quota:        quota,
+			reservations: make(map[digest.Digest]blobReservation),
+		})
+	}
+
+	return qm
+}
+
+func inNamespace(namespace, repository string) bool {
+	return repository == namespace || strings.HasPrefix(repository, namespace+"/")
+}
+
+// match returns the usages of the namespaces containing the repository,
+// they are always returned in the same order to lock them without deadlock.
+func (qm *quotaManager) match(repository string) []*quotaUsage {
+	if qm == nil {
+		return nil
+	}
+
+	var usages []*quotaUsage
+
+	for _, usage := range qm.usages {
+		if inNamespace(usage.quota.Namespace, repository) {
+			usages = append(usages, usage)
+		}
+	}
+
+	return usages
+}
+
+// refresh recomputes the usage from storage if it has expired, the
+// usage lock must be held.
+func (qm *quotaManager) refresh(ctx context.Context, usage *quotaUsage) error {
+	if time.Since(usage.updateTime) < quotaUsageTTL {
+		return nil
+	}
+
+	report, err := computeNamespaceUsage(ctx, qm.driver, usage.quota.Namespace)
+	if err != nil {
+		return err
+	}
+
+	usage.bytes = report.Bytes
+	usage.artifacts = report.Artifacts
+	usage.updateTime = report.UpdateTime
+
+	return nil
+}
+
+// lock locks the usages and refreshes them, the returned function unlocks them.
+func (qm *quotaManager) lock(ctx context.Context, usages []*quotaUsage) (func(), error) {
+	unlock := func() {
+		for _, usage := range usages {
+			usage.Unlock()
+		}
+	}
+
+	for _, usage := range usages {
+		usage.Lock()
+	}
+
+	now := time.Now()
+
+	for _, usage := range usages {
+		if err := qm.refresh(ctx, usage); err != nil {
+			unlock()
+			return nil, fmt.Errorf("while computing %s namespace usage: %w", usage.quota.Namespace, err)
+		}
+		for dgst, reservation := range usage.reservations {
+			if now.After(reservation.expiration) {
+				usage.reserved -= reservation.size
+				delete(usage.reservations, dgst)
+			}
+		}
+	}
+
+	return unlock, nil
+}
+
+// checkUsage verifies that adding bytes and artifacts doesn't exceed the
+// quota, it returns a DENIED error otherwise. The usage lock must be held.
+func checkUsage(usage *quotaUsage, bytes, artifacts int64) error {
+	quota := usage.quota
+
+	if used := usage.bytes + usage.reserved; quota.MaxBytes > 0 && used+bytes > quota.MaxBytes {
+		return errcode.ErrorCodeDenied.WithMessage(
+			fmt.Sprintf("storage quota exceeded for namespace %s: %d/%d bytes used", quota.Namespace, used, quota.MaxBytes),
+		)
+	} else if quota.MaxArtifacts > 0 && usage.artifacts+artifacts > quota.MaxArtifacts {
+		return errcode.ErrorCodeDenied.WithMessage(
+			fmt.Sprintf("artifact quota exceeded for namespace %s: %d/%d artifacts", quota.Namespace, usage.artifacts, quota.MaxArtifacts),
+		)
+	}
+
+	return nil
+}
+
+// reserveBlob reserves the blob size in the namespaces containing the
+// repository, it returns a DENIED error if a quota would be exceeded.
+func (qm *quotaManager) reserveBlob(ctx context.Context, repository string, dgst digest.Digest, size int64) error {
+	usages := qm.match(repository)
+
+	unlock, err := qm.lock(ctx, usages)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, usage := range usages {
+		if _, ok := usage.reservations[dgst]; ok {
+			continue
+		} else if err := checkUsage(usage, size, 0); err != nil {
+			return err
+		}
+	}
+
+	expiration := time.Now().Add(quotaReservationTTL)
+
+	for _, usage := range usages {
+		if reservation, ok := usage.reservations[dgst]; ok {
+			reservation.expiration = expiration
+			usage.reservations[dgst] = reservation
+			continue
+		}
+		usage.reservations[dgst] = blobReservation{
+			size:       size,
+			expiration: expiration,
+		}
+		usage.reserved += size
+	}
+
+	return nil
+}
+
+// releaseBlob releases the blob reservation in the namespaces containing
+// the repository.
+func (qm *quotaManager) releaseBlob(repository string, dgst digest.Digest) {
+	for _, usage := range qm.match(repository) {
+		usage.Lock()
+		if reservation, ok := usage.reservations[dgst]; ok {
+			usage.reserved -= reservation.size
+			delete(usage.reservations, dgst)
+		}
+		usage.Unlock()
+	}
+}
+
+// reserve adds bytes and artifacts to the usage of the namespaces containing
+// the repository, it returns a DENIED error if a quota would be exceeded. The
+// reservations of the given blobs are released as their size is part of the
+// added bytes. The reserved bytes and artifacts must be removed with update
+// if the manifest couldn't be stored.
+func (qm *quotaManager) reserve(ctx context.Context, repository string, bytes, artifacts int64, blobs []digest.Digest) error {
+	usages := qm.match(repository)
+
+	unlock, err := qm.lock(ctx, usages)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, usage := range usages {
+		released := int64(0)
+		for _, dgst := range blobs {
+			released += usage.reservations[dgst].size
+		}
+		if err := checkUsage(usage, bytes-released, artifacts); err != nil {
+			return err
+		}
+	}
+
+	for _, usage := range usages {
+		for _, dgst := range blobs {
+			if reservation, ok := usage.reservations[dgst]; ok {
+				usage.reserved -= reservation.size
+				delete(usage.reservations, dgst)
+			}
+		}
+		usage.bytes += bytes
+		usage.artifacts += artifacts
+	}
+
+	return nil
+}
+
+// update adds bytes and artifacts, possibly negative, to the usage of the
+// namespaces containing the repository.
+func (qm *quotaManager) update(repository string, bytes, artifacts int64) {
+	for _, usage := range qm.match(repository) {
+		usage.Lock()
+		// the next refresh will compute it from storage
+		if !usage.updateTime.IsZero() {
+			usage.bytes += bytes
+			usage.artifacts += artifacts
+		}
+		usage.Unlock()
+	}
+}
+
+// usage returns the usage of the configured quotas.
+func (qm *quotaManager) usage(ctx context.Context) ([]*namespaceUsage, error) {
+	reports := make([]*namespaceUsage, 0)
+
+	if qm == nil {
+		return reports, nil
+	}
+
+	for _, usage := range qm.usages {
+		usage.Lock()
+		err := qm.refresh(ctx, usage)
+		report := usage.report()
+		usage.Unlock()
+
+		if err != nil {
+			return nil, fmt.Errorf("while computing %s namespace usage: %w", usage.quota.Namespace, err)
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// computeNamespaceUsage walks the manifests of the namespace repositories
+// and sums the size of the blobs they reference.
+func computeNamespaceUsage(ctx context.Context, driver storagedriver.StorageDriver, namespace string) (*namespaceUsage, error) {
+	registry, err := storage.NewRegistry(ctx, driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct registry: %w", err)
+	}
+
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	report := &namespaceUsage{
+		Namespace:  namespace,
+		UpdateTime: time.Now().UTC(),
+	}
+
+	err = repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		if !inNamespace(namespace, repoName) {
+			return nil
+		}
+
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repository name %s: %w", repoName, err)
+		}
+		repo, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository %s: %w", repoName, err)
+		}
+		manifestService, err := repo.Manifests(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to construct manifest service for %s: %w", repoName, err)
+		}
+		manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert ManifestService to ManifestEnumerator")
+		}
+
+		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+			manifest, err := manifestService.Get(ctx, dgst)
+			if err != nil {
+				return err
+			}
+			report.Bytes += manifestSize(manifest)
+			report.Artifacts++
+			return nil
+		})
+		if err != nil && !errors.As(err, &distribution.ErrRepositoryUnknown{}) {
+			return fmt.Errorf("failed to enumerate manifests of %s: %w", repoName, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// manifestSize returns the size of the blobs referenced by the manifest.
+func manifestSize(manifest distribution.Manifest) int64 {
+	size := int64(0)
+	for _, desc := range manifest.References() {
+		size += desc.Size
+	}
+	return size
+}
+
+// quotaBlobStore rejects blobs exceeding the namespace quotas.
+type quotaBlobStore struct {
+	distribution.BlobStore
+	repository string
+	quotas     *quotaManager
+}
+
+// Put reserves the blob size before storing the blob.
+func (bs *quotaBlobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
+	dgst := digest.FromBytes(p)
+
+	if err := bs.quotas.reserveBlob(ctx, bs.repository, dgst, int64(len(p))); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	desc, err := bs.BlobStore.Put(ctx, mediaType, p)
+	if err != nil {
+		bs.quotas.releaseBlob(bs.repository, dgst)
+		return distribution.Descriptor{}, err
+	}
+
+	return desc, nil
+}
+
+// Create returns a blob writer reserving the blob size on commit.
+func (bs *quotaBlobStore) Create(ctx context.Context, options ...distribution.BlobCreateOption) (distribution.BlobWriter, error) {
+	bw, err := bs.BlobStore.Create(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaBlobWriter{BlobWriter: bw, blobStore: bs}, nil
+}
+
+// Resume returns a blob writer reserving the blob size on commit.
+func (bs *quotaBlobStore) Resume(ctx context.Context, id string) (distribution.BlobWriter, error) {
+	bw, err := bs.BlobStore.Resume(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaBlobWriter{BlobWriter: bw, blobStore: bs}, nil
+}
+
+type quotaBlobWriter struct {
+	distribution.BlobWriter
+	blobStore *quotaBlobStore
+}
+
+// Commit reserves the blob size before committing the blob, the upload
+// is canceled when quotas are exceeded.
+func (bw *quotaBlobWriter) Commit(ctx context.Context, provisional distribution.Descriptor) (distribution.Descriptor, error) {
+	quotas := bw.blobStore.quotas
+	repository := bw.blobStore.repository
+
+	if err := quotas.reserveBlob(ctx, repository, provisional.Digest, bw.Size()); err != nil {
+		if cancelErr := bw.Cancel(ctx); cancelErr != nil {
+			quotas.logger.Errorf("failed to cancel blob upload for %s: %s", repository, cancelErr)
+		}
+		return distribution.Descriptor{}, err
+	}
+
+	desc, err := bw.BlobWriter.Commit(ctx, provisional)
+	if err != nil {
+		quotas.releaseBlob(repository, provisional.Digest)
+		return distribution.Descriptor{}, err
+	}
+
+	return desc, nil
+}
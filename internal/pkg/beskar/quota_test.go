@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/distribution/distribution/v3"
+	"github.com/distribution/distribution/v3/manifest/schema2"
+	"github.com/distribution/distribution/v3/registry/api/errcode"
+	"github.com/distribution/distribution/v3/registry/storage"
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/distribution/distribution/v3/testutil"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/pkg/config"
+)
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+
+	registry, err := storage.NewRegistry(ctx, driver)
+	require.NoError(t, err)
+
+	named, err := reference.WithName("artifacts/static/team-x/files")
+	require.NoError(t, err)
+
+	repo, err := registry.Repository(ctx, named)
+	require.NoError(t, err)
+
+	layers, err := testutil.CreateRandomLayers(2)
+	require.NoError(t, err)
+	require.NoError(t, testutil.UploadBlobs(repo, layers))
+
+	// testutil.MakeSchema2Manifest doesn't set the layer sizes
+	configDesc, err := repo.Blobs(ctx).Put(ctx, schema2.MediaTypeImageConfig, []byte("{}"))
+	require.NoError(t, err)
+
+	builder := schema2.NewManifestBuilder(configDesc, []byte("{}"))
+	for dgst := range layers {
+		desc, err := repo.Blobs(ctx).Stat(ctx, dgst)
+		require.NoError(t, err)
+		require.NoError(t, builder.AppendReference(desc))
+	}
+
+	manifest, err := builder.Build(ctx)
+	require.NoError(t, err)
+
+	manifestService, err := repo.Manifests(ctx)
+	require.NoError(t, err)
+
+	_, err = manifestService.Put(ctx, manifest)
+	require.NoError(t, err)
+
+	size := manifestSize(manifest)
+	require.Greater(t, size, int64(0))
+
+	usage, err := computeNamespaceUsage(ctx, driver, "artifacts/static/team-x")
+	require.NoError(t, err)
+	require.Equal(t, size, usage.Bytes)
+	require.Equal(t, int64(1), usage.Artifacts)
+
+	usage, err = computeNamespaceUsage(ctx, driver, "artifacts/static/team")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), usage.Artifacts)
+
+	quotas := newQuotaManager([]config.Quota{
+		{
+			Namespace:    "artifacts/static/team-x",
+			MaxBytes:     size + 10,
+			MaxArtifacts: 2,
+		},
+	}, driver, logrus.NewEntry(logrus.New()))
+
+	require.NoError(t, quotas.reserve(ctx, "artifacts/static/team-y/files", size*10, 10, nil))
+
+	// committed blobs are reserved until a manifest references them
+	blobStore := &quotaBlobStore{
+		BlobStore:  repo.Blobs(ctx),
+		repository: named.Name(),
+		quotas:     quotas,
+	}
+	blob := []byte("0123456789")
+	blobDigest := digest.FromBytes(blob)
+
+	bw, err := blobStore.Create(ctx)
+	require.NoError(t, err)
+	_, err = bw.Write(blob)
+	require.NoError(t, err)
+	require.NoError(t, bw.Close())
+
+	// like a chunked upload finished by a PUT request
+	bw, err = blobStore.Resume(ctx, bw.ID())
+	require.NoError(t, err)
+	_, err = bw.Commit(ctx, distribution.Descriptor{Digest: blobDigest})
+	require.NoError(t, err)
+
+	usages, err := quotas.usage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, size, usages[0].Bytes)
+	require.Equal(t, int64(10), usages[0].ReservedBytes)
+
+	err = quotas.reserveBlob(ctx, "artifacts/static/team-x/files", digest.FromString("other"), 1)
+	var errCode errcode.Error
+	require.True(t, errors.As(err, &errCode))
+	require.Equal(t, errcode.ErrorCodeDenied, errCode.Code)
+
+	// the manifest size replaces the blob reservation
+	require.NoError(t, quotas.reserve(ctx, "artifacts/static/team-x/files", 10, 1, []digest.Digest{blobDigest}))
+
+	usages, err = quotas.usage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, size+10, usages[0].Bytes)
+	require.Zero(t, usages[0].ReservedBytes)
+	require.Equal(t, int64(2), usages[0].Artifacts)
+
+	err = quotas.reserve(ctx, "artifacts/static/team-x/files", 0, 1, nil)
+	require.True(t, errors.As(err, &errCode))
+	require.Equal(t, errcode.ErrorCodeDenied, errCode.Code)
+
+	// concurrent reservations can't exceed the quota
+	quotas.update("artifacts/static/team-x/files", -10, -1)
+
+	var (
+		wg       sync.WaitGroup
+		reserved atomic.Int64
+	)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if quotas.reserveBlob(ctx, "artifacts/static/team-x/files", digest.FromString(strconv.Itoa(i)), 1) == nil {
+				reserved.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, int64(10), reserved.Load())
+}
@@ -14,31 +14,39 @@ import (
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"os"
+	"path"
 	"reflect"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/distribution/v3/registry"
 	"github.com/distribution/distribution/v3/registry/auth"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/gorilla/mux"
 	"github.com/hashicorp/memberlist"
 	"github.com/mailgun/groupcache/v2"
 	"github.com/opencontainers/go-digest"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"go.ciq.dev/beskar/internal/pkg/cache"
 	"go.ciq.dev/beskar/internal/pkg/cmux"
 	"go.ciq.dev/beskar/internal/pkg/config"
 	"go.ciq.dev/beskar/internal/pkg/gossip"
+	"go.ciq.dev/beskar/internal/pkg/maintenance"
+	"go.ciq.dev/beskar/internal/pkg/metrics"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
+	"go.ciq.dev/beskar/internal/pkg/webhook"
 	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
 	"go.ciq.dev/beskar/pkg/mtls"
 	"go.ciq.dev/beskar/pkg/netutil"
 	"go.ciq.dev/beskar/pkg/sighandler"
 	"go.ciq.dev/beskar/pkg/version"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/trace/noop"
 
 	// load distribution filesystem storage driver
 	_ "github.com/distribution/distribution/v3/registry/storage/driver/filesystem"
@@ -56,17 +64,34 @@ import (
 var serverPluginContextKey int
 
 type Registry struct {
-	registry       distribution.Namespace
-	beskarConfig   *config.BeskarConfig
-	router         *mux.Router
-	server         *http.Server
-	member         *gossip.Member
-	manifestCache  *cache.GroupCache
-	pluginManager  *pluginManager
-	errCh          chan error
-	logger         *logrus.Entry
-	wait           sighandler.WaitFunc
-	hashedHostname string
+	registry         distribution.Namespace
+	beskarConfig     atomic.Pointer[config.BeskarConfig]
+	router           *mux.Router
+	server           *http.Server
+	member           *gossip.Member
+	manifestCache    *cache.GroupCache
+	pluginManager    *pluginManager
+	errCh            chan error
+	logger           *logrus.Entry
+	wait             sighandler.WaitFunc
+	hashedHostname   string
+	accessController *accessController
+	shutdownTracing  tracing.ShutdownFunc
+	outbox           *outbox
+	webhook          *webhook.Notifier
+	driver           storagedriver.StorageDriver
+	manifestGroup    *manifestCache
+	gcMutex          sync.Mutex
+	gcReport         atomic.Pointer[gcReport]
+	quotas           *quotaManager
+	audit            *auditLog
+	reloader         configReloader
+	maintenance      *maintenance.Mode
+	maintenanceMutex sync.Mutex
+	proxies          *proxyManager
+	replicator       *replicator
+	admission        *admissionController
+	blobCache        *blobCache
 }
 
 //nolint:gochecknoinits
@@ -81,11 +106,15 @@ func init() {
 	http.DefaultTransport = transport
 }
 
-func New(beskarConfig *config.BeskarConfig) (context.Context, *Registry, error) {
+// New returns a beskar registry for the configuration parsed from the
+// configuration directory, the directory is used to reload the configuration.
+func New(beskarConfig *config.BeskarConfig, configDir string) (context.Context, *Registry, error) {
 	beskarRegistry := &Registry{
-		beskarConfig: beskarConfig,
-		errCh:        make(chan error, 1),
+		errCh:       make(chan error, 1),
+		maintenance: &maintenance.Mode{},
 	}
+	beskarRegistry.beskarConfig.Store(beskarConfig)
+	beskarRegistry.reloader.dir = configDir
 
 	ctx, waitFunc := sighandler.New(beskarRegistry.errCh, syscall.SIGINT)
 	beskarRegistry.wait = waitFunc
@@ -95,12 +124,74 @@ func New(beskarConfig *config.BeskarConfig) (context.Context, *Registry, error)
 
 	// for probes
 	beskarRegistry.router.Handle("/", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	beskarRegistry.router.Handle("/metrics", metrics.Handler())
 
-	err := registerRegistryMiddleware(beskarRegistry, func(registry distribution.Namespace) *pluginManager {
+	nodeName, err := os.Hostname()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	beskarRegistry.webhook, err = webhook.New(
+		"/beskar",
+		beskarConfig.Webhooks,
+		webhook.WithErrorHandler(func(endpoint string, event *webhook.CloudEvent, err error) {
+			beskarRegistry.logger.Errorf("webhook %s delivery error for %s event on %s: %s", endpoint, event.Type, event.Subject, err)
+		}),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	beskarRegistry.proxies, err = newProxyManager(beskarConfig.Proxy, beskarRegistry.logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	beskarRegistry.blobCache, err = newBlobCache(beskarConfig.Cache.Blobs, beskarRegistry.logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	beskarRegistry.admission, err = newAdmissionController(beskarConfig.Admission, beskarRegistry.logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	beskarRegistry.replicator, err = newReplicator(beskarConfig.Replication, beskarRegistry.logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	trustedProxies, err := parseTrustedProxies(beskarConfig.Audit.TrustedProxies)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = registerRegistryMiddleware(beskarRegistry, func(registry distribution.Namespace, driver storagedriver.StorageDriver) registryServices {
 		beskarRegistry.registry = registry
+		beskarRegistry.driver = driver
+		beskarRegistry.outbox = newOutbox(driver, nodeName, beskarRegistry.logger)
+		beskarRegistry.replicator.setStorage(driver, nodeName)
 		beskarRegistry.pluginManager = newPluginManager(registry, beskarRegistry.logger)
+		beskarRegistry.quotas = newQuotaManager(beskarConfig.Quotas, driver, beskarRegistry.logger)
+		beskarRegistry.audit = newAuditLog(driver, nodeName, trustedProxies, beskarRegistry.logger)
+		beskarRegistry.pluginManager.setAuditLog(beskarRegistry.audit)
+		beskarRegistry.pluginManager.setMaintenanceMode(beskarRegistry.maintenance)
+		beskarRegistry.pluginManager.setBodyLimit(beskarConfig.Router.BodyLimit)
+		beskarRegistry.admission.pluginManager = beskarRegistry.pluginManager
+		if beskarRegistry.blobCache != nil {
+			beskarRegistry.blobCache.registry = registry
+		}
 		beskarRegistry.router.PathPrefix(artifactsPath).Handler(beskarRegistry.pluginManager)
-		return beskarRegistry.pluginManager
+		return registryServices{
+			pluginManager: beskarRegistry.pluginManager,
+			quotas:        beskarRegistry.quotas,
+			audit:         beskarRegistry.audit,
+			maintenance:   beskarRegistry.maintenance,
+			proxies:       beskarRegistry.proxies,
+			admission:     beskarRegistry.admission,
+			blobCache:     beskarRegistry.blobCache,
+		}
 	})
 	if err != nil {
 		return nil, nil, err
@@ -110,17 +201,43 @@ func New(beskarConfig *config.BeskarConfig) (context.Context, *Registry, error)
 	s := md5.Sum([]byte(beskarConfig.Hostname))
 	beskarRegistry.hashedHostname = hex.EncodeToString(s[:])
 
-	if err := auth.Register("beskar", newAccessController(beskarRegistry.hashedHostname)); err != nil {
+	accessControllerInit := newAccessController(
+		beskarRegistry.hashedHostname,
+		beskarConfig.Auth,
+		func(ac *accessController) {
+			beskarRegistry.accessController = ac
+		},
+	)
+	if err := auth.Register("beskar", accessControllerInit); err != nil {
 		return nil, nil, err
 	}
 
+	beskarRegistry.initAdminRouter()
+
+	if beskarConfig.Auth.Token.Enabled {
+		beskarRegistry.router.Handle(tokenPath, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if beskarRegistry.accessController == nil || beskarRegistry.accessController.tokenAuthenticator == nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			beskarRegistry.accessController.serveToken(w, r)
+		}))
+	}
+
 	registryServer, err := registry.NewRegistry(ctx, beskarConfig.Registry)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// TODO: allow to enable/disable tracing
-	otel.SetTracerProvider(noop.NewTracerProvider())
+	if beskarRegistry.pluginManager != nil && beskarRegistry.accessController != nil {
+		beskarRegistry.pluginManager.setAccessController(beskarRegistry.accessController)
+	}
+
+	// override the tracer provider set by the registry
+	beskarRegistry.shutdownTracing, err = tracing.Init(ctx, "beskar", version.Semver, beskarConfig.Tracing)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	reflectServer := reflect.ValueOf(registryServer).Elem().FieldByName("server")
 	if reflectServer.IsZero() || reflectServer.IsNil() {
@@ -165,7 +282,11 @@ func (br *Registry) startGossipWatcher() {
 
 			if self.Port != node.Port || !self.Addr.Equal(node.Addr) {
 				meta := gossip.NewBeskarMeta()
-				if err := meta.Decode(node.Meta); err == nil && meta.Ready {
+				err := meta.Decode(node.Meta)
+				if err == nil && meta.InstanceType == gossip.BeskarInstance {
+					br.mergeMaintenance(meta.Maintenance)
+				}
+				if err == nil && meta.Ready {
 					switch meta.InstanceType {
 					case gossip.BeskarInstance:
 						peer := net.JoinHostPort(node.Addr.String(), strconv.Itoa(int(meta.ServicePort)))
@@ -173,8 +294,10 @@ func (br *Registry) startGossipWatcher() {
 						br.logger.Debugf("Added groupcache peer %s", peer)
 					case gossip.PluginInstance:
 						br.logger.Infof("Register plugin")
-						if err := br.pluginManager.register(node, meta, br.beskarConfig); err != nil {
+						if err := br.pluginManager.register(node, meta); err != nil {
 							br.logger.Errorf("plugin register error: %s", err)
+						} else {
+							br.outbox.wake()
 						}
 					}
 				}
@@ -189,7 +312,11 @@ func (br *Registry) startGossipWatcher() {
 
 			if self.Port != node.Port || !self.Addr.Equal(node.Addr) {
 				meta := gossip.NewBeskarMeta()
-				if err := meta.Decode(node.Meta); err == nil && meta.Ready {
+				err := meta.Decode(node.Meta)
+				if err == nil && meta.InstanceType == gossip.BeskarInstance {
+					br.mergeMaintenance(meta.Maintenance)
+				}
+				if err == nil && meta.Ready {
 					switch meta.InstanceType {
 					case gossip.BeskarInstance:
 						peer := net.JoinHostPort(node.Addr.String(), strconv.Itoa(int(meta.ServicePort)))
@@ -197,8 +324,10 @@ func (br *Registry) startGossipWatcher() {
 						br.logger.Debugf("Added groupcache peer %s", peer)
 					case gossip.PluginInstance:
 						br.logger.Infof("Register plugin")
-						if err := br.pluginManager.register(node, meta, br.beskarConfig); err != nil {
+						if err := br.pluginManager.register(node, meta); err != nil {
 							br.logger.Errorf("plugin register error: %s", err)
+						} else {
+							br.outbox.wake()
 						}
 					}
 				}
@@ -232,7 +361,7 @@ func (br *Registry) startGossipWatcher() {
 func (br *Registry) initGossip() (_ *mtls.CAPEM, errFn error) {
 	br.logger.Info("Initializing gossip")
 
-	_, port, err := net.SplitHostPort(br.beskarConfig.Cache.Addr)
+	_, port, err := net.SplitHostPort(br.runningConfig().Cache.Addr)
 	if err != nil {
 		return nil, err
 	}
@@ -241,7 +370,7 @@ func (br *Registry) initGossip() (_ *mtls.CAPEM, errFn error) {
 		return nil, err
 	}
 
-	_, port, err = net.SplitHostPort(br.beskarConfig.Registry.HTTP.Addr)
+	_, port, err = net.SplitHostPort(br.runningConfig().Registry.HTTP.Addr)
 	if err != nil {
 		return nil, err
 	}
@@ -254,9 +383,10 @@ func (br *Registry) initGossip() (_ *mtls.CAPEM, errFn error) {
 	meta.ServicePort = uint16(cachePort)
 	meta.RegistryPort = uint16(registryPort)
 	meta.InstanceType = gossip.BeskarInstance
-	meta.Hostname = br.beskarConfig.Hostname
+	meta.Hostname = br.runningConfig().Hostname
+	meta.Maintenance = br.maintenance.Get()
 
-	br.member, err = gossip.Start(br.beskarConfig.Gossip, meta, nil, 300*time.Second)
+	br.member, err = gossip.Start(br.runningConfig().Gossip, meta, nil, 300*time.Second)
 	if err != nil {
 		return nil, err
 	}
@@ -297,7 +427,7 @@ func (br *Registry) initMTLS(ln net.Listener, caPEM *mtls.CAPEM, tlsConfig *tls.
 		time.Now().AddDate(10, 0, 0),
 		mtls.WithCertRequestIPs(localIPs...),
 		mtls.WithCertRequestHostnames(
-			br.beskarConfig.Hostname,
+			br.runningConfig().Hostname,
 			br.hashedHostname,
 		),
 	)
@@ -348,7 +478,7 @@ func (br *Registry) initManifestCache(caPEM *mtls.CAPEM) (_ *groupcache.Group, e
 		return nil, fmt.Errorf("while generating cache server mTLS certificates: %w", err)
 	}
 
-	_, port, err := net.SplitHostPort(br.beskarConfig.Cache.Addr)
+	_, port, err := net.SplitHostPort(br.runningConfig().Cache.Addr)
 	if err != nil {
 		return nil, err
 	}
@@ -365,6 +495,15 @@ func (br *Registry) initManifestCache(caPEM *mtls.CAPEM) (_ *groupcache.Group, e
 		},
 	})
 
+	// peers may have to fetch blobs from the storage before returning them
+	blobTransport := transport.Clone()
+	blobTransport.ResponseHeaderTimeout = blobCachePeerTimeout
+	br.blobCache.setPeers(br.manifestCache, blobTransport)
+
+	if err := prometheus.Register(br.manifestCache); err != nil {
+		return nil, fmt.Errorf("while registering cache metrics: %w", err)
+	}
+
 	go func() {
 		err = br.manifestCache.Start(cacheServerConfig)
 		if err != nil {
@@ -372,7 +511,7 @@ func (br *Registry) initManifestCache(caPEM *mtls.CAPEM) (_ *groupcache.Group, e
 		}
 	}()
 
-	return br.manifestCache.NewGroup("manifests", cache.DefaultCacheSize, cacheGetter{
+	return br.manifestCache.NewGroup(manifestGroupName, cacheSize(br.runningConfig().Cache.Size), cacheGetter{
 		registry: br.registry,
 	})
 }
@@ -395,6 +534,10 @@ func (br *Registry) Serve(ctx context.Context, ln net.Listener) (errFn error) {
 		br.errCh <- br.server.Serve(ln)
 	}()
 
+	if err := br.loadMaintenance(ctx); err != nil {
+		return err
+	}
+
 	caPEM, err := br.initGossip()
 	if err != nil {
 		return err
@@ -433,23 +576,25 @@ func (br *Registry) Serve(ctx context.Context, ln net.Listener) (errFn error) {
 
 	br.router.NotFoundHandler = br.server.Handler
 
-	br.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	br.server.Handler = tracing.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
 			if bytes.Equal(leaf.AuthorityKeyId, r.TLS.PeerCertificates[0].AuthorityKeyId) {
 				r = r.WithContext(context.WithValue(r.Context(), &serverPluginContextKey, true))
 			}
 		}
 		br.router.ServeHTTP(w, r)
-	})
+	}), "beskar")
 
 	br.server.BaseContext = func(net.Listener) context.Context {
 		return context.WithValue(ctx, &manifestCacheKey, manifestCache)
 	}
 
-	manifestCache.Group, err = br.initManifestCache(caPEM)
+	manifestGroup, err := br.initManifestCache(caPEM)
 	if err != nil {
 		return err
 	}
+	manifestCache.group.Store(manifestGroup)
+	br.manifestGroup = manifestCache
 	defer func() {
 		manifestCacheErr := br.manifestCache.Stop(ctx)
 		if errFn == nil {
@@ -463,6 +608,12 @@ func (br *Registry) Serve(ctx context.Context, ln net.Listener) (errFn error) {
 		return err
 	}
 
+	go br.outbox.run(ctx, br.pluginManager)
+	go br.audit.run(ctx)
+	go br.pluginManager.runHealthChecks(ctx)
+	go br.watchConfig(ctx)
+	br.replicator.run(ctx, br.registry)
+
 	waitPlugins, err := loadPlugins(ctx)
 	if err != nil {
 		return err
@@ -474,17 +625,25 @@ func (br *Registry) Serve(ctx context.Context, ln net.Listener) (errFn error) {
 
 	waitPlugins()
 
-	if err == nil && br.beskarConfig.Registry.HTTP.DrainTimeout > 0 {
-		c, cancel := context.WithTimeout(context.Background(), br.beskarConfig.Registry.HTTP.DrainTimeout)
+	if err == nil && br.runningConfig().Registry.HTTP.DrainTimeout > 0 {
+		c, cancel := context.WithTimeout(context.Background(), br.runningConfig().Registry.HTTP.DrainTimeout)
 		err = br.server.Shutdown(c)
 		cancel()
 	}
 
+	if tracingErr := br.shutdownTracing(context.Background()); err == nil {
+		err = tracingErr
+	}
+
 	return err
 }
 
 func (br *Registry) Put(ctx context.Context, repository distribution.Repository, dgst digest.Digest, mediaType string, payload []byte) error {
-	return br.sendEvent(
+	// the manifest is stored at this point, it's replicated even if
+	// the plugin event can't be delivered
+	br.replicator.replicate(ctx, replicationActionPut, repository.Named().String(), dgst, mediaType, manifestTag(ctx), payload)
+
+	err := br.sendEvent(
 		ctx,
 		&eventv1.EventPayload{
 			Repository: repository.Named().String(),
@@ -494,10 +653,16 @@ func (br *Registry) Put(ctx context.Context, repository distribution.Repository,
 			Action:     eventv1.Action_ACTION_PUT,
 		},
 	)
+	if err == nil {
+		br.webhook.ArtifactPushed(repository.Named().String(), dgst.String(), mediaType)
+	}
+	return err
 }
 
 func (br *Registry) Delete(ctx context.Context, repository distribution.Repository, dgst digest.Digest, mediaType string, payload []byte) error {
-	return br.sendEvent(
+	br.replicator.replicate(ctx, replicationActionDelete, repository.Named().String(), dgst, mediaType, "", payload)
+
+	err := br.sendEvent(
 		ctx,
 		&eventv1.EventPayload{
 			Repository: repository.Named().String(),
@@ -507,6 +672,10 @@ func (br *Registry) Delete(ctx context.Context, repository distribution.Reposito
 			Action:     eventv1.Action_ACTION_DELETE,
 		},
 	)
+	if err == nil {
+		br.webhook.ArtifactDeleted(repository.Named().String(), dgst.String(), mediaType)
+	}
+	return err
 }
 
 func (br *Registry) sendEvent(ctx context.Context, event *eventv1.EventPayload) error {
@@ -515,33 +684,53 @@ func (br *Registry) sendEvent(ctx context.Context, event *eventv1.EventPayload)
 		return nil
 	}
 
-	switch event.Mediatype {
-	case "application/vnd.oci.image.manifest.v1+json",
-		"application/vnd.docker.distribution.manifest.v1+json",
-		"application/vnd.docker.distribution.manifest.v2+json":
-		ociManifest, err := v1.ParseManifest(bytes.NewReader(event.Payload))
-		if err != nil {
-			return err
-		}
-		event.Mediatype = string(ociManifest.Config.MediaType)
-		plugin, ok := br.pluginManager.getPlugin(event.Mediatype)
-		if !ok {
-			return nil
-		}
+	if !isImageManifest(event.Mediatype) {
+		return nil
+	}
 
-		br.logger.Debugf("Sending manifest %s event to plugin", event.Repository)
+	ociManifest, err := v1.ParseManifest(bytes.NewReader(event.Payload))
+	if err != nil {
+		return err
+	}
+	event.Mediatype = string(ociManifest.Config.MediaType)
+	plugin, ok := br.pluginManager.getPlugin(event.Mediatype)
+	if !ok {
+		return nil
+	}
 
-		event.Origin = eventv1.Origin_ORIGIN_EXTERNAL
+	br.logger.Debugf("Sending manifest %s event to plugin", event.Repository)
 
-		// plugins connections are identified within server ConnContext
-		isPlugin, ok := ctx.Value(&serverPluginContextKey).(bool)
-		if ok && isPlugin {
-			event.Origin = eventv1.Origin_ORIGIN_PLUGIN
+	event.Origin = eventv1.Origin_ORIGIN_EXTERNAL
+	if isPluginContext(ctx) {
+		event.Origin = eventv1.Origin_ORIGIN_PLUGIN
+	}
+
+	return br.deliverEvent(ctx, plugin, event)
+}
+
+// deliverEvent sends the event to the plugin, events which couldn't be
+// delivered are stored in the outbox and redelivered later. Events are
+// also queued in the outbox while previous events for the same plugin
+// repository are pending in order to preserve their delivery order.
+// Events rejected by the plugin are returned as errors.
+func (br *Registry) deliverEvent(ctx context.Context, plugin *plugin, event *eventv1.EventPayload) error {
+	var err error
+
+	if br.outbox.hasPending(plugin.name, path.Dir(event.Repository)) {
+		err = errOutboxPending
+	} else {
+		err = plugin.sendEvent(ctx, event, nil)
+		if err == nil || isEventRejected(err) {
+			return err
 		}
+	}
 
-		return plugin.sendEvent(ctx, event, nil)
-	default:
+	if outboxErr := br.outbox.add(ctx, plugin.name, event, err); outboxErr != nil {
+		br.logger.Errorf("outbox error for %s event on %s: %s", event.Action, event.Repository, outboxErr)
+		return err
 	}
 
+	br.logger.Warnf("%s event for %s stored in outbox for plugin %s: %s", event.Action, event.Repository, plugin.name, err)
+
 	return nil
 }
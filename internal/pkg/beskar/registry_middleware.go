@@ -13,15 +13,33 @@ import (
 	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
 	"github.com/distribution/reference"
 	"github.com/mailgun/groupcache/v2"
+	"go.ciq.dev/beskar/internal/pkg/maintenance"
 )
 
-type registryCallbackFunc func(distribution.Namespace) *pluginManager
+// registryServices are the beskar services used by the registry middleware.
+type registryServices struct {
+	pluginManager *pluginManager
+	quotas        *quotaManager
+	audit         *auditLog
+	maintenance   *maintenance.Mode
+	proxies       *proxyManager
+	admission     *admissionController
+	blobCache     *blobCache
+}
+
+type registryCallbackFunc func(distribution.Namespace, storagedriver.StorageDriver) registryServices
 
 type RegistryMiddleware struct {
 	registry             distribution.Namespace
 	manifestEventHandler ManifestEventHandler
 	cache                atomic.Pointer[groupcache.Group]
 	pluginManager        *pluginManager
+	quotas               *quotaManager
+	audit                *auditLog
+	maintenance          *maintenance.Mode
+	proxies              *proxyManager
+	admission            *admissionController
+	blobCache            *blobCache
 }
 
 func registerRegistryMiddleware(meh ManifestEventHandler, callbackFn registryCallbackFunc) error {
@@ -34,7 +52,14 @@ func initRegistryMiddleware(meh ManifestEventHandler, callbackFn registryCallbac
 			registry:             registry,
 			manifestEventHandler: meh,
 		}
-		mr.pluginManager = callbackFn(mr)
+		services := callbackFn(mr, driver)
+		mr.pluginManager = services.pluginManager
+		mr.quotas = services.quotas
+		mr.audit = services.audit
+		mr.maintenance = services.maintenance
+		mr.proxies = services.proxies
+		mr.admission = services.admission
+		mr.blobCache = services.blobCache
 		return mr, nil
 	}
 }
@@ -51,7 +76,7 @@ func (m *RegistryMiddleware) Scope() distribution.Scope {
 // reference.
 func (m *RegistryMiddleware) Repository(ctx context.Context, name reference.Named) (distribution.Repository, error) {
 	if mc, ok := ctx.Value(&manifestCacheKey).(*manifestCache); ok {
-		m.cache.Store(mc.Group)
+		m.cache.Store(mc.load())
 	}
 
 	matches := artifactsMatch.FindStringSubmatch(name.String())
@@ -66,10 +91,27 @@ func (m *RegistryMiddleware) Repository(ctx context.Context, name reference.Name
 		return nil, err
 	}
 
+	if upstream, remoteName := m.proxies.match(name.Name()); upstream != nil {
+		return newProxyRepository(&RepositoryMiddleware{
+			repository:           repository,
+			manifestEventHandler: m.manifestEventHandler,
+			quotas:               m.quotas,
+			audit:                m.audit,
+			maintenance:          m.maintenance,
+			admission:            m.admission,
+			blobCache:            m.blobCache,
+		}, upstream, remoteName), nil
+	}
+
 	if _, ok := ctx.Value(&noCacheKey).(*int); ok {
 		return &RepositoryMiddleware{
 			repository:           repository,
 			manifestEventHandler: m.manifestEventHandler,
+			quotas:               m.quotas,
+			audit:                m.audit,
+			maintenance:          m.maintenance,
+			admission:            m.admission,
+			blobCache:            m.blobCache,
 		}, nil
 	}
 
@@ -77,6 +119,11 @@ func (m *RegistryMiddleware) Repository(ctx context.Context, name reference.Name
 		repository:           repository,
 		manifestEventHandler: m.manifestEventHandler,
 		cache:                m.cache.Load(),
+		quotas:               m.quotas,
+		audit:                m.audit,
+		maintenance:          m.maintenance,
+		admission:            m.admission,
+		blobCache:            m.blobCache,
 	}, nil
 }
 
@@ -0,0 +1,326 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/sirupsen/logrus"
+	"go.ciq.dev/beskar/internal/pkg/config"
+)
+
+const (
+	// configCheckInterval is the interval between two checks of the
+	// configuration file for changes.
+	configCheckInterval = 10 * time.Second
+
+	manifestGroupName = "manifests"
+	accountOption     = "account"
+)
+
+// configReloadReport is the outcome of a configuration reload.
+type configReloadReport struct {
+	Time time.Time `json:"time"`
+	// Applied lists the settings changed and applied live.
+	Applied []string `json:"applied"`
+	// RestartRequired lists the settings changed which require a restart
+	// to take effect, they are reported until beskar is restarted.
+	RestartRequired []string `json:"restartRequired"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// configReloader re-parses the beskar configuration on SIGHUP or when the
+// configuration file changes, and applies the settings which can be changed
+// without restart: the registry account, the router body limit, the cache
+// size, the log level and the gossip peers.
+type configReloader struct {
+	sync.Mutex
+	dir        string
+	content    []byte
+	lastReport *configReloadReport
+}
+
+// cacheSize returns the cache size in bytes from the configured size in MiB.
+func cacheSize(size uint32) int64 {
+	return int64(size) * 1024 * 1024
+}
+
+func readConfigFile(dir string) []byte {
+	content, err := os.ReadFile(config.BeskarConfigPath(dir))
+	if err != nil {
+		return nil
+	}
+	return content
+}
+
+// watchConfig reloads the configuration on SIGHUP or when the configuration
+// file content changes until the context is canceled.
+func (br *Registry) watchConfig(ctx context.Context) {
+	br.reloader.Lock()
+	br.reloader.content = readConfigFile(br.reloader.dir)
+	br.reloader.Unlock()
+
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	ticker := time.NewTicker(configCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hupCh:
+			br.logger.Info("SIGHUP received, reloading configuration")
+		case <-ticker.C:
+			content := readConfigFile(br.reloader.dir)
+
+			br.reloader.Lock()
+			changed := content != nil && !bytes.Equal(content, br.reloader.content)
+			br.reloader.Unlock()
+
+			if !changed {
+				continue
+			}
+			br.logger.Info("Configuration file changed, reloading configuration")
+		}
+
+		br.reloadConfig()
+	}
+}
+
+// reloadConfig parses the configuration and applies the changed settings
+// which don't require a restart, the running configuration is kept on error.
+func (br *Registry) reloadConfig() *configReloadReport {
+	br.reloader.Lock()
+	defer br.reloader.Unlock()
+
+	report := &configReloadReport{
+		Time:            time.Now().UTC(),
+		Applied:         []string{},
+		RestartRequired: []string{},
+	}
+	br.reloader.lastReport = report
+
+	// the content is recorded even if it can't be parsed to not
+	// reload an invalid configuration file until it changes again
+	br.reloader.content = readConfigFile(br.reloader.dir)
+
+	newConfig, err := config.ParseBeskarConfig(br.reloader.dir)
+	if err != nil {
+		report.Error = err.Error()
+		br.logger.Errorf("configuration reload error, keeping running configuration: %s", err)
+		return report
+	}
+
+	// the running configuration is replaced by a copy updated with the applied
+	// settings only, settings requiring a restart keep being reported until then
+	running := copyConfig(br.runningConfig())
+	defer br.beskarConfig.Store(running)
+
+	if newLevel := newConfig.Registry.Log.Level; newLevel != running.Registry.Log.Level {
+		level, err := logrus.ParseLevel(string(newLevel))
+		if err != nil {
+			report.Error = fmt.Sprintf("bad log level %q: %s", newLevel, err)
+		} else {
+			logrus.SetLevel(level)
+			running.Registry.Log.Level = newLevel
+			report.Applied = append(report.Applied, "registry.log.level")
+		}
+	}
+
+	newAccount := newConfig.Registry.Auth["beskar"][accountOption]
+	if !reflect.DeepEqual(newAccount, running.Registry.Auth["beskar"][accountOption]) {
+		if br.accessController == nil {
+			report.RestartRequired = append(report.RestartRequired, "registry.auth.beskar.account")
+		} else if err := br.accessController.setAccount(newConfig.Registry.Auth["beskar"]); err != nil {
+			report.Error = err.Error()
+		} else {
+			running.Registry.Auth["beskar"][accountOption] = newAccount
+			report.Applied = append(report.Applied, "registry.auth.beskar.account")
+		}
+	}
+
+	if newConfig.Router.BodyLimit != running.Router.BodyLimit {
+		br.pluginManager.setBodyLimit(newConfig.Router.BodyLimit)
+		running.Router.BodyLimit = newConfig.Router.BodyLimit
+		report.Applied = append(report.Applied, "router.bodylimit")
+	}
+
+	if newConfig.Cache.Size != running.Cache.Size {
+		if err := br.resizeManifestCache(newConfig.Cache.Size); err != nil {
+			report.Error = err.Error()
+		} else {
+			running.Cache.Size = newConfig.Cache.Size
+			report.Applied = append(report.Applied, "cache.size")
+		}
+	}
+
+	if !reflect.DeepEqual(newConfig.Gossip.Peers, running.Gossip.Peers) {
+		if err := br.joinPeers(newConfig.Gossip.Peers, running.Gossip.Peers); err != nil {
+			report.Error = err.Error()
+		} else {
+			running.Gossip.Peers = newConfig.Gossip.Peers
+			report.Applied = append(report.Applied, "gossip.peers")
+		}
+	}
+
+	report.RestartRequired = append(report.RestartRequired, restartRequiredChanges(running, newConfig)...)
+
+	if len(report.Applied) > 0 {
+		br.logger.Infof("configuration reloaded, applied settings: %v", report.Applied)
+	} else {
+		br.logger.Info("configuration reloaded, no setting changed")
+	}
+	if len(report.RestartRequired) > 0 {
+		br.logger.Warnf("configuration reloaded, settings requiring a restart to take effect: %v", report.RestartRequired)
+	}
+	if report.Error != "" {
+		br.logger.Errorf("configuration reload error: %s", report.Error)
+	}
+
+	return report
+}
+
+// runningConfig returns the running configuration, it must not be modified,
+// configuration reloads replace it by an updated copy.
+func (br *Registry) runningConfig() *config.BeskarConfig {
+	return br.beskarConfig.Load()
+}
+
+// copyConfig returns a copy of the configuration whose settings applied
+// live can be changed without modifying the original configuration.
+func copyConfig(c *config.BeskarConfig) *config.BeskarConfig {
+	cc := *c
+
+	registry := *c.Registry
+	registry.Auth = make(configuration.Auth, len(c.Registry.Auth))
+	for name, params := range c.Registry.Auth {
+		registry.Auth[name] = make(configuration.Parameters, len(params))
+		for key, value := range params {
+			registry.Auth[name][key] = value
+		}
+	}
+	cc.Registry = &registry
+
+	return &cc
+}
+
+// lastConfigReload returns the report of the last configuration reload if any.
+func (br *Registry) lastConfigReload() *configReloadReport {
+	br.reloader.Lock()
+	defer br.reloader.Unlock()
+
+	return br.reloader.lastReport
+}
+
+// resizeManifestCache replaces the manifest cache group by a group with the new size.
+func (br *Registry) resizeManifestCache(size uint32) error {
+	if br.manifestGroup.load() == nil {
+		return fmt.Errorf("manifest cache not initialized")
+	}
+
+	group, err := br.manifestCache.ReplaceGroup(manifestGroupName, cacheSize(size), cacheGetter{
+		registry: br.registry,
+	})
+	if err != nil {
+		return err
+	}
+	br.manifestGroup.group.Store(group)
+
+	return nil
+}
+
+// joinPeers joins the peers not in the running configuration, removed
+// peers remain cluster members until they leave the cluster.
+func (br *Registry) joinPeers(peers, runningPeers []string) error {
+	if br.member == nil {
+		return fmt.Errorf("gossip not initialized")
+	}
+
+	known := make(map[string]struct{}, len(runningPeers))
+	for _, peer := range runningPeers {
+		known[peer] = struct{}{}
+	}
+
+	var newPeers []string
+	for _, peer := range peers {
+		if _, ok := known[peer]; !ok {
+			newPeers = append(newPeers, peer)
+		}
+	}
+	if len(newPeers) == 0 {
+		return nil
+	}
+
+	if _, err := br.member.Join(newPeers); err != nil {
+		return fmt.Errorf("while joining gossip peers %v: %w", newPeers, err)
+	}
+
+	return nil
+}
+
+// restartRequiredChanges returns the settings which differ between the running
+// and the new configuration, settings applied live must be equal already.
+func restartRequiredChanges(running, newConfig *config.BeskarConfig) []string {
+	var changes []string
+
+	fields := []struct {
+		name     string
+		old, new any
+	}{
+		{"profiling", running.Profiling, newConfig.Profiling},
+		{"hostname", running.Hostname, newConfig.Hostname},
+		{"cache.addr", running.Cache.Addr, newConfig.Cache.Addr},
+		{"cache.blobs", running.Cache.Blobs, newConfig.Cache.Blobs},
+		{"gossip.addr", running.Gossip.Addr, newConfig.Gossip.Addr},
+		{"gossip.key", running.Gossip.Key, newConfig.Gossip.Key},
+		{"auth", running.Auth, newConfig.Auth},
+		{"tracing", running.Tracing, newConfig.Tracing},
+		{"webhooks", running.Webhooks, newConfig.Webhooks},
+		{"quotas", running.Quotas, newConfig.Quotas},
+		{"proxy", running.Proxy, newConfig.Proxy},
+		{"replication", running.Replication, newConfig.Replication},
+		{"admission", running.Admission, newConfig.Admission},
+		{"registry", registryWithoutLiveSettings(running.Registry), registryWithoutLiveSettings(newConfig.Registry)},
+	}
+
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.old, field.new) {
+			changes = append(changes, field.name)
+		}
+	}
+
+	return changes
+}
+
+// registryWithoutLiveSettings returns a copy of the registry configuration
+// without the log level and the account, both applied live.
+func registryWithoutLiveSettings(registry *configuration.Configuration) configuration.Configuration {
+	c := *registry
+	c.Log.Level = ""
+	c.Auth = make(configuration.Auth, len(registry.Auth))
+
+	for name, params := range registry.Auth {
+		c.Auth[name] = make(configuration.Parameters, len(params))
+		for key, value := range params {
+			if name == "beskar" && key == accountOption {
+				continue
+			}
+			c.Auth[name][key] = value
+		}
+	}
+
+	return c
+}
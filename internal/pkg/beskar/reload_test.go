@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"os"
+	"testing"
+
+	"github.com/distribution/distribution/v3/configuration"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/pkg/config"
+)
+
+func TestRestartRequiredChanges(t *testing.T) {
+	newConfig := func(account, level string) *config.BeskarConfig {
+		registry := &configuration.Configuration{
+			Auth: configuration.Auth{
+				"beskar": configuration.Parameters{
+					"account": account,
+				},
+			},
+		}
+		registry.Log.Level = configuration.Loglevel(level)
+
+		return &config.BeskarConfig{
+			Hostname: "localhost",
+			Registry: registry,
+		}
+	}
+
+	running := newConfig("beskar:hash1", "info")
+
+	// live settings only
+	require.Empty(t, restartRequiredChanges(running, newConfig("beskar:hash2", "debug")))
+
+	changed := newConfig("beskar:hash1", "info")
+	changed.Hostname = "beskar.example.com"
+	changed.Registry.HTTP.Addr = "0.0.0.0:5200"
+	changed.Quotas = []config.Quota{{Namespace: "artifacts/static", MaxArtifacts: 10}}
+
+	require.Equal(t, []string{"hostname", "quotas", "registry"}, restartRequiredChanges(running, changed))
+
+	// the running configuration is left untouched
+	require.Equal(t, "beskar:hash1", running.Registry.Auth["beskar"]["account"])
+	require.Equal(t, configuration.Loglevel("info"), running.Registry.Log.Level)
+
+	// live settings are applied on a copy of the running configuration
+	updated := copyConfig(running)
+	updated.Registry.Auth["beskar"]["account"] = "beskar:hash2"
+	updated.Registry.Log.Level = "debug"
+	updated.Router.BodyLimit = 1024
+
+	require.Equal(t, "beskar:hash1", running.Registry.Auth["beskar"]["account"])
+	require.Equal(t, configuration.Loglevel("info"), running.Registry.Log.Level)
+	require.Zero(t, running.Router.BodyLimit)
+	require.Empty(t, restartRequiredChanges(running, updated))
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("registry: [")
+
+	require.NoError(t, os.WriteFile(config.BeskarConfigPath(dir), content, 0o600))
+
+	br := &Registry{
+		logger: logrus.NewEntry(logrus.New()),
+	}
+	br.reloader.dir = dir
+
+	report := br.reloadConfig()
+	require.NotEmpty(t, report.Error)
+
+	// the invalid content is not reloaded again until it changes
+	require.Equal(t, content, br.reloader.content)
+}
@@ -0,0 +1,807 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/distribution/distribution/v3"
+	storagedriver "github.com/distribution/distribution/v3/registry/storage/driver"
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/uuid"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"go.ciq.dev/beskar/internal/pkg/config"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
+)
+
+const (
+	replicationActionPut    = "put"
+	replicationActionDelete = "delete"
+
+	replicationResultSuccess = "success"
+	replicationResultFailure = "failure"
+
+	// replicationRootPath is the storage driver path where the events
+	// to replicate are persisted until replicated, events are stored
+	// per target and ordered by their identifier:
+	// /beskar/replication/<target>/<id>.json
+	replicationRootPath = "/beskar/replication"
+
+	// replicationLeasePath is the storage driver path of the target leases,
+	// the events of a target are replicated by the beskar node holding its
+	// lease, the lease is claimed by another node once expired:
+	// /beskar/replication-leases/<target>.json
+	replicationLeasePath = "/beskar/replication-leases"
+
+	replicationMaxFailures   = 100
+	replicationRetryMaxDelay = 30 * time.Second
+	replicationRetryMaxTime  = 5 * time.Minute
+	replicationScanInterval  = 10 * time.Second
+	// replicationLeaseDuration is greater than the time spent retrying
+	// an event, so the lease is renewed between events.
+	replicationLeaseDuration = 2 * replicationRetryMaxTime
+)
+
+var manifestTagKey int
+
+// withManifestTag returns a context holding the tag a manifest is pushed
+// with, the manifest event handler doesn't receive manifest options.
+func withManifestTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, &manifestTagKey, tag)
+}
+
+func manifestTag(ctx context.Context) string {
+	tag, _ := ctx.Value(&manifestTagKey).(string)
+	return tag
+}
+
+// replicationTask is a manifest push or deletion to replicate.
+type replicationTask struct {
+	ID         string    `json:"id"`
+	Action     string    `json:"action"`
+	Repository string    `json:"repository"`
+	Digest     string    `json:"digest"`
+	MediaType  string    `json:"mediaType"`
+	Tag        string    `json:"tag,omitempty"`
+	Time       time.Time `json:"time"`
+	payload    []byte
+}
+
+// replicationEntry is a task persisted in the storage driver.
+type replicationEntry struct {
+	Task    *replicationTask `json:"task"`
+	Payload []byte           `json:"payload,omitempty"`
+}
+
+// replicationLease is the lease of a target held by the node replicating its events.
+type replicationLease struct {
+	Target  string    `json:"target"`
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+func newReplicationTaskID(t time.Time) string {
+	return fmt.Sprintf("%020d-%s", t.UnixNano(), uuid.NewString()[:8])
+}
+
+// replicationTaskTime returns the creation time encoded in the task identifier.
+func replicationTaskTime(id string) (time.Time, bool) {
+	nsec, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nsec).UTC(), true
+}
+
+// replicationFailure is a task which couldn't be replicated.
+type replicationFailure struct {
+	*replicationTask
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// replicationStatus is the replication status of a target reported
+// by the admin API.
+type replicationStatus struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Pending is the number of events not replicated yet.
+	Pending int `json:"pending"`
+	// LagSeconds is the age of the oldest pending event.
+	LagSeconds     float64               `json:"lagSeconds"`
+	LastReplicated time.Time             `json:"lastReplicated,omitempty"`
+	Replicated     uint64                `json:"replicated"`
+	Failed         uint64                `json:"failed"`
+	Failures       []*replicationFailure `json:"failures"`
+}
+
+// replicationTarget replicates the matching repositories to a remote
+// registry, events are persisted in the storage driver and replicated
+// in order by the worker of the node holding the target lease.
+type replicationTarget struct {
+	name         string
+	url          string
+	repositories []*regexp.Regexp
+	registry     name.Registry
+	auth         authn.Authenticator
+	transport    http.RoundTripper
+	logger       *logrus.Entry
+	driver       storagedriver.StorageDriver
+	node         string
+	wakeCh       chan struct{}
+
+	// leaseExpires is the expiration time of the target lease
+	// held by this node, only accessed by the worker.
+	leaseExpires time.Time
+
+	mutex          sync.Mutex
+	pending        int
+	oldest         time.Time
+	current        *replicationTask
+	lastReplicated time.Time
+	replicated     uint64
+	failed         uint64
+	failures       []*replicationFailure
+}
+
+func (rt *replicationTarget) match(repository string) bool {
+	for _, re := range rt.repositories {
+		if re.MatchString(repository) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rt *replicationTarget) remoteOptions(ctx context.Context) []remote.Option {
+	return []remote.Option{
+		remote.WithAuth(rt.auth),
+		remote.WithTransport(rt.transport),
+		remote.WithContext(ctx),
+	}
+}
+
+func (rt *replicationTarget) entryPath(id string) string {
+	return path.Join(replicationRootPath, rt.name, id+".json")
+}
+
+func (rt *replicationTarget) leaseFile() string {
+	return path.Join(replicationLeasePath, rt.name+".json")
+}
+
+// enqueue persists the task and wakes up the worker, the task is reported
+// as failed if it can't be persisted so it can be queued again later.
+func (rt *replicationTarget) enqueue(ctx context.Context, task *replicationTask) {
+	data, err := json.Marshal(&replicationEntry{
+		Task:    task,
+		Payload: task.payload,
+	})
+	if err == nil {
+		err = rt.driver.PutContent(ctx, rt.entryPath(task.ID), data)
+	}
+	if err != nil {
+		rt.fail(task, fmt.Errorf("while storing replication event: %w", err))
+		return
+	}
+
+	rt.mutex.Lock()
+	oldest := rt.oldest
+	if oldest.IsZero() || task.Time.Before(oldest) {
+		oldest = task.Time
+	}
+	rt.setPendingLocked(rt.pending+1, oldest)
+	rt.mutex.Unlock()
+
+	select {
+	case rt.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (rt *replicationTarget) setPendingLocked(pending int, oldest time.Time) {
+	rt.pending = pending
+	rt.oldest = oldest
+	replicationPendingEvents.WithLabelValues(rt.name).Set(float64(pending))
+}
+
+// entries returns the sorted identifiers of the persisted tasks.
+func (rt *replicationTarget) entries(ctx context.Context) ([]string, error) {
+	children, err := rt.driver.List(ctx, path.Join(replicationRootPath, rt.name))
+	if err != nil {
+		if errors.As(err, &storagedriver.PathNotFoundError{}) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(children))
+	for _, child := range children {
+		if name := path.Base(child); strings.HasSuffix(name, ".json") {
+			ids = append(ids, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (rt *replicationTarget) getEntry(ctx context.Context, id string) (*replicationTask, error) {
+	data, err := rt.driver.GetContent(ctx, rt.entryPath(id))
+	if err != nil {
+		return nil, err
+	}
+
+	entry := new(replicationEntry)
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("while decoding replication event %s: %w", id, err)
+	} else if entry.Task == nil {
+		return nil, fmt.Errorf("replication event %s without task", id)
+	}
+	entry.Task.payload = entry.Payload
+
+	return entry.Task, nil
+}
+
+func (rt *replicationTarget) removeEntry(ctx context.Context, id string) error {
+	err := rt.driver.Delete(ctx, rt.entryPath(id))
+	if err != nil && !errors.As(err, &storagedriver.PathNotFoundError{}) {
+		return err
+	}
+	return nil
+}
+
+func (rt *replicationTarget) getLease(ctx context.Context) (*replicationLease, error) {
+	data, err := rt.driver.GetContent(ctx, rt.leaseFile())
+	if err != nil {
+		if errors.As(err, &storagedriver.PathNotFoundError{}) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	lease := new(replicationLease)
+	if err := json.Unmarshal(data, lease); err != nil {
+		return nil, fmt.Errorf("while decoding replication lease of target %s: %w", rt.name, err)
+	}
+
+	return lease, nil
+}
+
+// claim acquires or renews the target lease and reports whether this node
+// replicates the target events. Like outbox leases, the storage driver
+// doesn't provide atomic operations, two nodes may both replicate events
+// in the rare case of concurrent claims, manifests are then pushed twice.
+func (rt *replicationTarget) claim(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+
+	if rt.leaseExpires.Sub(now) > replicationLeaseDuration/2 {
+		return true, nil
+	}
+
+	lease, err := rt.getLease(ctx)
+	if err != nil {
+		return false, err
+	} else if lease != nil && lease.Owner != rt.node && lease.Expires.After(now) {
+		rt.leaseExpires = time.Time{}
+		return false, nil
+	}
+
+	lease = &replicationLease{
+		Target:  rt.name,
+		Owner:   rt.node,
+		Expires: now.Add(replicationLeaseDuration),
+	}
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return false, err
+	} else if err := rt.driver.PutContent(ctx, rt.leaseFile(), data); err != nil {
+		return false, fmt.Errorf("while storing replication lease of target %s: %w", rt.name, err)
+	}
+
+	// read the lease back to detect a concurrent claim
+	current, err := rt.getLease(ctx)
+	if err != nil {
+		return false, err
+	} else if current == nil || current.Owner != rt.node {
+		rt.leaseExpires = time.Time{}
+		return false, nil
+	}
+
+	if rt.leaseExpires.IsZero() {
+		rt.logger.Infof("Replicating events of target %s from this node", rt.name)
+	}
+	rt.leaseExpires = lease.Expires
+
+	return true, nil
+}
+
+func (rt *replicationTarget) fail(task *replicationTask, err error) {
+	rt.logger.Errorf("replication of %s %s@%s failed: %s", task.Action, task.Repository, task.Digest, err)
+	replicationEvents.WithLabelValues(rt.name, task.Action, replicationResultFailure).Inc()
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	rt.failed++
+	rt.failures = append(rt.failures, &replicationFailure{
+		replicationTask: task,
+		Error:           err.Error(),
+		FailedAt:        time.Now().UTC(),
+	})
+	if len(rt.failures) > replicationMaxFailures {
+		rt.failures = rt.failures[len(rt.failures)-replicationMaxFailures:]
+	}
+}
+
+func (rt *replicationTarget) succeed(task *replicationTask) {
+	replicationEvents.WithLabelValues(rt.name, task.Action, replicationResultSuccess).Inc()
+	replicationLag.WithLabelValues(rt.name).Set(time.Since(task.Time).Seconds())
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	rt.replicated++
+	rt.lastReplicated = time.Now().UTC()
+}
+
+func (rt *replicationTarget) setCurrent(task *replicationTask) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	rt.current = task
+}
+
+// retry queues the failed tasks again, it returns the number of tasks queued.
+func (rt *replicationTarget) retry(ctx context.Context) int {
+	rt.mutex.Lock()
+	failures := rt.failures
+	rt.failures = nil
+	rt.mutex.Unlock()
+
+	for _, failure := range failures {
+		rt.enqueue(ctx, failure.replicationTask)
+	}
+
+	return len(failures)
+}
+
+func (rt *replicationTarget) status() *replicationStatus {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	status := &replicationStatus{
+		Name:           rt.name,
+		URL:            rt.url,
+		Pending:        rt.pending,
+		LastReplicated: rt.lastReplicated,
+		Replicated:     rt.replicated,
+		Failed:         rt.failed,
+		Failures:       make([]*replicationFailure, len(rt.failures)),
+	}
+	copy(status.Failures, rt.failures)
+
+	// events are replicated in order, the event being
+	// replicated is the oldest pending event
+	if rt.current != nil {
+		status.LagSeconds = time.Since(rt.current.Time).Seconds()
+	} else if rt.pending > 0 && !rt.oldest.IsZero() {
+		status.LagSeconds = time.Since(rt.oldest).Seconds()
+	}
+
+	return status
+}
+
+// run periodically replicates the persisted tasks while this node holds
+// the target lease until the context is canceled, nodes not holding the
+// lease only refresh the pending events reported by the admin API.
+func (rt *replicationTarget) run(ctx context.Context, registry distribution.Namespace) {
+	ticker := time.NewTicker(replicationScanInterval)
+	defer ticker.Stop()
+
+	for {
+		rt.scan(ctx, registry)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-rt.wakeCh:
+		}
+	}
+}
+
+func (rt *replicationTarget) scan(ctx context.Context, registry distribution.Namespace) {
+	ids, err := rt.entries(ctx)
+	if err != nil {
+		rt.logger.Errorf("replication list error: %s", err)
+		return
+	}
+	rt.updatePending(ids)
+
+	if len(ids) == 0 {
+		return
+	}
+
+	for i, id := range ids {
+		owned, err := rt.claim(ctx)
+		if err != nil {
+			rt.logger.Errorf("replication lease error: %s", err)
+			return
+		} else if !owned {
+			return
+		}
+
+		task, err := rt.getEntry(ctx, id)
+		if errors.As(err, &storagedriver.PathNotFoundError{}) {
+			// replicated by the previous lease holder
+			continue
+		} else if err != nil {
+			rt.logger.Errorf("replication event %s error: %s", id, err)
+			return
+		}
+
+		rt.setCurrent(task)
+
+		err = rt.replicate(ctx, registry, task)
+		if err != nil && ctx.Err() != nil {
+			rt.setCurrent(nil)
+			return
+		}
+
+		if removeErr := rt.removeEntry(ctx, id); removeErr != nil {
+			rt.logger.Errorf("replication event %s removal error: %s", id, removeErr)
+		}
+
+		if err != nil {
+			rt.fail(task, err)
+		} else {
+			rt.succeed(task)
+		}
+
+		rt.setCurrent(nil)
+		rt.updatePending(ids[i+1:])
+	}
+}
+
+// updatePending refreshes the pending events from the persisted task identifiers.
+func (rt *replicationTarget) updatePending(ids []string) {
+	var oldest time.Time
+	if len(ids) > 0 {
+		oldest, _ = replicationTaskTime(ids[0])
+	}
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	rt.setPendingLocked(len(ids), oldest)
+}
+
+func (rt *replicationTarget) replicate(ctx context.Context, registry distribution.Namespace, task *replicationTask) error {
+	remoteRepository := rt.registry.Repo(task.Repository)
+
+	eb := backoff.NewExponentialBackOff()
+	eb.MaxInterval = replicationRetryMaxDelay
+	eb.MaxElapsedTime = replicationRetryMaxTime
+
+	return backoff.Retry(func() error {
+		var err error
+
+		switch task.Action {
+		case replicationActionPut:
+			err = rt.replicatePut(ctx, registry, remoteRepository, task)
+		case replicationActionDelete:
+			err = remote.Delete(remoteRepository.Digest(task.Digest), rt.remoteOptions(ctx)...)
+			// the manifest may have been deleted already or never replicated
+			if isUpstreamNotFound(err) {
+				err = nil
+			}
+		default:
+			err = fmt.Errorf("unknown replication action %s", task.Action)
+		}
+
+		if err != nil && !isReplicationRetryable(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(eb, ctx))
+}
+
+// replicatePut pushes the manifest with the blobs and the child manifests
+// missing on the remote registry.
+func (rt *replicationTarget) replicatePut(ctx context.Context, registry distribution.Namespace, remoteRepository name.Repository, task *replicationTask) error {
+	named, err := reference.WithName(task.Repository)
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	repository, err := registry.Repository(ctx, named)
+	if err != nil {
+		return err
+	}
+
+	var ref name.Reference = remoteRepository.Digest(task.Digest)
+	if task.Tag != "" {
+		ref = remoteRepository.Tag(task.Tag)
+	}
+
+	return rt.pushManifest(ctx, repository, ref, task.MediaType, task.payload)
+}
+
+func (rt *replicationTarget) pushManifest(ctx context.Context, repository distribution.Repository, ref name.Reference, mediaType string, payload []byte) error {
+	manifest, _, err := distribution.UnmarshalManifest(mediaType, payload)
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+
+	manifestMediaTypes := make(map[string]struct{})
+	for _, mt := range distribution.ManifestMediaTypes() {
+		manifestMediaTypes[mt] = struct{}{}
+	}
+
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	blobs := repository.Blobs(ctx)
+	remoteRepository := ref.Context()
+
+	for _, desc := range manifest.References() {
+		if _, ok := manifestMediaTypes[desc.MediaType]; ok {
+			child, err := manifests.Get(ctx, desc.Digest)
+			if err != nil {
+				return fmt.Errorf("while getting manifest %s: %w", desc.Digest, err)
+			}
+			childMediaType, childPayload, err := child.Payload()
+			if err != nil {
+				return err
+			}
+			childRef := remoteRepository.Digest(desc.Digest.String())
+			if err := rt.pushManifest(ctx, repository, childRef, childMediaType, childPayload); err != nil {
+				return err
+			}
+			continue
+		}
+
+		layer, err := partial.CompressedToLayer(&replicationBlob{
+			ctx:   ctx,
+			blobs: blobs,
+			desc:  desc,
+		})
+		if err != nil {
+			return err
+		}
+		// the blob is uploaded only if it doesn't exist on the remote registry
+		if err := remote.WriteLayer(remoteRepository, layer, rt.remoteOptions(ctx)...); err != nil {
+			return fmt.Errorf("while writing blob %s: %w", desc.Digest, err)
+		}
+	}
+
+	// the manifest isn't pushed again if it exists on the remote registry,
+	// that also prevents replication loops between clusters replicating
+	// the same repositories to each other
+	return remote.Put(ref, &replicationManifest{
+		mediaType: mediaType,
+		payload:   payload,
+	}, rt.remoteOptions(ctx)...)
+}
+
+// isReplicationRetryable returns false for client errors returned by the
+// remote registry, except for rate limiting.
+func isReplicationRetryable(err error) bool {
+	var transportErr *transport.Error
+	if !errors.As(err, &transportErr) {
+		return true
+	}
+	status := transportErr.StatusCode
+	return status == http.StatusTooManyRequests || status < 400 || status >= 500
+}
+
+// replicationManifest is a raw manifest pushed to the remote registry.
+type replicationManifest struct {
+	mediaType string
+	payload   []byte
+}
+
+func (rm *replicationManifest) RawManifest() ([]byte, error) {
+	return rm.payload, nil
+}
+
+func (rm *replicationManifest) MediaType() (types.MediaType, error) {
+	return types.MediaType(rm.mediaType), nil
+}
+
+// replicationBlob is a local blob pushed to the remote registry.
+type replicationBlob struct {
+	ctx   context.Context
+	blobs distribution.BlobStore
+	desc  distribution.Descriptor
+}
+
+func (rb *replicationBlob) Digest() (v1.Hash, error) {
+	return v1.NewHash(rb.desc.Digest.String())
+}
+
+func (rb *replicationBlob) Compressed() (io.ReadCloser, error) {
+	return rb.blobs.Open(rb.ctx, rb.desc.Digest)
+}
+
+func (rb *replicationBlob) Size() (int64, error) {
+	return rb.desc.Size, nil
+}
+
+func (rb *replicationBlob) MediaType() (types.MediaType, error) {
+	return types.MediaType(rb.desc.MediaType), nil
+}
+
+// replicator replicates manifest pushes and deletions to the configured
+// targets. Pending events are persisted in the registry storage driver and
+// replicated by one beskar node per target, they survive restarts and are
+// taken over by another node if the replicating node goes away. Events
+// failing after retries are reported by the admin API of the replicating
+// node and can be queued again from there.
+type replicator struct {
+	targets []*replicationTarget
+}
+
+func newReplicator(replicationConfig config.Replication, logger *logrus.Entry) (*replicator, error) {
+	r := &replicator{
+		targets: make([]*replicationTarget, 0, len(replicationConfig.Targets)),
+	}
+
+	for _, target := range replicationConfig.Targets {
+		u, err := url.Parse(target.URL)
+		if err != nil {
+			return nil, fmt.Errorf("replication target %s: bad URL: %w", target.Name, err)
+		}
+
+		var nameOptions []name.Option
+		if u.Scheme == "http" {
+			nameOptions = append(nameOptions, name.Insecure)
+		}
+
+		registry, err := name.NewRegistry(u.Host, nameOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("replication target %s: %w", target.Name, err)
+		}
+
+		auth := authn.Anonymous
+		if target.Username != "" || target.Password != "" {
+			auth = &authn.Basic{
+				Username: target.Username,
+				Password: target.Password,
+			}
+		}
+
+		rt := &replicationTarget{
+			name:      target.Name,
+			url:       target.URL,
+			registry:  registry,
+			auth:      auth,
+			transport: tracing.Transport(http.DefaultTransport),
+			logger:    logger.WithField("replication", target.Name),
+			wakeCh:    make(chan struct{}, 1),
+		}
+
+		for _, glob := range target.Repositories {
+			re, err := compileRepositoryGlob(glob)
+			if err != nil {
+				return nil, fmt.Errorf("replication target %s: %w", target.Name, err)
+			}
+			rt.repositories = append(rt.repositories, re)
+		}
+
+		r.targets = append(r.targets, rt)
+	}
+
+	return r, nil
+}
+
+// compileRepositoryGlob compiles a repository glob where * matches any
+// sequence of characters, including /.
+func compileRepositoryGlob(glob string) (*regexp.Regexp, error) {
+	pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(glob), `\*`, ".*") + "$"
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad repository glob %q: %w", glob, err)
+	}
+	return re, nil
+}
+
+// setStorage sets the storage driver where the pending events are persisted
+// and the name of this node, it must be called before run and replicate.
+func (r *replicator) setStorage(driver storagedriver.StorageDriver, node string) {
+	if r == nil {
+		return
+	}
+
+	for _, target := range r.targets {
+		target.driver = driver
+		target.node = node
+	}
+}
+
+// replicate queues the manifest event for the targets replicating the repository.
+func (r *replicator) replicate(ctx context.Context, action, repository string, dgst digest.Digest, mediaType, tag string, payload []byte) {
+	if r == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+
+	task := &replicationTask{
+		ID:         newReplicationTaskID(now),
+		Action:     action,
+		Repository: repository,
+		Digest:     dgst.String(),
+		MediaType:  mediaType,
+		Tag:        tag,
+		Time:       now,
+		payload:    payload,
+	}
+
+	for _, target := range r.targets {
+		if target.match(repository) {
+			target.enqueue(ctx, task)
+		}
+	}
+}
+
+// run starts the target workers until the context is canceled.
+func (r *replicator) run(ctx context.Context, registry distribution.Namespace) {
+	if r == nil {
+		return
+	}
+
+	for _, target := range r.targets {
+		go target.run(ctx, registry)
+	}
+}
+
+func (r *replicator) target(name string) (*replicationTarget, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	for _, target := range r.targets {
+		if target.name == name {
+			return target, true
+		}
+	}
+
+	return nil, false
+}
+
+func (r *replicator) status() []*replicationStatus {
+	statuses := []*replicationStatus{}
+	if r == nil {
+		return statuses
+	}
+
+	for _, target := range r.targets {
+		statuses = append(statuses, target.status())
+	}
+
+	return statuses
+}
@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/pkg/config"
+)
+
+func TestReplicatorQueue(t *testing.T) {
+	ctx := context.Background()
+
+	r, err := newReplicator(config.Replication{
+		Targets: []config.ReplicationTarget{
+			{
+				Name:         "cluster-b",
+				URL:          "https://beskar.cluster-b.example.com",
+				Repositories: []string{"artifacts/yum/prod/*"},
+			},
+		},
+	}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+
+	driver := inmemory.New()
+	r.setStorage(driver, "node1")
+
+	target, ok := r.target("cluster-b")
+	require.True(t, ok)
+	require.Equal(t, "beskar.cluster-b.example.com/artifacts/yum/prod/rocky", target.registry.Repo("artifacts/yum/prod/rocky").String())
+
+	dgst := digest.FromString("manifest")
+
+	r.replicate(ctx, replicationActionPut, "artifacts/yum/prod/rocky/packages", dgst, "application/vnd.oci.image.manifest.v1+json", "latest", []byte("{}"))
+	r.replicate(ctx, replicationActionPut, "artifacts/yum/dev/rocky/packages", dgst, "application/vnd.oci.image.manifest.v1+json", "latest", nil)
+
+	status := r.status()
+	require.Len(t, status, 1)
+	require.Equal(t, 1, status[0].Pending)
+
+	// pending events are persisted and reloaded by another replicator
+	other, err := newReplicator(config.Replication{
+		Targets: []config.ReplicationTarget{
+			{Name: "cluster-b", URL: "https://beskar.cluster-b.example.com"},
+		},
+	}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	other.setStorage(driver, "node2")
+
+	otherTarget, _ := other.target("cluster-b")
+	ids, err := otherTarget.entries(ctx)
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+
+	task, err := otherTarget.getEntry(ctx, ids[0])
+	require.NoError(t, err)
+	require.Equal(t, "artifacts/yum/prod/rocky/packages", task.Repository)
+	require.Equal(t, "latest", task.Tag)
+	require.Equal(t, []byte("{}"), task.payload)
+
+	created, ok := replicationTaskTime(task.ID)
+	require.True(t, ok)
+	require.True(t, created.Equal(task.Time))
+
+	otherTarget.updatePending(ids)
+	require.Equal(t, 1, other.status()[0].Pending)
+	require.Positive(t, other.status()[0].LagSeconds)
+
+	// the target events are replicated by a single node
+	owned, err := target.claim(ctx)
+	require.NoError(t, err)
+	require.True(t, owned)
+	owned, err = otherTarget.claim(ctx)
+	require.NoError(t, err)
+	require.False(t, owned)
+
+	target.leaseExpires = time.Time{}
+	lease, err := target.getLease(ctx)
+	require.NoError(t, err)
+	lease.Expires = time.Now().Add(-time.Second)
+	data, err := json.Marshal(lease)
+	require.NoError(t, err)
+	require.NoError(t, driver.PutContent(ctx, target.leaseFile(), data))
+
+	owned, err = otherTarget.claim(ctx)
+	require.NoError(t, err)
+	require.True(t, owned)
+	owned, err = target.claim(ctx)
+	require.NoError(t, err)
+	require.False(t, owned)
+
+	require.NoError(t, target.removeEntry(ctx, task.ID))
+	target.updatePending(nil)
+
+	for i := 0; i < replicationMaxFailures+10; i++ {
+		target.fail(task, fmt.Errorf("failure %d", i))
+	}
+
+	status = r.status()
+	require.Equal(t, uint64(replicationMaxFailures+10), status[0].Failed)
+	require.Len(t, status[0].Failures, replicationMaxFailures)
+	require.Equal(t, "failure 10", status[0].Failures[0].Error)
+
+	require.Equal(t, replicationMaxFailures, target.retry(ctx))
+	require.Empty(t, r.status()[0].Failures)
+
+	// the same task failed repeatedly, it's persisted once
+	ids, err = target.entries(ctx)
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+
+	_, ok = r.target("unknown")
+	require.False(t, ok)
+
+	var nilReplicator *replicator
+	nilReplicator.replicate(ctx, replicationActionDelete, "artifacts/yum/prod/rocky/packages", dgst, "", "", nil)
+	require.Empty(t, nilReplicator.status())
+}
+
+func TestManifestTag(t *testing.T) {
+	ctx := context.Background()
+	require.Empty(t, manifestTag(ctx))
+	require.Equal(t, "latest", manifestTag(withManifestTag(ctx, "latest")))
+}
@@ -6,24 +6,40 @@ package beskar
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/distribution/reference"
 	"github.com/mailgun/groupcache/v2"
 	"github.com/opencontainers/go-digest"
+	"go.ciq.dev/beskar/internal/pkg/maintenance"
 )
 
 var manifestCacheKey int
 
+// manifestCache holds the manifest cache group, the group is
+// replaced when the cache size is changed on configuration reload.
 type manifestCache struct {
-	*groupcache.Group
+	group atomic.Pointer[groupcache.Group]
+}
+
+func (mc *manifestCache) load() *groupcache.Group {
+	if mc == nil {
+		return nil
+	}
+	return mc.group.Load()
 }
 
 type RepositoryMiddleware struct {
 	repository           distribution.Repository
 	manifestEventHandler ManifestEventHandler
 	cache                *groupcache.Group
+	quotas               *quotaManager
+	audit                *auditLog
+	maintenance          *maintenance.Mode
+	admission            *admissionController
+	blobCache            *blobCache
 }
 
 // Named returns the name of the repository.
@@ -44,6 +60,10 @@ func (m *RepositoryMiddleware) Manifests(ctx context.Context, options ...distrib
 		manifestEventHandler: m.manifestEventHandler,
 		repository:           m,
 		cache:                m.cache,
+		quotas:               m.quotas,
+		audit:                m.audit,
+		maintenance:          m.maintenance,
+		admission:            m.admission,
 	}
 
 	for _, option := range options {
@@ -57,7 +77,34 @@ func (m *RepositoryMiddleware) Manifests(ctx context.Context, options ...distrib
 
 // Blobs returns a reference to this repository's blob service.
 func (m *RepositoryMiddleware) Blobs(ctx context.Context) distribution.BlobStore {
-	return m.repository.Blobs(ctx)
+	repository := m.repository.Named().Name()
+
+	blobStore := m.repository.Blobs(ctx)
+
+	if len(m.quotas.match(repository)) > 0 {
+		blobStore = &quotaBlobStore{
+			BlobStore:  blobStore,
+			repository: repository,
+			quotas:     m.quotas,
+		}
+	}
+
+	if m.maintenance != nil {
+		blobStore = &maintenanceBlobStore{
+			BlobStore:   blobStore,
+			maintenance: m.maintenance,
+		}
+	}
+
+	if m.blobCache != nil {
+		blobStore = &blobCacheStore{
+			BlobStore:  blobStore,
+			repository: repository,
+			cache:      m.blobCache,
+		}
+	}
+
+	return blobStore
 }
 
 // Tags returns a reference to this repositories tag service
@@ -70,6 +117,10 @@ type manifestServiceWrapper struct {
 	manifestEventHandler ManifestEventHandler
 	repository           distribution.Repository
 	cache                *groupcache.Group
+	quotas               *quotaManager
+	audit                *auditLog
+	maintenance          *maintenance.Mode
+	admission            *admissionController
 }
 
 // Exists returns true if the manifest exists.
@@ -99,16 +150,69 @@ func (w *manifestServiceWrapper) Get(ctx context.Context, dgst digest.Digest, op
 }
 
 // Put creates or updates the given manifest returning the manifest digest
-func (w *manifestServiceWrapper) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
-	dgst, err := w.ManifestService.Put(ctx, manifest, options...)
+func (w *manifestServiceWrapper) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (dgst digest.Digest, errFn error) {
+	mediaType, payload, err := manifest.Payload()
 	if err != nil {
 		return "", err
 	}
 
-	mediaType, payload, err := manifest.Payload()
+	repository := w.repository.Named().Name()
+
+	defer func() {
+		auditDigest := dgst
+		if auditDigest == "" {
+			auditDigest = digest.FromBytes(payload)
+		}
+		w.audit.recordManifest(ctx, auditOperationPutManifest, repository, auditDigest.String(), errFn)
+	}()
+
+	if state := w.maintenance.Get(); state.Enabled {
+		return "", maintenanceError(state)
+	}
+
+	stored := false
+
+	if len(w.quotas.match(repository)) > 0 {
+		// pushing an existing manifest again doesn't change the usage
+		exists, err := w.ManifestService.Exists(ctx, digest.FromBytes(payload))
+		if err != nil {
+			return "", err
+		} else if !exists {
+			blobs := make([]digest.Digest, 0, len(manifest.References()))
+			for _, desc := range manifest.References() {
+				blobs = append(blobs, desc.Digest)
+			}
+
+			// the manifest size replaces the reservations of its blobs
+			size := manifestSize(manifest)
+			if err := w.quotas.reserve(ctx, repository, size, 1, blobs); err != nil {
+				return "", err
+			}
+
+			defer func() {
+				if !stored {
+					w.quotas.update(repository, -size, -1)
+				}
+			}()
+		}
+	}
+
+	tag := ""
+	for _, option := range options {
+		if tagOption, ok := option.(distribution.WithTagOption); ok {
+			tag = tagOption.Tag
+		}
+	}
+
+	if err := w.admission.admit(ctx, w.repository, tag, digest.FromBytes(payload), mediaType, payload); err != nil {
+		return "", err
+	}
+
+	dgst, err = w.ManifestService.Put(ctx, manifest, options...)
 	if err != nil {
 		return "", err
 	}
+	stored = true
 
 	if w.cache != nil {
 		value, err := encodeManifest(mediaType, payload)
@@ -122,12 +226,24 @@ func (w *manifestServiceWrapper) Put(ctx context.Context, manifest distribution.
 		}
 	}
 
+	if tag != "" {
+		ctx = withManifestTag(ctx, tag)
+	}
+
 	return dgst, w.manifestEventHandler.Put(ctx, w.repository, dgst, mediaType, payload)
 }
 
 // Delete removes the manifest specified by the given digest. Deleting
 // a manifest that doesn't exist will return ErrManifestNotFound
-func (w *manifestServiceWrapper) Delete(ctx context.Context, dgst digest.Digest) error {
+func (w *manifestServiceWrapper) Delete(ctx context.Context, dgst digest.Digest) (errFn error) {
+	defer func() {
+		w.audit.recordManifest(ctx, auditOperationDeleteManifest, w.repository.Named().Name(), dgst.String(), errFn)
+	}()
+
+	if state := w.maintenance.Get(); state.Enabled {
+		return maintenanceError(state)
+	}
+
 	manifest, err := w.Get(ctx, dgst, nil)
 	if err != nil {
 		return err
@@ -137,6 +253,8 @@ func (w *manifestServiceWrapper) Delete(ctx context.Context, dgst digest.Digest)
 		return err
 	}
 
+	w.quotas.update(w.repository.Named().Name(), -manifestSize(manifest), -1)
+
 	if w.cache != nil {
 		if err := w.cache.Remove(ctx, getCacheKey(w.repository, dgst)); err != nil {
 			return err
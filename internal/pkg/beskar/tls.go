@@ -113,7 +113,7 @@ func nextProtos(config *configuration.Configuration) []string {
 func (br *Registry) getTLSConfig(logger *logrus.Entry) (*tls.Config, error) {
 	var err error
 
-	config := br.beskarConfig.Registry
+	config := br.runningConfig().Registry
 
 	if config.HTTP.TLS.Certificate == "" && config.HTTP.TLS.LetsEncrypt.CacheFile == "" {
 		return nil, nil
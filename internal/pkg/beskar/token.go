@@ -0,0 +1,330 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"go.ciq.dev/beskar/internal/pkg/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const tokenPath = "/auth/token"
+
+var (
+	errInsufficientScope = errors.New("insufficient scope")
+	errInvalidToken      = errors.New("invalid token")
+)
+
+// tokenScope represents an access scope of the form type:name:actions,
+// the name may contain wildcards matching any characters.
+type tokenScope struct {
+	resourceType string
+	name         *regexp.Regexp
+	actions      map[string]struct{}
+}
+
+func parseTokenScope(scope string) (*tokenScope, error) {
+	resourceType, name, actions, err := splitScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	namePattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(name), `\*`, ".*") + "$"
+	nameMatcher, err := regexp.Compile(namePattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad scope name %q: %w", name, err)
+	}
+
+	ts := &tokenScope{
+		resourceType: resourceType,
+		name:         nameMatcher,
+		actions:      make(map[string]struct{}),
+	}
+	for _, action := range actions {
+		ts.actions[action] = struct{}{}
+	}
+
+	return ts, nil
+}
+
+func (ts *tokenScope) allow(resourceType, name, action string) bool {
+	if ts.resourceType != resourceType || !ts.name.MatchString(name) {
+		return false
+	}
+	if _, ok := ts.actions["*"]; ok {
+		return true
+	}
+	_, ok := ts.actions[action]
+	return ok
+}
+
+func splitScope(scope string) (string, string, []string, error) {
+	first := strings.IndexByte(scope, ':')
+	last := strings.LastIndexByte(scope, ':')
+	if first <= 0 || first == last || last == len(scope)-1 {
+		return "", "", nil, fmt.Errorf("bad scope format %q: type:name:actions expected", scope)
+	}
+	return scope[:first], scope[first+1 : last], strings.Split(scope[last+1:], ","), nil
+}
+
+type tokenAccount struct {
+	hashPassword []byte
+	scopes       []*tokenScope
+}
+
+type tokenAccess struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+}
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Access []*tokenAccess `json:"access"`
+}
+
+func (tc *tokenClaims) allow(access auth.Access) bool {
+	for _, ta := range tc.Access {
+		if ta.Type != access.Type || ta.Name != access.Name {
+			continue
+		}
+		for _, action := range ta.Actions {
+			if action == access.Action || action == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tokenAuthenticator issues and verifies bearer tokens.
+type tokenAuthenticator struct {
+	config   config.TokenAuth
+	secret   []byte
+	accounts map[string]*tokenAccount
+}
+
+func newTokenAuthenticator(tokenConfig config.TokenAuth) (*tokenAuthenticator, error) {
+	ta := &tokenAuthenticator{
+		config:   tokenConfig,
+		secret:   []byte(tokenConfig.Secret),
+		accounts: make(map[string]*tokenAccount),
+	}
+
+	for _, account := range tokenConfig.Accounts {
+		idx := strings.Index(account.Account, ":")
+		if idx <= 0 || idx+1 >= len(account.Account) {
+			return nil, fmt.Errorf("token account is badly formatted: htpasswd bcrypt format expected")
+		}
+		username := account.Account[:idx]
+
+		tokenAccount := &tokenAccount{
+			hashPassword: []byte(account.Account[idx+1:]),
+		}
+		for _, scope := range account.Scopes {
+			ts, err := parseTokenScope(scope)
+			if err != nil {
+				return nil, fmt.Errorf("token account %s: %w", username, err)
+			}
+			tokenAccount.scopes = append(tokenAccount.scopes, ts)
+		}
+
+		ta.accounts[username] = tokenAccount
+	}
+
+	return ta, nil
+}
+
+func (ta *tokenAuthenticator) realm(r *http.Request) string {
+	if ta.config.Realm != "" {
+		return ta.config.Realm
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	} else if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, tokenPath)
+}
+
+func (ta *tokenAuthenticator) verify(tokenString string) (*tokenClaims, error) {
+	claims := new(tokenClaims)
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+		return ta.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	} else if claims.Issuer != ta.config.Issuer {
+		return nil, fmt.Errorf("token issuer %q mismatch", claims.Issuer)
+	} else if !claims.VerifyAudience(ta.config.Service, true) {
+		return nil, fmt.Errorf("token audience mismatch")
+	}
+
+	return claims, nil
+}
+
+func (ta *tokenAuthenticator) issue(username string, access []*tokenAccess) (string, time.Time, error) {
+	now := time.Now().UTC()
+
+	claims := &tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    ta.config.Issuer,
+			Subject:   username,
+			Audience:  jwt.ClaimStrings{ta.config.Service},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ta.config.Expiration)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.NewString(),
+		},
+		Access: access,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ta.secret)
+	return token, now, err
+}
+
+// grantedAccess returns the requested scopes filtered by the scopes allowed
+// for the account, a nil scope list means full access.
+func grantedAccess(requested []string, allowed []*tokenScope) []*tokenAccess {
+	var access []*tokenAccess
+
+	for _, scope := range requested {
+		resourceType, name, actions, err := splitScope(scope)
+		if err != nil {
+			continue
+		}
+
+		granted := make([]string, 0, len(actions))
+		for _, action := range actions {
+			if allowed == nil {
+				granted = append(granted, action)
+				continue
+			}
+			for _, ts := range allowed {
+				if ts.allow(resourceType, name, action) {
+					granted = append(granted, action)
+					break
+				}
+			}
+		}
+
+		if len(granted) > 0 {
+			access = append(access, &tokenAccess{
+				Type:    resourceType,
+				Name:    name,
+				Actions: granted,
+			})
+		}
+	}
+
+	return access
+}
+
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	IssuedAt    string `json:"issued_at"`
+}
+
+// serveToken implements the token endpoint of the docker registry token
+// authentication specification, accounts are authenticated with basic
+// authentication and receive a token limited to their allowed scopes,
+// only the registry account receives a token without scope restriction.
+func (ac *accessController) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	ta := ac.tokenAuthenticator
+
+	if service := r.URL.Query().Get("service"); service != "" && service != ta.config.Service {
+		http.Error(w, fmt.Sprintf("unknown service %q", service), http.StatusBadRequest)
+		return
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Basic realm=beskar")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var allowed []*tokenScope
+
+	if account, ok := ta.accounts[username]; ok {
+		if err := bcrypt.CompareHashAndPassword(account.hashPassword, []byte(password)); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		allowed = account.scopes
+		if allowed == nil {
+			allowed = []*tokenScope{}
+		}
+	} else if registryAccount := ac.account.Load(); username != registryAccount.username {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if err := bcrypt.CompareHashAndPassword(registryAccount.hashPassword, []byte(password)); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var requested []string
+	for _, scope := range r.URL.Query()["scope"] {
+		requested = append(requested, strings.Fields(scope)...)
+	}
+
+	token, issuedAt, err := ta.issue(username, grantedAccess(requested, allowed))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_ = json.NewEncoder(w).Encode(&tokenResponse{
+		Token:       token,
+		AccessToken: token,
+		ExpiresIn:   int(ta.config.Expiration.Seconds()),
+		IssuedAt:    issuedAt.Format(time.RFC3339),
+	})
+}
+
+// challengeScope returns the scope parameter of a bearer challenge
+// for the requested access records.
+func challengeScope(accessRecords []auth.Access) string {
+	resourceActions := make(map[string][]string)
+	resources := make([]string, 0, len(accessRecords))
+
+	for _, record := range accessRecords {
+		resource := record.Type + ":" + record.Name
+		if _, ok := resourceActions[resource]; !ok {
+			resources = append(resources, resource)
+		}
+		resourceActions[resource] = append(resourceActions[resource], record.Action)
+	}
+
+	sort.Strings(resources)
+
+	scopes := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		scopes = append(scopes, resource+":"+strings.Join(resourceActions[resource], ","))
+	}
+
+	return strings.Join(scopes, " ")
+}
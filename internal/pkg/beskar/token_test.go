@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package beskar
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/distribution/distribution/v3/registry/auth"
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/pkg/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTokenScope(t *testing.T) {
+	ts, err := parseTokenScope("repository:artifacts/yum/team-a/*:pull,push")
+	require.NoError(t, err)
+
+	require.True(t, ts.allow("repository", "artifacts/yum/team-a/repo", "pull"))
+	require.True(t, ts.allow("repository", "artifacts/yum/team-a/repo/files:repodata", "push"))
+	require.False(t, ts.allow("repository", "artifacts/yum/team-a/repo", "delete"))
+	require.False(t, ts.allow("repository", "artifacts/yum/team-b/repo", "pull"))
+	require.False(t, ts.allow("registry", "artifacts/yum/team-a/repo", "pull"))
+
+	_, err = parseTokenScope("repository:pull")
+	require.Error(t, err)
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	ta, err := newTokenAuthenticator(config.TokenAuth{
+		Enabled:    true,
+		Service:    "beskar",
+		Issuer:     "beskar",
+		Secret:     "secret",
+		Expiration: time.Minute,
+	})
+	require.NoError(t, err)
+
+	allowed := []*tokenScope{}
+	ts, err := parseTokenScope("repository:artifacts/yum/team-a/*:pull")
+	require.NoError(t, err)
+	allowed = append(allowed, ts)
+
+	access := grantedAccess([]string{
+		"repository:artifacts/yum/team-a/repo:pull,push",
+		"repository:artifacts/yum/team-b/repo:pull",
+	}, allowed)
+	require.Len(t, access, 1)
+	require.Equal(t, []string{"pull"}, access[0].Actions)
+
+	token, _, err := ta.issue("team-a", access)
+	require.NoError(t, err)
+
+	claims, err := ta.verify(token)
+	require.NoError(t, err)
+	require.Equal(t, "team-a", claims.Subject)
+
+	pull := auth.Access{
+		Resource: auth.Resource{Type: "repository", Name: "artifacts/yum/team-a/repo"},
+		Action:   "pull",
+	}
+	push := pull
+	push.Action = "push"
+
+	require.True(t, claims.allow(pull))
+	require.False(t, claims.allow(push))
+
+	_, err = ta.verify(token + "x")
+	require.Error(t, err)
+}
+
+func TestServeToken(t *testing.T) {
+	hashPassword, err := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.MinCost)
+	require.NoError(t, err)
+	teamPassword, err := bcrypt.GenerateFromPassword([]byte("team"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	ta, err := newTokenAuthenticator(config.TokenAuth{
+		Enabled:    true,
+		Service:    "beskar",
+		Issuer:     "beskar",
+		Secret:     "secret",
+		Expiration: time.Minute,
+		Accounts: []config.TokenAccount{
+			{
+				Account: "team-a:" + string(teamPassword),
+				Scopes:  []string{"repository:artifacts/yum/team-a/*:pull"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	ac := &accessController{
+		tokenAuthenticator: ta,
+	}
+	ac.account.Store(&registryAccount{
+		username:     "beskar",
+		hashPassword: hashPassword,
+	})
+
+	for _, tc := range []struct {
+		username string
+		password string
+		status   int
+	}{
+		{username: "beskar", password: "admin", status: http.StatusOK},
+		{username: "team-a", password: "team", status: http.StatusOK},
+		{username: "team-a", password: "admin", status: http.StatusUnauthorized},
+		// the registry account password is only valid for the registry account
+		{username: "mallory", password: "admin", status: http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tokenPath+"?service=beskar&scope=repository:artifacts/yum/team-a/repo:pull", nil)
+		req.SetBasicAuth(tc.username, tc.password)
+
+		rec := httptest.NewRecorder()
+		ac.serveToken(rec, req)
+
+		require.Equal(t, tc.status, rec.Code, tc.username)
+	}
+}
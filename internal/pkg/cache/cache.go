@@ -15,20 +15,28 @@ import (
 	"time"
 
 	"github.com/mailgun/groupcache/v2"
+	"github.com/mailgun/groupcache/v2/consistenthash"
 )
 
 const (
 	// 64 MiB cache size by default
 	DefaultCacheSize = 1024 * 1024 * 64
+
+	// ringReplicas is the number of virtual nodes per peer,
+	// the same than groupcache.
+	ringReplicas = 50
 )
 
 type GroupCache struct {
-	peerMutex sync.Mutex
-	peers     map[string]string
-	pool      *groupcache.HTTPPool
-	groups    map[string]*groupcache.Group
-	self      string
-	server    *http.Server
+	peerMutex   sync.Mutex
+	peers       map[string]string
+	ring        *consistenthash.Map
+	pool        *groupcache.HTTPPool
+	groupsMutex sync.RWMutex
+	groups      map[string]*groupcache.Group
+	self        string
+	server      *http.Server
+	mux         *http.ServeMux
 }
 
 func NewCache(self string, options *groupcache.HTTPPoolOptions) *GroupCache {
@@ -39,14 +47,25 @@ func NewCache(self string, options *groupcache.HTTPPoolOptions) *GroupCache {
 	pool := groupcache.NewHTTPPoolOpts(self, options)
 	pool.Set(self)
 
-	return &GroupCache{
+	gc := &GroupCache{
 		peers: map[string]string{
 			self: "",
 		},
 		pool:   pool,
 		self:   self,
 		groups: make(map[string]*groupcache.Group),
+		mux:    http.NewServeMux(),
 	}
+	gc.mux.Handle("/", pool)
+	gc.setPeers()
+
+	return gc
+}
+
+// Handle registers an additional handler on the cache server,
+// it must be called before Start.
+func (gc *GroupCache) Handle(pattern string, handler http.Handler) {
+	gc.mux.Handle(pattern, handler)
 }
 
 func (gc *GroupCache) Start(tlsConfig *tls.Config) error {
@@ -60,7 +79,7 @@ func (gc *GroupCache) Start(tlsConfig *tls.Config) error {
 	}
 	ln = tls.NewListener(ln, tlsConfig)
 	gc.server = &http.Server{
-		Handler:           gc.pool,
+		Handler:           gc.mux,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 	return gc.server.Serve(ln)
@@ -83,6 +102,21 @@ func (gc *GroupCache) setPeers() {
 	sort.Strings(peers)
 
 	gc.pool.Set(peers...)
+
+	gc.ring = consistenthash.New(ringReplicas, nil)
+	gc.ring.Add(peers...)
+}
+
+// PickPeer returns the peer owning the key with the same consistent
+// hashing than the groupcache groups, self is true if the peer is
+// the local peer.
+func (gc *GroupCache) PickPeer(key string) (peer string, self bool) {
+	gc.peerMutex.Lock()
+	defer gc.peerMutex.Unlock()
+
+	peer = gc.ring.Get(key)
+
+	return peer, peer == gc.self
 }
 
 func (gc *GroupCache) AddPeer(peer string, name string) {
@@ -102,7 +136,29 @@ func (gc *GroupCache) RemovePeer(peer string, name string) {
 	gc.peerMutex.Unlock()
 }
 
+// Peers returns a copy of the peers URL mapped to their gossip
+// node name, the local peer has an empty node name.
+func (gc *GroupCache) Peers() map[string]string {
+	peers := make(map[string]string)
+
+	if gc == nil {
+		return peers
+	}
+
+	gc.peerMutex.Lock()
+	defer gc.peerMutex.Unlock()
+
+	for peer, name := range gc.peers {
+		peers[peer] = name
+	}
+
+	return peers
+}
+
 func (gc *GroupCache) NewGroup(name string, cacheBytes int64, getter groupcache.Getter) (*groupcache.Group, error) {
+	gc.groupsMutex.Lock()
+	defer gc.groupsMutex.Unlock()
+
 	if group, ok := gc.groups[name]; ok {
 		return group, nil
 	}
@@ -116,3 +172,21 @@ func (gc *GroupCache) NewGroup(name string, cacheBytes int64, getter groupcache.
 
 	return group, nil
 }
+
+// ReplaceGroup replaces the named group by a new group with a different
+// cache size, the values cached by the previous group are dropped.
+func (gc *GroupCache) ReplaceGroup(name string, cacheBytes int64, getter groupcache.Getter) (*groupcache.Group, error) {
+	gc.groupsMutex.Lock()
+	defer gc.groupsMutex.Unlock()
+
+	if getter == nil {
+		return nil, fmt.Errorf("getter is nil")
+	}
+
+	groupcache.DeregisterGroup(name)
+
+	group := groupcache.NewGroup(name, cacheBytes, getter)
+	gc.groups[name] = group
+
+	return group, nil
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.ciq.dev/beskar/internal/pkg/metrics"
+)
+
+var (
+	cacheGetsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "cache", "gets_total"),
+		"Total number of cache get requests, including from peers.",
+		[]string{"group"}, nil,
+	)
+	cacheHitsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "cache", "hits_total"),
+		"Total number of cache hits.",
+		[]string{"group"}, nil,
+	)
+	cacheMissesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "cache", "misses_total"),
+		"Total number of cache misses.",
+		[]string{"group"}, nil,
+	)
+	cachePeerLoadsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "cache", "peer_loads_total"),
+		"Total number of values loaded from peers.",
+		[]string{"group"}, nil,
+	)
+	cachePeerErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "cache", "peer_errors_total"),
+		"Total number of errors while loading values from peers.",
+		[]string{"group"}, nil,
+	)
+	cacheLocalLoadErrorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, "cache", "local_load_errors_total"),
+		"Total number of errors while loading values locally.",
+		[]string{"group"}, nil,
+	)
+)
+
+var _ prometheus.Collector = &GroupCache{}
+
+// Describe implements prometheus.Collector.
+func (gc *GroupCache) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheGetsDesc
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cachePeerLoadsDesc
+	ch <- cachePeerErrorsDesc
+	ch <- cacheLocalLoadErrorsDesc
+}
+
+// Collect implements prometheus.Collector and reports
+// the statistics of all cache groups.
+func (gc *GroupCache) Collect(ch chan<- prometheus.Metric) {
+	gc.groupsMutex.RLock()
+	defer gc.groupsMutex.RUnlock()
+
+	for name, group := range gc.groups {
+		stats := &group.Stats
+
+		ch <- prometheus.MustNewConstMetric(cacheGetsDesc, prometheus.CounterValue, float64(stats.Gets.Get()), name)
+		ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stats.CacheHits.Get()), name)
+		ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stats.Loads.Get()), name)
+		ch <- prometheus.MustNewConstMetric(cachePeerLoadsDesc, prometheus.CounterValue, float64(stats.PeerLoads.Get()), name)
+		ch <- prometheus.MustNewConstMetric(cachePeerErrorsDesc, prometheus.CounterValue, float64(stats.PeerErrors.Get()), name)
+		ch <- prometheus.MustNewConstMetric(cacheLocalLoadErrorsDesc, prometheus.CounterValue, float64(stats.LocalLoadErrs.Get()), name)
+	}
+}
@@ -9,13 +9,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/distribution/distribution/v3/configuration"
 	"go.ciq.dev/beskar/internal/pkg/gossip"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
+	"go.ciq.dev/beskar/internal/pkg/webhook"
 )
 
 const (
@@ -26,35 +31,203 @@ const (
 //go:embed default/beskar.yaml
 var defaultBeskarConfig string
 
-type Cache struct {
-	Addr string `yaml:"addr"`
+// BlobCache defines the local disk cache of blobs served by the registry,
+// blobs are spread across the beskar instances with consistent hashing.
+type BlobCache struct {
+	// Dir is the cache directory, the blob cache is disabled when empty.
+	Dir string `yaml:"dir"`
+	// Size is the maximum size of the cache in MiB.
 	Size uint32 `yaml:"size"`
+	// MaxBlobSize is the maximum size in MiB of a cached blob, larger
+	// blobs are always served from the storage.
+	MaxBlobSize uint32 `yaml:"maxblobsize"`
+}
+
+type Cache struct {
+	Addr  string    `yaml:"addr"`
+	Size  uint32    `yaml:"size"`
+	Blobs BlobCache `yaml:"blobs"`
 }
 
 type Router struct {
 	BodyLimit int64 `yaml:"bodylimit"`
 }
 
+// TokenAccount defines an account allowed to request bearer tokens
+// from the beskar token endpoint.
+type TokenAccount struct {
+	// Account with a bcrypt hashed password in htpasswd format.
+	Account string `yaml:"account"`
+	// Scopes granted to the account in the form type:name:actions,
+	// name accepts wildcards (eg: repository:artifacts/yum/team-a/*:pull,push).
+	Scopes []string `yaml:"scopes"`
+}
+
+type TokenAuth struct {
+	Enabled bool `yaml:"enabled"`
+	// Realm is the token endpoint URL returned to clients with
+	// the authentication challenge, when empty it's built from
+	// the request host.
+	Realm      string         `yaml:"realm"`
+	Service    string         `yaml:"service"`
+	Issuer     string         `yaml:"issuer"`
+	Secret     string         `yaml:"secret"`
+	Expiration time.Duration  `yaml:"expiration"`
+	Accounts   []TokenAccount `yaml:"accounts"`
+}
+
+// AuthPolicy defines an operator supplied Rego authorization policy
+// evaluated for every registry and plugin request, the policy must
+// define the rule data.beskar.authz.allow.
+type AuthPolicy struct {
+	// Rego is the path of the Rego policy file, the policy is
+	// disabled when empty.
+	Rego string `yaml:"rego"`
+	// Data is an optional path to a JSON file loaded as policy data.
+	Data string `yaml:"data"`
+}
+
+type Auth struct {
+	Token  TokenAuth  `yaml:"token"`
+	Policy AuthPolicy `yaml:"policy"`
+}
+
+// Quota defines storage limits for the repositories under a namespace,
+// a zero limit means unlimited.
+type Quota struct {
+	// Namespace is a repository prefix (eg: artifacts/static/team-x).
+	Namespace string `yaml:"namespace"`
+	// MaxBytes is the maximum total size of the artifacts layers.
+	MaxBytes int64 `yaml:"maxbytes"`
+	// MaxArtifacts is the maximum number of artifact manifests.
+	MaxArtifacts int64 `yaml:"maxartifacts"`
+}
+
+// ProxyUpstream defines an upstream OCI registry whose repositories are
+// pulled through and cached under a namespace (eg: pulling
+// proxy/docker.io/library/alpine pulls library/alpine from docker.io).
+type ProxyUpstream struct {
+	// Namespace is the repository prefix mapped to the upstream registry.
+	Namespace string `yaml:"namespace"`
+	// URL is the upstream registry URL (eg: https://registry-1.docker.io).
+	URL string `yaml:"url"`
+	// Username and Password are the upstream registry credentials,
+	// anonymous access is used when empty.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// TTL is the time a tag resolved from the upstream registry is
+	// served from the cache before being resolved again.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+type Proxy struct {
+	Upstreams []ProxyUpstream `yaml:"upstreams"`
+}
+
+// ReplicationTarget defines a remote beskar cluster or OCI registry the
+// matching repositories are replicated to, manifests pushed and deleted
+// locally are pushed and deleted on the remote registry along with the
+// missing blobs.
+type ReplicationTarget struct {
+	// Name identifies the target in logs, metrics and the admin API.
+	Name string `yaml:"name"`
+	// URL is the remote registry URL (eg: https://beskar.cluster-b.example.com).
+	URL string `yaml:"url"`
+	// Username and Password are the remote registry credentials,
+	// anonymous access is used when empty.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Repositories are the replicated repository globs (eg: artifacts/yum/prod/*).
+	Repositories []string `yaml:"repositories"`
+}
+
+type Replication struct {
+	Targets []ReplicationTarget `yaml:"targets"`
+}
+
+const (
+	// AdmissionFailurePolicyIgnore admits the manifest when the plugin can't be asked.
+	AdmissionFailurePolicyIgnore = "ignore"
+	// AdmissionFailurePolicyFail rejects the push when the plugin can't be asked.
+	AdmissionFailurePolicyFail = "fail"
+)
+
+// Admission defines the checks run before a pushed manifest is committed,
+// besides the optional Rego policy the enabled plugins are asked to validate
+// the artifacts pushed to their repositories.
+type Admission struct {
+	// Rego is the path of the Rego admission policy file, the policy
+	// must define the set data.beskar.admission.deny containing the
+	// rejection messages. The policy is disabled when empty.
+	Rego string `yaml:"rego"`
+	// Data is an optional path to a JSON file loaded as policy data.
+	Data string `yaml:"data"`
+	// Plugins are the names of the plugins asked to validate the manifests
+	// pushed by clients (eg: yum), no plugin is asked when empty.
+	Plugins []string `yaml:"plugins"`
+	// FailurePolicy is applied when a plugin can't be asked, either ignore
+	// to admit the manifest or fail to reject the push, defaults to ignore.
+	FailurePolicy string `yaml:"failurepolicy"`
+}
+
+// Audit defines the audit log settings.
+type Audit struct {
+	// TrustedProxies are the IP addresses or CIDR ranges of the reverse
+	// proxies and load balancers in front of beskar, the X-Forwarded-For
+	// and X-Real-Ip headers are only honored from those addresses to
+	// record the client IP address.
+	TrustedProxies []string `yaml:"trustedproxies"`
+}
+
 type BeskarConfig struct {
-	Version   string                       `yaml:"version"`
-	Profiling bool                         `yaml:"profiling"`
-	Hostname  string                       `yaml:"hostname"`
-	Cache     Cache                        `yaml:"cache"`
-	Gossip    gossip.Config                `yaml:"gossip"`
-	Registry  *configuration.Configuration `yaml:"registry"`
-	Router    Router                       `yaml:"router"`
+	Version     string                       `yaml:"version"`
+	Profiling   bool                         `yaml:"profiling"`
+	Hostname    string                       `yaml:"hostname"`
+	Cache       Cache                        `yaml:"cache"`
+	Gossip      gossip.Config                `yaml:"gossip"`
+	Registry    *configuration.Configuration `yaml:"registry"`
+	Router      Router                       `yaml:"router"`
+	Auth        Auth                         `yaml:"auth"`
+	Tracing     tracing.Config               `yaml:"tracing"`
+	Webhooks    webhook.Config               `yaml:"webhooks"`
+	Quotas      []Quota                      `yaml:"quotas"`
+	Proxy       Proxy                        `yaml:"proxy"`
+	Replication Replication                  `yaml:"replication"`
+	Admission   Admission                    `yaml:"admission"`
+	Audit       Audit                        `yaml:"audit"`
 }
 
 type BeskarConfigV1 BeskarConfig
 
-func ParseBeskarConfig(dir string) (*BeskarConfig, error) {
-	inMemoryConfig := false
-	customDir := false
-	filename := filepath.Join(DefaultConfigDir, BeskarConfigFile)
+// ParseTrustedProxy parses a trusted proxy IP address or CIDR range.
+func ParseTrustedProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("bad CIDR range %q: %w", proxy, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("bad IP address %q: %w", proxy, err)
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// BeskarConfigPath returns the path of the beskar configuration
+// file for the configuration directory.
+func BeskarConfigPath(dir string) string {
 	if dir != "" {
-		filename = filepath.Join(dir, BeskarConfigFile)
-		customDir = true
+		return filepath.Join(dir, BeskarConfigFile)
 	}
+	return filepath.Join(DefaultConfigDir, BeskarConfigFile)
+}
+
+func ParseBeskarConfig(dir string) (*BeskarConfig, error) {
+	inMemoryConfig := false
+	customDir := dir != ""
+	filename := BeskarConfigPath(dir)
 
 	var configReader io.Reader
 
@@ -110,11 +283,103 @@ func ParseBeskarConfig(dir string) (*BeskarConfig, error) {
 					if v1.Cache.Size == 0 {
 						v1.Cache.Size = 64
 					}
+					if v1.Cache.Blobs.Dir != "" {
+						if v1.Cache.Blobs.Size == 0 {
+							v1.Cache.Blobs.Size = 10240
+						}
+						if v1.Cache.Blobs.MaxBlobSize == 0 || v1.Cache.Blobs.MaxBlobSize > v1.Cache.Blobs.Size {
+							v1.Cache.Blobs.MaxBlobSize = min(512, v1.Cache.Blobs.Size)
+						}
+					}
 
 					if v1.Gossip.Key == "" {
 						return nil, fmt.Errorf("gossip key is missing")
 					}
 
+					if v1.Auth.Token.Enabled {
+						if v1.Auth.Token.Secret == "" {
+							return nil, fmt.Errorf("token authentication secret is missing")
+						}
+						if v1.Auth.Token.Service == "" {
+							v1.Auth.Token.Service = "beskar"
+						}
+						if v1.Auth.Token.Issuer == "" {
+							v1.Auth.Token.Issuer = "beskar"
+						}
+						if v1.Auth.Token.Expiration == 0 {
+							v1.Auth.Token.Expiration = 5 * time.Minute
+						}
+					}
+
+					for i, quota := range v1.Quotas {
+						v1.Quotas[i].Namespace = strings.Trim(quota.Namespace, "/")
+						if v1.Quotas[i].Namespace == "" {
+							return nil, fmt.Errorf("quota %d: namespace is missing", i)
+						} else if quota.MaxBytes < 0 || quota.MaxArtifacts < 0 {
+							return nil, fmt.Errorf("quota %s: negative limit", quota.Namespace)
+						}
+					}
+
+					namespaces := make(map[string]struct{})
+					for i, upstream := range v1.Proxy.Upstreams {
+						v1.Proxy.Upstreams[i].Namespace = strings.Trim(upstream.Namespace, "/")
+						namespace := v1.Proxy.Upstreams[i].Namespace
+						if namespace == "" {
+							return nil, fmt.Errorf("proxy upstream %d: namespace is missing", i)
+						} else if namespace == "artifacts" || strings.HasPrefix(namespace, "artifacts/") {
+							return nil, fmt.Errorf("proxy upstream %s: artifacts namespace is reserved to plugins", namespace)
+						} else if _, ok := namespaces[namespace]; ok {
+							return nil, fmt.Errorf("proxy upstream %s: duplicate namespace", namespace)
+						}
+						namespaces[namespace] = struct{}{}
+
+						u, err := url.Parse(upstream.URL)
+						if err != nil {
+							return nil, fmt.Errorf("proxy upstream %s: bad URL: %w", namespace, err)
+						} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+							return nil, fmt.Errorf("proxy upstream %s: URL %q must be an http(s) URL", namespace, upstream.URL)
+						}
+						if upstream.TTL < 0 {
+							return nil, fmt.Errorf("proxy upstream %s: negative TTL", namespace)
+						} else if upstream.TTL == 0 {
+							v1.Proxy.Upstreams[i].TTL = time.Hour
+						}
+					}
+
+					targets := make(map[string]struct{})
+					for i, target := range v1.Replication.Targets {
+						if target.Name == "" {
+							return nil, fmt.Errorf("replication target %d: name is missing", i)
+						} else if _, ok := targets[target.Name]; ok {
+							return nil, fmt.Errorf("replication target %s: duplicate name", target.Name)
+						}
+						targets[target.Name] = struct{}{}
+
+						u, err := url.Parse(target.URL)
+						if err != nil {
+							return nil, fmt.Errorf("replication target %s: bad URL: %w", target.Name, err)
+						} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+							return nil, fmt.Errorf("replication target %s: URL %q must be an http(s) URL", target.Name, target.URL)
+						}
+						if len(target.Repositories) == 0 {
+							return nil, fmt.Errorf("replication target %s: no repository to replicate", target.Name)
+						}
+					}
+
+					switch v1.Admission.FailurePolicy {
+					case "":
+						v1.Admission.FailurePolicy = AdmissionFailurePolicyIgnore
+					case AdmissionFailurePolicyIgnore, AdmissionFailurePolicyFail:
+					default:
+						return nil, fmt.Errorf("admission: unknown failure policy %q", v1.Admission.FailurePolicy)
+					}
+
+					for _, proxy := range v1.Audit.TrustedProxies {
+						if _, err := ParseTrustedProxy(proxy); err != nil {
+							return nil, fmt.Errorf("audit trusted proxy: %w", err)
+						}
+					}
+
 					return (*BeskarConfig)(v1), nil
 				}
 				return nil, fmt.Errorf("expected *BeskarConfigV1, received %#v", c)
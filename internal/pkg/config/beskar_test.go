@@ -5,6 +5,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -24,4 +25,9 @@ func TestParseBeskarConfig(t *testing.T) {
 	require.Equal(t, []string{}, bc.Gossip.Peers)
 
 	require.Equal(t, "localhost", bc.Hostname)
+
+	require.Equal(t, false, bc.Auth.Token.Enabled)
+	require.Equal(t, "beskar", bc.Auth.Token.Service)
+	require.Equal(t, "beskar", bc.Auth.Token.Issuer)
+	require.Equal(t, 5*time.Minute, bc.Auth.Token.Expiration)
 }
@@ -0,0 +1,281 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package diskcache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// ErrTooLarge is returned when a blob doesn't fit in the cache.
+var ErrTooLarge = errors.New("blob exceeds the cache size")
+
+const tmpDir = "tmp"
+
+type entry struct {
+	digest digest.Digest
+	size   int64
+}
+
+// Cache is a size bounded content addressed disk cache, the least
+// recently used blobs are evicted first. Blobs are stored under
+// <dir>/<algorithm>/<first two hex characters>/<hex>.
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mutex     sync.Mutex
+	size      int64
+	lru       *list.List
+	entries   map[digest.Digest]*list.Element
+	evictions uint64
+}
+
+// New returns a cache storing up to maxSize bytes in the directory, blobs
+// already present are indexed by modification time.
+func New(dir string, maxSize int64) (*Cache, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("cache size must be positive")
+	}
+
+	c := &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[digest.Digest]*list.Element),
+	}
+
+	// discard partially written blobs
+	if err := os.RemoveAll(filepath.Join(dir, tmpDir)); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, tmpDir), 0o700); err != nil {
+		return nil, err
+	}
+
+	if err := c.load(); err != nil {
+		return nil, fmt.Errorf("while loading cache directory %s: %w", dir, err)
+	}
+
+	return c, nil
+}
+
+func (c *Cache) load() error {
+	type file struct {
+		entry
+		modTime time.Time
+	}
+
+	var files []file
+
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if d.IsDir() {
+			if d.Name() == tmpDir && filepath.Dir(path) == c.dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// files not stored by the cache are ignored
+		dgst := digest.NewDigestFromEncoded(digest.Algorithm(filepath.Base(filepath.Dir(filepath.Dir(path)))), d.Name())
+		if dgst.Validate() != nil || c.path(dgst) != path {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		files = append(files, file{
+			entry: entry{
+				digest: dgst,
+				size:   info.Size(),
+			},
+			modTime: info.ModTime(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i := range files {
+		c.entries[files[i].digest] = c.lru.PushFront(&files[i].entry)
+		c.size += files[i].size
+	}
+
+	return c.evict()
+}
+
+func (c *Cache) path(dgst digest.Digest) string {
+	encoded := dgst.Encoded()
+	return filepath.Join(c.dir, dgst.Algorithm().String(), encoded[:2], encoded)
+}
+
+// Open returns the cached blob, it returns an error satisfying
+// errors.Is(err, fs.ErrNotExist) if the blob isn't cached.
+func (c *Cache) Open(dgst digest.Digest) (*os.File, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[dgst]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	f, err := os.Open(c.path(dgst))
+	if err != nil {
+		// removed behind our back
+		_ = c.remove(element)
+		return nil, err
+	}
+
+	c.lru.MoveToFront(element)
+
+	return f, nil
+}
+
+// Put stores the blob content read from r, the content is verified
+// against the digest before being added to the cache.
+func (c *Cache) Put(dgst digest.Digest, r io.Reader) (errFn error) {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(c.dir, tmpDir), "blob-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if errFn != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	verifier := dgst.Verifier()
+
+	size, err := io.Copy(io.MultiWriter(tmp, verifier), io.LimitReader(r, c.maxSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	} else if size > c.maxSize {
+		return ErrTooLarge
+	} else if !verifier.Verified() {
+		return fmt.Errorf("blob content doesn't match digest %s", dgst)
+	}
+
+	path := c.path(dgst)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[dgst]; ok {
+		c.lru.MoveToFront(element)
+		return os.Remove(tmp.Name())
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	c.entries[dgst] = c.lru.PushFront(&entry{
+		digest: dgst,
+		size:   size,
+	})
+	c.size += size
+
+	return c.evict()
+}
+
+// Delete removes the blob from the cache.
+func (c *Cache) Delete(dgst digest.Digest) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[dgst]
+	if !ok {
+		return nil
+	}
+
+	return c.remove(element)
+}
+
+// evict removes the least recently used blobs until the cache size is
+// below the limit, opened blobs remain readable until they are closed.
+func (c *Cache) evict() error {
+	for c.size > c.maxSize {
+		element := c.lru.Back()
+		if element == nil {
+			return nil
+		}
+		if err := c.remove(element); err != nil {
+			return err
+		}
+		c.evictions++
+	}
+	return nil
+}
+
+func (c *Cache) remove(element *list.Element) error {
+	e := c.lru.Remove(element).(*entry)
+	delete(c.entries, e.digest)
+	c.size -= e.size
+
+	if err := os.Remove(c.path(e.digest)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Stats are the cache statistics.
+type Stats struct {
+	Size      int64  `json:"size"`
+	MaxSize   int64  `json:"maxSize"`
+	Blobs     int    `json:"blobs"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// Stats returns the cache statistics.
+func (c *Cache) Stats() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return Stats{
+		Size:      c.size,
+		MaxSize:   c.maxSize,
+		Blobs:     len(c.entries),
+		Evictions: c.evictions,
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package diskcache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func putBlob(t *testing.T, c *Cache, content string) digest.Digest {
+	dgst := digest.FromString(content)
+	require.NoError(t, c.Put(dgst, strings.NewReader(content)))
+	return dgst
+}
+
+func readBlob(t *testing.T, c *Cache, dgst digest.Digest) string {
+	f, err := c.Open(dgst)
+	require.NoError(t, err)
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	require.NoError(t, err)
+
+	return string(content)
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := New(dir, 10)
+	require.NoError(t, err)
+
+	a := putBlob(t, c, "aaaa")
+	b := putBlob(t, c, "bbbb")
+	require.Equal(t, "aaaa", readBlob(t, c, a))
+
+	// b is the least recently used blob
+	d := putBlob(t, c, "dddd")
+
+	_, err = c.Open(b)
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+	require.Equal(t, "aaaa", readBlob(t, c, a))
+	require.Equal(t, "dddd", readBlob(t, c, d))
+	require.Equal(t, Stats{Size: 8, MaxSize: 10, Blobs: 2, Evictions: 1}, c.Stats())
+
+	err = c.Put(digest.FromString("too large"), strings.NewReader("too large for the cache"))
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	err = c.Put(digest.FromString("other"), bytes.NewReader([]byte("content")))
+	require.Error(t, err)
+
+	require.NoError(t, c.Delete(d))
+	_, err = c.Open(d)
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	// blobs are indexed again on restart
+	c, err = New(dir, 10)
+	require.NoError(t, err)
+	require.Equal(t, "aaaa", readBlob(t, c, a))
+	require.Equal(t, Stats{Size: 4, MaxSize: 10, Blobs: 1}, c.Stats())
+
+	// the cache is shrunk to the new size
+	c, err = New(dir, 2)
+	require.NoError(t, err)
+	require.Equal(t, 0, c.Stats().Blobs)
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/memberlist"
+	"go.ciq.dev/beskar/internal/pkg/maintenance"
 )
 
 // Member represents a member part of a gossip cluster.
@@ -91,6 +92,12 @@ func (member *Member) join(peers []string) (int, error) {
 	return count, err
 }
 
+// Join joins the cluster through the given peers, unlike the initial
+// join the member is not shut down when it fails.
+func (member *Member) Join(peers []string) (int, error) {
+	return member.ml.Join(peers)
+}
+
 // Shutdown leaves the cluster.
 func (member *Member) Shutdown() error {
 	if member == nil {
@@ -124,16 +131,39 @@ func (member *Member) Send(node *memberlist.Node, msg []byte) error {
 
 // MarkAsReady updates node metadata ready status and advertise nodes about change.
 func (member *Member) MarkAsReady(timeout time.Duration) error {
+	return member.updateMeta(timeout, func(meta *BeskarMeta) {
+		meta.Ready = true
+	})
+}
+
+// SetMaintenance updates node metadata maintenance state and advertise nodes about change.
+func (member *Member) SetMaintenance(state maintenance.State, timeout time.Duration) error {
+	return member.updateMeta(timeout, func(meta *BeskarMeta) {
+		meta.Maintenance = state
+	})
+}
+
+func (member *Member) updateMeta(timeout time.Duration, updateFn func(*BeskarMeta)) error {
+	member.nd.metaMutex.Lock()
+
 	meta := NewBeskarMeta()
 	if err := meta.Decode(member.nd.meta); err != nil {
+		member.nd.metaMutex.Unlock()
 		return fmt.Errorf("while decoding metadata")
 	}
-	meta.Ready = true
+	updateFn(meta)
 	mb, err := meta.Encode()
 	if err != nil {
+		member.nd.metaMutex.Unlock()
 		return err
+	} else if len(mb) > memberlist.MetaMaxSize {
+		member.nd.metaMutex.Unlock()
+		return fmt.Errorf("meta data size exceed limit of %d bytes", memberlist.MetaMaxSize)
 	}
 	member.nd.meta = mb
+
+	member.nd.metaMutex.Unlock()
+
 	return member.ml.UpdateNode(timeout)
 }
 
@@ -4,6 +4,8 @@
 package gossip
 
 import (
+	"sync"
+
 	"github.com/hashicorp/memberlist"
 )
 
@@ -28,6 +30,7 @@ type MemberEvent struct {
 
 // nodeDelegate regroups some hooks.
 type nodeDelegate struct {
+	metaMutex   sync.RWMutex
 	meta        []byte
 	eventChan   chan MemberEvent
 	localState  []byte
@@ -69,7 +72,12 @@ func (nd *nodeDelegate) NotifyUpdate(node *memberlist.Node) {
 
 // NodeMeta is used to retrieve meta-data about the current node
 // when broadcasting an alive message.
-func (nd *nodeDelegate) NodeMeta(_ int) []byte { return nd.meta }
+func (nd *nodeDelegate) NodeMeta(_ int) []byte {
+	nd.metaMutex.RLock()
+	defer nd.metaMutex.RUnlock()
+
+	return nd.meta
+}
 
 // GetBroadcasts is called when user data messages can be broadcast.
 func (nd *nodeDelegate) GetBroadcasts(_, _ int) [][]byte { return nil }
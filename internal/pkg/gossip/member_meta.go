@@ -6,6 +6,8 @@ package gossip
 import (
 	"bytes"
 	"encoding/gob"
+
+	"go.ciq.dev/beskar/internal/pkg/maintenance"
 )
 
 type InstanceType uint8
@@ -28,6 +30,8 @@ type BeskarMeta struct {
 	// for beskar instances it will return the configured hostname, for plugins it returns
 	// the node hostname
 	Hostname string
+	// Maintenance is the read-only maintenance state known by beskar instances.
+	Maintenance maintenance.State
 }
 
 func NewBeskarMeta() *BeskarMeta {
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sync/atomic"
+	"time"
+)
+
+// MaxReasonLength is the maximum length of a maintenance reason, the state
+// is advertised with the gossip node metadata which has a limited size.
+const MaxReasonLength = 128
+
+// RetryAfter is the delay suggested to clients to retry rejected requests.
+const RetryAfter = 60 * time.Second
+
+// State is the cluster read-only state, beskar instances advertise it with
+// their gossip node metadata and the state with the highest version wins.
+type State struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+	// Version is the change time in unix nanoseconds.
+	Version int64 `json:"version"`
+}
+
+// Since returns the time the state was changed.
+func (s State) Since() time.Time {
+	if s.Version == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, s.Version).UTC()
+}
+
+// Message returns the message returned to clients with rejected requests.
+func (s State) Message() string {
+	if s.Reason != "" {
+		return fmt.Sprintf("beskar is in read-only maintenance mode: %s", s.Reason)
+	}
+	return "beskar is in read-only maintenance mode"
+}
+
+// Mode holds the maintenance state agreed by the cluster.
+type Mode struct {
+	state atomic.Pointer[State]
+}
+
+// Get returns the current state, a nil mode is never in maintenance.
+func (m *Mode) Get() State {
+	if m == nil {
+		return State{}
+	}
+	if s := m.state.Load(); s != nil {
+		return *s
+	}
+	return State{}
+}
+
+// Enabled returns true when the cluster is in read-only maintenance mode.
+func (m *Mode) Enabled() bool {
+	return m.Get().Enabled
+}
+
+// Next returns a new state versioned after the current state, versions are
+// the change time unless the current state comes from a node with a clock
+// ahead, the new state must be merged to be applied.
+func (m *Mode) Next(enabled bool, reason string) (State, error) {
+	if len(reason) > MaxReasonLength {
+		return State{}, fmt.Errorf("maintenance reason exceeds %d characters", MaxReasonLength)
+	}
+
+	version := time.Now().UnixNano()
+	if current := m.Get(); version <= current.Version {
+		version = current.Version + 1
+	}
+
+	return State{
+		Enabled: enabled,
+		Reason:  reason,
+		Version: version,
+	}, nil
+}
+
+// Merge sets the state if it's more recent than the current state,
+// it returns true if the state was changed.
+func (m *Mode) Merge(s State) bool {
+	for {
+		current := m.state.Load()
+		if current != nil && current.Version >= s.Version {
+			return false
+		} else if current == nil && s.Version == 0 {
+			return false
+		}
+		if m.state.CompareAndSwap(current, &s) {
+			return true
+		}
+	}
+}
+
+// IsMutatingRequest returns true for plugin API calls modifying
+// repositories: all requests other than GET and HEAD plus the GET requests
+// triggering a repository synchronization.
+func IsMutatingRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		switch path.Base(r.URL.Path) {
+		case "sync", "sync:url":
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+type failureResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// WriteError rejects a plugin API request with the same error format
+// than the plugin APIs.
+func WriteError(w http.ResponseWriter, s State) {
+	resp := failureResponse{}
+	resp.Error.Code = "UNAVAILABLE"
+	resp.Error.Message = s.Message()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(RetryAfter.Seconds())))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = json.NewEncoder(w).Encode(resp)
+}
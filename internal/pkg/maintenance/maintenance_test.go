@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package maintenance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMode(t *testing.T) {
+	var nilMode *Mode
+	require.False(t, nilMode.Enabled())
+
+	mode := &Mode{}
+	require.False(t, mode.Enabled())
+	require.False(t, mode.Merge(State{}))
+
+	enabled, err := mode.Next(true, "storage migration")
+	require.NoError(t, err)
+	require.True(t, mode.Merge(enabled))
+	require.True(t, mode.Enabled())
+	require.Equal(t, "beskar is in read-only maintenance mode: storage migration", mode.Get().Message())
+
+	// same or older states are ignored
+	require.False(t, mode.Merge(enabled))
+	require.False(t, mode.Merge(State{Version: enabled.Version - 1}))
+
+	// a node with a clock ahead
+	ahead := State{Enabled: true, Version: enabled.Version + int64(1e12)}
+	require.True(t, mode.Merge(ahead))
+
+	disabled, err := mode.Next(false, "")
+	require.NoError(t, err)
+	require.Greater(t, disabled.Version, ahead.Version)
+	require.True(t, mode.Merge(disabled))
+	require.False(t, mode.Enabled())
+
+	_, err = mode.Next(true, strings.Repeat("r", MaxReasonLength+1))
+	require.Error(t, err)
+}
+
+func TestIsMutatingRequest(t *testing.T) {
+	for method, mutating := range map[string]bool{
+		http.MethodGet:    false,
+		http.MethodHead:   false,
+		http.MethodPost:   true,
+		http.MethodPut:    true,
+		http.MethodDelete: true,
+	} {
+		req := httptest.NewRequest(method, "/artifacts/yum/api/v1/repository", nil)
+		require.Equal(t, mutating, IsMutatingRequest(req), method)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/artifacts/yum/api/v1/repository/sync:url", nil)
+	require.True(t, IsMutatingRequest(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/artifacts/yum/api/v1/repository/sync:status", nil)
+	require.False(t, IsMutatingRequest(req))
+}
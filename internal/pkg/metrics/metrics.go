@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace is the prefix of all beskar metrics.
+const Namespace = "beskar"
+
+const (
+	syncStatusSuccess = "success"
+	syncStatusFailure = "failure"
+)
+
+var (
+	syncDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "repository",
+			Name:      "sync_duration_seconds",
+			Help:      "Duration of repository synchronizations.",
+			// from 1 second to ~4.5 hours
+			Buckets: prometheus.ExponentialBuckets(1, 2, 15),
+		},
+		[]string{"plugin", "repository", "status"},
+	)
+	syncPackages = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Subsystem: "repository",
+			Name:      "sync_packages",
+			Help:      "Number of packages synchronized and total number of packages reported by the last repository synchronization.",
+		},
+		[]string{"plugin", "repository", "state"},
+	)
+)
+
+// Handler returns the HTTP handler exposing metrics in the prometheus format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveSync records the duration and the package counts of a repository synchronization.
+func ObserveSync(plugin, repository string, start time.Time, synced, total int, err error) {
+	status := syncStatusSuccess
+	if err != nil {
+		status = syncStatusFailure
+	}
+
+	syncDuration.WithLabelValues(plugin, repository, status).Observe(time.Since(start).Seconds())
+	syncPackages.WithLabelValues(plugin, repository, "synced").Set(float64(synced))
+	syncPackages.WithLabelValues(plugin, repository, "total").Set(float64(total))
+}
@@ -24,16 +24,20 @@ import (
 	"go.ciq.dev/beskar/internal/pkg/cmux"
 	"go.ciq.dev/beskar/internal/pkg/gossip"
 	"go.ciq.dev/beskar/internal/pkg/log"
+	"go.ciq.dev/beskar/internal/pkg/maintenance"
+	"go.ciq.dev/beskar/internal/pkg/metrics"
 	"go.ciq.dev/beskar/internal/pkg/repository"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
 	pluginv1 "go.ciq.dev/beskar/pkg/api/plugin/v1"
 	"go.ciq.dev/beskar/pkg/mtls"
 	"go.ciq.dev/beskar/pkg/netutil"
 )
 
 type Config struct {
-	Router *chi.Mux
-	Gossip gossip.Config
-	Info   *pluginv1.Info
+	Router  *chi.Mux
+	Gossip  gossip.Config
+	Tracing tracing.Config
+	Info    *pluginv1.Info
 }
 
 type Service[H repository.Handler] interface {
@@ -65,10 +69,26 @@ func Serve[H repository.Handler](ln net.Listener, service Service[H]) (errFn err
 
 	serviceConfig := service.Config()
 
+	shutdownTracing, err := tracing.Init(ctx, "beskar-"+serviceConfig.Info.Name, serviceConfig.Info.Version, serviceConfig.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// use a fresh context as the service context is probably canceled
+		tracingErr := shutdownTracing(context.Background())
+		if errFn == nil {
+			errFn = tracingErr
+		}
+	}()
+
+	serviceConfig.Router.Handle("/metrics", metrics.Handler())
+
 	httpContext := log.SetContextAttrs(ctx, slog.String("context", "http"))
 
+	maintenanceMode := &maintenance.Mode{}
+
 	server := http.Server{
-		Handler:           serviceConfig.Router,
+		Handler:           tracing.Handler(maintenanceMiddleware(maintenanceMode, serviceConfig.Router), serviceConfig.Info.Name),
 		ReadTimeout:       5 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
 		BaseContext: func(net.Listener) context.Context {
@@ -97,7 +117,7 @@ func Serve[H repository.Handler](ln net.Listener, service Service[H]) (errFn err
 		}
 	}()
 
-	beskarMetaCh := startGossipWatcher(ctx, gossipMember)
+	beskarMetaCh := startGossipWatcher(ctx, gossipMember, maintenanceMode)
 
 	if err := setServerTLSConfig(serverListener, caPEM); err != nil {
 		return err
@@ -139,6 +159,8 @@ func Serve[H repository.Handler](ln net.Listener, service Service[H]) (errFn err
 
 		serviceConfig.Router.With(IsTLSMiddleware).HandleFunc("/event", wh.event)
 		serviceConfig.Router.With(IsTLSMiddleware).HandleFunc("/info", wh.info)
+		serviceConfig.Router.With(IsTLSMiddleware).HandleFunc("/references", wh.references)
+		serviceConfig.Router.With(IsTLSMiddleware).HandleFunc("/admit", wh.admit)
 
 		transport, err := getBeskarTransport(caPEM, beskarMeta)
 		if err != nil {
@@ -197,7 +219,7 @@ func setServerTLSConfig(ln *cmux.Listener, caPEM *mtls.CAPEM) error {
 	return nil
 }
 
-func startGossipWatcher(ctx context.Context, member *gossip.Member) <-chan *gossip.BeskarMeta {
+func startGossipWatcher(ctx context.Context, member *gossip.Member, maintenanceMode *maintenance.Mode) <-chan *gossip.BeskarMeta {
 	var hostnameOnce sync.Once
 	beskarMetaCh := make(chan *gossip.BeskarMeta, 1)
 
@@ -220,6 +242,7 @@ func startGossipWatcher(ctx context.Context, member *gossip.Member) <-chan *goss
 					meta := gossip.NewBeskarMeta()
 					if err := meta.Decode(node.Meta); err == nil {
 						if meta.InstanceType == gossip.BeskarInstance {
+							mergeMaintenance(logger, maintenanceMode, meta.Maintenance)
 							hostnameOnce.Do(func() {
 								logger.Info("beskar instance added", "hostname", meta.Hostname, "port", meta.RegistryPort)
 								beskarMetaCh <- meta
@@ -228,6 +251,16 @@ func startGossipWatcher(ctx context.Context, member *gossip.Member) <-chan *goss
 						}
 					}
 				}
+			case gossip.NodeUpdate:
+				node, ok := event.Arg.(*memberlist.Node)
+				if !ok || self.Name == node.Name {
+					continue
+				}
+
+				meta := gossip.NewBeskarMeta()
+				if err := meta.Decode(node.Meta); err == nil && meta.InstanceType == gossip.BeskarInstance {
+					mergeMaintenance(logger, maintenanceMode, meta.Maintenance)
+				}
 			case gossip.NodeLeave:
 				node, ok := event.Arg.(*memberlist.Node)
 				if !ok || self.Name == node.Name {
@@ -241,6 +274,18 @@ func startGossipWatcher(ctx context.Context, member *gossip.Member) <-chan *goss
 	return beskarMetaCh
 }
 
+// mergeMaintenance merges the maintenance state advertised by a beskar instance.
+func mergeMaintenance(logger *slog.Logger, maintenanceMode *maintenance.Mode, state maintenance.State) {
+	if !maintenanceMode.Merge(state) {
+		return
+	}
+	if state.Enabled {
+		logger.Warn("read-only maintenance mode enabled", "reason", state.Reason)
+	} else {
+		logger.Info("read-only maintenance mode disabled")
+	}
+}
+
 func initGossip(port string, gossipConfig gossip.Config) (_ *gossip.Member, _ *mtls.CAPEM, errFn error) {
 	servicePort, err := strconv.ParseUint(port, 10, 16)
 	if err != nil {
@@ -327,5 +372,5 @@ func getBeskarTransport(caPEM *mtls.CAPEM, beskarMeta *gossip.BeskarMeta) (http.
 		return conn, conn.HandshakeContext(ctx)
 	}
 
-	return transport, nil
+	return tracing.Transport(transport), nil
 }
@@ -5,14 +5,22 @@ package pluginsrv
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"path/filepath"
+	"strings"
 
 	"go.ciq.dev/beskar/internal/pkg/log"
+	"go.ciq.dev/beskar/internal/pkg/maintenance"
 	"go.ciq.dev/beskar/internal/pkg/repository"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
 	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
 	pluginv1 "go.ciq.dev/beskar/pkg/api/plugin/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -39,6 +47,20 @@ func IsTLSMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// maintenanceMiddleware rejects the plugin API calls modifying repositories
+// while beskar is in read-only maintenance mode.
+func maintenanceMiddleware(mode *maintenance.Mode, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/artifacts/") && maintenance.IsMutatingRequest(r) {
+			if state := mode.Get(); state.Enabled {
+				maintenance.WriteError(w, state)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (wh *webHandler[H]) event(w http.ResponseWriter, r *http.Request) {
 	if wh.manager == nil {
 		w.WriteHeader(http.StatusNotImplemented)
@@ -65,25 +87,42 @@ func (wh *webHandler[H]) event(w http.ResponseWriter, r *http.Request) {
 	event := new(eventv1.EventPayload)
 	if err := proto.Unmarshal(buf.Bytes(), event); err != nil {
 		logger.ErrorContext(ctx, "unmarshal event", "error", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	repositoryName := filepath.Dir(event.Repository)
 	if repositoryName == "" {
 		logger.ErrorContext(ctx, "empty repository name")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	logger.InfoContext(ctx, "process event", "action", event.Action.String(), "repository", repositoryName)
 
+	ctx, span := tracing.Start(ctx, "plugin.event", trace.WithAttributes(
+		attribute.String("repository", repositoryName),
+		attribute.String("action", event.Action.String()),
+		attribute.String("digest", event.Digest),
+	))
+	defer span.End()
+
 	switch event.Action {
 	case eventv1.Action_ACTION_PUT, eventv1.Action_ACTION_DELETE:
-		err = wh.manager.Get(ctx, repositoryName).QueueEvent(event, true)
+		handler := wh.manager.Get(ctx, repositoryName)
+		eventTracer, ok := any(handler).(repository.EventTracer)
+		if ok {
+			eventTracer.SetEventSpanContext(event, span.SpanContext())
+		}
+		err = handler.QueueEvent(event, true)
 		if err != nil {
+			if eventTracer != nil {
+				eventTracer.RemoveEventSpanContext(event)
+			}
 			logger.ErrorContext(ctx, "process put/delete event", "repository", repositoryName, "error", err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
+			span.SetStatus(codes.Error, err.Error())
+			// the event won't be processed, beskar must not retry it
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 			return
 		}
 	case eventv1.Action_ACTION_START:
@@ -95,6 +134,94 @@ func (wh *webHandler[H]) event(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// admit validates a manifest pushed to the registry before it's committed, the manifest is
+// rejected with a forbidden status and the rejection message, admission failures are reported
+// with an internal server error status. It's not implemented for plugins
+// without repository manager or repository handlers not implementing repository.Admitter.
+func (wh *webHandler[H]) admit(w http.ResponseWriter, r *http.Request) {
+	if wh.manager == nil || r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	ctx := r.Context()
+	logger := log.GetContextLogger(ctx)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.ErrorContext(ctx, "manifest copy", "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	event := new(eventv1.EventPayload)
+	if err := proto.Unmarshal(data, event); err != nil {
+		logger.ErrorContext(ctx, "unmarshal event", "error", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	repositoryName := filepath.Dir(event.Repository)
+
+	admitter, ok := any(wh.manager.Get(ctx, repositoryName)).(repository.Admitter)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	if err := admitter.Admit(ctx, event); err != nil {
+		var rejectedErr *repository.AdmissionRejectedError
+		if !errors.As(err, &rejectedErr) {
+			logger.ErrorContext(ctx, "manifest admission", "repository", repositoryName, "digest", event.Digest, "error", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		logger.WarnContext(ctx, "manifest rejected", "repository", repositoryName, "digest", event.Digest, "error", err.Error())
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+}
+
+// references returns the artifacts referenced by a repository for the beskar
+// garbage collection, it's not implemented for plugins without repository manager
+// or repository handlers not implementing repository.ReferenceLister.
+func (wh *webHandler[H]) references(w http.ResponseWriter, r *http.Request) {
+	if wh.manager == nil || r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	ctx := r.Context()
+	logger := log.GetContextLogger(ctx)
+
+	repositoryName := r.URL.Query().Get("repository")
+	if repositoryName == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	referenceLister, ok := any(wh.manager.Get(ctx, repositoryName)).(repository.ReferenceLister)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	references, err := referenceLister.References(ctx)
+	if errors.Is(err, repository.ErrPendingEvents) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	} else if err != nil {
+		logger.ErrorContext(ctx, "repository references", "repository", repositoryName, "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(references)
+}
+
 func (wh *webHandler[H]) info(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusNotImplemented)
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"context"
+
+	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
+)
+
+// Admitter - Optional interface implemented by handlers validating artifacts before they are committed
+// to the registry. Beskar calls Admit synchronously when a manifest is pushed, a returned AdmissionRejectedError
+// rejects the push and its message is returned to the client. Other errors are admission failures handled
+// by the beskar admission failure policy. The artifact blobs are already uploaded and can be fetched from
+// the registry, manifests pushed by the plugin itself are not submitted.
+type Admitter interface {
+	Admit(ctx context.Context, event *eventv1.EventPayload) error
+}
+
+// AdmissionRejectedError - Error returned by Admit when the artifact doesn't satisfy the repository policy.
+type AdmissionRejectedError struct {
+	Err error
+}
+
+// RejectAdmission - Returns an AdmissionRejectedError rejecting the artifact for the given reason.
+func RejectAdmission(err error) error {
+	return &AdmissionRejectedError{Err: err}
+}
+
+func (e *AdmissionRejectedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AdmissionRejectedError) Unwrap() error {
+	return e.Err
+}
@@ -17,10 +17,12 @@ import (
 
 	"go.ciq.dev/beskar/internal/pkg/config"
 	"go.ciq.dev/beskar/internal/pkg/gossip"
+	"go.ciq.dev/beskar/internal/pkg/webhook"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
+	"go.opentelemetry.io/otel/trace"
 	"gocloud.dev/blob"
 )
 
@@ -32,6 +34,7 @@ type HandlerParams struct {
 	remove        func(string)
 	BeskarMeta    *gossip.BeskarMeta
 	Sync          config.SyncConfig
+	Webhook       *webhook.Notifier
 }
 
 func (hp HandlerParams) Remove(repository string) {
@@ -64,6 +67,13 @@ type Handler interface {
 	Stop()
 }
 
+// EventTracer - Optional interface implemented by handlers embedding RepoHandler, it allows
+// to propagate the trace context of received events to their asynchronous processing.
+type EventTracer interface {
+	SetEventSpanContext(event *eventv1.EventPayload, spanContext trace.SpanContext)
+	RemoveEventSpanContext(event *eventv1.EventPayload)
+}
+
 // RepoHandler - A partial default implementation of the Handler interface that provides some common functionality.
 // You can embed this in your own handler to get some default functionality, e.g., an event queue.
 type RepoHandler struct {
@@ -81,6 +91,8 @@ type RepoHandler struct {
 
 	syncArtifactsMutex sync.RWMutex
 	syncArtifacts      map[string]chan error
+
+	eventSpanContexts sync.Map
 }
 
 func NewRepoHandler(repository string, params *HandlerParams, cancel context.CancelFunc) *RepoHandler {
@@ -102,6 +114,32 @@ func (rh *RepoHandler) EnqueueEvent(event *eventv1.EventPayload) {
 	rh.EventQueueUpdate()
 }
 
+// SetEventSpanContext - Associates the span context of the received event with the event.
+func (rh *RepoHandler) SetEventSpanContext(event *eventv1.EventPayload, spanContext trace.SpanContext) {
+	if spanContext.IsValid() {
+		rh.eventSpanContexts.Store(event.Digest, spanContext)
+	}
+}
+
+// RemoveEventSpanContext - Removes the span context associated with an event which won't be processed.
+func (rh *RepoHandler) RemoveEventSpanContext(event *eventv1.EventPayload) {
+	rh.eventSpanContexts.Delete(event.Digest)
+}
+
+// EventContext - Returns a context carrying the span context associated with the event if any,
+// spans created from the returned context are part of the trace of the received event.
+func (rh *RepoHandler) EventContext(ctx context.Context, event *eventv1.EventPayload) context.Context {
+	v, ok := rh.eventSpanContexts.LoadAndDelete(event.Digest)
+	if !ok {
+		return ctx
+	}
+	spanContext, ok := v.(trace.SpanContext)
+	if !ok {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, spanContext)
+}
+
 func (rh *RepoHandler) DequeueEvents() []*eventv1.EventPayload {
 	rh.queueMutex.Lock()
 	events := rh.queue
@@ -138,6 +176,12 @@ func (rh *RepoHandler) Stop() {
 	rh.Stopped.Store(true)
 	rh.cancel()
 	<-rh.Queued
+
+	// queued events are not processed anymore
+	rh.eventSpanContexts.Range(func(key, _ any) bool {
+		rh.eventSpanContexts.Delete(key)
+		return true
+	})
 }
 
 func (rh *RepoHandler) DownloadBlob(ref string, destinationPath string) (errFn error) {
@@ -35,7 +35,10 @@ func NewManager[H Handler](
 
 func (m *Manager[H]) remove(repository string) {
 	m.repositoryMutex.Lock()
-	delete(m.repositories, repository)
+	if _, ok := m.repositories[repository]; ok {
+		delete(m.repositories, repository)
+		repositoryHandlers.Dec()
+	}
 	m.repositoryMutex.Unlock()
 }
 
@@ -61,6 +64,11 @@ func (m *Manager[H]) Get(ctx context.Context, repository string) H {
 	parentHandler := NewRepoHandler(repository, m.repositoryParams, cancel)
 	rh := m.newHandler(logger, parentHandler)
 
+	if !ok {
+		repositoryHandlers.Inc()
+	}
+	repositoryHandlerStarts.Inc()
+
 	m.repositories[repository] = rh
 
 	m.repositoryMutex.Unlock()
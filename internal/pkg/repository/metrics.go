@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.ciq.dev/beskar/internal/pkg/metrics"
+)
+
+var (
+	repositoryHandlers = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "repository",
+			Name:      "handlers",
+			Help:      "Number of running repository handlers.",
+		},
+	)
+	repositoryHandlerStarts = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metrics.Namespace,
+			Subsystem: "repository",
+			Name:      "handler_starts_total",
+			Help:      "Total number of repository handlers started.",
+		},
+	)
+)
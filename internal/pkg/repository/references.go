@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package repository
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrPendingEvents - Returned by References while the repository has events not processed yet,
+// the garbage collection skips the repository as the artifacts of those events may not be
+// referenced yet.
+var ErrPendingEvents = errors.New("repository has events not processed yet")
+
+// References - Artifacts referenced by a plugin repository, tags and digests are indexed
+// by registry repository (eg: artifacts/yum/myrepo/packages). Only the registry repositories
+// listed in Repositories are managed by the plugin repository and subject to garbage collection.
+type References struct {
+	Repositories []string            `json:"repositories"`
+	Tags         map[string][]string `json:"tags"`
+	Digests      map[string][]string `json:"digests"`
+}
+
+func NewReferences() *References {
+	return &References{
+		Tags:    make(map[string][]string),
+		Digests: make(map[string][]string),
+	}
+}
+
+// AddRepository - Declares a registry repository managed by the plugin repository.
+func (r *References) AddRepository(repository string) {
+	r.Repositories = append(r.Repositories, repository)
+}
+
+// AddTag - Marks the tag of the registry repository as referenced.
+func (r *References) AddTag(repository, tag string) {
+	r.Tags[repository] = append(r.Tags[repository], tag)
+}
+
+// AddDigest - Marks the manifest digest of the registry repository as referenced.
+func (r *References) AddDigest(repository, digest string) {
+	r.Digests[repository] = append(r.Digests[repository], digest)
+}
+
+// ReferenceLister - Optional interface implemented by handlers able to report the artifacts
+// they still reference, it's used by the beskar online garbage collection to untag orphaned
+// manifests. Repositories of plugins not implementing it are ignored by the garbage collection.
+type ReferenceLister interface {
+	References(ctx context.Context) (*References, error)
+}
@@ -28,6 +28,17 @@ type funcContext struct {
 	registry   distribution.Namespace
 	builtinErr error
 	bodyLimit  int64
+	explain    bool
+	lookups    []BlobDigestLookup
+}
+
+func termString(t *ast.Term) string {
+	if t == nil {
+		return ""
+	} else if s, ok := t.Value.(ast.String); ok {
+		return string(s)
+	}
+	return t.String()
 }
 
 var ociBlobDigestBuiltin = rego.Function3(
@@ -44,6 +55,18 @@ var ociBlobDigestBuiltin = rego.Function3(
 		}
 
 		defer func() {
+			if funcContext.explain {
+				lookup := BlobDigestLookup{
+					Reference:   termString(a),
+					SearchType:  termString(b),
+					SearchValue: termString(c),
+					Digest:      termString(term),
+				}
+				if errFn != nil {
+					lookup.Error = errFn.Error()
+				}
+				funcContext.lookups = append(funcContext.lookups, lookup)
+			}
 			if errFn != nil {
 				funcContext.builtinErr = fmt.Errorf("%s builtin eval oci.blob_digest error: %w", bctx.Location, errFn)
 				bctx.Cancel.Cancel()
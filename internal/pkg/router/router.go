@@ -9,20 +9,41 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/distribution/distribution/v3"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/topdown"
 	"github.com/open-policy-agent/opa/util"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var errCancelled = topdown.Error{Code: topdown.CancelErr}
 
 type Result struct {
-	Repository  string
-	RedirectURL string
-	Found       bool
+	Repository  string `json:"repository"`
+	RedirectURL string `json:"redirectURL"`
+	Found       bool   `json:"found"`
+}
+
+// BlobDigestLookup is an oci.blob_digest call performed during a decision.
+type BlobDigestLookup struct {
+	Reference   string `json:"reference"`
+	SearchType  string `json:"searchType"`
+	SearchValue string `json:"searchValue"`
+	Digest      string `json:"digest"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Explanation details how a routing decision was taken.
+type Explanation struct {
+	Result  *Result            `json:"result,omitempty"`
+	Error   string             `json:"error,omitempty"`
+	Lookups []BlobDigestLookup `json:"lookups"`
+	Trace   string             `json:"trace"`
 }
 
 type RegoOption = func(r *rego.Rego)
@@ -93,18 +114,78 @@ func New(name, module string, options ...RegoRouterOption) (_ *RegoRouter, err e
 	return router, nil
 }
 
-func (rr *RegoRouter) Decision(req *http.Request, registry distribution.Namespace) (*Result, error) {
+func (rr *RegoRouter) Decision(req *http.Request, registry distribution.Namespace) (_ *Result, errFn error) {
+	ctx, span := tracing.Start(req.Context(), "router.Decision", trace.WithAttributes(
+		attribute.String("router", rr.name),
+		attribute.String("path", req.URL.Path),
+		attribute.String("method", req.Method),
+	))
+	defer func() {
+		tracing.End(span, errFn)
+	}()
+
 	fctx := &funcContext{
 		req:       req,
 		registry:  registry,
 		bodyLimit: rr.bodyLimit,
 	}
-	ctx := context.WithValue(req.Context(), &funcContextKey, fctx)
 
-	rs, err := rr.peq.Eval(ctx, rego.EvalInput(map[string]string{
-		"path":   req.URL.Path,
-		"method": req.Method,
+	result, err := rr.eval(ctx, fctx)
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(
+		attribute.String("repository", result.Repository),
+		attribute.Bool("found", result.Found),
+		attribute.Bool("redirect", result.RedirectURL != ""),
+	)
+
+	return result, nil
+}
+
+// Explain evaluates the routing decision for the request like Decision does
+// and reports the result along with the oci.blob_digest lookups performed
+// and the evaluation trace. Evaluation errors are reported in the explanation.
+func (rr *RegoRouter) Explain(req *http.Request, registry distribution.Namespace) *Explanation {
+	fctx := &funcContext{
+		req:       req,
+		registry:  registry,
+		bodyLimit: rr.bodyLimit,
+		explain:   true,
+	}
+
+	tracer := topdown.NewBufferTracer()
+
+	result, err := rr.eval(req.Context(), fctx, rego.EvalQueryTracer(tracer))
+
+	explanation := &Explanation{
+		Result:  result,
+		Lookups: fctx.lookups,
+	}
+	if err != nil {
+		explanation.Error = err.Error()
+	}
+	if explanation.Lookups == nil {
+		explanation.Lookups = []BlobDigestLookup{}
+	}
+
+	buf := new(strings.Builder)
+	topdown.PrettyTraceWithLocation(buf, *tracer)
+	explanation.Trace = buf.String()
+
+	return explanation
+}
+
+func (rr *RegoRouter) eval(ctx context.Context, fctx *funcContext, options ...rego.EvalOption) (*Result, error) {
+	ctx = context.WithValue(ctx, &funcContextKey, fctx)
+
+	options = append(options, rego.EvalInput(map[string]string{
+		"path":   fctx.req.URL.Path,
+		"method": fctx.req.Method,
 	}))
+
+	rs, err := rr.peq.Eval(ctx, options...)
 	if err != nil {
 		if errors.Is(err, &errCancelled) && fctx.builtinErr != nil {
 			return nil, fctx.builtinErr
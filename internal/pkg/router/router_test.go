@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testModule = `package router
+
+default output = {"repository": "", "redirect_url": "", "found": false}
+
+output = obj {
+    input.method == "POST"
+    repo := object.get(request.body(), "repository", "")
+    obj := {
+        "repository": repo,
+        "redirect_url": "",
+        "found": repo != ""
+    }
+}
+`
+
+func TestExplain(t *testing.T) {
+	rr, err := New("test", testModule)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/artifacts/test/api/v1/repository", strings.NewReader(`{"repository": "artifacts/test/repo"}`))
+
+	explanation := rr.Explain(req, nil)
+	require.Empty(t, explanation.Error)
+	require.NotNil(t, explanation.Result)
+	require.True(t, explanation.Result.Found)
+	require.Equal(t, "artifacts/test/repo", explanation.Result.Repository)
+	require.Empty(t, explanation.Lookups)
+	require.NotEmpty(t, explanation.Trace)
+
+	req = httptest.NewRequest(http.MethodGet, "/artifacts/test/api/v1/repository", nil)
+
+	result, err := rr.Decision(req, nil)
+	require.NoError(t, err)
+	require.False(t, result.Found)
+}
@@ -0,0 +1,20 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http"
+)
+
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the OTLP collector endpoint (eg: 127.0.0.1:4317).
+	Endpoint string `yaml:"endpoint"`
+	// Protocol is the OTLP protocol, either grpc or http.
+	Protocol string `yaml:"protocol"`
+	Insecure bool   `yaml:"insecure"`
+	// SampleRatio is the ratio of sampled traces between 0 and 1.
+	SampleRatio float64 `yaml:"sampleratio"`
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import "time"
+
+const DefaultTimeout = 10 * time.Second
+
+type Endpoint struct {
+	// Name identifies the endpoint in logs.
+	Name string `yaml:"name"`
+	// URL is the endpoint receiving CloudEvents.
+	URL string `yaml:"url"`
+	// Secret is the HMAC-SHA256 key used to sign event payloads,
+	// payloads are not signed when empty.
+	Secret string `yaml:"secret"`
+	// Repositories is a list of repository globs, a wildcard matches
+	// any characters (eg: artifacts/yum/*), all repositories match
+	// when empty.
+	Repositories []string `yaml:"repositories"`
+	// Events is the list of event types sent to the endpoint, all
+	// event types are sent when empty.
+	Events  []string      `yaml:"events"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type Config struct {
+	Endpoints []Endpoint `yaml:"endpoints"`
+}
@@ -0,0 +1,330 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/uuid"
+)
+
+const (
+	EventArtifactPushed       = "dev.beskar.artifact.pushed"
+	EventArtifactDeleted      = "dev.beskar.artifact.deleted"
+	EventRepositorySynced     = "dev.beskar.repository.synced"
+	EventRepositorySyncFailed = "dev.beskar.repository.sync_failed"
+
+	// SignatureHeader contains the hex encoded HMAC-SHA256 signature
+	// of the request body prefixed by sha256=.
+	SignatureHeader = "X-Beskar-Signature"
+
+	ContentType = "application/cloudevents+json"
+
+	queueSize     = 1024
+	workerCount   = 4
+	retryMaxDelay = 30 * time.Second
+	retryMaxTime  = 5 * time.Minute
+)
+
+// CloudEvent is a CloudEvents 1.0 event in JSON structured content mode.
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            any       `json:"data,omitempty"`
+}
+
+// ArtifactData is the data of artifact pushed and deleted events.
+type ArtifactData struct {
+	Repository string `json:"repository"`
+	Digest     string `json:"digest"`
+	MediaType  string `json:"mediaType"`
+}
+
+// SyncData is the data of repository synced and sync failed events.
+type SyncData struct {
+	Repository string  `json:"repository"`
+	Plugin     string  `json:"plugin"`
+	Synced     int     `json:"synced"`
+	Total      int     `json:"total"`
+	Duration   float64 `json:"durationSeconds"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type ErrorHandler func(endpoint string, event *CloudEvent, err error)
+
+// LogErrorHandler returns an error handler logging delivery errors.
+func LogErrorHandler(logger *slog.Logger) ErrorHandler {
+	return func(endpoint string, event *CloudEvent, err error) {
+		logger.Error("webhook delivery error", "endpoint", endpoint, "type", event.Type, "subject", event.Subject, "error", err.Error())
+	}
+}
+
+type endpoint struct {
+	Endpoint
+	repositories []*regexp.Regexp
+	events       map[string]struct{}
+}
+
+func (e *endpoint) match(eventType, repository string) bool {
+	if len(e.events) > 0 {
+		if _, ok := e.events[eventType]; !ok {
+			return false
+		}
+	}
+	if len(e.repositories) == 0 {
+		return true
+	}
+	for _, re := range e.repositories {
+		if re.MatchString(repository) {
+			return true
+		}
+	}
+	return false
+}
+
+type delivery struct {
+	endpoint *endpoint
+	event    *CloudEvent
+}
+
+// Notifier sends CloudEvents to the configured webhook endpoints,
+// events are delivered asynchronously and retried with backoff.
+// A nil Notifier discards all events.
+type Notifier struct {
+	source       string
+	endpoints    []*endpoint
+	client       *http.Client
+	queue        chan *delivery
+	errorHandler ErrorHandler
+}
+
+type Option func(*Notifier)
+
+// WithErrorHandler sets a handler called for events which couldn't be delivered.
+func WithErrorHandler(handler ErrorHandler) Option {
+	return func(n *Notifier) {
+		n.errorHandler = handler
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to deliver events.
+func WithHTTPClient(client *http.Client) Option {
+	return func(n *Notifier) {
+		n.client = client
+	}
+}
+
+// New returns a notifier for the configured endpoints, it returns
+// nil if there is no endpoint configured.
+func New(source string, config Config, options ...Option) (*Notifier, error) {
+	if len(config.Endpoints) == 0 {
+		return nil, nil
+	}
+
+	n := &Notifier{
+		source: source,
+		client: http.DefaultClient,
+		queue:  make(chan *delivery, queueSize),
+	}
+
+	for _, opt := range options {
+		opt(n)
+	}
+
+	for i, ep := range config.Endpoints {
+		if ep.URL == "" {
+			return nil, fmt.Errorf("webhook endpoint %d: missing URL", i)
+		}
+		if ep.Name == "" {
+			ep.Name = ep.URL
+		}
+		if ep.Timeout <= 0 {
+			ep.Timeout = DefaultTimeout
+		}
+
+		e := &endpoint{
+			Endpoint: ep,
+			events:   make(map[string]struct{}),
+		}
+		for _, glob := range ep.Repositories {
+			re, err := compileGlob(glob)
+			if err != nil {
+				return nil, fmt.Errorf("webhook endpoint %s: %w", ep.Name, err)
+			}
+			e.repositories = append(e.repositories, re)
+		}
+		for _, eventType := range ep.Events {
+			e.events[eventType] = struct{}{}
+		}
+
+		n.endpoints = append(n.endpoints, e)
+	}
+
+	for i := 0; i < workerCount; i++ {
+		go n.worker()
+	}
+
+	return n, nil
+}
+
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(glob), `\*`, ".*") + "$"
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad repository glob %q: %w", glob, err)
+	}
+	return re, nil
+}
+
+// ArtifactPushed notifies endpoints that a manifest was pushed.
+func (n *Notifier) ArtifactPushed(repository, digest, mediaType string) {
+	n.Notify(EventArtifactPushed, repository, &ArtifactData{
+		Repository: repository,
+		Digest:     digest,
+		MediaType:  mediaType,
+	})
+}
+
+// ArtifactDeleted notifies endpoints that a manifest was deleted.
+func (n *Notifier) ArtifactDeleted(repository, digest, mediaType string) {
+	n.Notify(EventArtifactDeleted, repository, &ArtifactData{
+		Repository: repository,
+		Digest:     digest,
+		MediaType:  mediaType,
+	})
+}
+
+// RepositorySynced notifies endpoints about a repository sync completion,
+// a sync failed event is sent when err is not nil.
+func (n *Notifier) RepositorySynced(plugin, repository string, start time.Time, synced, total int, err error) {
+	data := &SyncData{
+		Repository: repository,
+		Plugin:     plugin,
+		Synced:     synced,
+		Total:      total,
+		Duration:   time.Since(start).Seconds(),
+	}
+
+	eventType := EventRepositorySynced
+	if err != nil {
+		eventType = EventRepositorySyncFailed
+		data.Error = err.Error()
+	}
+
+	n.Notify(eventType, repository, data)
+}
+
+// Notify queues the event for delivery to the endpoints matching
+// the event type and the repository.
+func (n *Notifier) Notify(eventType, repository string, data any) {
+	if n == nil {
+		return
+	}
+
+	event := &CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              uuid.NewString(),
+		Source:          n.source,
+		Type:            eventType,
+		Subject:         repository,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+
+	for _, e := range n.endpoints {
+		if !e.match(eventType, repository) {
+			continue
+		}
+		select {
+		case n.queue <- &delivery{endpoint: e, event: event}:
+		default:
+			n.handleError(e, event, fmt.Errorf("webhook queue is full"))
+		}
+	}
+}
+
+func (n *Notifier) handleError(e *endpoint, event *CloudEvent, err error) {
+	if n.errorHandler != nil {
+		n.errorHandler(e.Name, event, err)
+	}
+}
+
+func (n *Notifier) worker() {
+	for d := range n.queue {
+		if err := n.deliver(d.endpoint, d.event); err != nil {
+			n.handleError(d.endpoint, d.event, err)
+		}
+	}
+}
+
+func (n *Notifier) deliver(e *endpoint, event *CloudEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	eb := backoff.NewExponentialBackOff()
+	eb.MaxInterval = retryMaxDelay
+	eb.MaxElapsedTime = retryMaxTime
+
+	return backoff.Retry(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		req.Header.Set("Content-Type", ContentType)
+		if e.Secret != "" {
+			req.Header.Set(SignatureHeader, Sign([]byte(e.Secret), body))
+		}
+
+		resp, err := n.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+
+		err = fmt.Errorf("webhook endpoint has returned status %d", resp.StatusCode)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, eb)
+}
+
+// Sign returns the signature header value of the payload.
+func Sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature header value of the payload.
+func Verify(secret, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
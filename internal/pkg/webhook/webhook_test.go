@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifier(t *testing.T) {
+	secret := "s3cr3t"
+	eventCh := make(chan *CloudEvent, 4)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil || r.Header.Get("Content-Type") != ContentType {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		} else if !Verify([]byte(secret), body, r.Header.Get(SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		event := new(CloudEvent)
+		if err := json.Unmarshal(body, event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		eventCh <- event
+	}))
+	defer server.Close()
+
+	n, err := New("/beskar", Config{})
+	require.NoError(t, err)
+	require.Nil(t, n)
+	// nil notifier discards events
+	n.ArtifactPushed("artifacts/yum/repo/packages", "sha256:0123", "application/vnd.oci.image.manifest.v1+json")
+
+	errCh := make(chan error, 4)
+
+	n, err = New("/beskar", Config{
+		Endpoints: []Endpoint{
+			{
+				Name:         "ci",
+				URL:          server.URL,
+				Secret:       secret,
+				Repositories: []string{"artifacts/yum/*"},
+				Events:       []string{EventArtifactPushed, EventRepositorySyncFailed},
+			},
+		},
+	}, WithErrorHandler(func(_ string, _ *CloudEvent, err error) {
+		errCh <- err
+	}))
+	require.NoError(t, err)
+
+	n.ArtifactPushed("artifacts/static/repo/files", "sha256:0123", "application/vnd.oci.image.manifest.v1+json")
+	n.ArtifactDeleted("artifacts/yum/repo/packages", "sha256:0123", "application/vnd.oci.image.manifest.v1+json")
+	n.RepositorySynced("yum", "artifacts/yum/repo", time.Now(), 1, 1, nil)
+	n.ArtifactPushed("artifacts/yum/repo/packages", "sha256:0123", "application/vnd.oci.image.manifest.v1+json")
+	n.RepositorySynced("yum", "artifacts/yum/repo", time.Now(), 0, 1, errors.New("mirror unreachable"))
+
+	events := make(map[string]*CloudEvent)
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-eventCh:
+			events[event.Type] = event
+		case err := <-errCh:
+			t.Fatalf("unexpected delivery error: %s", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for webhook events")
+		}
+	}
+
+	pushed := events[EventArtifactPushed]
+	require.NotNil(t, pushed)
+	require.Equal(t, "1.0", pushed.SpecVersion)
+	require.Equal(t, "/beskar", pushed.Source)
+	require.Equal(t, "artifacts/yum/repo/packages", pushed.Subject)
+	require.Equal(t, "sha256:0123", pushed.Data.(map[string]any)["digest"])
+
+	failed := events[EventRepositorySyncFailed]
+	require.NotNil(t, failed)
+	require.Equal(t, "mirror unreachable", failed.Data.(map[string]any)["error"])
+
+	select {
+	case event := <-eventCh:
+		t.Fatalf("unexpected event %s", event.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"go.ciq.dev/beskar/internal/pkg/gossip"
 	"go.ciq.dev/beskar/internal/pkg/log"
 	"go.ciq.dev/beskar/internal/pkg/storage"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
+	"go.ciq.dev/beskar/internal/pkg/webhook"
 )
 
 const (
@@ -35,6 +37,8 @@ type BeskarMirrorConfig struct {
 	Log             log.Config        `yaml:"log"`
 	Addr            string            `yaml:"addr"`
 	Gossip          gossip.Config     `yaml:"gossip"`
+	Tracing         tracing.Config    `yaml:"tracing"`
+	Webhooks        webhook.Config    `yaml:"webhooks"`
 	Storage         storage.Config    `yaml:"storage"`
 	Profiling       bool              `yaml:"profiling"`
 	DataDir         string            `yaml:"datadir"`
@@ -46,6 +46,8 @@ type Handler struct {
 	syncCh  chan chan error
 	sync    atomic.Pointer[mirrordb.Sync]
 	syncing atomic.Bool
+	// syncedFiles is the number of files downloaded by the current sync
+	syncedFiles atomic.Int64
 
 	propertyMutex sync.RWMutex
 	created       bool
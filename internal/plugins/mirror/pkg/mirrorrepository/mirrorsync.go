@@ -217,6 +217,8 @@ func (s *MirrorSyncer) filePush(remoteFile *mirrordb.RepositoryFile) error {
 		return err
 	}
 
+	s.h.syncedFiles.Add(1)
+
 	return nil
 }
 
@@ -144,6 +144,8 @@ func (s *PlanSyncer) filePush(remoteFile rsync.FileInfo) error {
 		return err
 	}
 
+	s.h.syncedFiles.Add(1)
+
 	return nil
 }
 
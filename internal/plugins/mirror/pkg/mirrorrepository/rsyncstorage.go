@@ -148,6 +148,10 @@ func (s *Storage) Put(filePath string, content io.Reader, fileSize int64, metada
 		return 0, err
 	}
 
+	if metadata.Mode.IsREG() {
+		s.h.syncedFiles.Add(1)
+	}
+
 	return fileSize, nil
 }
 
@@ -8,13 +8,27 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
+	"go.ciq.dev/beskar/internal/pkg/metrics"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
 	apiv1 "go.ciq.dev/beskar/pkg/plugins/mirror/api/v1"
 	"go.ciq.dev/go-rsync/rsync"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func (h *Handler) repositorySync(_ context.Context) (errFn error) {
+func (h *Handler) repositorySync(ctx context.Context) (errFn error) {
+	_, span := tracing.Start(ctx, "mirror.repositorySync", trace.WithAttributes(
+		attribute.String("repository", h.Repository),
+	))
+	defer func() {
+		tracing.End(span, errFn)
+	}()
+
 	sync := h.updateSyncing(true)
+	syncStart := time.Now()
+	h.syncedFiles.Store(0)
 
 	defer func() {
 		h.logger.Debug("sync artifact reset")
@@ -31,6 +45,15 @@ func (h *Handler) repositorySync(_ context.Context) (errFn error) {
 			sync.SyncError = ""
 		}
 
+		sync.SyncedFiles = int(h.syncedFiles.Load())
+		if repositoryDB, err := h.getRepositoryDB(dbCtx); err == nil {
+			if count, err := repositoryDB.CountFiles(dbCtx); err == nil {
+				sync.TotalFiles = count
+			}
+		}
+		metrics.ObserveSync("mirror", h.Repository, syncStart, sync.SyncedFiles, sync.TotalFiles, errFn)
+		h.Params.Webhook.RepositorySynced("mirror", h.Repository, syncStart, sync.SyncedFiles, sync.TotalFiles, errFn)
+
 		h.logger.Debug("update sync database")
 		if err := h.updateSyncDatabase(dbCtx, sync); err != nil {
 			if errFn == nil {
@@ -22,6 +22,7 @@ import (
 	"go.ciq.dev/beskar/internal/pkg/pluginsrv"
 	"go.ciq.dev/beskar/internal/pkg/repository"
 	"go.ciq.dev/beskar/internal/pkg/storage"
+	"go.ciq.dev/beskar/internal/pkg/webhook"
 	"go.ciq.dev/beskar/internal/plugins/mirror/pkg/config"
 	"go.ciq.dev/beskar/internal/plugins/mirror/pkg/mirrorrepository"
 	pluginv1 "go.ciq.dev/beskar/pkg/api/plugin/v1"
@@ -71,6 +72,15 @@ func New(ctx context.Context, beskarMirrorConfig *config.BeskarMirrorConfig) (*P
 		mirrorrepository.NewHandler,
 	)
 
+	plugin.handlerParams.Webhook, err = webhook.New(
+		"/beskar/mirror",
+		beskarMirrorConfig.Webhooks,
+		webhook.WithErrorHandler(webhook.LogErrorHandler(logger)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	prefix := storage.GetPrefix(beskarMirrorConfig.Storage)
 
 	plugin.handlerParams.Bucket, err = storage.Init(ctx, beskarMirrorConfig.Storage, prefix)
@@ -90,6 +100,7 @@ func New(ctx context.Context, beskarMirrorConfig *config.BeskarMirrorConfig) (*P
 
 	plugin.config.Router = router
 	plugin.config.Gossip = beskarMirrorConfig.Gossip
+	plugin.config.Tracing = beskarMirrorConfig.Tracing
 	plugin.config.Info = &pluginv1.Info{
 		Name:       "mirror",
 		Version:    version.Semver,
@@ -18,6 +18,8 @@ import (
 	"go.ciq.dev/beskar/internal/pkg/config"
 	"go.ciq.dev/beskar/internal/pkg/gossip"
 	"go.ciq.dev/beskar/internal/pkg/log"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
+	"go.ciq.dev/beskar/internal/pkg/webhook"
 )
 
 const (
@@ -33,6 +35,8 @@ type BeskarOSTreeConfig struct {
 	Log             log.Config        `yaml:"log"`
 	Addr            string            `yaml:"addr"`
 	Gossip          gossip.Config     `yaml:"gossip"`
+	Tracing         tracing.Config    `yaml:"tracing"`
+	Webhooks        webhook.Config    `yaml:"webhooks"`
 	Profiling       bool              `yaml:"profiling"`
 	DataDir         string            `yaml:"datadir"`
 	ConfigDirectory string            `yaml:"-"`
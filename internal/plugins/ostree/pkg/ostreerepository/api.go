@@ -8,13 +8,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/RussellLuo/kun/pkg/werror"
 	"github.com/RussellLuo/kun/pkg/werror/gcode"
+	"go.ciq.dev/beskar/internal/pkg/metrics"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
 	"go.ciq.dev/beskar/internal/plugins/ostree/pkg/libostree"
 	"go.ciq.dev/beskar/pkg/orasostree"
 	apiv1 "go.ciq.dev/beskar/pkg/plugins/ostree/api/v1"
 	"go.ciq.dev/beskar/pkg/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -261,7 +266,12 @@ func (h *Handler) SyncRepository(_ context.Context, properties *apiv1.OSTreeRepo
 		h.logger.Debug("syncing repository")
 
 		var err error
+		syncStart := time.Now()
 		defer func() {
+			syncedRefs := len(h.repoSync.Load().SyncedRefs)
+			metrics.ObserveSync("ostree", h.Repository, syncStart, syncedRefs, syncedRefs, err)
+			h.Params.Webhook.RepositorySynced("ostree", h.Repository, syncStart, syncedRefs, syncedRefs, err)
+
 			if err != nil {
 				h.logger.Error("repository sync failed", "properties", properties, "error", err.Error())
 				repoSync := *h.repoSync.Load()
@@ -276,6 +286,13 @@ func (h *Handler) SyncRepository(_ context.Context, properties *apiv1.OSTreeRepo
 		ctx, cancel := context.WithTimeout(context.Background(), properties.Timeout.AsDuration())
 		defer cancel()
 
+		ctx, span := tracing.Start(ctx, "ostree.repositorySync", trace.WithAttributes(
+			attribute.String("repository", h.Repository),
+		))
+		defer func() {
+			tracing.End(span, err)
+		}()
+
 		err = h.BeginLocalRepoTransaction(ctx, func(ctx context.Context, repo *libostree.Repo) (commit bool, transactionFnErr error) {
 			// Pull the latest changes from the remote.
 			opts := h.standardPullOptions(libostree.Depth(properties.Depth))
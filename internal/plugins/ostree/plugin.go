@@ -20,6 +20,7 @@ import (
 	"go.ciq.dev/beskar/internal/pkg/log"
 	"go.ciq.dev/beskar/internal/pkg/pluginsrv"
 	"go.ciq.dev/beskar/internal/pkg/repository"
+	"go.ciq.dev/beskar/internal/pkg/webhook"
 	"go.ciq.dev/beskar/internal/plugins/ostree/pkg/config"
 	"go.ciq.dev/beskar/internal/plugins/ostree/pkg/ostreerepository"
 	pluginv1 "go.ciq.dev/beskar/pkg/api/plugin/v1"
@@ -68,16 +69,27 @@ func New(ctx context.Context, beskarOSTreeConfig *config.BeskarOSTreeConfig) (*P
 		router.Handle("/debug/pprof/{cmd}", http.HandlerFunc(pprof.Index)) // special handling for Gorilla mux
 	}
 
+	notifier, err := webhook.New(
+		"/beskar/"+PluginName,
+		beskarOSTreeConfig.Webhooks,
+		webhook.WithErrorHandler(webhook.LogErrorHandler(logger)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	params := &repository.HandlerParams{
-		Dir:  filepath.Join(beskarOSTreeConfig.DataDir, "_repohandlers_"),
-		Sync: beskarOSTreeConfig.Sync,
+		Dir:     filepath.Join(beskarOSTreeConfig.DataDir, "_repohandlers_"),
+		Sync:    beskarOSTreeConfig.Sync,
+		Webhook: notifier,
 	}
 
 	return &Plugin{
 		ctx: ctx,
 		config: pluginsrv.Config{
-			Router: router,
-			Gossip: beskarOSTreeConfig.Gossip,
+			Router:  router,
+			Gossip:  beskarOSTreeConfig.Gossip,
+			Tracing: beskarOSTreeConfig.Tracing,
 			Info: &pluginv1.Info{
 				Name: PluginName,
 				// Not registering media types so that Beskar doesn't send events.
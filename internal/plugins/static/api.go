@@ -25,6 +25,20 @@ func (p *Plugin) DeleteRepository(ctx context.Context, repository string, delete
 	return p.repositoryManager.Get(ctx, repository).DeleteRepository(ctx, deleteFiles)
 }
 
+func (p *Plugin) UpdateRepository(ctx context.Context, repository string, properties *apiv1.RepositoryProperties) (err error) {
+	if err := checkRepository(repository); err != nil {
+		return err
+	}
+	return p.repositoryManager.Get(ctx, repository).UpdateRepository(ctx, properties)
+}
+
+func (p *Plugin) GetRepository(ctx context.Context, repository string) (properties *apiv1.RepositoryProperties, err error) {
+	if err := checkRepository(repository); err != nil {
+		return nil, err
+	}
+	return p.repositoryManager.Get(ctx, repository).GetRepository(ctx)
+}
+
 func (p *Plugin) ListRepositoryLogs(ctx context.Context, repository string, page *apiv1.Page) (logs []apiv1.RepositoryLog, err error) {
 	if err := checkRepository(repository); err != nil {
 		return nil, err
@@ -20,6 +20,7 @@ import (
 	"go.ciq.dev/beskar/internal/pkg/gossip"
 	"go.ciq.dev/beskar/internal/pkg/log"
 	"go.ciq.dev/beskar/internal/pkg/storage"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
 )
 
 const (
@@ -35,6 +36,7 @@ type BeskarStaticConfig struct {
 	Log             log.Config     `yaml:"log"`
 	Addr            string         `yaml:"addr"`
 	Gossip          gossip.Config  `yaml:"gossip"`
+	Tracing         tracing.Config `yaml:"tracing"`
 	Storage         storage.Config `yaml:"storage"`
 	Profiling       bool           `yaml:"profiling"`
 	DataDir         string         `yaml:"datadir"`
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS properties (
+    id INTEGER PRIMARY KEY,
+    retention_max_age_days INTEGER DEFAULT 0 NOT NULL
+);
+
+INSERT INTO properties VALUES(1, 0);
\ No newline at end of file
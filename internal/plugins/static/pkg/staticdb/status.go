@@ -23,6 +23,10 @@ type Event struct {
 	Payload []byte `db:"payload"`
 }
 
+type Properties struct {
+	RetentionMaxAgeDays int `db:"retention_max_age_days"`
+}
+
 type StatusDB struct {
 	*sqlite.DB
 }
@@ -176,3 +180,59 @@ func (db *StatusDB) CountEvents(ctx context.Context) (int, error) {
 
 	return count, nil
 }
+
+func (db *StatusDB) GetProperties(ctx context.Context) (*Properties, error) {
+	db.Reference.Add(1)
+	defer db.Reference.Add(-1)
+
+	if err := db.Open(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryxContext(ctx, "SELECT retention_max_age_days FROM properties WHERE id = 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	properties := new(Properties)
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("failed to retrieve repository properties")
+	}
+	if err := rows.StructScan(properties); err != nil {
+		return nil, err
+	}
+
+	return properties, nil
+}
+
+func (db *StatusDB) UpdateProperties(ctx context.Context, properties *Properties) error {
+	db.Reference.Add(1)
+	defer db.Reference.Add(-1)
+
+	if err := db.Open(ctx); err != nil {
+		return err
+	}
+
+	db.Lock()
+	result, err := db.NamedExecContext(
+		ctx,
+		"UPDATE properties SET retention_max_age_days = :retention_max_age_days WHERE id = 1",
+		properties,
+	)
+	db.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if inserted != 1 {
+		return fmt.Errorf("properties not updated in status database")
+	}
+
+	return nil
+}
@@ -77,6 +77,64 @@ func (h *Handler) DeleteRepository(ctx context.Context, deleteFiles bool) (err e
 	return nil
 }
 
+func (h *Handler) UpdateRepository(ctx context.Context, properties *apiv1.RepositoryProperties) (err error) {
+	if !h.Started() {
+		return werror.Wrap(gcode.ErrUnavailable, err)
+	} else if properties == nil {
+		return werror.Wrap(gcode.ErrInvalidArgument, fmt.Errorf("properties can't be nil"))
+	} else if h.delete.Load() {
+		return werror.Wrap(gcode.ErrAlreadyExists, fmt.Errorf("repository %s is being deleted", h.Repository))
+	}
+
+	db, err := h.getStatusDB(ctx)
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+	defer db.Close(false)
+
+	propertiesDB, err := db.GetProperties(ctx)
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+
+	if properties.Retention != nil {
+		if properties.Retention.MaxAgeDays < 0 {
+			return werror.Wrap(gcode.ErrInvalidArgument, errors.New("retention max_age_days can't be negative"))
+		}
+		propertiesDB.RetentionMaxAgeDays = properties.Retention.MaxAgeDays
+	}
+	h.setRetentionMaxAgeDays(propertiesDB.RetentionMaxAgeDays)
+
+	if err := db.UpdateProperties(ctx, propertiesDB); err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+
+	return db.Sync(ctx)
+}
+
+func (h *Handler) GetRepository(ctx context.Context) (properties *apiv1.RepositoryProperties, err error) {
+	if !h.Started() {
+		return nil, werror.Wrap(gcode.ErrUnavailable, err)
+	}
+
+	db, err := h.getStatusDB(ctx)
+	if err != nil {
+		return nil, werror.Wrap(gcode.ErrInternal, err)
+	}
+	defer db.Close(false)
+
+	propertiesDB, err := db.GetProperties(ctx)
+	if err != nil {
+		return nil, werror.Wrap(gcode.ErrInternal, err)
+	}
+
+	return &apiv1.RepositoryProperties{
+		Retention: &apiv1.RetentionPolicy{
+			MaxAgeDays: propertiesDB.RetentionMaxAgeDays,
+		},
+	}, nil
+}
+
 func (h *Handler) ListRepositoryLogs(ctx context.Context, _ *apiv1.Page) (logs []apiv1.RepositoryLog, err error) {
 	if !h.Started() {
 		return nil, werror.Wrap(gcode.ErrUnavailable, err)
@@ -11,13 +11,17 @@ import (
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"go.ciq.dev/beskar/internal/pkg/repository"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
 	"go.ciq.dev/beskar/internal/plugins/static/pkg/staticdb"
 	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
 	"go.ciq.dev/beskar/pkg/orasfile"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Handler struct {
@@ -32,6 +36,11 @@ type Handler struct {
 	logDB        *staticdb.LogDB
 	statusDB     *staticdb.StatusDB
 
+	propertyMutex sync.RWMutex
+	maxAgeDays    int
+
+	retentionRunning atomic.Bool
+
 	delete atomic.Bool
 }
 
@@ -159,6 +168,19 @@ func (h *Handler) getLogDB(ctx context.Context) (*staticdb.LogDB, error) {
 	return db, nil
 }
 
+func (h *Handler) setRetentionMaxAgeDays(maxAgeDays int) {
+	h.propertyMutex.Lock()
+	h.maxAgeDays = maxAgeDays
+	h.propertyMutex.Unlock()
+}
+
+func (h *Handler) getRetentionMaxAgeDays() int {
+	h.propertyMutex.RLock()
+	defer h.propertyMutex.RUnlock()
+
+	return h.maxAgeDays
+}
+
 func (h *Handler) Start(ctx context.Context) {
 	// initialize status DB
 	statusDB, err := h.getStatusDB(ctx)
@@ -168,6 +190,14 @@ func (h *Handler) Start(ctx context.Context) {
 		return
 	}
 
+	properties, err := statusDB.GetProperties(ctx)
+	if err != nil {
+		h.cleanup()
+		h.logger.Error("status DB properties initialization", "error", err.Error())
+		return
+	}
+	h.setRetentionMaxAgeDays(properties.RetentionMaxAgeDays)
+
 	numEvents, err := statusDB.CountEvents(ctx)
 	if err != nil {
 		h.cleanup()
@@ -186,11 +216,18 @@ func (h *Handler) Start(ctx context.Context) {
 		return
 	}
 
+	retentionTicker := time.NewTicker(retentionInterval)
+
 	go func() {
+		defer retentionTicker.Stop()
+
 		for !h.Stopped.Load() {
 			select {
 			case <-ctx.Done():
 				h.Stopped.Store(true)
+			case <-retentionTicker.C:
+				// removals are processed by this loop, don't block it
+				go h.applyRetention(ctx)
 			case <-h.Queued:
 				h.processEvents()
 
@@ -207,38 +244,54 @@ func (h *Handler) processEvents() {
 	processContext := context.Background()
 
 	for _, event := range h.DequeueEvents() {
-		manifest, err := v1.ParseManifest(bytes.NewReader(event.Payload))
-		if err != nil {
-			h.logger.Error("parse package manifest", "error", err.Error())
-			continue
+		h.processEvent(processContext, event)
+
+		if h.Stopped.Load() {
+			break
 		}
+	}
+}
 
-		if event.Action == eventv1.Action_ACTION_PUT {
-			switch manifest.Config.MediaType {
-			case types.MediaType(orasfile.StaticFileConfigType):
-				err := h.processFileManifest(processContext, manifest)
-				if err != nil {
-					h.logger.Error("process file manifest", "error", err.Error())
-				}
-			}
-		} else if event.Action == eventv1.Action_ACTION_DELETE {
-			switch manifest.Config.MediaType {
-			case types.MediaType(orasfile.StaticFileConfigType):
-				err := h.deleteFileManifest(processContext, manifest)
-				if err != nil {
-					h.logger.Error("delete package manifest", "error", err.Error())
-				}
+func (h *Handler) processEvent(ctx context.Context, event *eventv1.EventPayload) {
+	ctx, span := tracing.Start(h.EventContext(ctx, event), "static.processEvent", trace.WithAttributes(
+		attribute.String("repository", h.Repository),
+		attribute.String("action", event.Action.String()),
+		attribute.String("digest", event.Digest),
+	))
+
+	var err error
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	manifest, err := v1.ParseManifest(bytes.NewReader(event.Payload))
+	if err != nil {
+		h.logger.Error("parse package manifest", "error", err.Error())
+		return
+	}
+
+	if event.Action == eventv1.Action_ACTION_PUT {
+		switch manifest.Config.MediaType {
+		case types.MediaType(orasfile.StaticFileConfigType):
+			err = h.processFileManifest(ctx, manifest)
+			if err != nil {
+				h.logger.Error("process file manifest", "error", err.Error())
 			}
 		}
-
-		if err := h.statusDB.RemoveEvent(processContext, event); err != nil {
-			h.logger.Error("event remove", "error", err.Error())
-		} else if err := h.statusDB.Sync(processContext); err != nil {
-			h.logger.Error("event remove", "error", err.Error())
+	} else if event.Action == eventv1.Action_ACTION_DELETE {
+		switch manifest.Config.MediaType {
+		case types.MediaType(orasfile.StaticFileConfigType):
+			err = h.deleteFileManifest(ctx, manifest)
+			if err != nil {
+				h.logger.Error("delete package manifest", "error", err.Error())
+			}
 		}
+	}
 
-		if h.Stopped.Load() {
-			break
-		}
+	if err := h.statusDB.RemoveEvent(ctx, event); err != nil {
+		h.logger.Error("event remove", "error", err.Error())
+	} else if err := h.statusDB.Sync(ctx); err != nil {
+		h.logger.Error("event remove", "error", err.Error())
 	}
 }
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package staticrepository
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"go.ciq.dev/beskar/internal/pkg/repository"
+	"go.ciq.dev/beskar/internal/plugins/static/pkg/staticdb"
+)
+
+var _ repository.ReferenceLister = &Handler{}
+
+// References returns the file tags referenced by the repository database.
+func (h *Handler) References(ctx context.Context) (*repository.References, error) {
+	// artifacts of the events not processed yet are not referenced by the databases
+	statusDB, err := h.getStatusDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	numEvents, err := statusDB.CountEvents(ctx)
+	if err != nil {
+		return nil, err
+	} else if numEvents > 0 || h.EventQueueLength() > 0 {
+		return nil, repository.ErrPendingEvents
+	}
+
+	references := repository.NewReferences()
+
+	filesRepository := filepath.Join(h.Repository, "files")
+	references.AddRepository(filesRepository)
+
+	db, err := h.getRepositoryDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(false)
+
+	err = db.WalkFiles(ctx, func(file *staticdb.RepositoryFile) error {
+		references.AddTag(filesRepository, file.Tag)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while walking repository files: %w", err)
+	}
+
+	return references, nil
+}
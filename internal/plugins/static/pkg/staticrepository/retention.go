@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package staticrepository
+
+import (
+	"context"
+	"time"
+
+	"go.ciq.dev/beskar/internal/plugins/static/pkg/staticdb"
+)
+
+// retentionInterval is the interval between two retention policy runs.
+const retentionInterval = time.Hour
+
+// applyRetention removes the files not satisfying the repository retention
+// policy, removals go through the same path as RemoveRepositoryFile and are
+// recorded in the repository log database.
+func (h *Handler) applyRetention(ctx context.Context) {
+	maxAgeDays := h.getRetentionMaxAgeDays()
+	if maxAgeDays <= 0 || h.delete.Load() {
+		return
+	} else if h.retentionRunning.Swap(true) {
+		return
+	}
+	defer h.retentionRunning.Store(false)
+
+	expiration := time.Now().UTC().AddDate(0, 0, -maxAgeDays).Unix()
+
+	files, err := h.expiredFiles(ctx, expiration)
+	if err != nil {
+		h.logger.Error("retention policy", "error", err.Error())
+		return
+	}
+
+	for _, file := range files {
+		if h.Stopped.Load() || h.delete.Load() {
+			return
+		}
+
+		if err := h.RemoveRepositoryFile(ctx, file.Tag); err != nil {
+			h.logger.Error("retention policy file removal", "file", file.Name, "error", err.Error())
+			h.logDatabase(ctx, staticdb.LogError, "retention policy removal of file %s: %s", file.Name, err)
+			continue
+		}
+
+		h.logger.Info("retention policy file removed", "file", file.Name)
+		h.logDatabase(ctx, staticdb.LogInfo, "retention policy removed file %s (older than %d days)", file.Name, maxAgeDays)
+	}
+}
+
+// expiredFiles returns the files uploaded before the expiration unix time.
+func (h *Handler) expiredFiles(ctx context.Context, expiration int64) ([]*staticdb.RepositoryFile, error) {
+	db, err := h.getRepositoryDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(false)
+
+	var files []*staticdb.RepositoryFile
+
+	err = db.WalkFiles(ctx, func(file *staticdb.RepositoryFile) error {
+		if file.UploadTime > 0 && file.UploadTime < expiration {
+			files = append(files, file)
+		}
+		return nil
+	})
+
+	return files, err
+}
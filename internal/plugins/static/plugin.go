@@ -89,6 +89,7 @@ func New(ctx context.Context, beskarStaticConfig *config.BeskarStaticConfig) (*P
 
 	plugin.config.Router = router
 	plugin.config.Gossip = beskarStaticConfig.Gossip
+	plugin.config.Tracing = beskarStaticConfig.Tracing
 	plugin.config.Info = &pluginv1.Info{
 		Name:       "static",
 		Version:    version.Semver,
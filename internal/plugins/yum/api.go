@@ -108,3 +108,31 @@ func (p *Plugin) ListRepositoryPackages(ctx context.Context, repository string,
 	}
 	return p.repositoryManager.Get(ctx, repository).ListRepositoryPackages(ctx, page)
 }
+
+func (p *Plugin) AddRepositoryModules(ctx context.Context, repository string, modules string, replace bool) (err error) {
+	if err := checkRepository(repository); err != nil {
+		return err
+	}
+	return p.repositoryManager.Get(ctx, repository).AddRepositoryModules(ctx, modules, replace)
+}
+
+func (p *Plugin) RemoveRepositoryModule(ctx context.Context, repository string, name string, stream string) (err error) {
+	if err := checkRepository(repository); err != nil {
+		return err
+	}
+	return p.repositoryManager.Get(ctx, repository).RemoveRepositoryModule(ctx, name, stream)
+}
+
+func (p *Plugin) RemoveRepositoryModuleDefaults(ctx context.Context, repository string, name string) (err error) {
+	if err := checkRepository(repository); err != nil {
+		return err
+	}
+	return p.repositoryManager.Get(ctx, repository).RemoveRepositoryModuleDefaults(ctx, name)
+}
+
+func (p *Plugin) ListRepositoryModules(ctx context.Context, repository string) (repositoryModules []*apiv1.RepositoryModule, err error) {
+	if err := checkRepository(repository); err != nil {
+		return nil, err
+	}
+	return p.repositoryManager.Get(ctx, repository).ListRepositoryModules(ctx)
+}
@@ -20,6 +20,8 @@ import (
 	"go.ciq.dev/beskar/internal/pkg/gossip"
 	"go.ciq.dev/beskar/internal/pkg/log"
 	"go.ciq.dev/beskar/internal/pkg/storage"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
+	"go.ciq.dev/beskar/internal/pkg/webhook"
 )
 
 const (
@@ -35,12 +37,28 @@ type BeskarYumConfig struct {
 	Log             log.Config     `yaml:"log"`
 	Addr            string         `yaml:"addr"`
 	Gossip          gossip.Config  `yaml:"gossip"`
+	Tracing         tracing.Config `yaml:"tracing"`
+	Webhooks        webhook.Config `yaml:"webhooks"`
 	Storage         storage.Config `yaml:"storage"`
+	Signing         SigningConfig  `yaml:"signing"`
 	Profiling       bool           `yaml:"profiling"`
 	DataDir         string         `yaml:"datadir"`
 	ConfigDirectory string         `yaml:"-"`
 }
 
+// SigningConfig is the GPG key signing the metadata of
+// repositories without their own signing key.
+type SigningConfig struct {
+	// KeyFile is the path of the armored GPG private key, signing is
+	// disabled if empty.
+	KeyFile string `yaml:"keyfile"`
+	// Passphrase decrypts the private key if it's encrypted.
+	Passphrase string `yaml:"passphrase"`
+	// Secret encrypts the repository signing keys stored in the repository
+	// databases, repositories can't have their own signing key if empty.
+	Secret string `yaml:"secret"`
+}
+
 func (bc BeskarYumConfig) ListenIP() (string, error) {
 	host, _, err := net.SplitHostPort(bc.Addr)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"fmt"
 
 	"go.ciq.dev/beskar/internal/pkg/sqlite"
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yummeta"
 	"gocloud.dev/blob"
 )
 
@@ -34,6 +35,17 @@ type ExtraMetadata struct {
 	Data         []byte `db:"data"`
 }
 
+// Module is a module stream or a module defaults document of modules.yaml.
+type Module struct {
+	Document string `db:"document"`
+	Name     string `db:"name"`
+	Stream   string `db:"stream"`
+	Version  uint64 `db:"version"`
+	Context  string `db:"context"`
+	Arch     string `db:"arch"`
+	Data     []byte `db:"data"`
+}
+
 type MetadataDB struct {
 	*sqlite.DB
 }
@@ -111,6 +123,32 @@ func (db *MetadataDB) RemovePackage(ctx context.Context, id string) (bool, error
 	return affected == 1, nil
 }
 
+func (db *MetadataDB) GetPackage(ctx context.Context, id string) (*PackageMetadata, error) {
+	db.Reference.Add(1)
+	defer db.Reference.Add(-1)
+
+	if err := db.Open(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryxContext(ctx, "SELECT * FROM packages WHERE id = ? LIMIT 1", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pkg := new(PackageMetadata)
+
+	if !rows.Next() {
+		return nil, sqlite.ErrNoEntryFound
+	}
+	if err := rows.StructScan(pkg); err != nil {
+		return nil, err
+	}
+
+	return pkg, nil
+}
+
 func (db *MetadataDB) CountPackages(ctx context.Context) (int, error) {
 	db.Reference.Add(1)
 	defer db.Reference.Add(-1)
@@ -258,3 +296,118 @@ func (db *MetadataDB) WalkExtraMetadata(ctx context.Context, walkFn WalkExtraMet
 
 	return nil
 }
+
+// AddModules adds the module documents in a single transaction, the module
+// defaults document of a module replaces the existing one.
+func (db *MetadataDB) AddModules(ctx context.Context, modules []*Module) error {
+	db.Reference.Add(1)
+	defer db.Reference.Add(-1)
+
+	if err := db.Open(ctx); err != nil {
+		return err
+	}
+
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, module := range modules {
+		if module.Document == yummeta.ModuleDefaultsDocument {
+			// there is only one module defaults document per module
+			_, err := tx.ExecContext(ctx, "DELETE FROM modules WHERE document = ? AND name = ?", module.Document, module.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.NamedExecContext(
+			ctx,
+			// BE CAREFUL and respect the table's columns order !!
+			"INSERT INTO modules VALUES(:document, :name, :stream, :version, :context, :arch, :data) "+
+				"ON CONFLICT (document, name, stream, version, context, arch) DO UPDATE SET data = :data",
+			module,
+		)
+		if err != nil {
+			return err
+		}
+
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		} else if inserted != 1 {
+			return fmt.Errorf("module not inserted into database")
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveModules removes the module documents of the module name and
+// stream, an empty stream removes the documents of all module streams.
+func (db *MetadataDB) RemoveModules(ctx context.Context, document, name, stream string) (int64, error) {
+	db.Reference.Add(1)
+	defer db.Reference.Add(-1)
+
+	if err := db.Open(ctx); err != nil {
+		return 0, err
+	}
+
+	query := "DELETE FROM modules WHERE document = ? AND name = ?"
+	args := []any{document, name}
+
+	if stream != "" {
+		query += " AND stream = ?"
+		args = append(args, stream)
+	}
+
+	db.Lock()
+	result, err := db.ExecContext(ctx, query, args...)
+	db.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+type WalkModuleFunc func(*Module) error
+
+// WalkModules walks the module documents, module streams come first.
+func (db *MetadataDB) WalkModules(ctx context.Context, walkFn WalkModuleFunc) error {
+	if walkFn == nil {
+		return fmt.Errorf("no walk module function provided")
+	}
+
+	db.Reference.Add(1)
+	defer db.Reference.Add(-1)
+
+	if err := db.Open(ctx); err != nil {
+		return err
+	}
+
+	rows, err := db.QueryxContext(ctx, "SELECT * FROM modules ORDER BY document, name, stream, version, context, arch")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		module := new(Module)
+		err := rows.StructScan(module)
+		if err != nil {
+			return err
+		} else if err := walkFn(module); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"embed"
 	"encoding/hex"
 	"fmt"
+	"strings"
 
 	"go.ciq.dev/beskar/internal/pkg/sqlite"
 	"gocloud.dev/blob"
@@ -35,6 +36,7 @@ type RepositoryPackage struct {
 	Description  string `db:"description"`
 	Verified     bool   `db:"verified"`
 	GPGSignature string `db:"gpg_signature"`
+	Epoch        int    `db:"epoch"`
 }
 
 func (pkg RepositoryPackage) RPMName() string {
@@ -45,6 +47,11 @@ func (pkg RepositoryPackage) RPMName() string {
 	return fmt.Sprintf("%s-%s-%s.%s.rpm", pkg.Name, pkg.Version, pkg.Release, arch)
 }
 
+// NVRA returns the package name-version-release.arch.
+func (pkg RepositoryPackage) NVRA() string {
+	return strings.TrimSuffix(pkg.RPMName(), ".rpm")
+}
+
 type RepositoryDB struct {
 	*sqlite.DB
 }
@@ -83,11 +90,11 @@ func (db *RepositoryDB) AddPackage(ctx context.Context, pkg *RepositoryPackage)
 		ctx,
 		// BE CAREFUL and respect the table's columns order !!
 		"INSERT INTO packages VALUES(:tag, :id, :name, :upload_time, :build_time, :size, :architecture, :source_rpm, "+
-			":version, :release, :groups, :license, :vendor, :summary, :description, :verified, :gpg_signature) "+
+			":version, :release, :groups, :license, :vendor, :summary, :description, :verified, :gpg_signature, :epoch) "+
 			"ON CONFLICT (tag) DO UPDATE SET id = :id, name = :name, upload_time = :upload_time, build_time = :build_time, "+
 			"size = :size, architecture = :architecture, verified = :verified, source_rpm = :source_rpm, version = :version, "+
 			"release = :release, groups = :groups, license = :license, vendor = :vendor, summary = :summary, "+
-			"description = :description, gpg_signature = :gpg_signature",
+			"description = :description, gpg_signature = :gpg_signature, epoch = :epoch",
 		pkg,
 	)
 	db.Unlock()
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS modules (
+    document TEXT,
+    name TEXT,
+    stream TEXT,
+    version INTEGER,
+    context TEXT,
+    arch TEXT,
+    data BLOB,
+    PRIMARY KEY (document, name, stream, version, context, arch)
+);
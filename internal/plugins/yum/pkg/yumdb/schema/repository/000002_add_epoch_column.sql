@@ -0,0 +1 @@
+ALTER TABLE packages ADD epoch INTEGER DEFAULT 0 NOT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE properties ADD retention_keep_evrs INTEGER DEFAULT 0 NOT NULL;
\ No newline at end of file
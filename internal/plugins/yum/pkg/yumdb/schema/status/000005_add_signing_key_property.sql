@@ -0,0 +1 @@
+ALTER TABLE properties ADD signing_key BLOB DEFAULT '' NOT NULL;
\ No newline at end of file
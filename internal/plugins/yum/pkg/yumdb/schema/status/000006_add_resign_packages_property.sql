@@ -0,0 +1 @@
+ALTER TABLE properties ADD resign_packages BOOLEAN DEFAULT false NOT NULL;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE properties ADD retention_keep_snapshots INTEGER DEFAULT 0 NOT NULL;
+
+CREATE TABLE IF NOT EXISTS mirror_removed_packages (
+    id TEXT PRIMARY KEY,
+    snapshots INTEGER
+);
\ No newline at end of file
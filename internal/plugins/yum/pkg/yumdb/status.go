@@ -24,10 +24,14 @@ type Event struct {
 }
 
 type Properties struct {
-	Created    bool   `db:"created"`
-	Mirror     bool   `db:"mirror"`
-	MirrorURLs []byte `db:"mirror_urls"`
-	GPGKey     []byte `db:"gpg_key"`
+	Created                bool   `db:"created"`
+	Mirror                 bool   `db:"mirror"`
+	MirrorURLs             []byte `db:"mirror_urls"`
+	GPGKey                 []byte `db:"gpg_key"`
+	RetentionKeepEVRs      int    `db:"retention_keep_evrs"`
+	SigningKey             []byte `db:"signing_key"`
+	ResignPackages         bool   `db:"resign_packages"`
+	RetentionKeepSnapshots int    `db:"retention_keep_snapshots"`
 }
 
 type Reposync struct {
@@ -201,7 +205,7 @@ func (db *StatusDB) GetProperties(ctx context.Context) (*Properties, error) {
 		return nil, err
 	}
 
-	rows, err := db.QueryxContext(ctx, "SELECT created, mirror, mirror_urls, gpg_key FROM properties WHERE id = 1")
+	rows, err := db.QueryxContext(ctx, "SELECT created, mirror, mirror_urls, gpg_key, retention_keep_evrs, signing_key, resign_packages, retention_keep_snapshots FROM properties WHERE id = 1")
 	if err != nil {
 		return nil, err
 	}
@@ -230,7 +234,7 @@ func (db *StatusDB) UpdateProperties(ctx context.Context, properties *Properties
 	db.Lock()
 	result, err := db.NamedExecContext(
 		ctx,
-		"UPDATE properties SET created = :created, mirror = :mirror, mirror_urls = :mirror_urls, gpg_key = :gpg_key WHERE id = 1",
+		"UPDATE properties SET created = :created, mirror = :mirror, mirror_urls = :mirror_urls, gpg_key = :gpg_key, retention_keep_evrs = :retention_keep_evrs, signing_key = :signing_key, resign_packages = :resign_packages, retention_keep_snapshots = :retention_keep_snapshots WHERE id = 1",
 		properties,
 	)
 	db.Unlock()
@@ -338,3 +342,60 @@ func (db *StatusDB) UpdateReposync(ctx context.Context, reposync *Reposync) erro
 
 	return nil
 }
+
+// UpdateMirrorRemovedPackages records the mirror packages not found upstream by the last
+// mirror synchronization and returns for each of them the number of consecutive
+// synchronizations they were missing from. Packages found again upstream are forgotten.
+func (db *StatusDB) UpdateMirrorRemovedPackages(ctx context.Context, ids []string) (map[string]int, error) {
+	db.Reference.Add(1)
+	defer db.Reference.Add(-1)
+
+	if err := db.Open(ctx); err != nil {
+		return nil, err
+	}
+
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	rows, err := tx.QueryxContext(ctx, "SELECT id, snapshots FROM mirror_removed_packages")
+	if err != nil {
+		return nil, err
+	}
+
+	previous := make(map[string]int)
+
+	for rows.Next() {
+		var id string
+		var snapshots int
+
+		if err := rows.Scan(&id, &snapshots); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		previous[id] = snapshots
+	}
+	rows.Close()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mirror_removed_packages"); err != nil {
+		return nil, err
+	}
+
+	removed := make(map[string]int, len(ids))
+
+	for _, id := range ids {
+		removed[id] = previous[id] + 1
+		if _, err := tx.ExecContext(ctx, "INSERT INTO mirror_removed_packages VALUES(?, ?)", id, removed[id]); err != nil {
+			return nil, err
+		}
+	}
+
+	return removed, tx.Commit()
+}
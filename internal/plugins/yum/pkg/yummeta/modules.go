@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yummeta
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ModulesDataType DataType = "modules"
+	ModulesYAMLFile          = "modules.yaml"
+
+	ModuleStreamDocument   = "modulemd"
+	ModuleDefaultsDocument = "modulemd-defaults"
+)
+
+// ModuleDocument is a module stream or a module defaults document of modules.yaml,
+// for module defaults, Name is the module name and Stream the default stream.
+type ModuleDocument struct {
+	Document string
+	Name     string
+	Stream   string
+	Version  uint64
+	Context  string
+	Arch     string
+	// Artifacts are the NEVRA of the module stream packages.
+	Artifacts []string
+	// Data is the YAML document.
+	Data []byte
+}
+
+type moduleDocumentHeader struct {
+	Document string    `yaml:"document"`
+	Version  int       `yaml:"version"`
+	Data     yaml.Node `yaml:"data"`
+}
+
+type moduleStreamData struct {
+	Name      string `yaml:"name"`
+	Stream    string `yaml:"stream"`
+	Version   uint64 `yaml:"version"`
+	Context   string `yaml:"context"`
+	Arch      string `yaml:"arch"`
+	Artifacts struct {
+		RPMs []string `yaml:"rpms"`
+	} `yaml:"artifacts"`
+}
+
+type moduleDefaultsData struct {
+	Module string `yaml:"module"`
+	Stream string `yaml:"stream"`
+}
+
+// ParseModules returns the documents of modules.yaml, only module stream
+// version 2 and module defaults version 1 documents are supported.
+func ParseModules(r io.Reader) ([]*ModuleDocument, error) {
+	var documents []*ModuleDocument
+
+	decoder := yaml.NewDecoder(r)
+
+	for {
+		node := new(yaml.Node)
+
+		if err := decoder.Decode(node); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("while decoding modules document %d: %w", len(documents)+1, err)
+		}
+
+		document, err := parseModuleDocument(node)
+		if err != nil {
+			return nil, fmt.Errorf("modules document %d: %w", len(documents)+1, err)
+		}
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+func parseModuleDocument(node *yaml.Node) (*ModuleDocument, error) {
+	header := new(moduleDocumentHeader)
+	if err := node.Decode(header); err != nil {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+
+	document := &ModuleDocument{
+		Document: header.Document,
+		Data:     data,
+	}
+
+	switch header.Document {
+	case ModuleStreamDocument:
+		if header.Version != 2 {
+			return nil, fmt.Errorf("unsupported %s version %d", header.Document, header.Version)
+		}
+
+		stream := new(moduleStreamData)
+		if err := header.Data.Decode(stream); err != nil {
+			return nil, err
+		} else if stream.Name == "" || stream.Stream == "" {
+			return nil, fmt.Errorf("%s document without module name or stream", header.Document)
+		}
+
+		document.Name = stream.Name
+		document.Stream = stream.Stream
+		document.Version = stream.Version
+		document.Context = stream.Context
+		document.Arch = stream.Arch
+		document.Artifacts = stream.Artifacts.RPMs
+	case ModuleDefaultsDocument:
+		if header.Version != 1 {
+			return nil, fmt.Errorf("unsupported %s version %d", header.Document, header.Version)
+		}
+
+		defaults := new(moduleDefaultsData)
+		if err := header.Data.Decode(defaults); err != nil {
+			return nil, err
+		} else if defaults.Module == "" {
+			return nil, fmt.Errorf("%s document without module name", header.Document)
+		}
+
+		document.Name = defaults.Module
+		document.Stream = defaults.Stream
+	default:
+		return nil, fmt.Errorf("unsupported document %q", header.Document)
+	}
+
+	return document, nil
+}
+
+// WriteModules writes the modules.yaml made of the YAML documents.
+func WriteModules(w io.Writer, documents [][]byte) error {
+	for _, document := range documents {
+		if _, err := io.WriteString(w, "---\n"); err != nil {
+			return err
+		} else if _, err := w.Write(document); err != nil {
+			return err
+		} else if _, err := io.WriteString(w, "...\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ArtifactNVRA returns the name-version-release.arch of a module artifact
+// NEVRA, the epoch is removed if present.
+func ArtifactNVRA(nevra string) string {
+	colon := strings.IndexByte(nevra, ':')
+	if colon < 0 {
+		return nevra
+	}
+	dash := strings.LastIndexByte(nevra[:colon], '-')
+	return nevra[:dash+1] + nevra[colon+1:]
+}
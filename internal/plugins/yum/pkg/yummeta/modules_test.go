@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yummeta
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testModules = `---
+document: modulemd
+version: 2
+data:
+  name: perl
+  stream: 5.30
+  version: 8040020200923213406
+  context: 466ea64f
+  arch: x86_64
+  summary: Practical Extraction and Report Language
+  artifacts:
+    rpms:
+    - perl-4:5.30.1-452.module+el8.4.0+8990+01326e37.src
+    - perl-4:5.30.1-452.module+el8.4.0+8990+01326e37.x86_64
+    - perl-libs-4:5.30.1-452.module+el8.4.0+8990+01326e37.x86_64
+...
+---
+document: modulemd-defaults
+version: 1
+data:
+  module: perl
+  stream: 5.26
+  profiles:
+    5.26: [common]
+...
+`
+
+func TestParseModules(t *testing.T) {
+	documents, err := ParseModules(strings.NewReader(testModules))
+	require.NoError(t, err)
+	require.Len(t, documents, 2)
+
+	stream := documents[0]
+	require.Equal(t, ModuleStreamDocument, stream.Document)
+	require.Equal(t, "perl", stream.Name)
+	require.Equal(t, "5.30", stream.Stream)
+	require.Equal(t, uint64(8040020200923213406), stream.Version)
+	require.Equal(t, "466ea64f", stream.Context)
+	require.Equal(t, "x86_64", stream.Arch)
+	require.Len(t, stream.Artifacts, 3)
+	require.Equal(t, "perl-5.30.1-452.module+el8.4.0+8990+01326e37.src", ArtifactNVRA(stream.Artifacts[0]))
+
+	defaults := documents[1]
+	require.Equal(t, ModuleDefaultsDocument, defaults.Document)
+	require.Equal(t, "perl", defaults.Name)
+	require.Equal(t, "5.26", defaults.Stream)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, WriteModules(buf, [][]byte{stream.Data, defaults.Data}))
+
+	written, err := ParseModules(buf)
+	require.NoError(t, err)
+	require.Equal(t, documents, written)
+
+	_, err = ParseModules(strings.NewReader("document: modulemd-obsoletes\nversion: 1\ndata: {}\n"))
+	require.Error(t, err)
+
+	_, err = ParseModules(strings.NewReader("document: modulemd\nversion: 2\ndata:\n  name: perl\n"))
+	require.Error(t, err)
+
+	require.Equal(t, "bash-5.1.8-6.el9.x86_64", ArtifactNVRA("bash-5.1.8-6.el9.x86_64"))
+}
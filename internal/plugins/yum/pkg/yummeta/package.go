@@ -0,0 +1,274 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yummeta
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// Package is a package entry of primary.xml.
+type Package struct {
+	XMLName     xml.Name        `xml:"package"`
+	Type        string          `xml:"type,attr"`
+	Name        string          `xml:"name"`
+	Arch        string          `xml:"arch"`
+	Version     PackageVersion  `xml:"version"`
+	Checksum    PackageChecksum `xml:"checksum"`
+	Summary     string          `xml:"summary"`
+	Description string          `xml:"description"`
+	Packager    string          `xml:"packager"`
+	URL         string          `xml:"url"`
+	Time        PackageTime     `xml:"time"`
+	Size        PackageSize     `xml:"size"`
+	Location    PackageLocation `xml:"location"`
+	Format      PackageFormat   `xml:"format"`
+}
+
+type PackageVersion struct {
+	Epoch string `xml:"epoch,attr"`
+	Ver   string `xml:"ver,attr"`
+	Rel   string `xml:"rel,attr"`
+}
+
+type PackageChecksum struct {
+	Type  string `xml:"type,attr"`
+	PkgID string `xml:"pkgid,attr"`
+	Value string `xml:",chardata"`
+}
+
+type PackageTime struct {
+	File  int64 `xml:"file,attr"`
+	Build int64 `xml:"build,attr"`
+}
+
+type PackageSize struct {
+	Package   int64 `xml:"package,attr"`
+	Installed int64 `xml:"installed,attr"`
+	Archive   int64 `xml:"archive,attr"`
+}
+
+type PackageLocation struct {
+	Href string `xml:"href,attr"`
+}
+
+type PackageHeaderRange struct {
+	Start int64 `xml:"start,attr"`
+	End   int64 `xml:"end,attr"`
+}
+
+// PackageEntry is a package dependency.
+type PackageEntry struct {
+	Name  string `xml:"name,attr"`
+	Flags string `xml:"flags,attr,omitempty"`
+	Epoch string `xml:"epoch,attr,omitempty"`
+	Ver   string `xml:"ver,attr,omitempty"`
+	Rel   string `xml:"rel,attr,omitempty"`
+	Pre   string `xml:"pre,attr,omitempty"`
+}
+
+const (
+	PackageFileDir   = "dir"
+	PackageFileGhost = "ghost"
+)
+
+// RPM dependency sense flags.
+const (
+	rpmSenseLess       = 1 << 1
+	rpmSenseGreater    = 1 << 2
+	rpmSenseEqual      = 1 << 3
+	rpmSensePrereq     = 1 << 6
+	rpmSenseScriptPre  = 1 << 9
+	rpmSenseScriptPost = 1 << 10
+)
+
+// NewPackageEntry returns the package dependency from the RPM header
+// dependency name, sense flags and [epoch:]version[-release].
+func NewPackageEntry(name string, flags int64, evr string) PackageEntry {
+	entry := PackageEntry{
+		Name: name,
+	}
+
+	switch flags & (rpmSenseLess | rpmSenseGreater | rpmSenseEqual) {
+	case rpmSenseLess:
+		entry.Flags = "LT"
+	case rpmSenseGreater:
+		entry.Flags = "GT"
+	case rpmSenseEqual:
+		entry.Flags = "EQ"
+	case rpmSenseLess | rpmSenseEqual:
+		entry.Flags = "LE"
+	case rpmSenseGreater | rpmSenseEqual:
+		entry.Flags = "GE"
+	}
+
+	if evr != "" {
+		entry.Epoch = "0"
+		if epoch, version, ok := strings.Cut(evr, ":"); ok {
+			if epoch != "" {
+				entry.Epoch = epoch
+			}
+			evr = version
+		}
+		if i := strings.LastIndexByte(evr, '-'); i >= 0 {
+			entry.Ver, entry.Rel = evr[:i], evr[i+1:]
+		} else {
+			entry.Ver = evr
+		}
+	}
+
+	return entry
+}
+
+// IsPreRequire returns true if the require sense flags
+// denote a dependency required by the package scriptlets.
+func IsPreRequire(flags int64) bool {
+	return flags&(rpmSensePrereq|rpmSenseScriptPre|rpmSenseScriptPost) != 0
+}
+
+// IsPrimaryFile returns true if the file is listed in primary.xml in
+// addition to filelists.xml.
+func IsPrimaryFile(path string) bool {
+	return strings.HasPrefix(path, "/etc/") || strings.Contains(path, "bin/") || path == "/usr/lib/sendmail"
+}
+
+// PackageFile is a package file, type is empty for regular files.
+type PackageFile struct {
+	Type string `xml:"type,attr,omitempty"`
+	Path string `xml:",chardata"`
+}
+
+// PackageFormat is the format element of a primary.xml package entry, elements
+// are prefixed by the rpm namespace which is ignored when decoding.
+type PackageFormat struct {
+	License     string             `xml:"license"`
+	Vendor      string             `xml:"vendor"`
+	Group       string             `xml:"group"`
+	BuildHost   string             `xml:"buildhost"`
+	SourceRPM   string             `xml:"sourcerpm"`
+	HeaderRange PackageHeaderRange `xml:"header-range"`
+	Provides    []PackageEntry     `xml:"provides>entry"`
+	Requires    []PackageEntry     `xml:"requires>entry"`
+	Conflicts   []PackageEntry     `xml:"conflicts>entry"`
+	Obsoletes   []PackageEntry     `xml:"obsoletes>entry"`
+	Suggests    []PackageEntry     `xml:"suggests>entry"`
+	Enhances    []PackageEntry     `xml:"enhances>entry"`
+	Recommends  []PackageEntry     `xml:"recommends>entry"`
+	Supplements []PackageEntry     `xml:"supplements>entry"`
+	Files       []PackageFile      `xml:"file"`
+}
+
+type packageEntries struct {
+	Entries []PackageEntry `xml:"rpm:entry"`
+}
+
+func rpmElement(name string) xml.StartElement {
+	return xml.StartElement{Name: xml.Name{Local: "rpm:" + name}}
+}
+
+// Dependencies returns the package dependencies indexed by type
+// (provides, requires ...) in the primary.xml order.
+func (f *PackageFormat) Dependencies() []PackageDependencies {
+	return []PackageDependencies{
+		{Type: "provides", Entries: f.Provides},
+		{Type: "requires", Entries: f.Requires},
+		{Type: "conflicts", Entries: f.Conflicts},
+		{Type: "obsoletes", Entries: f.Obsoletes},
+		{Type: "suggests", Entries: f.Suggests},
+		{Type: "enhances", Entries: f.Enhances},
+		{Type: "recommends", Entries: f.Recommends},
+		{Type: "supplements", Entries: f.Supplements},
+	}
+}
+
+type PackageDependencies struct {
+	Type    string
+	Entries []PackageEntry
+}
+
+func (f PackageFormat) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for _, element := range []struct {
+		name  string
+		value string
+	}{
+		{"license", f.License},
+		{"vendor", f.Vendor},
+		{"group", f.Group},
+		{"buildhost", f.BuildHost},
+		{"sourcerpm", f.SourceRPM},
+	} {
+		if err := e.EncodeElement(element.value, rpmElement(element.name)); err != nil {
+			return err
+		}
+	}
+
+	if err := e.EncodeElement(f.HeaderRange, rpmElement("header-range")); err != nil {
+		return err
+	}
+
+	for _, dependencies := range f.Dependencies() {
+		if len(dependencies.Entries) == 0 {
+			continue
+		}
+		err := e.EncodeElement(packageEntries{Entries: dependencies.Entries}, rpmElement(dependencies.Type))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range f.Files {
+		if err := e.EncodeElement(file, xml.StartElement{Name: xml.Name{Local: "file"}}); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// FilelistsPackage is a package entry of filelists.xml.
+type FilelistsPackage struct {
+	XMLName xml.Name       `xml:"package"`
+	PkgID   string         `xml:"pkgid,attr"`
+	Name    string         `xml:"name,attr"`
+	Arch    string         `xml:"arch,attr"`
+	Version PackageVersion `xml:"version"`
+	Files   []PackageFile  `xml:"file"`
+}
+
+// OtherPackage is a package entry of other.xml.
+type OtherPackage struct {
+	XMLName    xml.Name           `xml:"package"`
+	PkgID      string             `xml:"pkgid,attr"`
+	Name       string             `xml:"name,attr"`
+	Arch       string             `xml:"arch,attr"`
+	Version    PackageVersion     `xml:"version"`
+	Changelogs []PackageChangelog `xml:"changelog"`
+}
+
+type PackageChangelog struct {
+	Author string `xml:"author,attr"`
+	Date   int64  `xml:"date,attr"`
+	Text   string `xml:",chardata"`
+}
+
+// MarshalPackage returns the XML representation of a package entry
+// to insert between a metadata file header and footer.
+func MarshalPackage(pkg any) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	encoder := xml.NewEncoder(buf)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(pkg); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
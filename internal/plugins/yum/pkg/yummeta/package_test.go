@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yummeta
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPackageEntry(t *testing.T) {
+	tests := []struct {
+		name     string
+		flags    int64
+		evr      string
+		expected PackageEntry
+	}{
+		{
+			name:     "bash",
+			expected: PackageEntry{Name: "bash"},
+		},
+		{
+			name:     "glibc",
+			flags:    rpmSenseGreater | rpmSenseEqual,
+			evr:      "2.28",
+			expected: PackageEntry{Name: "glibc", Flags: "GE", Epoch: "0", Ver: "2.28"},
+		},
+		{
+			name:     "NetworkManager",
+			flags:    rpmSenseEqual,
+			evr:      "1:1.40.16-4.el8_8",
+			expected: PackageEntry{Name: "NetworkManager", Flags: "EQ", Epoch: "1", Ver: "1.40.16", Rel: "4.el8_8"},
+		},
+		{
+			name:     "openssl-libs",
+			flags:    rpmSenseLess,
+			evr:      "3.0-1",
+			expected: PackageEntry{Name: "openssl-libs", Flags: "LT", Epoch: "0", Ver: "3.0", Rel: "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, NewPackageEntry(tt.name, tt.flags, tt.evr))
+	}
+
+	require.True(t, IsPreRequire(rpmSenseScriptPost))
+	require.False(t, IsPreRequire(rpmSenseEqual))
+
+	require.True(t, IsPrimaryFile("/etc/NetworkManager/dispatcher.d/00-netreport"))
+	require.True(t, IsPrimaryFile("/usr/sbin/ifup"))
+	require.False(t, IsPrimaryFile("/usr/share/doc/README"))
+}
+
+func TestMarshalPackage(t *testing.T) {
+	pkg := &Package{
+		Type: "rpm",
+		Name: "NetworkManager-initscripts-updown",
+		Arch: "noarch",
+		Version: PackageVersion{
+			Epoch: "1",
+			Ver:   "1.40.16",
+			Rel:   "4.el8_8",
+		},
+		Checksum: PackageChecksum{
+			Type:  "sha256",
+			PkgID: "YES",
+			Value: "0cf9f96f80808ca6ce9804779d9efc64cc564c8b7cbb98afc5c5f1315e7340cd",
+		},
+		Summary: "Legacy ifup/ifdown scripts for NetworkManager",
+		Location: PackageLocation{
+			Href: "Packages/n/NetworkManager-initscripts-updown-1.40.16-4.el8_8.noarch.rpm",
+		},
+		Format: PackageFormat{
+			License: "GPLv2+ and LGPLv2+",
+			HeaderRange: PackageHeaderRange{
+				Start: 4504,
+				End:   9736,
+			},
+			Provides: []PackageEntry{
+				{Name: "NetworkManager-initscripts-updown", Flags: "EQ", Epoch: "1", Ver: "1.40.16", Rel: "4.el8_8"},
+			},
+			Requires: []PackageEntry{
+				{Name: "/bin/sh", Pre: "1"},
+				{Name: "NetworkManager", Flags: "EQ", Epoch: "1", Ver: "1.40.16", Rel: "4.el8_8"},
+			},
+			Files: []PackageFile{
+				{Path: "/usr/sbin/ifup"},
+				{Path: "/etc/sysconfig/network-scripts", Type: PackageFileDir},
+			},
+		},
+	}
+
+	data, err := MarshalPackage(pkg)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `<rpm:license>GPLv2+ and LGPLv2+</rpm:license>`)
+	require.Contains(t, string(data), `<rpm:header-range start="4504" end="9736"></rpm:header-range>`)
+	require.Contains(t, string(data), `<rpm:entry name="/bin/sh" pre="1"></rpm:entry>`)
+	require.Contains(t, string(data), `<file type="dir">/etc/sysconfig/network-scripts</file>`)
+	require.NotContains(t, string(data), "rpm:conflicts")
+
+	decoded := new(Package)
+	require.NoError(t, xml.Unmarshal(data, decoded))
+	decoded.XMLName = xml.Name{}
+	require.Equal(t, pkg, decoded)
+}
@@ -0,0 +1,380 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yummeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// RPM header tags not exposed by the rpm package.
+const (
+	rpmTagEpoch             = 1003
+	rpmTagBuildHost         = 1007
+	rpmTagPackager          = 1015
+	rpmTagURL               = 1020
+	rpmTagFileModes         = 1030
+	rpmTagFileFlags         = 1037
+	rpmTagArchiveSize       = 1046
+	rpmTagProvideName       = 1047
+	rpmTagRequireFlags      = 1048
+	rpmTagRequireName       = 1049
+	rpmTagRequireVersion    = 1050
+	rpmTagConflictFlags     = 1053
+	rpmTagConflictName      = 1054
+	rpmTagConflictVersion   = 1055
+	rpmTagChangelogTime     = 1080
+	rpmTagChangelogName     = 1081
+	rpmTagChangelogText     = 1082
+	rpmTagObsoleteName      = 1090
+	rpmTagProvideFlags      = 1112
+	rpmTagProvideVersion    = 1113
+	rpmTagObsoleteFlags     = 1114
+	rpmTagObsoleteVersion   = 1115
+	rpmTagDirIndexes        = 1116
+	rpmTagBaseNames         = 1117
+	rpmTagDirNames          = 1118
+	rpmTagLongArchiveSize   = 271
+	rpmTagRecommendName     = 5046
+	rpmTagRecommendVersion  = 5047
+	rpmTagRecommendFlags    = 5048
+	rpmTagSuggestName       = 5049
+	rpmTagSuggestVersion    = 5050
+	rpmTagSuggestFlags      = 5051
+	rpmTagSupplementName    = 5052
+	rpmTagSupplementVersion = 5053
+	rpmTagSupplementFlags   = 5054
+	rpmTagEnhanceName       = 5055
+	rpmTagEnhanceVersion    = 5056
+	rpmTagEnhanceFlags      = 5057
+)
+
+const (
+	rpmLeadSize      = 96
+	rpmFileGhost     = 1 << 6
+	rpmFileModeDir   = 0o040000
+	rpmFileModeMask  = 0o170000
+	rpmDefaultEpoch  = "0"
+	rpmChecksumType  = "sha256"
+	rpmChangelogSize = 10
+)
+
+var rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+
+// RPMMetadata is the repository metadata of a RPM package.
+type RPMMetadata struct {
+	Primary   *Package
+	Filelists *FilelistsPackage
+	Other     *OtherPackage
+}
+
+// ReadRPMMetadata returns the primary, filelists and other metadata of the RPM
+// package file identified by the SHA256 checksum pkgID. Like createrepo_c, the
+// package is located under Packages/<first letter of the filename>/ and other
+// metadata keep the last ten changelog entries.
+func ReadRPMMetadata(packagePath, pkgID string) (*RPMMetadata, error) {
+	f, err := os.Open(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	headerStart, headerEnd, err := rpmHeaderRange(f)
+	if err != nil {
+		return nil, fmt.Errorf("while reading package header range: %w", err)
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	pkg, err := rpm.Read(f)
+	if err != nil {
+		return nil, err
+	}
+
+	arch := pkg.Architecture()
+	if pkg.SourceRPM() == "" {
+		arch = "src"
+	}
+
+	version := PackageVersion{
+		Epoch: rpmDefaultEpoch,
+		Ver:   pkg.Version(),
+		Rel:   pkg.Release(),
+	}
+	if epoch := rpmTagInts(pkg, rpmTagEpoch); len(epoch) > 0 {
+		version.Epoch = strconv.FormatInt(epoch[0], 10)
+	}
+
+	archiveSize := rpmTagInts(pkg, rpmTagLongArchiveSize)
+	if len(archiveSize) == 0 {
+		archiveSize = rpmTagInts(pkg, rpmTagArchiveSize)
+	}
+
+	filename := filepath.Base(packagePath)
+	files := rpmFiles(pkg)
+
+	primary := &Package{
+		Type:    "rpm",
+		Name:    pkg.Name(),
+		Arch:    arch,
+		Version: version,
+		Checksum: PackageChecksum{
+			Type:  rpmChecksumType,
+			PkgID: "YES",
+			Value: pkgID,
+		},
+		Summary:     pkg.Summary(),
+		Description: pkg.Description(),
+		Packager:    rpmTagString(pkg, rpmTagPackager),
+		URL:         rpmTagString(pkg, rpmTagURL),
+		Time: PackageTime{
+			File:  info.ModTime().Unix(),
+			Build: pkg.BuildTime().Unix(),
+		},
+		Size: PackageSize{
+			Package:   info.Size(),
+			Installed: int64(pkg.Size()),
+		},
+		Location: PackageLocation{
+			Href: fmt.Sprintf("Packages/%c/%s", strings.ToLower(filename)[0], filename),
+		},
+		Format: PackageFormat{
+			License:   pkg.License(),
+			Vendor:    pkg.Vendor(),
+			Group:     strings.Join(pkg.Groups(), ", "),
+			BuildHost: rpmTagString(pkg, rpmTagBuildHost),
+			SourceRPM: pkg.SourceRPM(),
+			HeaderRange: PackageHeaderRange{
+				Start: headerStart,
+				End:   headerEnd,
+			},
+			Provides:    rpmDependencies(pkg, rpmTagProvideName, rpmTagProvideFlags, rpmTagProvideVersion),
+			Conflicts:   rpmDependencies(pkg, rpmTagConflictName, rpmTagConflictFlags, rpmTagConflictVersion),
+			Obsoletes:   rpmDependencies(pkg, rpmTagObsoleteName, rpmTagObsoleteFlags, rpmTagObsoleteVersion),
+			Suggests:    rpmDependencies(pkg, rpmTagSuggestName, rpmTagSuggestFlags, rpmTagSuggestVersion),
+			Enhances:    rpmDependencies(pkg, rpmTagEnhanceName, rpmTagEnhanceFlags, rpmTagEnhanceVersion),
+			Recommends:  rpmDependencies(pkg, rpmTagRecommendName, rpmTagRecommendFlags, rpmTagRecommendVersion),
+			Supplements: rpmDependencies(pkg, rpmTagSupplementName, rpmTagSupplementFlags, rpmTagSupplementVersion),
+		},
+	}
+	if len(archiveSize) > 0 {
+		primary.Size.Archive = archiveSize[0]
+	}
+
+	primary.Format.Requires = rpmRequires(pkg, primary.Format.Provides, files)
+
+	for _, file := range files {
+		if IsPrimaryFile(file.Path) {
+			primary.Format.Files = append(primary.Format.Files, file)
+		}
+	}
+
+	return &RPMMetadata{
+		Primary: primary,
+		Filelists: &FilelistsPackage{
+			PkgID:   pkgID,
+			Name:    primary.Name,
+			Arch:    arch,
+			Version: version,
+			Files:   files,
+		},
+		Other: &OtherPackage{
+			PkgID:      pkgID,
+			Name:       primary.Name,
+			Arch:       arch,
+			Version:    version,
+			Changelogs: rpmChangelogs(pkg),
+		},
+	}, nil
+}
+
+// rpmHeaderRange returns the start and end offsets of the package header
+// following the lead and the 8 bytes aligned signature header.
+func rpmHeaderRange(r io.ReadSeeker) (int64, int64, error) {
+	readHeaderSize := func(offset int64) (int64, error) {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+
+		intro := make([]byte, 16)
+		if _, err := io.ReadFull(r, intro); err != nil {
+			return 0, err
+		} else if !bytes.Equal(intro[:4], rpmHeaderMagic) {
+			return 0, fmt.Errorf("bad header magic at offset %d", offset)
+		}
+
+		indexCount := int64(binary.BigEndian.Uint32(intro[8:12]))
+		dataSize := int64(binary.BigEndian.Uint32(intro[12:16]))
+
+		return 16 + indexCount*16 + dataSize, nil
+	}
+
+	signatureSize, err := readHeaderSize(rpmLeadSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	start := rpmLeadSize + signatureSize
+	if padding := start % 8; padding != 0 {
+		start += 8 - padding
+	}
+
+	headerSize, err := readHeaderSize(start)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return start, start + headerSize, nil
+}
+
+func rpmTagString(pkg *rpm.Package, id int) string {
+	if values := rpmTagStrings(pkg, id); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func rpmTagStrings(pkg *rpm.Package, id int) []string {
+	tag := pkg.Header.GetTag(id)
+	if tag == nil {
+		return nil
+	}
+	return tag.StringSlice()
+}
+
+func rpmTagInts(pkg *rpm.Package, id int) []int64 {
+	tag := pkg.Header.GetTag(id)
+	if tag == nil {
+		return nil
+	}
+	return tag.Int64Slice()
+}
+
+func rpmDependencies(pkg *rpm.Package, nameTag, flagsTag, versionTag int) []PackageEntry {
+	names := rpmTagStrings(pkg, nameTag)
+	flags := rpmTagInts(pkg, flagsTag)
+	versions := rpmTagStrings(pkg, versionTag)
+
+	entries := make([]PackageEntry, 0, len(names))
+
+	for i, name := range names {
+		if i >= len(flags) || i >= len(versions) {
+			break
+		}
+		entries = append(entries, NewPackageEntry(name, flags[i], versions[i]))
+	}
+
+	return entries
+}
+
+// rpmRequires returns the package requires without the rpmlib requires,
+// the primary files and the dependencies provided by the package itself.
+func rpmRequires(pkg *rpm.Package, provides []PackageEntry, files []PackageFile) []PackageEntry {
+	names := rpmTagStrings(pkg, rpmTagRequireName)
+	flags := rpmTagInts(pkg, rpmTagRequireFlags)
+	versions := rpmTagStrings(pkg, rpmTagRequireVersion)
+
+	provided := make(map[PackageEntry]struct{}, len(provides))
+	for _, provide := range provides {
+		provided[provide] = struct{}{}
+	}
+
+	packageFiles := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		packageFiles[file.Path] = struct{}{}
+	}
+
+	seen := make(map[PackageEntry]struct{}, len(names))
+	entries := make([]PackageEntry, 0, len(names))
+
+	for i, name := range names {
+		if i >= len(flags) || i >= len(versions) {
+			break
+		} else if strings.HasPrefix(name, "rpmlib(") {
+			continue
+		} else if _, ok := packageFiles[name]; ok && IsPrimaryFile(name) {
+			continue
+		}
+
+		entry := NewPackageEntry(name, flags[i], versions[i])
+		if _, ok := provided[entry]; ok {
+			continue
+		}
+		if IsPreRequire(flags[i]) {
+			entry.Pre = "1"
+		}
+		if _, ok := seen[entry]; ok {
+			continue
+		}
+		seen[entry] = struct{}{}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func rpmFiles(pkg *rpm.Package) []PackageFile {
+	baseNames := rpmTagStrings(pkg, rpmTagBaseNames)
+	dirNames := rpmTagStrings(pkg, rpmTagDirNames)
+	dirIndexes := rpmTagInts(pkg, rpmTagDirIndexes)
+	modes := rpmTagInts(pkg, rpmTagFileModes)
+	flags := rpmTagInts(pkg, rpmTagFileFlags)
+
+	files := make([]PackageFile, 0, len(baseNames))
+
+	for i, baseName := range baseNames {
+		if i >= len(dirIndexes) || dirIndexes[i] < 0 || dirIndexes[i] >= int64(len(dirNames)) {
+			break
+		}
+
+		file := PackageFile{
+			Path: path.Join(dirNames[dirIndexes[i]], baseName),
+		}
+		if i < len(flags) && flags[i]&rpmFileGhost != 0 {
+			file.Type = PackageFileGhost
+		} else if i < len(modes) && modes[i]&rpmFileModeMask == rpmFileModeDir {
+			file.Type = PackageFileDir
+		}
+
+		files = append(files, file)
+	}
+
+	return files
+}
+
+// rpmChangelogs returns the last changelog entries in chronological order.
+func rpmChangelogs(pkg *rpm.Package) []PackageChangelog {
+	times := rpmTagInts(pkg, rpmTagChangelogTime)
+	names := rpmTagStrings(pkg, rpmTagChangelogName)
+	texts := rpmTagStrings(pkg, rpmTagChangelogText)
+
+	count := min(len(times), len(names), len(texts), rpmChangelogSize)
+	changelogs := make([]PackageChangelog, count)
+
+	// the header stores the most recent entries first
+	for i := 0; i < count; i++ {
+		changelogs[count-i-1] = PackageChangelog{
+			Author: names[i],
+			Date:   times[i],
+			Text:   texts[i],
+		}
+	}
+
+	return changelogs
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cavaliergopher/rpm"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.ciq.dev/beskar/internal/pkg/repository"
+	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
+	"go.ciq.dev/beskar/pkg/oras"
+	"go.ciq.dev/beskar/pkg/orasrpm"
+)
+
+var _ repository.Admitter = &Handler{}
+
+// Admit rejects the packages pushed by clients when their signature can't be
+// verified with the repository keyring, packages are admitted without keyring.
+// Errors while fetching the package are returned as admission failures.
+func (h *Handler) Admit(_ context.Context, event *eventv1.EventPayload) error {
+	manifest, err := v1.ParseManifest(bytes.NewReader(event.Payload))
+	if err != nil {
+		return fmt.Errorf("while parsing manifest: %w", err)
+	} else if manifest.Config.MediaType != types.MediaType(orasrpm.RPMConfigType) {
+		return nil
+	}
+
+	keyring := h.getKeyring()
+	if keyring == nil {
+		return nil
+	}
+
+	packageLayer, err := oras.GetLayer(manifest, orasrpm.RPMPackageLayerType)
+	if err != nil {
+		return repository.RejectAdmission(err)
+	}
+	packageName := packageLayer.Annotations[imagespec.AnnotationTitle]
+
+	if err := os.MkdirAll(h.downloadDir(), 0o700); err != nil {
+		return err
+	}
+
+	ref := filepath.Join(h.Repository, "packages@"+packageLayer.Digest.String())
+	packagePath := filepath.Join(h.downloadDir(), "admit-"+packageLayer.Digest.Hex)
+
+	if err := h.DownloadBlob(ref, packagePath); err != nil {
+		return fmt.Errorf("while downloading package %s: %w", packageName, err)
+	}
+	defer os.Remove(packagePath)
+
+	f, err := os.Open(packagePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := rpm.GPGCheck(f, keyring); err != nil {
+		return repository.RejectAdmission(fmt.Errorf("package %s signature check failed: %w", packageName, err))
+	}
+
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"go.ciq.dev/beskar/pkg/utils"
@@ -20,6 +21,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"go.ciq.dev/beskar/internal/pkg/sqlite"
 	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yumdb"
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yummeta"
 	apiv1 "go.ciq.dev/beskar/pkg/plugins/yum/api/v1"
 	"golang.org/x/sync/semaphore"
 )
@@ -70,6 +72,36 @@ func (h *Handler) CreateRepository(ctx context.Context, properties *apiv1.Reposi
 			return werror.Wrap(gcode.ErrInternal, err)
 		}
 	}
+	if properties.Retention != nil {
+		if properties.Retention.KeepEVRs < 0 {
+			return werror.Wrap(gcode.ErrInvalidArgument, errors.New("retention keep_evrs can't be negative"))
+		}
+		propertiesDB.RetentionKeepEVRs = properties.Retention.KeepEVRs
+
+		if properties.Retention.KeepSnapshots < 0 {
+			return werror.Wrap(gcode.ErrInvalidArgument, errors.New("retention keep_snapshots can't be negative"))
+		}
+		propertiesDB.RetentionKeepSnapshots = properties.Retention.KeepSnapshots
+	}
+	h.setRetentionKeepEVRs(propertiesDB.RetentionKeepEVRs)
+	h.setRetentionKeepSnapshots(propertiesDB.RetentionKeepSnapshots)
+
+	if properties.SigningKey != nil {
+		if len(properties.SigningKey) > 0 && h.signingKeySecret == nil {
+			return werror.Wrap(gcode.ErrFailedPrecondition, errors.New("repository signing keys require the plugin signing secret"))
+		}
+		propertiesDB.SigningKey, err = h.setSigningKey(properties.SigningKey, properties.SigningKeyPassphrase)
+		if err != nil {
+			return werror.Wrap(gcode.ErrInvalidArgument, fmt.Errorf("bad signing key: %w", err))
+		}
+	}
+	if properties.ResignPackages != nil {
+		propertiesDB.ResignPackages = *properties.ResignPackages
+	}
+	if propertiesDB.ResignPackages && h.getSigningKey() == nil {
+		return werror.Wrap(gcode.ErrFailedPrecondition, errors.New("packages re-signing requires a signing key"))
+	}
+	h.setResignPackages(propertiesDB.ResignPackages)
 
 	if err := db.UpdateProperties(dbCtx, propertiesDB); err != nil {
 		return werror.Wrap(gcode.ErrInternal, err)
@@ -227,6 +259,36 @@ func (h *Handler) UpdateRepository(ctx context.Context, properties *apiv1.Reposi
 			return werror.Wrap(gcode.ErrInternal, err)
 		}
 	}
+	if properties.Retention != nil {
+		if properties.Retention.KeepEVRs < 0 {
+			return werror.Wrap(gcode.ErrInvalidArgument, errors.New("retention keep_evrs can't be negative"))
+		}
+		propertiesDB.RetentionKeepEVRs = properties.Retention.KeepEVRs
+
+		if properties.Retention.KeepSnapshots < 0 {
+			return werror.Wrap(gcode.ErrInvalidArgument, errors.New("retention keep_snapshots can't be negative"))
+		}
+		propertiesDB.RetentionKeepSnapshots = properties.Retention.KeepSnapshots
+	}
+	h.setRetentionKeepEVRs(propertiesDB.RetentionKeepEVRs)
+	h.setRetentionKeepSnapshots(propertiesDB.RetentionKeepSnapshots)
+
+	if properties.SigningKey != nil {
+		if len(properties.SigningKey) > 0 && h.signingKeySecret == nil {
+			return werror.Wrap(gcode.ErrFailedPrecondition, errors.New("repository signing keys require the plugin signing secret"))
+		}
+		propertiesDB.SigningKey, err = h.setSigningKey(properties.SigningKey, properties.SigningKeyPassphrase)
+		if err != nil {
+			return werror.Wrap(gcode.ErrInvalidArgument, fmt.Errorf("bad signing key: %w", err))
+		}
+	}
+	if properties.ResignPackages != nil {
+		propertiesDB.ResignPackages = *properties.ResignPackages
+	}
+	if propertiesDB.ResignPackages && h.getSigningKey() == nil {
+		return werror.Wrap(gcode.ErrFailedPrecondition, errors.New("packages re-signing requires a signing key"))
+	}
+	h.setResignPackages(propertiesDB.ResignPackages)
 
 	if err := db.UpdateProperties(dbCtx, propertiesDB); err != nil {
 		return werror.Wrap(gcode.ErrInternal, err)
@@ -256,6 +318,18 @@ func (h *Handler) GetRepository(ctx context.Context) (properties *apiv1.Reposito
 	properties = &apiv1.RepositoryProperties{
 		Mirror: &propertiesDB.Mirror,
 		GPGKey: propertiesDB.GPGKey,
+		Retention: &apiv1.RetentionPolicy{
+			KeepEVRs:      propertiesDB.RetentionKeepEVRs,
+			KeepSnapshots: propertiesDB.RetentionKeepSnapshots,
+		},
+		ResignPackages: &propertiesDB.ResignPackages,
+	}
+
+	if signingKey := h.getSigningKey(); signingKey != nil {
+		properties.SigningPublicKey, err = signingPublicKey(signingKey)
+		if err != nil {
+			return nil, werror.Wrap(gcode.ErrInternal, err)
+		}
 	}
 
 	if len(propertiesDB.MirrorURLs) > 0 {
@@ -432,6 +506,25 @@ func (h *Handler) removePackageFromBeskar(ctx context.Context, pkg *yumdb.Reposi
 	return nil
 }
 
+// removeRepositoryPackage removes the package unless it's a module stream artifact.
+func (h *Handler) removeRepositoryPackage(ctx context.Context, pkg *yumdb.RepositoryPackage) error {
+	h.modulesMutex.Lock()
+	defer h.modulesMutex.Unlock()
+
+	artifacts, err := h.moduleArtifacts(ctx)
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	} else if module, ok := artifacts[pkg.NVRA()]; ok {
+		return werror.Wrap(gcode.ErrFailedPrecondition, fmt.Errorf("package %s is an artifact of module %s, the module must be removed first", pkg.RPMName(), module))
+	}
+
+	if err := h.removePackageFromBeskar(ctx, pkg); err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+
+	return nil
+}
+
 func (h *Handler) RemoveRepositoryPackage(ctx context.Context, id string) (err error) {
 	if !h.Started() {
 		return werror.Wrap(gcode.ErrUnavailable, err)
@@ -455,11 +548,7 @@ func (h *Handler) RemoveRepositoryPackage(ctx context.Context, id string) (err e
 		return werror.Wrap(gcode.ErrInternal, err)
 	}
 
-	if err := h.removePackageFromBeskar(ctx, pkg); err != nil {
-		return werror.Wrap(gcode.ErrInternal, err)
-	}
-
-	return nil
+	return h.removeRepositoryPackage(ctx, pkg)
 }
 
 func (h *Handler) RemoveRepositoryPackageByTag(ctx context.Context, tag string) (err error) {
@@ -485,11 +574,7 @@ func (h *Handler) RemoveRepositoryPackageByTag(ctx context.Context, tag string)
 		return werror.Wrap(gcode.ErrInternal, err)
 	}
 
-	if err := h.removePackageFromBeskar(ctx, pkg); err != nil {
-		return werror.Wrap(gcode.ErrInternal, err)
-	}
-
-	return nil
+	return h.removeRepositoryPackage(ctx, pkg)
 }
 
 func (h *Handler) GetRepositoryPackage(ctx context.Context, id string) (repositoryPackage *apiv1.RepositoryPackage, err error) {
@@ -558,6 +643,164 @@ func (h *Handler) ListRepositoryPackages(ctx context.Context, _ *apiv1.Page) (re
 	return repositoryPackages, nil
 }
 
+func (h *Handler) AddRepositoryModules(ctx context.Context, modules string, replace bool) (err error) {
+	if !h.Started() {
+		return werror.Wrap(gcode.ErrUnavailable, err)
+	} else if h.getMirror() {
+		return werror.Wrap(gcode.ErrFailedPrecondition, fmt.Errorf("could not add modules for mirror repository"))
+	} else if h.delete.Load() {
+		return werror.Wrap(gcode.ErrAlreadyExists, fmt.Errorf("repository %s is being deleted", h.Repository))
+	}
+
+	documents, err := yummeta.ParseModules(strings.NewReader(modules))
+	if err != nil {
+		return werror.Wrap(gcode.ErrInvalidArgument, err)
+	} else if len(documents) == 0 {
+		return werror.Wrap(gcode.ErrInvalidArgument, errors.New("no module documents provided"))
+	}
+
+	repositoryDB, err := h.getRepositoryDB(ctx)
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+	defer repositoryDB.Close(false)
+
+	metadataDB, err := h.getMetadataDB(ctx)
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+	defer metadataDB.Close(false)
+
+	// package removals are serialized with module additions to
+	// not remove the artifacts of the modules being added
+	h.modulesMutex.Lock()
+	defer h.modulesMutex.Unlock()
+
+	if err := checkModules(ctx, repositoryDB, metadataDB, documents, replace); err != nil {
+		return err
+	}
+
+	modulesDB := make([]*yumdb.Module, 0, len(documents))
+
+	for _, document := range documents {
+		modulesDB = append(modulesDB, &yumdb.Module{
+			Document: document.Document,
+			Name:     document.Name,
+			Stream:   document.Stream,
+			Version:  document.Version,
+			Context:  document.Context,
+			Arch:     document.Arch,
+			Data:     document.Data,
+		})
+	}
+
+	if err := metadataDB.AddModules(ctx, modulesDB); err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	} else if err := metadataDB.Sync(dbCtx); err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+
+	h.requestMetadataUpdate()
+
+	return nil
+}
+
+func (h *Handler) RemoveRepositoryModule(ctx context.Context, name string, stream string) (err error) {
+	if !h.Started() {
+		return werror.Wrap(gcode.ErrUnavailable, err)
+	} else if h.getMirror() {
+		return werror.Wrap(gcode.ErrFailedPrecondition, fmt.Errorf("could not remove module for mirror repository"))
+	} else if h.delete.Load() {
+		return werror.Wrap(gcode.ErrAlreadyExists, fmt.Errorf("repository %s is being deleted", h.Repository))
+	} else if name == "" || stream == "" {
+		return werror.Wrap(gcode.ErrInvalidArgument, errors.New("module name and stream are required"))
+	}
+
+	db, err := h.getMetadataDB(ctx)
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+	defer db.Close(false)
+
+	defaultStream := false
+
+	err = db.WalkModules(ctx, func(module *yumdb.Module) error {
+		if module.Document == yummeta.ModuleDefaultsDocument && module.Name == name && module.Stream == stream {
+			defaultStream = true
+		}
+		return nil
+	})
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	} else if defaultStream {
+		return werror.Wrap(gcode.ErrFailedPrecondition, fmt.Errorf("stream %s is the module %s default stream", stream, name))
+	}
+
+	removed, err := db.RemoveModules(ctx, yummeta.ModuleStreamDocument, name, stream)
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	} else if removed == 0 {
+		return werror.Wrap(gcode.ErrNotFound, fmt.Errorf("module %s:%s not found", name, stream))
+	} else if err := db.Sync(dbCtx); err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+
+	h.requestMetadataUpdate()
+
+	return nil
+}
+
+func (h *Handler) RemoveRepositoryModuleDefaults(ctx context.Context, name string) (err error) {
+	if !h.Started() {
+		return werror.Wrap(gcode.ErrUnavailable, err)
+	} else if h.getMirror() {
+		return werror.Wrap(gcode.ErrFailedPrecondition, fmt.Errorf("could not remove module defaults for mirror repository"))
+	} else if h.delete.Load() {
+		return werror.Wrap(gcode.ErrAlreadyExists, fmt.Errorf("repository %s is being deleted", h.Repository))
+	}
+
+	db, err := h.getMetadataDB(ctx)
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+	defer db.Close(false)
+
+	removed, err := db.RemoveModules(ctx, yummeta.ModuleDefaultsDocument, name, "")
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	} else if removed == 0 {
+		return werror.Wrap(gcode.ErrNotFound, fmt.Errorf("module %s defaults not found", name))
+	} else if err := db.Sync(dbCtx); err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+
+	h.requestMetadataUpdate()
+
+	return nil
+}
+
+func (h *Handler) ListRepositoryModules(ctx context.Context) (repositoryModules []*apiv1.RepositoryModule, err error) {
+	if !h.Started() {
+		return nil, werror.Wrap(gcode.ErrUnavailable, err)
+	}
+
+	db, err := h.getMetadataDB(ctx)
+	if err != nil {
+		return nil, werror.Wrap(gcode.ErrInternal, err)
+	}
+	defer db.Close(false)
+
+	err = db.WalkModules(ctx, func(module *yumdb.Module) error {
+		repositoryModules = append(repositoryModules, toRepositoryModuleAPI(module))
+		return nil
+	})
+	if err != nil {
+		return nil, werror.Wrap(gcode.ErrInternal, err)
+	}
+
+	return repositoryModules, nil
+}
+
 func toRepositoryPackageAPI(pkg *yumdb.RepositoryPackage) *apiv1.RepositoryPackage {
 	return &apiv1.RepositoryPackage{
 		Tag:          pkg.Tag,
@@ -579,3 +822,14 @@ func toRepositoryPackageAPI(pkg *yumdb.RepositoryPackage) *apiv1.RepositoryPacka
 		GPGSignature: pkg.GPGSignature,
 	}
 }
+
+func toRepositoryModuleAPI(module *yumdb.Module) *apiv1.RepositoryModule {
+	return &apiv1.RepositoryModule{
+		Document: module.Document,
+		Name:     module.Name,
+		Stream:   module.Stream,
+		Version:  module.Version,
+		Context:  module.Context,
+		Arch:     module.Arch,
+	}
+}
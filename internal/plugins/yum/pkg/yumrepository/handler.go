@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
@@ -19,9 +20,12 @@ import (
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"go.ciq.dev/beskar/internal/pkg/repository"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
 	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yumdb"
 	eventv1 "go.ciq.dev/beskar/pkg/api/event/v1"
 	"go.ciq.dev/beskar/pkg/orasrpm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/openpgp"       //nolint:staticcheck
 	"golang.org/x/crypto/openpgp/armor" //nolint:staticcheck
 )
@@ -47,17 +51,51 @@ type Handler struct {
 	created       bool
 	mirror        bool
 	keyring       openpgp.KeyRing
+	signingKey    *openpgp.Entity
+	resign        bool
 	mirrorURLs    []*url.URL
+	keepEVRs      int
+	keepSnapshots int
+
+	// defaultSigningKey signs the metadata of repositories without signing key
+	defaultSigningKey *openpgp.Entity
+	// signingKeySecret encrypts the repository signing key in the status database
+	signingKeySecret []byte
+
+	retentionRunning atomic.Bool
+
+	// modulesMutex serializes module additions and package removals
+	modulesMutex sync.Mutex
+
+	// metadataChanges are only accessed by the event loop
+	metadataChanges *metadataChanges
+	// metadataUpdateCh requests a metadata update to the event loop
+	metadataUpdateCh chan struct{}
 
 	delete atomic.Bool
 }
 
 func NewHandler(logger *slog.Logger, repoHandler *repository.RepoHandler) *Handler {
 	return &Handler{
-		RepoHandler: repoHandler,
-		repoDir:     filepath.Join(repoHandler.Params.Dir, repoHandler.Repository),
-		logger:      logger,
-		syncCh:      make(chan chan error, 1),
+		RepoHandler:      repoHandler,
+		repoDir:          filepath.Join(repoHandler.Params.Dir, repoHandler.Repository),
+		logger:           logger,
+		syncCh:           make(chan chan error, 1),
+		metadataUpdateCh: make(chan struct{}, 1),
+	}
+}
+
+// NewHandlerWithSigningKey returns a handler constructor for repositories signing
+// their metadata with the default signing key unless they have their own signing key,
+// repository signing keys are stored encrypted with the secret and can't be set without.
+func NewHandlerWithSigningKey(defaultSigningKey *openpgp.Entity, secret string) func(*slog.Logger, *repository.RepoHandler) *Handler {
+	return func(logger *slog.Logger, repoHandler *repository.RepoHandler) *Handler {
+		h := NewHandler(logger, repoHandler)
+		h.defaultSigningKey = defaultSigningKey
+		if secret != "" {
+			h.signingKeySecret = []byte(secret)
+		}
+		return h
 	}
 }
 
@@ -65,6 +103,10 @@ func (h *Handler) downloadDir() string {
 	return filepath.Join(h.repoDir, "downloads")
 }
 
+func (h *Handler) metadataStateDir() string {
+	return filepath.Join(h.repoDir, "metadata-state")
+}
+
 func (h *Handler) QueueEvent(event *eventv1.EventPayload, store bool) error {
 	ctx := context.Background()
 
@@ -227,6 +269,8 @@ func (h *Handler) initProperties(ctx context.Context) error {
 	}
 	h.setMirror(properties.Mirror)
 	h.setCreated(properties.Created)
+	h.setRetentionKeepEVRs(properties.RetentionKeepEVRs)
+	h.setRetentionKeepSnapshots(properties.RetentionKeepSnapshots)
 
 	if len(properties.MirrorURLs) > 0 {
 		var mirrorURLs []string
@@ -245,6 +289,10 @@ func (h *Handler) initProperties(ctx context.Context) error {
 			return err
 		}
 	}
+	if err := h.loadSigningKey(ctx, statusDB, properties); err != nil {
+		return err
+	}
+	h.setResignPackages(properties.ResignPackages)
 
 	reposync, err := statusDB.GetReposync(ctx)
 	if err != nil {
@@ -307,6 +355,32 @@ func (h *Handler) getMirror() bool {
 	return h.mirror
 }
 
+func (h *Handler) setRetentionKeepEVRs(keepEVRs int) {
+	h.propertyMutex.Lock()
+	h.keepEVRs = keepEVRs
+	h.propertyMutex.Unlock()
+}
+
+func (h *Handler) getRetentionKeepEVRs() int {
+	h.propertyMutex.RLock()
+	defer h.propertyMutex.RUnlock()
+
+	return h.keepEVRs
+}
+
+func (h *Handler) setRetentionKeepSnapshots(keepSnapshots int) {
+	h.propertyMutex.Lock()
+	h.keepSnapshots = keepSnapshots
+	h.propertyMutex.Unlock()
+}
+
+func (h *Handler) getRetentionKeepSnapshots() int {
+	h.propertyMutex.RLock()
+	defer h.propertyMutex.RUnlock()
+
+	return h.keepSnapshots
+}
+
 func (h *Handler) setKeyring(key []byte) error {
 	p, err := armor.Decode(bytes.NewReader(key))
 	if err != nil {
@@ -332,6 +406,118 @@ func (h *Handler) getKeyring() openpgp.KeyRing {
 	return h.keyring
 }
 
+// setSigningKey sets the repository signing key decrypted with the passphrase and
+// returns the key encrypted to store in the status database, an empty key resets
+// it to the default signing key.
+func (h *Handler) setSigningKey(key []byte, passphrase string) ([]byte, error) {
+	var (
+		signingKey *openpgp.Entity
+		encrypted  []byte
+	)
+
+	if len(key) > 0 {
+		if h.signingKeySecret == nil {
+			return nil, errors.New("repository signing keys require the plugin signing secret")
+		}
+
+		var err error
+
+		signingKey, err = ReadSigningKey(key, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		encrypted, err = encryptSigningKey(key, passphrase, h.signingKeySecret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	h.propertyMutex.Lock()
+	h.signingKey = signingKey
+	h.propertyMutex.Unlock()
+
+	return encrypted, nil
+}
+
+// loadSigningKey sets the repository signing key stored in the status database,
+// keys stored in clear by previous versions are encrypted if the plugin signing
+// secret is set.
+func (h *Handler) loadSigningKey(ctx context.Context, statusDB *yumdb.StatusDB, properties *yumdb.Properties) error {
+	if len(properties.SigningKey) == 0 {
+		return nil
+	}
+
+	key, passphrase := properties.SigningKey, ""
+	inClear := isArmoredKey(key)
+
+	if !inClear {
+		if h.signingKeySecret == nil {
+			return errors.New("repository signing key can't be decrypted without the plugin signing secret")
+		}
+		var err error
+		key, passphrase, err = decryptSigningKey(key, h.signingKeySecret)
+		if err != nil {
+			return err
+		}
+	}
+
+	signingKey, err := ReadSigningKey(key, passphrase)
+	if err != nil {
+		return err
+	}
+
+	h.propertyMutex.Lock()
+	h.signingKey = signingKey
+	h.propertyMutex.Unlock()
+
+	if !inClear {
+		return nil
+	} else if h.signingKeySecret == nil {
+		h.logger.Warn("repository signing key stored in clear, set the plugin signing secret to encrypt it")
+		return nil
+	}
+
+	properties.SigningKey, err = encryptSigningKey(key, "", h.signingKeySecret)
+	if err != nil {
+		return err
+	} else if err := statusDB.UpdateProperties(ctx, properties); err != nil {
+		return err
+	}
+
+	return statusDB.Sync(ctx)
+}
+
+// getSigningKey returns the key signing the repository metadata, it
+// returns nil if neither the repository nor the plugin have a signing key.
+func (h *Handler) getSigningKey() *openpgp.Entity {
+	h.propertyMutex.RLock()
+	defer h.propertyMutex.RUnlock()
+
+	if h.signingKey != nil {
+		return h.signingKey
+	}
+	return h.defaultSigningKey
+}
+
+func (h *Handler) setResignPackages(resign bool) {
+	h.propertyMutex.Lock()
+	h.resign = resign
+	h.propertyMutex.Unlock()
+}
+
+// getPackageSigningKey returns the key re-signing the uploaded packages,
+// it returns nil if package re-signing is disabled.
+func (h *Handler) getPackageSigningKey() *openpgp.Entity {
+	h.propertyMutex.RLock()
+	resign := h.resign
+	h.propertyMutex.RUnlock()
+
+	if !resign {
+		return nil
+	}
+	return h.getSigningKey()
+}
+
 func (h *Handler) getReposync() *yumdb.Reposync {
 	return h.reposync.Load()
 }
@@ -363,6 +549,14 @@ func (h *Handler) Start(ctx context.Context) {
 		return
 	}
 
+	// the metadata state may be outdated, the first
+	// metadata update regenerates all metadata
+	if err := os.RemoveAll(h.metadataStateDir()); err != nil {
+		h.cleanup()
+		h.logger.Error("remove repository metadata state", "error", err.Error())
+		return
+	}
+
 	// initialize status DB
 	statusDB, err := h.getStatusDB(ctx)
 	if err != nil {
@@ -417,11 +611,39 @@ func (h *Handler) Start(ctx context.Context) {
 		return
 	}
 
+	retentionTicker := time.NewTicker(retentionInterval)
+
+	// metadataUpdate fires once no repository changes were
+	// received during the metadata debounce delay
+	var (
+		metadataTimer  *time.Timer
+		metadataUpdate <-chan time.Time
+	)
+
+	scheduleMetadataUpdate := func() {
+		if metadataTimer != nil {
+			metadataTimer.Stop()
+		}
+		metadataTimer = time.NewTimer(h.metadataChanges.delay())
+		metadataUpdate = metadataTimer.C
+	}
+
 	go func() {
+		defer retentionTicker.Stop()
+
 		for !h.Stopped.Load() {
 			select {
 			case <-ctx.Done():
 				h.Stopped.Store(true)
+			case <-metadataUpdate:
+				metadataTimer, metadataUpdate = nil, nil
+				h.pushMetadataChanges()
+			case <-h.metadataUpdateCh:
+				h.pendingMetadataChanges()
+				scheduleMetadataUpdate()
+			case <-retentionTicker.C:
+				// removals are processed by this loop, don't block it
+				go h.applyRetention(ctx)
 			case waitErrCh, more := <-h.syncCh:
 				if more {
 					go func() {
@@ -447,6 +669,10 @@ func (h *Handler) Start(ctx context.Context) {
 
 				h.processEvents(events)
 
+				if h.metadataChanges != nil {
+					scheduleMetadataUpdate()
+				}
+
 				// all remaining events in database have been processed
 				// start the repository sync
 				if lastIndex != nil && events[len(events)-1].Digest == lastIndex.Digest {
@@ -461,6 +687,10 @@ func (h *Handler) Start(ctx context.Context) {
 				}
 			}
 		}
+		if metadataTimer != nil {
+			metadataTimer.Stop()
+		}
+		h.pushMetadataChanges()
 		h.cleanup()
 	}()
 }
@@ -468,46 +698,11 @@ func (h *Handler) Start(ctx context.Context) {
 func (h *Handler) processEvents(events []*eventv1.EventPayload) {
 	processContext := context.Background()
 
-	for _, event := range events {
-		manifest, err := v1.ParseManifest(bytes.NewReader(event.Payload))
-		if err != nil {
-			h.logger.Error("parse package manifest", "error", err.Error())
-			continue
-		}
-
-		if event.Action == eventv1.Action_ACTION_PUT {
-			switch manifest.Config.MediaType {
-			case types.MediaType(orasrpm.RPMConfigType):
-				err := h.processPackageManifest(processContext, manifest, event.Digest)
-				if err != nil {
-					h.logger.Error("process package manifest", "error", err.Error())
-				}
-			case types.MediaType(orasrpm.RepomdDataConfigType):
-				err := h.processMetadataManifest(processContext, manifest, event.Digest)
-				if err != nil {
-					h.logger.Error("process metadata manifest", "error", err.Error())
-				}
-			}
-		} else if event.Action == eventv1.Action_ACTION_DELETE {
-			switch manifest.Config.MediaType {
-			case types.MediaType(orasrpm.RPMConfigType):
-				err := h.deletePackageManifest(processContext, manifest)
-				if err != nil {
-					h.logger.Error("delete package manifest", "error", err.Error())
-				}
-			case types.MediaType(orasrpm.RepomdDataConfigType):
-				err := h.deleteMetadataManifest(processContext, manifest)
-				if err != nil {
-					h.logger.Error("delete metadata manifest", "error", err.Error())
-				}
-			}
-		}
+	links := make([]trace.Link, 0, len(events))
 
-		if err := h.statusDB.RemoveEvent(processContext, event); err != nil {
-			h.logger.Error("event remove", "error", err.Error())
-		} else if err := h.statusDB.Sync(processContext); err != nil {
-			h.logger.Error("event remove", "error", err.Error())
-		}
+	for _, event := range events {
+		spanContext := h.processEvent(processContext, event)
+		links = append(links, trace.Link{SpanContext: spanContext})
 
 		if h.Stopped.Load() {
 			break
@@ -515,9 +710,99 @@ func (h *Handler) processEvents(events []*eventv1.EventPayload) {
 	}
 
 	if !h.getMirror() && !h.delete.Load() {
-		err := h.generateAndPushMetadata(processContext)
-		if err != nil {
-			h.logger.Error("generate/push metadata", "error", err.Error())
+		h.pendingMetadataChanges().addLinks(links...)
+	}
+}
+
+// pendingMetadataChanges returns the repository changes not yet
+// reflected in the repository metadata.
+func (h *Handler) pendingMetadataChanges() *metadataChanges {
+	if h.metadataChanges == nil {
+		h.metadataChanges = newMetadataChanges()
+	}
+	return h.metadataChanges
+}
+
+// requestMetadataUpdate requests a metadata update for repository
+// changes made outside of the event loop.
+func (h *Handler) requestMetadataUpdate() {
+	select {
+	case h.metadataUpdateCh <- struct{}{}:
+	default:
+		// an update is already requested
+	}
+}
+
+// pushMetadataChanges updates and pushes the repository metadata
+// with the pending repository changes.
+func (h *Handler) pushMetadataChanges() {
+	changes := h.metadataChanges
+	h.metadataChanges = nil
+
+	if changes == nil || h.getMirror() || h.delete.Load() {
+		return
+	}
+
+	ctx, span := tracing.Start(context.Background(), "yum.generateAndPushMetadata", trace.WithLinks(changes.links...))
+	err := h.generateAndPushMetadata(ctx, changes.packages)
+	if err != nil {
+		h.logger.Error("generate/push metadata", "error", err.Error())
+	}
+	tracing.End(span, err)
+}
+
+func (h *Handler) processEvent(ctx context.Context, event *eventv1.EventPayload) trace.SpanContext {
+	ctx, span := tracing.Start(h.EventContext(ctx, event), "yum.processEvent", trace.WithAttributes(
+		attribute.String("repository", h.Repository),
+		attribute.String("action", event.Action.String()),
+		attribute.String("digest", event.Digest),
+	))
+
+	var err error
+
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	manifest, err := v1.ParseManifest(bytes.NewReader(event.Payload))
+	if err != nil {
+		h.logger.Error("parse package manifest", "error", err.Error())
+		return span.SpanContext()
+	}
+
+	if event.Action == eventv1.Action_ACTION_PUT {
+		switch manifest.Config.MediaType {
+		case types.MediaType(orasrpm.RPMConfigType):
+			err = h.processPackageManifest(ctx, manifest, event.Digest)
+			if err != nil {
+				h.logger.Error("process package manifest", "error", err.Error())
+			}
+		case types.MediaType(orasrpm.RepomdDataConfigType):
+			err = h.processMetadataManifest(ctx, manifest, event.Digest)
+			if err != nil {
+				h.logger.Error("process metadata manifest", "error", err.Error())
+			}
 		}
+	} else if event.Action == eventv1.Action_ACTION_DELETE {
+		switch manifest.Config.MediaType {
+		case types.MediaType(orasrpm.RPMConfigType):
+			err = h.deletePackageManifest(ctx, manifest)
+			if err != nil {
+				h.logger.Error("delete package manifest", "error", err.Error())
+			}
+		case types.MediaType(orasrpm.RepomdDataConfigType):
+			err = h.deleteMetadataManifest(ctx, manifest)
+			if err != nil {
+				h.logger.Error("delete metadata manifest", "error", err.Error())
+			}
+		}
+	}
+
+	if err := h.statusDB.RemoveEvent(ctx, event); err != nil {
+		h.logger.Error("event remove", "error", err.Error())
+	} else if err := h.statusDB.Sync(ctx); err != nil {
+		h.logger.Error("event remove", "error", err.Error())
 	}
+
+	return span.SpanContext()
 }
@@ -0,0 +1,281 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yummeta"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// metadataDebounce is the delay without repository changes
+	// before the repository metadata are updated.
+	metadataDebounce = 5 * time.Second
+
+	// metadataMaxDelay bounds the metadata update delay when
+	// repository changes are continuously received.
+	metadataMaxDelay = time.Minute
+
+	// maxMetadataLinks is the maximum number of processed events
+	// linked to the metadata update trace span.
+	maxMetadataLinks = 128
+
+	metadataStateIndexFile = "index.json"
+)
+
+// metadataStateFiles are the uncompressed XML files of the metadata state,
+// they only contain the package entries without header and footer.
+var metadataStateFiles = [...]string{
+	yummeta.PrimaryXMLFile,
+	yummeta.FilelistsXMLFile,
+	yummeta.OtherXMLFile,
+}
+
+// metadataChanges are the repository changes accumulated until
+// the next metadata update, it's only accessed by the event loop.
+type metadataChanges struct {
+	packages map[string]struct{}
+	links    []trace.Link
+	since    time.Time
+}
+
+func newMetadataChanges() *metadataChanges {
+	return &metadataChanges{
+		packages: make(map[string]struct{}),
+		since:    time.Now(),
+	}
+}
+
+// addPackage records the ID of a package added or removed.
+func (mc *metadataChanges) addPackage(id string) {
+	mc.packages[id] = struct{}{}
+}
+
+func (mc *metadataChanges) addLinks(links ...trace.Link) {
+	if free := maxMetadataLinks - len(mc.links); free < len(links) {
+		links = links[:max(free, 0)]
+	}
+	mc.links = append(mc.links, links...)
+}
+
+// delay returns the delay before the metadata update.
+func (mc *metadataChanges) delay() time.Duration {
+	if remaining := metadataMaxDelay - time.Since(mc.since); remaining < metadataDebounce {
+		return max(remaining, 0)
+	}
+	return metadataDebounce
+}
+
+type metadataRange struct {
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+// metadataEntry locates a package within the metadata state, key
+// is the package key in the sqlite databases.
+type metadataEntry struct {
+	ID     string                                 `json:"id"`
+	Name   string                                 `json:"name"`
+	Key    int64                                  `json:"key"`
+	Ranges [len(metadataStateFiles)]metadataRange `json:"ranges"`
+}
+
+// metadataState is the local state of the last metadata generated for the
+// repository: the XML package entries with their index and the uncompressed
+// sqlite databases. It allows to update the metadata by removing and appending
+// the package entries affected by changes instead of regenerating everything.
+type metadataState struct {
+	dir     string
+	entries []*metadataEntry
+
+	next      []*metadataEntry
+	files     [len(metadataStateFiles)]*os.File
+	offsets   [len(metadataStateFiles)]int64
+	committed bool
+}
+
+// loadMetadataState loads the metadata state from the directory.
+func loadMetadataState(dir string) (*metadataState, error) {
+	index, err := os.ReadFile(filepath.Join(dir, metadataStateIndexFile))
+	if err != nil {
+		return nil, err
+	}
+
+	state := &metadataState{
+		dir: dir,
+	}
+	if err := json.Unmarshal(index, &state.entries); err != nil {
+		return nil, fmt.Errorf("while decoding metadata state index: %w", err)
+	}
+
+	for _, file := range metadataStateFiles {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// newMetadataState returns an empty metadata state, the previous state is removed.
+func newMetadataState(dir string) (*metadataState, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	} else if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &metadataState{
+		dir: dir,
+	}, nil
+}
+
+func (s *metadataState) empty() bool {
+	return len(s.entries) == 0
+}
+
+// begin starts a new state generation, the current state remains
+// readable until the new one is committed.
+func (s *metadataState) begin() error {
+	for i, file := range metadataStateFiles {
+		f, err := os.Create(filepath.Join(s.dir, file+".next"))
+		if err != nil {
+			return err
+		}
+		s.files[i] = f
+	}
+
+	// the state is inconsistent until the commit
+	err := os.Remove(filepath.Join(s.dir, metadataStateIndexFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// keep copies the package entries of the current state for which keepFn returns
+// true to the new state and to the writers, the entries dropped are passed to dropFn.
+func (s *metadataState) keep(writers [len(metadataStateFiles)]io.Writer, keepFn func(*metadataEntry) bool, dropFn func(*metadataEntry) error) error {
+	var current [len(metadataStateFiles)]*os.File
+
+	for i, file := range metadataStateFiles {
+		f, err := os.Open(filepath.Join(s.dir, file))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		current[i] = f
+	}
+
+	for _, entry := range s.entries {
+		if !keepFn(entry) {
+			if err := dropFn(entry); err != nil {
+				return err
+			}
+			continue
+		}
+
+		next := &metadataEntry{
+			ID:   entry.ID,
+			Name: entry.Name,
+			Key:  entry.Key,
+		}
+
+		for i, r := range entry.Ranges {
+			section := io.NewSectionReader(current[i], r.Offset, r.Size)
+			if _, err := io.Copy(io.MultiWriter(s.files[i], writers[i]), section); err != nil {
+				return err
+			}
+			next.Ranges[i] = metadataRange{Offset: s.offsets[i], Size: r.Size}
+			s.offsets[i] += r.Size
+		}
+
+		s.next = append(s.next, next)
+	}
+
+	return nil
+}
+
+// add appends the package entries to the new state.
+func (s *metadataState) add(id, name string, key int64, data [len(metadataStateFiles)][]byte) error {
+	entry := &metadataEntry{
+		ID:   id,
+		Name: name,
+		Key:  key,
+	}
+
+	for i, d := range data {
+		if _, err := s.files[i].Write(d); err != nil {
+			return err
+		}
+		entry.Ranges[i] = metadataRange{Offset: s.offsets[i], Size: int64(len(d))}
+		s.offsets[i] += int64(len(d))
+	}
+
+	s.next = append(s.next, entry)
+
+	return nil
+}
+
+// count returns the number of packages of the new state.
+func (s *metadataState) count() int {
+	return len(s.next)
+}
+
+// commit replaces the current state by the new one.
+func (s *metadataState) commit() error {
+	for i, file := range metadataStateFiles {
+		err := s.files[i].Close()
+		s.files[i] = nil
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(s.dir, file+".next"), filepath.Join(s.dir, file)); err != nil {
+			return err
+		}
+	}
+
+	index, err := json.Marshal(s.next)
+	if err != nil {
+		return err
+	}
+
+	tmpIndex := filepath.Join(s.dir, metadataStateIndexFile+".next")
+	if err := os.WriteFile(tmpIndex, index, 0o600); err != nil {
+		return err
+	} else if err := os.Rename(tmpIndex, filepath.Join(s.dir, metadataStateIndexFile)); err != nil {
+		return err
+	}
+
+	s.entries, s.next = s.next, nil
+	s.offsets = [len(metadataStateFiles)]int64{}
+	s.committed = true
+
+	return nil
+}
+
+// discard removes the state if the new state wasn't committed, the
+// next metadata generation will start from an empty state.
+func (s *metadataState) discard() error {
+	for i, f := range s.files {
+		if f != nil {
+			_ = f.Close()
+			s.files[i] = nil
+		}
+	}
+	if s.committed {
+		return nil
+	}
+	return os.RemoveAll(s.dir)
+}
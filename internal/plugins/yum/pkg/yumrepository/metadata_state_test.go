@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yummeta"
+)
+
+func TestMetadataState(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "metadata-state")
+
+	packageData := func(name string) [len(metadataStateFiles)][]byte {
+		return [len(metadataStateFiles)][]byte{
+			[]byte("<primary>" + name + "</primary>\n"),
+			[]byte("<filelists>" + name + "</filelists>\n"),
+			[]byte("<other>" + name + "</other>\n"),
+		}
+	}
+
+	state, err := newMetadataState(dir)
+	require.NoError(t, err)
+	require.True(t, state.empty())
+
+	require.NoError(t, state.begin())
+	require.NoError(t, state.add("1", "bash.rpm", 1, packageData("bash")))
+	require.NoError(t, state.add("2", "vim.rpm", 2, packageData("vim")))
+	require.NoError(t, state.add("3", "zsh.rpm", 3, packageData("zsh")))
+	require.NoError(t, state.commit())
+	require.NoError(t, state.discard())
+
+	state, err = loadMetadataState(dir)
+	require.NoError(t, err)
+	require.Len(t, state.entries, 3)
+
+	var buffers [len(metadataStateFiles)]bytes.Buffer
+	writers := [len(metadataStateFiles)]io.Writer{&buffers[0], &buffers[1], &buffers[2]}
+
+	var dropped []int64
+
+	require.NoError(t, state.begin())
+	err = state.keep(writers, func(entry *metadataEntry) bool {
+		return entry.ID != "2"
+	}, func(entry *metadataEntry) error {
+		dropped = append(dropped, entry.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, state.add("4", "vim.rpm", 4, packageData("vim-enhanced")))
+	require.Equal(t, 3, state.count())
+	require.NoError(t, state.commit())
+
+	require.Equal(t, []int64{2}, dropped)
+	require.Equal(t, "<primary>bash</primary>\n<primary>zsh</primary>\n", buffers[0].String())
+	require.Equal(t, "<other>bash</other>\n<other>zsh</other>\n", buffers[2].String())
+
+	primary, err := os.ReadFile(filepath.Join(dir, yummeta.PrimaryXMLFile))
+	require.NoError(t, err)
+	require.Equal(t, "<primary>bash</primary>\n<primary>zsh</primary>\n<primary>vim-enhanced</primary>\n", string(primary))
+
+	state, err = loadMetadataState(dir)
+	require.NoError(t, err)
+	require.Equal(t, []*metadataEntry{
+		{ID: "1", Name: "bash.rpm", Key: 1, Ranges: [3]metadataRange{{0, 24}, {0, 28}, {0, 20}}},
+		{ID: "3", Name: "zsh.rpm", Key: 3, Ranges: [3]metadataRange{{24, 23}, {28, 27}, {20, 19}}},
+		{ID: "4", Name: "vim.rpm", Key: 4, Ranges: [3]metadataRange{{47, 32}, {55, 36}, {39, 28}}},
+	}, state.entries)
+
+	// an uncommitted state is removed
+	require.NoError(t, state.begin())
+	require.NoError(t, state.discard())
+
+	_, err = loadMetadataState(dir)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/RussellLuo/kun/pkg/werror"
+	"github.com/RussellLuo/kun/pkg/werror/gcode"
+	"github.com/klauspost/compress/gzip"
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yumdb"
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yummeta"
+)
+
+func moduleKey(document, name, stream string, version uint64, moduleContext, arch string) string {
+	return fmt.Sprintf("%s/%s/%s/%d/%s/%s", document, name, stream, version, moduleContext, arch)
+}
+
+func moduleStreamKey(name, stream string) string {
+	return name + ":" + stream
+}
+
+// checkModules validates the module documents added to the repository, the module
+// stream artifacts must be repository packages and the module defaults stream must
+// be a repository module stream. Existing documents are only replaced if replace is true.
+func checkModules(ctx context.Context, repositoryDB *yumdb.RepositoryDB, metadataDB *yumdb.MetadataDB, documents []*yummeta.ModuleDocument, replace bool) error {
+	modules := make(map[string]struct{})
+	streams := make(map[string]struct{})
+
+	err := metadataDB.WalkModules(ctx, func(module *yumdb.Module) error {
+		if module.Document == yummeta.ModuleDefaultsDocument {
+			modules[moduleKey(module.Document, module.Name, "", 0, "", "")] = struct{}{}
+		} else {
+			modules[moduleKey(module.Document, module.Name, module.Stream, module.Version, module.Context, module.Arch)] = struct{}{}
+			streams[moduleStreamKey(module.Name, module.Stream)] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+
+	packages := make(map[string]struct{})
+
+	err = repositoryDB.WalkPackages(ctx, func(pkg *yumdb.RepositoryPackage) error {
+		packages[pkg.NVRA()] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return werror.Wrap(gcode.ErrInternal, err)
+	}
+
+	for _, document := range documents {
+		if document.Document != yummeta.ModuleStreamDocument {
+			continue
+		}
+
+		key := moduleKey(document.Document, document.Name, document.Stream, document.Version, document.Context, document.Arch)
+		if _, ok := modules[key]; ok && !replace {
+			return werror.Wrap(gcode.ErrAlreadyExists, fmt.Errorf("module %s:%s:%d:%s:%s already exists", document.Name, document.Stream, document.Version, document.Context, document.Arch))
+		}
+
+		for _, artifact := range document.Artifacts {
+			if _, ok := packages[yummeta.ArtifactNVRA(artifact)]; !ok {
+				return werror.Wrap(gcode.ErrFailedPrecondition, fmt.Errorf("module %s:%s artifact %s not found in repository", document.Name, document.Stream, artifact))
+			}
+		}
+
+		streams[moduleStreamKey(document.Name, document.Stream)] = struct{}{}
+	}
+
+	for _, document := range documents {
+		if document.Document != yummeta.ModuleDefaultsDocument {
+			continue
+		}
+
+		key := moduleKey(document.Document, document.Name, "", 0, "", "")
+		if _, ok := modules[key]; ok && !replace {
+			return werror.Wrap(gcode.ErrAlreadyExists, fmt.Errorf("module %s defaults already exist", document.Name))
+		}
+
+		if document.Stream == "" {
+			continue
+		} else if _, ok := streams[moduleStreamKey(document.Name, document.Stream)]; !ok {
+			return werror.Wrap(gcode.ErrFailedPrecondition, fmt.Errorf("module %s default stream %s not found in repository", document.Name, document.Stream))
+		}
+	}
+
+	return nil
+}
+
+// moduleArtifacts returns the module streams of the repository indexed by the
+// name-version-release.arch of their artifacts.
+func (h *Handler) moduleArtifacts(ctx context.Context) (map[string]string, error) {
+	db, err := h.getMetadataDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(false)
+
+	artifacts := make(map[string]string)
+
+	err = db.WalkModules(ctx, func(module *yumdb.Module) error {
+		if module.Document != yummeta.ModuleStreamDocument {
+			return nil
+		}
+
+		documents, err := yummeta.ParseModules(bytes.NewReader(module.Data))
+		if err != nil {
+			return fmt.Errorf("while parsing module %s:%s: %w", module.Name, module.Stream, err)
+		}
+
+		for _, document := range documents {
+			for _, artifact := range document.Artifacts {
+				artifacts[yummeta.ArtifactNVRA(artifact)] = moduleStreamKey(document.Name, document.Stream)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return artifacts, nil
+}
+
+// modulesMetadata returns the modules metadata generated from the repository
+// module documents, it returns nil if the repository doesn't have modules.
+func modulesMetadata(ctx context.Context, db *yumdb.MetadataDB) (*yumdb.ExtraMetadata, error) {
+	var documents [][]byte
+
+	err := db.WalkModules(ctx, func(module *yumdb.Module) error {
+		documents = append(documents, module.Data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if len(documents) == 0 {
+		return nil, nil
+	}
+
+	modulesYAML := new(bytes.Buffer)
+
+	if err := yummeta.WriteModules(modulesYAML, documents); err != nil {
+		return nil, err
+	}
+
+	data := new(bytes.Buffer)
+
+	gw := gzip.NewWriter(data)
+	if _, err := gw.Write(modulesYAML.Bytes()); err != nil {
+		return nil, err
+	} else if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	checksum := sha256.Sum256(data.Bytes())
+	openChecksum := sha256.Sum256(modulesYAML.Bytes())
+
+	return &yumdb.ExtraMetadata{
+		Type:         string(yummeta.ModulesDataType),
+		Filename:     yummeta.ModulesYAMLFile + ".gz",
+		Checksum:     hex.EncodeToString(checksum[:]),
+		OpenChecksum: hex.EncodeToString(openChecksum[:]),
+		Size:         uint64(data.Len()),
+		OpenSize:     uint64(modulesYAML.Len()),
+		Timestamp:    time.Now().UTC().Unix(),
+		Data:         data.Bytes(),
+	}, nil
+}
@@ -4,12 +4,13 @@
 package yumrepository
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 	_ "unsafe" // for go:linkname
@@ -17,11 +18,12 @@ import (
 	"github.com/cavaliergopher/rpm"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.ciq.dev/beskar/internal/pkg/sqlite"
 	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yumdb"
-	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yummeta"
 	"go.ciq.dev/beskar/pkg/oras"
 	"go.ciq.dev/beskar/pkg/orasrpm"
-	"golang.org/x/crypto/openpgp" //nolint:staticcheck
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
 )
 
 func (h *Handler) processPackageManifest(ctx context.Context, packageManifest *v1.Manifest, manifestDigest string) (errFn error) {
@@ -58,10 +60,31 @@ func (h *Handler) processPackageManifest(ctx context.Context, packageManifest *v
 	}
 	defer os.Remove(packagePath)
 
-	repositoryPackage, err := validatePackage(packageLayer.Digest.Hex, packagePath, h.getKeyring())
+	keyring := h.getKeyring()
+
+	var signature *packet.Signature
+
+	if signingKey := h.getPackageSigningKey(); signingKey != nil && !h.getMirror() {
+		signature, err = rpmSignature(packagePath, openpgp.EntityList{signingKey})
+		if err != nil {
+			return fmt.Errorf("while checking package %s signature: %w", packageName, err)
+		} else if signature == nil {
+			// packages are only re-signed once verified with the repository keyring
+			if _, err := validatePackage(packageLayer.Digest.Hex, packagePath, keyring); err != nil {
+				return fmt.Errorf("while validating package %s before re-signing: %w", packageName, err)
+			}
+			return h.resignPackage(ctx, signingKey, packageName, packagePath, manifestDigest)
+		}
+		keyring = keyringWithSigningKey(keyring, signingKey)
+	}
+
+	repositoryPackage, err := validatePackage(packageLayer.Digest.Hex, packagePath, keyring)
 	if err != nil {
 		return fmt.Errorf("while validating package %s: %w", packageName, err)
 	}
+	if signature != nil {
+		repositoryPackage.GPGSignature = rpmSignatureString(signature)
+	}
 
 	if !h.getMirror() {
 		packageMetadata, err := extractPackageXMLMetadata(packageLayer.Digest.Hex, packagePath)
@@ -73,6 +96,7 @@ func (h *Handler) processPackageManifest(ctx context.Context, packageManifest *v
 		if err != nil {
 			return fmt.Errorf("while adding package %s to metadata database: %w", packageName, err)
 		}
+		h.pendingMetadataChanges().addPackage(packageMetadata.ID)
 	}
 
 	err = h.addPackageToRepositoryDatabase(ctx, repositoryPackage)
@@ -83,7 +107,38 @@ func (h *Handler) processPackageManifest(ctx context.Context, packageManifest *v
 	return nil
 }
 
-func (h *Handler) generateAndPushMetadata(ctx context.Context) (errFn error) {
+// resignPackage pushes the package signed with the signing key under the same
+// tag and deletes the original package manifest, the signed package is then
+// added to the repository when its manifest event is processed.
+func (h *Handler) resignPackage(ctx context.Context, signingKey *openpgp.Entity, packageName, packagePath, manifestDigest string) error {
+	signedPath := packagePath + ".signed"
+	defer os.Remove(signedPath)
+
+	if err := signRPM(signingKey, packagePath, signedPath); err != nil {
+		return fmt.Errorf("while signing package %s: %w", packageName, err)
+	}
+
+	pusher, err := orasrpm.NewRPMPusher(signedPath, h.Repository, h.Params.NameOptions...)
+	if err != nil {
+		return fmt.Errorf("while preparing signed package %s push: %w", packageName, err)
+	} else if err := oras.Push(pusher, h.Params.RemoteOptions...); err != nil {
+		return fmt.Errorf("while pushing signed package %s: %w", packageName, err)
+	}
+
+	ref := filepath.Join(h.Repository, "packages@"+manifestDigest)
+	if err := h.DeleteManifest(ref); err != nil {
+		return fmt.Errorf("while deleting unsigned package %s manifest: %w", packageName, err)
+	}
+
+	h.logDatabase(ctx, yumdb.LogInfo, "package %s re-signed with key ID %016x", packageName, signingKey.PrimaryKey.KeyId)
+
+	return nil
+}
+
+// generateAndPushMetadata pushes the repository metadata updated with the packages
+// added or removed, all metadata are regenerated if packages is nil or if the
+// metadata state doesn't allow an incremental update.
+func (h *Handler) generateAndPushMetadata(ctx context.Context, packages map[string]struct{}) (errFn error) {
 	defer func() {
 		if errFn != nil {
 			h.logger.Error("metadata generation", "error", errFn.Error())
@@ -102,6 +157,54 @@ func (h *Handler) generateAndPushMetadata(ctx context.Context) (errFn error) {
 		return err
 	}
 
+	var extraMetadatas []*yumdb.ExtraMetadata
+
+	modules, err := modulesMetadata(ctx, db)
+	if err != nil {
+		return fmt.Errorf("while generating modules metadata: %w", err)
+	}
+
+	err = db.WalkExtraMetadata(ctx, func(em *yumdb.ExtraMetadata) error {
+		// repository modules take precedence over uploaded modules metadata
+		if modules != nil && em.Type == modules.Type {
+			return nil
+		}
+		extraMetadatas = append(extraMetadatas, em)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if modules != nil {
+		extraMetadatas = append(extraMetadatas, modules)
+	}
+
+	if packages != nil {
+		state, err := loadMetadataState(h.metadataStateDir())
+		if err == nil {
+			err = h.pushMetadata(ctx, db, state, packageCount, packages, extraMetadatas)
+			if err == nil {
+				return nil
+			}
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			h.logger.Warn("incremental metadata update, regenerating all metadata", "error", err.Error())
+		}
+	}
+
+	state, err := newMetadataState(h.metadataStateDir())
+	if err != nil {
+		return fmt.Errorf("while creating metadata state: %w", err)
+	}
+
+	return h.pushMetadata(ctx, db, state, packageCount, nil, extraMetadatas)
+}
+
+// pushMetadata generates and pushes the repository metadata from the metadata state,
+// entries of packages added or removed are replaced by the metadata database ones.
+// If packages is nil, the metadata state is expected to be empty and all packages
+// of the metadata database are added.
+func (h *Handler) pushMetadata(ctx context.Context, db *yumdb.MetadataDB, state *metadataState, packageCount int, packages map[string]struct{}, extraMetadatas []*yumdb.ExtraMetadata) error {
 	repodataDir, err := os.MkdirTemp(h.repoDir, "repodata-")
 	if err != nil {
 		return fmt.Errorf("while creating temporary package directory: %w", err)
@@ -113,38 +216,61 @@ func (h *Handler) generateAndPushMetadata(ctx context.Context) (errFn error) {
 		return err
 	}
 
-	repomd, err := newRepomd(outputDir, filepath.Join(h.Repository, "repodata"), packageCount)
+	repomd, err := newRepomd(ctx, outputDir, filepath.Join(h.Repository, "repodata"), packageCount, state)
 	if err != nil {
 		return err
 	}
+	defer repomd.close()
 
-	err = db.WalkPackageMetadata(ctx, func(pkg *yumdb.PackageMetadata) error {
-		if err := repomd.add(bytes.NewReader(pkg.Primary), yummeta.PrimaryXMLFile); err != nil {
-			return fmt.Errorf("while adding %s: %w", yummeta.PrimaryXMLFile, err)
+	if packages == nil {
+		err = db.WalkPackageMetadata(ctx, func(pkg *yumdb.PackageMetadata) error {
+			return repomd.addPackage(ctx, pkg)
+		})
+		if err != nil {
+			return err
 		}
-		if err := repomd.add(bytes.NewReader(pkg.Filelists), yummeta.FilelistsXMLFile); err != nil {
-			return fmt.Errorf("while adding %s: %w", yummeta.FilelistsXMLFile, err)
+	} else {
+		added := make([]*yumdb.PackageMetadata, 0, len(packages))
+		addedNames := make(map[string]struct{}, len(packages))
+
+		for id := range packages {
+			pkg, err := db.GetPackage(ctx, id)
+			if errors.Is(err, sqlite.ErrNoEntryFound) {
+				// removed package
+				continue
+			} else if err != nil {
+				return err
+			}
+			added = append(added, pkg)
+			addedNames[pkg.Name] = struct{}{}
 		}
-		if err := repomd.add(bytes.NewReader(pkg.Other), yummeta.OtherXMLFile); err != nil {
-			return fmt.Errorf("while adding %s: %w", yummeta.OtherXMLFile, err)
+
+		// an uploaded package replaces the package with the same filename
+		err = repomd.keepPackages(ctx, func(entry *metadataEntry) bool {
+			_, changed := packages[entry.ID]
+			_, replaced := addedNames[entry.Name]
+			return !changed && !replaced
+		})
+		if err != nil {
+			return err
 		}
-		return nil
-	})
-	if err != nil {
-		return err
-	}
 
-	var extraMetadatas []*yumdb.ExtraMetadata
+		sort.Slice(added, func(i, j int) bool {
+			return added[i].Name < added[j].Name
+		})
 
-	err = db.WalkExtraMetadata(ctx, func(em *yumdb.ExtraMetadata) error {
-		extraMetadatas = append(extraMetadatas, em)
-		return nil
-	})
-	if err != nil {
-		return err
+		for _, pkg := range added {
+			if err := repomd.addPackage(ctx, pkg); err != nil {
+				return err
+			}
+		}
 	}
 
-	return repomd.push(h.Params, extraMetadatas)
+	if count := repomd.packageCount(); count != packageCount {
+		return fmt.Errorf("metadata contain %d packages instead of %d", count, packageCount)
+	}
+
+	return repomd.push(ctx, h.Params, extraMetadatas, h.getSigningKey())
 }
 
 func (h *Handler) deletePackageManifest(ctx context.Context, packageManifest *v1.Manifest) (errFn error) {
@@ -169,6 +295,7 @@ func (h *Handler) deletePackageManifest(ctx context.Context, packageManifest *v1
 		if err != nil {
 			return fmt.Errorf("while removing package %s from metadata database: %w", packageName, err)
 		}
+		h.pendingMetadataChanges().addPackage(packageID)
 	}
 
 	err = h.removePackageFromRepositoryDatabase(ctx, packageID)
@@ -179,6 +306,13 @@ func (h *Handler) deletePackageManifest(ctx context.Context, packageManifest *v1
 	return nil
 }
 
+// keyringWithSigningKey returns the repository keyring completed with the signing
+// key, re-signed packages are only signed by the signing key.
+func keyringWithSigningKey(keyring openpgp.KeyRing, signingKey *openpgp.Entity) openpgp.KeyRing {
+	entities, _ := keyring.(openpgp.EntityList)
+	return append(entities[:len(entities):len(entities)], signingKey)
+}
+
 func validatePackage(packageID, packagePath string, keyring openpgp.KeyRing) (*yumdb.RepositoryPackage, error) {
 	r, err := os.Open(packagePath)
 	if err != nil {
@@ -211,6 +345,7 @@ func validatePackage(packageID, packagePath string, keyring openpgp.KeyRing) (*y
 		Size:         pkg.Size(),
 		Architecture: arch,
 		SourceRPM:    pkg.SourceRPM(),
+		Epoch:        pkg.Epoch(),
 		Version:      pkg.Version(),
 		Release:      pkg.Release(),
 		Groups:       strings.Join(pkg.Groups(), ", "),
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"go.ciq.dev/beskar/internal/pkg/repository"
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yumdb"
+)
+
+var _ repository.ReferenceLister = &Handler{}
+
+// References returns the package and metadata tags referenced by the repository databases.
+func (h *Handler) References(ctx context.Context) (*repository.References, error) {
+	// artifacts of the events not processed yet are not referenced by the databases
+	statusDB, err := h.getStatusDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	numEvents, err := statusDB.CountEvents(ctx)
+	if err != nil {
+		return nil, err
+	} else if numEvents > 0 || h.EventQueueLength() > 0 {
+		return nil, repository.ErrPendingEvents
+	}
+
+	references := repository.NewReferences()
+
+	packagesRepository := filepath.Join(h.Repository, "packages")
+	repodataRepository := filepath.Join(h.Repository, "repodata")
+
+	references.AddRepository(packagesRepository)
+	references.AddRepository(repodataRepository)
+
+	repositoryDB, err := h.getRepositoryDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer repositoryDB.Close(false)
+
+	err = repositoryDB.WalkPackages(ctx, func(pkg *yumdb.RepositoryPackage) error {
+		references.AddTag(packagesRepository, pkg.Tag)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while walking repository packages: %w", err)
+	}
+
+	metadataDB, err := h.getMetadataDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer metadataDB.Close(false)
+
+	references.AddTag(repodataRepository, RepomdXMLTag)
+
+	err = metadataDB.WalkExtraMetadata(ctx, func(meta *yumdb.ExtraMetadata) error {
+		references.AddTag(repodataRepository, meta.Type)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while walking extra metadata: %w", err)
+	}
+
+	return references, nil
+}
@@ -4,6 +4,8 @@
 package yumrepository
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/xml"
@@ -12,9 +14,8 @@ import (
 	"hash"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
@@ -25,6 +26,7 @@ import (
 	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yummeta"
 	"go.ciq.dev/beskar/pkg/oras"
 	"go.ciq.dev/beskar/pkg/orasrpm"
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck
 )
 
 const RepomdXMLTag = "repomdxml"
@@ -69,6 +71,10 @@ func newMetaXML(path, header string) (*metaXML, error) {
 	}
 	meta.Writer = io.MultiWriter(gw, meta.openChecksum, meta.getOpenWriter())
 
+	if header == "" {
+		return meta, nil
+	}
+
 	_, err = meta.Write([]byte(header + "\n"))
 	return meta, err
 }
@@ -110,6 +116,29 @@ func (x *metaXML) add(rc io.Reader) error {
 	return err
 }
 
+// repomdData returns the repomd.xml entry of the compressed file.
+func (x *metaXML) repomdData(dataType yummeta.DataType, timestamp int64) *yummeta.RepoMdData {
+	checksumType, checksum := x.Digest()
+
+	return &yummeta.RepoMdData{
+		Type: string(dataType),
+		Checksum: &yummeta.RepoMdDataChecksum{
+			Type:  checksumType,
+			Value: checksum,
+		},
+		Size: x.size,
+		OpenChecksum: &yummeta.RepoMdDataChecksum{
+			Type:  checksumType,
+			Value: hex.EncodeToString(x.openChecksum.Sum(nil)),
+		},
+		OpenSize: x.openSize,
+		Location: &yummeta.RepoMdDataLocation{
+			Href: fmt.Sprintf("repodata/%s-%s", checksum, yummeta.DataFilePrefix(dataType)),
+		},
+		Timestamp: timestamp,
+	}
+}
+
 func (x *metaXML) save(footer string) error {
 	_, err := x.Write([]byte(footer + "\n"))
 	closeErr := x.close()
@@ -197,20 +226,86 @@ func (x *otherXML) Annotations() map[string]string {
 	}
 }
 
+// metaDatabase is a compressed sqlite database.
+type metaDatabase struct {
+	*metaXML
+	dataType yummeta.DataType
+}
+
+// newMetaDatabase compresses the database into the output directory.
+func newMetaDatabase(dbPath, outputDir string, dataType yummeta.DataType) (_ *metaDatabase, errFn error) {
+	db, err := os.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	metaXML, err := newMetaXML(filepath.Join(outputDir, yummeta.DataFilePrefix(dataType)), "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = metaXML.add(db)
+	if closeErr := metaXML.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("while compressing %s: %w", dbPath, err)
+	}
+
+	return &metaDatabase{
+		metaXML:  metaXML,
+		dataType: dataType,
+	}, nil
+}
+
+func (x *metaDatabase) Mediatype() string {
+	return orasrpm.GetRepomdDataLayerType(string(x.dataType))
+}
+
+func (x *metaDatabase) Annotations() map[string]string {
+	_, hex := x.Digest()
+	return map[string]string{
+		imagespec.AnnotationTitle: fmt.Sprintf("%s-%s", hex, yummeta.DataFilePrefix(x.dataType)),
+	}
+}
+
+func (x *metaDatabase) repomdData(timestamp int64) *yummeta.RepoMdData {
+	data := x.metaXML.repomdData(x.dataType, timestamp)
+	data.DatabaseVersion = strconv.Itoa(sqliteDatabaseVersion)
+	return data
+}
+
 type repomd struct {
 	repository    string
 	repomdXMLPath string
 	primaryXML    *primaryXML
 	filelistsXML  *filelistsXML
 	otherXML      *otherXML
+	databases     *sqliteDatabases
+	state         *metadataState
 }
 
-func newRepomd(dir, repository string, packageCount int) (*repomd, error) {
+// newRepomd starts the generation of the repository metadata into dir from the
+// metadata state, the package count must match the number of packages kept and
+// added to the metadata.
+func newRepomd(ctx context.Context, dir, repository string, packageCount int, state *metadataState) (_ *repomd, errFn error) {
 	var err error
 
 	rm := &repomd{
 		repository:    repository,
 		repomdXMLPath: filepath.Join(dir, yummeta.RepomdXMLFile),
+		state:         state,
+	}
+
+	defer func() {
+		if errFn != nil {
+			rm.close()
+		}
+	}()
+
+	if err := state.begin(); err != nil {
+		return nil, fmt.Errorf("while initializing metadata state: %w", err)
 	}
 
 	rm.primaryXML, err = newPrimaryXML(filepath.Join(dir, yummeta.DataFilePrefix(yummeta.PrimaryDataType)), packageCount)
@@ -228,30 +323,64 @@ func newRepomd(dir, repository string, packageCount int) (*repomd, error) {
 		return nil, err
 	}
 
+	rm.databases, err = newSQLiteDatabases(ctx, state.dir)
+	if err != nil {
+		return nil, err
+	}
+
 	return rm, nil
 }
 
-func (r *repomd) add(rc io.Reader, file string) error {
-	switch file {
-	case yummeta.PrimaryXMLFile:
-		if err := r.primaryXML.add(rc); err != nil {
-			return err
-		}
-	case yummeta.FilelistsXMLFile:
-		if err := r.filelistsXML.add(rc); err != nil {
-			return err
-		}
-	case yummeta.OtherXMLFile:
-		if err := r.otherXML.add(rc); err != nil {
-			return err
+// keepPackages adds the packages of the metadata state for which keep returns true
+// to the XML files, the other packages are removed from the sqlite databases.
+func (r *repomd) keepPackages(ctx context.Context, keep func(*metadataEntry) bool) error {
+	writers := [len(metadataStateFiles)]io.Writer{r.primaryXML, r.filelistsXML, r.otherXML}
+
+	return r.state.keep(writers, keep, func(entry *metadataEntry) error {
+		if err := r.databases.remove(ctx, entry.Key); err != nil {
+			return fmt.Errorf("while removing package %s from sqlite databases: %w", entry.Name, err)
 		}
-	default:
-		return fmt.Errorf("unknown file %s", file)
-	}
+		return nil
+	})
+}
 
+// packageCount returns the number of packages kept and added to the metadata.
+func (r *repomd) packageCount() int {
+	return r.state.count()
+}
+
+// addPackage adds the package metadata to the XML files, to the sqlite databases
+// and to the metadata state.
+func (r *repomd) addPackage(ctx context.Context, pkg *yumdb.PackageMetadata) error {
+	if err := r.primaryXML.add(bytes.NewReader(pkg.Primary)); err != nil {
+		return fmt.Errorf("while adding %s: %w", yummeta.PrimaryXMLFile, err)
+	}
+	if err := r.filelistsXML.add(bytes.NewReader(pkg.Filelists)); err != nil {
+		return fmt.Errorf("while adding %s: %w", yummeta.FilelistsXMLFile, err)
+	}
+	if err := r.otherXML.add(bytes.NewReader(pkg.Other)); err != nil {
+		return fmt.Errorf("while adding %s: %w", yummeta.OtherXMLFile, err)
+	}
+	key, err := r.databases.add(ctx, pkg)
+	if err != nil {
+		return fmt.Errorf("while adding package %s to sqlite databases: %w", pkg.Name, err)
+	}
+	data := [len(metadataStateFiles)][]byte{pkg.Primary, pkg.Filelists, pkg.Other}
+	if err := r.state.add(pkg.ID, pkg.Name, key, data); err != nil {
+		return fmt.Errorf("while adding package %s to metadata state: %w", pkg.Name, err)
+	}
 	return nil
 }
 
+// close releases the sqlite databases and discards the metadata
+// state if the metadata were not pushed.
+func (r *repomd) close() {
+	if r.databases != nil {
+		r.databases.close()
+	}
+	_ = r.state.discard()
+}
+
 func (r *repomd) save(repomdRoot *yummeta.RepoMdRoot) error {
 	repomd, err := os.Create(r.repomdXMLPath)
 	if err != nil {
@@ -272,18 +401,8 @@ func (r *repomd) save(repomdRoot *yummeta.RepoMdRoot) error {
 	return repomd.Close()
 }
 
-func (r *repomd) getRoot() (*yummeta.RepoMdRoot, error) {
-	repomd, err := os.Open(r.repomdXMLPath)
-	if err != nil {
-		return nil, err
-	}
-	defer repomd.Close()
-
-	repomdRoot := new(yummeta.RepoMdRoot)
-	return repomdRoot, xml.NewDecoder(repomd).Decode(repomdRoot)
-}
-
-func (r *repomd) push(params *repository.HandlerParams, extraMetadatas []*yumdb.ExtraMetadata) error {
+// push pushes the repository metadata, repomd.xml is signed if a signing key is provided.
+func (r *repomd) push(ctx context.Context, params *repository.HandlerParams, extraMetadatas []*yumdb.ExtraMetadata, signingKey *openpgp.Entity) error {
 	pushRef, err := name.ParseReference(
 		r.repository+":"+RepomdXMLTag,
 		params.NameOptions...,
@@ -302,114 +421,45 @@ func (r *repomd) push(params *repository.HandlerParams, extraMetadatas []*yumdb.
 		return err
 	}
 
-	repomdRoot := new(yummeta.RepoMdRoot)
-	repomdRoot.Xmlns = "http://linux.duke.edu/metadata/repo"
-	repomdRoot.XmlnsRpm = "http://linux.duke.edu/metadata/rpm"
-
-	now := time.Now().UTC().Unix()
-
-	repomdRoot.Data = []*yummeta.RepoMdData{
-		{
-			Type: string(yummeta.PrimaryDataType),
-			Checksum: &yummeta.RepoMdDataChecksum{
-				Type:  "sha256",
-				Value: hex.EncodeToString(r.primaryXML.checkSum.Sum(nil)),
-			},
-			Size: r.primaryXML.size,
-			OpenChecksum: &yummeta.RepoMdDataChecksum{
-				Type:  "sha256",
-				Value: hex.EncodeToString(r.primaryXML.openChecksum.Sum(nil)),
-			},
-			OpenSize: r.primaryXML.openSize,
-			Location: &yummeta.RepoMdDataLocation{
-				Href: filepath.Join("repodata", yummeta.DataFilePrefix(yummeta.PrimaryDataType)),
-			},
-			Timestamp: now,
-		},
-		{
-			Type: string(yummeta.FilelistsDataType),
-			Checksum: &yummeta.RepoMdDataChecksum{
-				Type:  "sha256",
-				Value: hex.EncodeToString(r.filelistsXML.checkSum.Sum(nil)),
-			},
-			Size: r.filelistsXML.size,
-			OpenChecksum: &yummeta.RepoMdDataChecksum{
-				Type:  "sha256",
-				Value: hex.EncodeToString(r.filelistsXML.openChecksum.Sum(nil)),
-			},
-			OpenSize: r.filelistsXML.openSize,
-			Location: &yummeta.RepoMdDataLocation{
-				Href: filepath.Join("repodata", yummeta.DataFilePrefix(yummeta.FilelistsDataType)),
-			},
-			Timestamp: now,
-		},
-		{
-			Type: string(yummeta.OtherDataType),
-			Checksum: &yummeta.RepoMdDataChecksum{
-				Type:  "sha256",
-				Value: hex.EncodeToString(r.otherXML.checkSum.Sum(nil)),
-			},
-			Size: r.otherXML.size,
-			OpenChecksum: &yummeta.RepoMdDataChecksum{
-				Type:  "sha256",
-				Value: hex.EncodeToString(r.otherXML.openChecksum.Sum(nil)),
-			},
-			OpenSize: r.otherXML.openSize,
-			Location: &yummeta.RepoMdDataLocation{
-				Href: filepath.Join("repodata", yummeta.DataFilePrefix(yummeta.OtherDataType)),
-			},
-			Timestamp: now,
-		},
-	}
-
-	if err := r.save(repomdRoot); err != nil {
-		return err
+	err = r.databases.save(
+		ctx,
+		hex.EncodeToString(r.primaryXML.openChecksum.Sum(nil)),
+		hex.EncodeToString(r.filelistsXML.openChecksum.Sum(nil)),
+		hex.EncodeToString(r.otherXML.openChecksum.Sum(nil)),
+	)
+	if err != nil {
+		return fmt.Errorf("while saving sqlite databases: %w", err)
 	}
 
 	repodataDir := filepath.Dir(r.repomdXMLPath)
+	now := time.Now().UTC().Unix()
 
-	if err := generateSQLiteFiles(repodataDir); err != nil {
-		return err
-	}
+	repomdRoot := new(yummeta.RepoMdRoot)
+	repomdRoot.Xmlns = "http://linux.duke.edu/metadata/repo"
+	repomdRoot.Rpm = "http://linux.duke.edu/metadata/rpm"
+	repomdRoot.Revision = strconv.FormatInt(now, 10)
 
-	repomdRoot, err = r.getRoot()
-	if err != nil {
-		return err
+	repomdRoot.Data = []*yummeta.RepoMdData{
+		r.primaryXML.repomdData(yummeta.PrimaryDataType, now),
+		r.filelistsXML.repomdData(yummeta.FilelistsDataType, now),
+		r.otherXML.repomdData(yummeta.OtherDataType, now),
 	}
 
-	metadataLayers := make([]oras.Layer, 0, 3)
+	metadataLayers := make([]oras.Layer, 0, 8+len(extraMetadatas))
 
-	sqliteFiles := map[yummeta.DataType]string{
-		yummeta.PrimaryDatabaseDataType:   yummeta.DataFilePrefix(yummeta.PrimaryDatabaseDataType),
-		yummeta.FilelistsDatabaseDataType: yummeta.DataFilePrefix(yummeta.FilelistsDatabaseDataType),
-		yummeta.OtherDatabaseDataType:     yummeta.DataFilePrefix(yummeta.OtherDatabaseDataType),
+	databaseTypes := []yummeta.DataType{
+		yummeta.PrimaryDatabaseDataType,
+		yummeta.FilelistsDatabaseDataType,
+		yummeta.OtherDatabaseDataType,
 	}
 
-	for dataType, sqliteFile := range sqliteFiles {
-		mediatype := orasrpm.GetRepomdDataLayerType(string(dataType))
-		path := filepath.Join(repodataDir, sqliteFile)
-		annotations := make(map[string]string)
-		layer, err := orasrpm.NewGenericRPMMetadata(path, mediatype, annotations)
-		if err != nil && !errors.Is(err, os.ErrNotExist) {
+	for _, dataType := range databaseTypes {
+		database, err := newMetaDatabase(r.databases.path(dataType), repodataDir, dataType)
+		if err != nil {
 			return err
 		}
-		metadataLayers = append(metadataLayers, orasrpm.NewRPMMetadataLayer(layer))
-
-		for _, data := range repomdRoot.Data {
-			if yummeta.DataType(data.Type) == dataType {
-				_, layerDigest := layer.Digest()
-				data.Location.Href = fmt.Sprintf("repodata/%s-%s", layerDigest, sqliteFile)
-				annotations[imagespec.AnnotationTitle] = filepath.Base(data.Location.Href)
-				break
-			}
-		}
-	}
-
-	for _, data := range repomdRoot.Data {
-		switch yummeta.DataType(data.Type) {
-		case yummeta.FilelistsDataType, yummeta.OtherDataType, yummeta.PrimaryDataType:
-			data.Location.Href = fmt.Sprintf("repodata/%s-%s", data.Checksum.Value, yummeta.DataFilePrefix(yummeta.DataType(data.Type)))
-		}
+		metadataLayers = append(metadataLayers, orasrpm.NewRPMMetadataLayer(database))
+		repomdRoot.Data = append(repomdRoot.Data, database.repomdData(now))
 	}
 
 	for _, extraMetadata := range extraMetadatas {
@@ -460,6 +510,20 @@ func (r *repomd) push(params *repository.HandlerParams, extraMetadatas []*yumdb.
 		return err
 	}
 
+	if signingKey != nil {
+		repomdXMLSignaturePath := filepath.Join(repodataDir, RepomdXMLSignatureFile)
+
+		if err := signFile(signingKey, r.repomdXMLPath, repomdXMLSignaturePath); err != nil {
+			return fmt.Errorf("while signing %s: %w", yummeta.RepomdXMLFile, err)
+		}
+
+		repomdXMLSignature, err := orasrpm.NewGenericRPMMetadata(repomdXMLSignaturePath, orasrpm.RepomdXMLSignatureLayerType, nil)
+		if err != nil {
+			return err
+		}
+		metadataLayers = append(metadataLayers, orasrpm.NewRPMMetadataLayer(repomdXMLSignature))
+	}
+
 	metadataLayers = append(
 		metadataLayers,
 		orasrpm.NewRPMMetadataLayer(repomdXML),
@@ -468,97 +532,47 @@ func (r *repomd) push(params *repository.HandlerParams, extraMetadatas []*yumdb.
 		orasrpm.NewRPMMetadataLayer(r.otherXML),
 	)
 
-	return oras.Push(
+	err = oras.Push(
 		orasrpm.NewRPMMetadataPusher(pushRef, orasrpm.RepomdConfigType, metadataLayers...),
 		params.RemoteOptions...,
 	)
-}
+	if err != nil {
+		return err
+	}
 
-func generateSQLiteFiles(dir string) error {
-	//nolint:gosec // internal use only
-	cmd := exec.Command(
-		"sqliterepo_c",
-		"--compress-type=gz",
-		"--checksum=sha256",
-		filepath.Dir(dir),
-	)
+	if err := r.state.commit(); err != nil {
+		return fmt.Errorf("while saving metadata state: %w", err)
+	}
 
-	return cmd.Run()
+	return nil
 }
 
-func extractPackageXMLMetadata(packageID, packagePath string) (_ *yumdb.PackageMetadata, errFn error) {
-	packageDir, packageName := filepath.Split(packagePath)
-
-	tmpDir, err := os.MkdirTemp(packageDir, "repodata-")
+// extractPackageXMLMetadata returns the primary, filelists and other XML metadata of the package.
+func extractPackageXMLMetadata(packageID, packagePath string) (*yumdb.PackageMetadata, error) {
+	rpmMetadata, err := yummeta.ReadRPMMetadata(packagePath, packageID)
 	if err != nil {
-		return nil, fmt.Errorf("while creating temporary package directory: %w", err)
-	}
-	defer os.RemoveAll(tmpDir)
-
-	//nolint:gosec
-	cmd := exec.Command(
-		"createrepo_c",
-		"--no-database",
-		"--checksum=sha256",
-		"--simple-md-filenames",
-		"--general-compress-type=gz",
-		"--location-prefix="+fmt.Sprintf("Packages/%c", strings.ToLower(packageName)[0]),
-		"-n", packageName,
-		"-o", tmpDir,
-		packageDir,
-	)
-
-	if err := cmd.Run(); err != nil {
 		return nil, err
 	}
 
-	repodataDir := filepath.Join(tmpDir, "repodata")
-
 	packageMetadata := &yumdb.PackageMetadata{
 		ID:   packageID,
-		Name: packageName,
+		Name: filepath.Base(packagePath),
 	}
 
-	primaryXMLInput := filepath.Join(repodataDir, yummeta.DataFilePrefix(yummeta.PrimaryDataType))
-
-	packageMetadata.Primary, err = extractMetadataTo(primaryXMLInput, &yummeta.PrimaryRoot{})
+	packageMetadata.Primary, err = yummeta.MarshalPackage(rpmMetadata.Primary)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("while encoding primary metadata: %w", err)
 	}
 
-	filelistsXMLInput := filepath.Join(repodataDir, yummeta.DataFilePrefix(yummeta.FilelistsDataType))
-
-	packageMetadata.Filelists, err = extractMetadataTo(filelistsXMLInput, &yummeta.FilelistsRoot{})
+	packageMetadata.Filelists, err = yummeta.MarshalPackage(rpmMetadata.Filelists)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("while encoding filelists metadata: %w", err)
 	}
 
-	otherXMLInput := filepath.Join(repodataDir, yummeta.DataFilePrefix(yummeta.OtherDataType))
-
-	packageMetadata.Other, err = extractMetadataTo(otherXMLInput, &yummeta.OtherRoot{})
+	packageMetadata.Other, err = yummeta.MarshalPackage(rpmMetadata.Other)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("while encoding other metadata: %w", err)
 	}
 
 	return packageMetadata, nil
 }
-
-func extractMetadataTo(input string, root yummeta.XMLRoot) (_ []byte, errFn error) {
-	in, err := os.Open(input)
-	if err != nil {
-		return nil, err
-	}
-	defer in.Close()
-
-	gr, err := gzip.NewReader(in)
-	if err != nil {
-		return nil, err
-	}
-	defer gr.Close()
-
-	if err := xml.NewDecoder(gr).Decode(root); err != nil {
-		return nil, err
-	}
-
-	return root.Data(), nil
-}
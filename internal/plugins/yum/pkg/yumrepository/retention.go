@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yumdb"
+)
+
+// retentionInterval is the interval between two retention policy runs.
+const retentionInterval = time.Hour
+
+// applyRetention removes the packages not satisfying the repository retention
+// policy, removals go through the same path as RemoveRepositoryPackage and are
+// recorded in the repository log database.
+func (h *Handler) applyRetention(ctx context.Context) {
+	keepEVRs := h.getRetentionKeepEVRs()
+	if keepEVRs <= 0 || h.getMirror() || h.syncing.Load() || h.delete.Load() {
+		return
+	} else if h.retentionRunning.Swap(true) {
+		return
+	}
+	defer h.retentionRunning.Store(false)
+
+	packages, err := h.repositoryPackages(ctx)
+	if err != nil {
+		h.logger.Error("retention policy", "error", err.Error())
+		return
+	}
+
+	artifacts, err := h.moduleArtifacts(ctx)
+	if err != nil {
+		h.logger.Error("retention policy", "error", err.Error())
+		return
+	}
+
+	for _, pkg := range expiredPackages(packages, keepEVRs) {
+		if h.Stopped.Load() || h.delete.Load() {
+			return
+		}
+
+		rpmName := pkg.RPMName()
+
+		// module stream artifacts are kept until the module is removed
+		if _, ok := artifacts[pkg.NVRA()]; ok {
+			continue
+		}
+
+		if err := h.RemoveRepositoryPackage(ctx, pkg.ID); err != nil {
+			h.logger.Error("retention policy package removal", "package", rpmName, "error", err.Error())
+			h.logDatabase(ctx, yumdb.LogError, "retention policy removal of package %s: %s", rpmName, err)
+			continue
+		}
+
+		h.logger.Info("retention policy package removed", "package", rpmName)
+		h.logDatabase(ctx, yumdb.LogInfo, "retention policy removed package %s (keep %d EVRs)", rpmName, keepEVRs)
+	}
+}
+
+// mirrorRemovedPackages records the packages not found upstream by a successful mirror
+// synchronization, it returns the packages which aren't part of the snapshots kept by
+// the retention policy and reports whether packages were removed upstream since the
+// previous synchronization.
+func (h *Handler) mirrorRemovedPackages(ctx context.Context, removed map[string]struct{}) (map[string]struct{}, bool, error) {
+	db, err := h.getStatusDB(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer db.Close(false)
+
+	ids := make([]string, 0, len(removed))
+	for id := range removed {
+		ids = append(ids, id)
+	}
+
+	missingSnapshots, err := db.UpdateMirrorRemovedPackages(ctx, ids)
+	if err != nil {
+		return nil, false, fmt.Errorf("while recording mirror removed packages: %w", err)
+	} else if err := db.Sync(ctx); err != nil {
+		return nil, false, err
+	}
+
+	upstreamRemoval := false
+	for _, missing := range missingSnapshots {
+		if missing == 1 {
+			upstreamRemoval = true
+			break
+		}
+	}
+
+	keepSnapshots := h.getRetentionKeepSnapshots()
+	expired := expiredMirrorPackages(missingSnapshots, keepSnapshots)
+
+	if keepSnapshots > 1 && len(expired) > 0 {
+		h.logDatabase(ctx, yumdb.LogInfo, "retention policy removes %d packages not found upstream (keep %d snapshots)", len(expired), keepSnapshots)
+	}
+
+	return expired, upstreamRemoval, nil
+}
+
+// expiredMirrorPackages returns the packages missing from the keepSnapshots most
+// recent mirror snapshots based on the number of consecutive snapshots they are
+// missing from. The most recent snapshot is always kept.
+func expiredMirrorPackages(missingSnapshots map[string]int, keepSnapshots int) map[string]struct{} {
+	expired := make(map[string]struct{})
+
+	for id, missing := range missingSnapshots {
+		if missing >= keepSnapshots {
+			expired[id] = struct{}{}
+		}
+	}
+
+	return expired
+}
+
+func (h *Handler) repositoryPackages(ctx context.Context) ([]*yumdb.RepositoryPackage, error) {
+	db, err := h.getRepositoryDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close(false)
+
+	var packages []*yumdb.RepositoryPackage
+
+	err = db.WalkPackages(ctx, func(pkg *yumdb.RepositoryPackage) error {
+		packages = append(packages, pkg)
+		return nil
+	})
+
+	return packages, err
+}
+
+// expiredPackages returns the packages beyond the keepEVRs most recent EVRs
+// for each package name and architecture.
+func expiredPackages(packages []*yumdb.RepositoryPackage, keepEVRs int) []*yumdb.RepositoryPackage {
+	groups := make(map[string][]*yumdb.RepositoryPackage)
+
+	for _, pkg := range packages {
+		arch := pkg.Architecture
+		if pkg.SourceRPM == "" {
+			arch = "src"
+		}
+		key := pkg.Name + "." + arch
+		groups[key] = append(groups[key], pkg)
+	}
+
+	var expired []*yumdb.RepositoryPackage
+
+	for _, group := range groups {
+		// most recent first
+		sort.SliceStable(group, func(i, j int) bool {
+			return compareEVR(group[i], group[j]) > 0
+		})
+
+		evrs := 0
+
+		for i, pkg := range group {
+			if i == 0 || compareEVR(group[i-1], pkg) != 0 {
+				evrs++
+			}
+			if evrs > keepEVRs {
+				expired = append(expired, pkg)
+			}
+		}
+	}
+
+	return expired
+}
+
+func compareEVR(a, b *yumdb.RepositoryPackage) int {
+	if a.Epoch != b.Epoch {
+		if a.Epoch > b.Epoch {
+			return 1
+		}
+		return -1
+	}
+	if c := rpm.CompareVersions(a.Version, b.Version); c != 0 {
+		return c
+	}
+	return rpm.CompareVersions(a.Release, b.Release)
+}
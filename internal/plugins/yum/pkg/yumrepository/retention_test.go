@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yumdb"
+)
+
+func TestExpiredPackages(t *testing.T) {
+	newPackage := func(id, name, arch, version, release string) *yumdb.RepositoryPackage {
+		return &yumdb.RepositoryPackage{
+			ID:           id,
+			Name:         name,
+			Architecture: arch,
+			SourceRPM:    name + "-" + version + "-" + release + ".src.rpm",
+			Version:      version,
+			Release:      release,
+		}
+	}
+
+	packages := []*yumdb.RepositoryPackage{
+		newPackage("1", "foo", "x86_64", "1.2", "1.el9"),
+		newPackage("2", "foo", "x86_64", "1.10", "1.el9"),
+		newPackage("3", "foo", "x86_64", "1.10", "2.el9"),
+		newPackage("4", "foo", "x86_64", "1.9", "1.el9"),
+		newPackage("5", "foo", "aarch64", "1.2", "1.el9"),
+		newPackage("6", "bar", "x86_64", "2.0", "1.el9"),
+		newPackage("7", "bar", "x86_64", "1.0", "1.el9"),
+	}
+
+	ids := func(packages []*yumdb.RepositoryPackage) []string {
+		ids := make([]string, 0, len(packages))
+		for _, pkg := range packages {
+			ids = append(ids, pkg.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	require.Equal(t, []string{"1", "2", "4", "7"}, ids(expiredPackages(packages, 1)))
+	require.Equal(t, []string{"1", "4"}, ids(expiredPackages(packages, 2)))
+	require.Empty(t, expiredPackages(packages, 4))
+
+	// the epoch takes precedence over version and release
+	epochPackage := newPackage("8", "bar", "x86_64", "0.1", "1.el9")
+	epochPackage.Epoch = 1
+	packages = append(packages, epochPackage)
+
+	require.Equal(t, []string{"1", "2", "4", "6", "7"}, ids(expiredPackages(packages, 1)))
+	require.Equal(t, []string{"1", "4", "7"}, ids(expiredPackages(packages, 2)))
+}
+
+func TestExpiredMirrorPackages(t *testing.T) {
+	missingSnapshots := map[string]int{
+		"1": 1,
+		"2": 2,
+		"3": 3,
+	}
+
+	ids := func(packages map[string]struct{}) []string {
+		ids := make([]string, 0, len(packages))
+		for id := range packages {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	require.Equal(t, []string{"1", "2", "3"}, ids(expiredMirrorPackages(missingSnapshots, 0)))
+	require.Equal(t, []string{"1", "2", "3"}, ids(expiredMirrorPackages(missingSnapshots, 1)))
+	require.Equal(t, []string{"3"}, ids(expiredMirrorPackages(missingSnapshots, 3)))
+	require.Empty(t, ids(expiredMirrorPackages(missingSnapshots, 4)))
+}
@@ -0,0 +1,459 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
+)
+
+const (
+	rpmLeadSize        = 96
+	rpmHeaderIntroSize = 16
+	rpmIndexEntrySize  = 16
+)
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01, 0x00, 0x00, 0x00, 0x00}
+)
+
+// RPM header data types.
+const (
+	rpmTypeNull        = 0
+	rpmTypeChar        = 1
+	rpmTypeInt8        = 2
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeInt64       = 5
+	rpmTypeString      = 6
+	rpmTypeBin         = 7
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// RPM signature header tags.
+const (
+	rpmSigTagHeaderSignatures = 62
+	rpmSigTagDSA              = 267
+	rpmSigTagRSA              = 268
+	rpmSigTagSHA1             = 269
+	rpmSigTagSHA256           = 273
+	rpmSigTagPGP              = 1002
+	rpmSigTagGPG              = 1005
+	rpmSigTagPGP5             = 1006
+	rpmSigTagReservedSpace    = 1008
+)
+
+// rpmHeaderEntry is an entry of a RPM header with its raw data.
+type rpmHeaderEntry struct {
+	tag   uint32
+	typ   uint32
+	count uint32
+	data  []byte
+}
+
+// rpmFile is a RPM package split into its lead, signature header and the
+// remaining header and payload which are covered by the signatures.
+type rpmFile struct {
+	f         *os.File
+	lead      []byte
+	signature []rpmHeaderEntry
+	header    []byte
+	// offset of the header
+	offset int64
+	size   int64
+}
+
+func openRPMFile(path string) (_ *rpmFile, errFn error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if errFn != nil {
+			_ = f.Close()
+		}
+	}()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	rf := &rpmFile{
+		f:    f,
+		lead: make([]byte, rpmLeadSize),
+		size: fi.Size(),
+	}
+
+	if _, err := io.ReadFull(f, rf.lead); err != nil {
+		return nil, fmt.Errorf("while reading RPM lead: %w", err)
+	} else if !bytes.Equal(rf.lead[:4], rpmLeadMagic) {
+		return nil, errors.New("not a RPM package")
+	}
+
+	signature, err := readRPMHeader(f)
+	if err != nil {
+		return nil, fmt.Errorf("while reading RPM signature header: %w", err)
+	}
+	rf.signature, err = parseRPMHeader(signature)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing RPM signature header: %w", err)
+	}
+
+	// the signature header is padded to a multiple of 8 bytes
+	rf.offset = int64(rpmLeadSize + len(signature) + (8-len(signature)%8)%8)
+	if _, err := f.Seek(rf.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	rf.header, err = readRPMHeader(f)
+	if err != nil {
+		return nil, fmt.Errorf("while reading RPM header: %w", err)
+	}
+
+	return rf, nil
+}
+
+func (rf *rpmFile) close() error {
+	return rf.f.Close()
+}
+
+// signed returns a reader of the header and payload.
+func (rf *rpmFile) signed() io.Reader {
+	return io.NewSectionReader(rf.f, rf.offset, rf.size-rf.offset)
+}
+
+// payload returns a reader of the payload.
+func (rf *rpmFile) payload() io.Reader {
+	offset := rf.offset + int64(len(rf.header))
+	return io.NewSectionReader(rf.f, offset, rf.size-offset)
+}
+
+func (rf *rpmFile) signatureTag(tag uint32) []byte {
+	for _, entry := range rf.signature {
+		if entry.tag == tag {
+			return entry.data
+		}
+	}
+	return nil
+}
+
+// readRPMHeader returns the raw header structure starting at the current reader position.
+func readRPMHeader(r io.Reader) ([]byte, error) {
+	intro := make([]byte, rpmHeaderIntroSize)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return nil, err
+	} else if !bytes.Equal(intro[:8], rpmHeaderMagic) {
+		return nil, errors.New("bad header magic")
+	}
+
+	indexCount := binary.BigEndian.Uint32(intro[8:12])
+	dataSize := binary.BigEndian.Uint32(intro[12:16])
+
+	// same limits than rpm
+	if indexCount > 0xffff || dataSize > 256<<20 {
+		return nil, errors.New("header too large")
+	}
+
+	header := make([]byte, rpmHeaderIntroSize+int(indexCount)*rpmIndexEntrySize+int(dataSize))
+	copy(header, intro)
+
+	if _, err := io.ReadFull(r, header[rpmHeaderIntroSize:]); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// parseRPMHeader returns the header entries without the region entry.
+func parseRPMHeader(header []byte) ([]rpmHeaderEntry, error) {
+	indexCount := int(binary.BigEndian.Uint32(header[8:12]))
+	data := header[rpmHeaderIntroSize+indexCount*rpmIndexEntrySize:]
+
+	entries := make([]rpmHeaderEntry, 0, indexCount)
+
+	for i := 0; i < indexCount; i++ {
+		index := header[rpmHeaderIntroSize+i*rpmIndexEntrySize:]
+
+		entry := rpmHeaderEntry{
+			tag:   binary.BigEndian.Uint32(index[0:4]),
+			typ:   binary.BigEndian.Uint32(index[4:8]),
+			count: binary.BigEndian.Uint32(index[12:16]),
+		}
+		offset := int(binary.BigEndian.Uint32(index[8:12]))
+
+		if entry.tag == rpmSigTagHeaderSignatures {
+			continue
+		} else if offset > len(data) {
+			return nil, fmt.Errorf("tag %d: data offset out of range", entry.tag)
+		}
+
+		size, err := rpmEntrySize(entry.typ, entry.count, data[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("tag %d: %w", entry.tag, err)
+		}
+		entry.data = data[offset : offset+size]
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// rpmEntrySize returns the data size of a header entry.
+func rpmEntrySize(typ, count uint32, data []byte) (int, error) {
+	var size int
+
+	switch typ {
+	case rpmTypeNull:
+	case rpmTypeChar, rpmTypeInt8, rpmTypeBin:
+		size = int(count)
+	case rpmTypeInt16:
+		size = int(count) * 2
+	case rpmTypeInt32:
+		size = int(count) * 4
+	case rpmTypeInt64:
+		size = int(count) * 8
+	case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+		for i := uint32(0); i < count; i++ {
+			end := bytes.IndexByte(data[size:], 0)
+			if end < 0 {
+				return 0, errors.New("unterminated string")
+			}
+			size += end + 1
+		}
+	default:
+		return 0, fmt.Errorf("unknown data type %d", typ)
+	}
+
+	if size > len(data) {
+		return 0, errors.New("data out of range")
+	}
+
+	return size, nil
+}
+
+// rpmEntryAlignment returns the data alignment of a header entry type.
+func rpmEntryAlignment(typ uint32) int {
+	switch typ {
+	case rpmTypeInt16:
+		return 2
+	case rpmTypeInt32:
+		return 4
+	case rpmTypeInt64:
+		return 8
+	default:
+		return 1
+	}
+}
+
+// marshalRPMHeader returns the raw header structure of the entries sorted by
+// tag and preceded by the region entry.
+func marshalRPMHeader(regionTag uint32, entries []rpmHeaderEntry) []byte {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].tag < entries[j].tag
+	})
+
+	indexCount := len(entries) + 1
+
+	index := new(bytes.Buffer)
+	data := new(bytes.Buffer)
+
+	writeIndex := func(w io.Writer, tag, typ uint32, offset int32, count uint32) {
+		_ = binary.Write(w, binary.BigEndian, []uint32{tag, typ, uint32(offset), count})
+	}
+
+	for _, entry := range entries {
+		if pad := data.Len() % rpmEntryAlignment(entry.typ); pad > 0 {
+			data.Write(make([]byte, rpmEntryAlignment(entry.typ)-pad))
+		}
+		writeIndex(index, entry.tag, entry.typ, int32(data.Len()), entry.count)
+		data.Write(entry.data)
+	}
+
+	// the region trailer at the end of the data references all index entries
+	regionOffset := data.Len()
+	writeIndex(data, regionTag, rpmTypeBin, -int32(indexCount*rpmIndexEntrySize), rpmIndexEntrySize)
+
+	header := new(bytes.Buffer)
+	header.Write(rpmHeaderMagic)
+	_ = binary.Write(header, binary.BigEndian, []uint32{uint32(indexCount), uint32(data.Len())})
+	writeIndex(header, regionTag, rpmTypeBin, int32(regionOffset), rpmIndexEntrySize)
+	header.Write(index.Bytes())
+	header.Write(data.Bytes())
+
+	return header.Bytes()
+}
+
+// signRPM writes to signedPath the RPM package with its signatures replaced by
+// a header signature and a header and payload signature made with the signing key.
+func signRPM(signingKey *openpgp.Entity, packagePath, signedPath string) error {
+	if signingKey.PrivateKey == nil {
+		return errors.New("signing key has no private key")
+	}
+
+	var headerTag, headerPayloadTag uint32
+
+	switch signingKey.PrivateKey.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+		headerTag, headerPayloadTag = rpmSigTagRSA, rpmSigTagPGP
+	case packet.PubKeyAlgoDSA, packet.PubKeyAlgoECDSA:
+		headerTag, headerPayloadTag = rpmSigTagDSA, rpmSigTagGPG
+	default:
+		return fmt.Errorf("unsupported signing key algorithm %d", signingKey.PrivateKey.PubKeyAlgo)
+	}
+
+	rf, err := openRPMFile(packagePath)
+	if err != nil {
+		return err
+	}
+	defer rf.close()
+
+	headerSignature := new(bytes.Buffer)
+	if err := openpgp.DetachSign(headerSignature, signingKey, bytes.NewReader(rf.header), nil); err != nil {
+		return fmt.Errorf("while signing RPM header: %w", err)
+	}
+
+	headerPayloadSignature := new(bytes.Buffer)
+	if err := openpgp.DetachSign(headerPayloadSignature, signingKey, rf.signed(), nil); err != nil {
+		return fmt.Errorf("while signing RPM header and payload: %w", err)
+	}
+
+	entries := make([]rpmHeaderEntry, 0, len(rf.signature)+4)
+	hasSHA1, hasSHA256 := false, false
+
+	for _, entry := range rf.signature {
+		switch entry.tag {
+		case rpmSigTagDSA, rpmSigTagRSA, rpmSigTagPGP, rpmSigTagGPG, rpmSigTagPGP5, rpmSigTagReservedSpace:
+			// previous signatures are discarded
+			continue
+		case rpmSigTagSHA1:
+			hasSHA1 = true
+		case rpmSigTagSHA256:
+			hasSHA256 = true
+		}
+		entries = append(entries, entry)
+	}
+
+	if !hasSHA1 {
+		digest := sha1.Sum(rf.header) //nolint:gosec
+		entries = append(entries, rpmStringEntry(rpmSigTagSHA1, hex.EncodeToString(digest[:])))
+	}
+	if !hasSHA256 {
+		digest := sha256.Sum256(rf.header)
+		entries = append(entries, rpmStringEntry(rpmSigTagSHA256, hex.EncodeToString(digest[:])))
+	}
+
+	entries = append(
+		entries,
+		rpmHeaderEntry{tag: headerTag, typ: rpmTypeBin, count: uint32(headerSignature.Len()), data: headerSignature.Bytes()},
+		rpmHeaderEntry{tag: headerPayloadTag, typ: rpmTypeBin, count: uint32(headerPayloadSignature.Len()), data: headerPayloadSignature.Bytes()},
+	)
+
+	signature := marshalRPMHeader(rpmSigTagHeaderSignatures, entries)
+
+	signed, err := os.Create(signedPath)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range [][]byte{rf.lead, signature, make([]byte, (8-len(signature)%8)%8), rf.header} {
+		if _, err := signed.Write(b); err != nil {
+			_ = signed.Close()
+			return err
+		}
+	}
+	if _, err := io.Copy(signed, rf.payload()); err != nil {
+		_ = signed.Close()
+		return err
+	}
+
+	return signed.Close()
+}
+
+func rpmStringEntry(tag uint32, s string) rpmHeaderEntry {
+	return rpmHeaderEntry{tag: tag, typ: rpmTypeString, count: 1, data: append([]byte(s), 0)}
+}
+
+// rpmSignature returns the header and payload signature of the RPM package if it was
+// made by a key of the keyring, it returns nil if the package isn't signed or if the
+// signature doesn't verify with the keyring.
+func rpmSignature(packagePath string, keyring openpgp.KeyRing) (*packet.Signature, error) {
+	rf, err := openRPMFile(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rf.close()
+
+	signature := rf.signatureTag(rpmSigTagPGP)
+	if signature == nil {
+		signature = rf.signatureTag(rpmSigTagGPG)
+	}
+	if signature == nil {
+		return nil, nil
+	}
+
+	if _, err := openpgp.CheckDetachedSignature(keyring, rf.signed(), bytes.NewReader(signature)); err != nil {
+		return nil, nil //nolint:nilerr
+	}
+
+	p, err := packet.Read(bytes.NewReader(signature))
+	if err != nil {
+		return nil, err
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		return nil, nil
+	}
+
+	return sig, nil
+}
+
+// rpmSignatureString returns the signature description as displayed by rpm.
+func rpmSignatureString(sig *packet.Signature) string {
+	algo := "unknown"
+	switch sig.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+		algo = "RSA"
+	case packet.PubKeyAlgoDSA:
+		algo = "DSA"
+	case packet.PubKeyAlgoECDSA:
+		algo = "ECDSA"
+	}
+
+	hash := "unknown"
+	switch sig.Hash {
+	case crypto.SHA1:
+		hash = "SHA1"
+	case crypto.SHA224:
+		hash = "SHA224"
+	case crypto.SHA256:
+		hash = "SHA256"
+	case crypto.SHA384:
+		hash = "SHA384"
+	case crypto.SHA512:
+		hash = "SHA512"
+	}
+
+	var keyID uint64
+	if sig.IssuerKeyId != nil {
+		keyID = *sig.IssuerKeyId
+	}
+
+	return fmt.Sprintf("%s/%s, %s, Key ID %016x", algo, hash, sig.CreationTime.UTC().Format("Mon Jan _2 15:04:05 2006"), keyID)
+}
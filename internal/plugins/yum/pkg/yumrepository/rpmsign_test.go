@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cavaliergopher/rpm"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck
+)
+
+func TestSignRPM(t *testing.T) {
+	dir := t.TempDir()
+
+	payload := bytes.Repeat([]byte("payload"), 1024)
+
+	header := marshalRPMHeader(63, []rpmHeaderEntry{
+		rpmStringEntry(1000, "bash"),
+		rpmStringEntry(1001, "5.1.8"),
+		{tag: 1009, typ: rpmTypeInt32, count: 1, data: []byte{0, 0, 4, 0}},
+	})
+
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(header)+len(payload)))
+
+	signature := marshalRPMHeader(rpmSigTagHeaderSignatures, []rpmHeaderEntry{
+		{tag: 1000, typ: rpmTypeInt32, count: 1, data: size},
+		{tag: rpmSigTagPGP, typ: rpmTypeBin, count: 3, data: []byte{1, 2, 3}},
+	})
+
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+
+	unsigned := new(bytes.Buffer)
+	unsigned.Write(lead)
+	unsigned.Write(signature)
+	unsigned.Write(make([]byte, (8-len(signature)%8)%8))
+	unsigned.Write(header)
+	unsigned.Write(payload)
+
+	packagePath := filepath.Join(dir, "bash.rpm")
+	require.NoError(t, os.WriteFile(packagePath, unsigned.Bytes(), 0o600))
+
+	signingKey, err := openpgp.NewEntity("beskar", "", "beskar@example.com", nil)
+	require.NoError(t, err)
+	keyring := openpgp.EntityList{signingKey}
+
+	sig, err := rpmSignature(packagePath, keyring)
+	require.NoError(t, err)
+	require.Nil(t, sig)
+
+	signedPath := filepath.Join(dir, "bash.signed.rpm")
+	require.NoError(t, signRPM(signingKey, packagePath, signedPath))
+
+	sig, err = rpmSignature(signedPath, keyring)
+	require.NoError(t, err)
+	require.NotNil(t, sig)
+	require.Equal(t, signingKey.PrimaryKey.KeyId, *sig.IssuerKeyId)
+	require.Contains(t, rpmSignatureString(sig), "RSA/SHA256")
+
+	rf, err := openRPMFile(signedPath)
+	require.NoError(t, err)
+	defer rf.close()
+
+	require.Equal(t, 0, int(rf.offset%8))
+	require.Equal(t, header, rf.header)
+	require.Equal(t, size, rf.signatureTag(1000))
+	require.NotNil(t, rf.signatureTag(rpmSigTagSHA1))
+	require.NotNil(t, rf.signatureTag(rpmSigTagSHA256))
+
+	_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(header), bytes.NewReader(rf.signatureTag(rpmSigTagRSA)))
+	require.NoError(t, err)
+
+	signedPayload, err := io.ReadAll(rf.payload())
+	require.NoError(t, err)
+	require.Equal(t, payload, signedPayload)
+
+	otherKey, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	require.NoError(t, err)
+
+	sig, err = rpmSignature(signedPath, openpgp.EntityList{otherKey})
+	require.NoError(t, err)
+	require.Nil(t, sig)
+}
+
+func TestSignRealRPM(t *testing.T) {
+	packagePath := filepath.Join(
+		"..", "..", "..", "..", "..", "integration", "testdata", "vault-rocky-8.3-ha-debug",
+		"Packages", "clufter-debugsource-0.77.1-5.el8.x86_64.rpm",
+	)
+
+	signingKey, err := openpgp.NewEntity("beskar", "", "beskar@example.com", nil)
+	require.NoError(t, err)
+	otherKey, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	require.NoError(t, err)
+
+	sig, err := rpmSignature(packagePath, openpgp.EntityList{signingKey})
+	require.NoError(t, err)
+	require.Nil(t, sig)
+
+	signedPath := filepath.Join(t.TempDir(), "clufter-debugsource.rpm")
+	require.NoError(t, signRPM(signingKey, packagePath, signedPath))
+
+	original, err := rpm.Open(packagePath)
+	require.NoError(t, err)
+
+	f, err := os.Open(signedPath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	signer, err := rpm.GPGCheck(f, openpgp.EntityList{signingKey})
+	require.NoError(t, err)
+	require.Equal(t, signingKey.PrimaryKey.KeyId, signer.PrimaryKey.KeyId)
+
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	signed, err := rpm.Read(f)
+	require.NoError(t, err)
+	require.Equal(t, original.Name(), signed.Name())
+	require.Equal(t, original.Version(), signed.Version())
+	require.Equal(t, original.Release(), signed.Release())
+	require.Equal(t, original.Architecture(), signed.Architecture())
+
+	// the re-signed package doesn't verify with a repository keyring
+	// without the signing key
+	keyring := openpgp.EntityList{otherKey}
+
+	_, err = validatePackage("id", signedPath, keyring)
+	require.Error(t, err)
+
+	pkg, err := validatePackage("id", signedPath, keyringWithSigningKey(keyring, signingKey))
+	require.NoError(t, err)
+	require.True(t, pkg.Verified)
+	require.Equal(t, "clufter-debugsource", pkg.Name)
+	require.Len(t, keyring, 1)
+
+	pkg, err = validatePackage("id", signedPath, keyringWithSigningKey(nil, signingKey))
+	require.NoError(t, err)
+	require.True(t, pkg.Verified)
+}
@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/armor"  //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
+)
+
+const RepomdXMLSignatureFile = "repomd.xml.asc"
+
+// ReadSigningKey returns the GPG entity of an armored private key used to sign the
+// repository metadata, encrypted private keys are decrypted with the passphrase.
+func ReadSigningKey(key []byte, passphrase string) (*openpgp.Entity, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("while reading signing key: %w", err)
+	}
+
+	for _, entity := range entities {
+		if entity.PrivateKey == nil {
+			continue
+		}
+
+		privateKeys := []*packet.PrivateKey{entity.PrivateKey}
+		for _, subkey := range entity.Subkeys {
+			if subkey.PrivateKey != nil {
+				privateKeys = append(privateKeys, subkey.PrivateKey)
+			}
+		}
+
+		for _, privateKey := range privateKeys {
+			if !privateKey.Encrypted {
+				continue
+			} else if passphrase == "" {
+				return nil, errors.New("signing key is encrypted and no passphrase was provided")
+			} else if err := privateKey.Decrypt([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("while decrypting signing key: %w", err)
+			}
+		}
+
+		return entity, nil
+	}
+
+	return nil, errors.New("no private key found in signing key")
+}
+
+// ReadSigningKeyFile is like ReadSigningKey with the armored private key read from a file.
+func ReadSigningKeyFile(path string, passphrase string) (*openpgp.Entity, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ReadSigningKey(key, passphrase)
+}
+
+// storedSigningKey is a repository signing key stored in the repository status database.
+type storedSigningKey struct {
+	Key        []byte `json:"key"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// encryptSigningKey returns the armored private key and its passphrase encrypted
+// with the plugin secret, the repository status database is synced to the bucket
+// and must not contain the private key in clear.
+func encryptSigningKey(key []byte, passphrase string, secret []byte) ([]byte, error) {
+	data, err := json.Marshal(&storedSigningKey{
+		Key:        key,
+		Passphrase: passphrase,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+
+	w, err := openpgp.SymmetricallyEncrypt(buf, secret, nil, nil)
+	if err != nil {
+		return nil, err
+	} else if _, err := w.Write(data); err != nil {
+		return nil, err
+	} else if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decryptSigningKey returns the armored private key and its passphrase encrypted
+// by encryptSigningKey.
+func decryptSigningKey(encrypted []byte, secret []byte) ([]byte, string, error) {
+	prompted := false
+
+	md, err := openpgp.ReadMessage(bytes.NewReader(encrypted), nil, func([]openpgp.Key, bool) ([]byte, error) {
+		// the prompt is called again if the secret is wrong
+		if prompted {
+			return nil, errors.New("wrong signing key secret")
+		}
+		prompted = true
+		return secret, nil
+	}, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("while decrypting signing key: %w", err)
+	}
+
+	data, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, "", fmt.Errorf("while decrypting signing key: %w", err)
+	}
+
+	signingKey := new(storedSigningKey)
+	if err := json.Unmarshal(data, signingKey); err != nil {
+		return nil, "", fmt.Errorf("while decoding signing key: %w", err)
+	}
+
+	return signingKey.Key, signingKey.Passphrase, nil
+}
+
+// isArmoredKey returns true for signing keys stored in clear by previous versions.
+func isArmoredKey(key []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN PGP"))
+}
+
+// signingPublicKey returns the armored public key of the signing key.
+func signingPublicKey(signingKey *openpgp.Entity) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := signingKey.Serialize(w); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// signFile writes the armored detached signature of the file to signaturePath.
+func signFile(signingKey *openpgp.Entity, path, signaturePath string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	signature, err := os.Create(signaturePath)
+	if err != nil {
+		return err
+	}
+
+	if err := openpgp.ArmoredDetachSign(signature, signingKey, f, nil); err != nil {
+		_ = signature.Close()
+		return err
+	}
+
+	return signature.Close()
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"       //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/armor" //nolint:staticcheck
+)
+
+func TestSignFile(t *testing.T) {
+	entity, err := openpgp.NewEntity("beskar", "", "beskar@example.com", nil)
+	require.NoError(t, err)
+
+	privateKey := new(bytes.Buffer)
+	w, err := armor.Encode(privateKey, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivate(w, nil))
+	require.NoError(t, w.Close())
+
+	signingKey, err := ReadSigningKey(privateKey.Bytes(), "")
+	require.NoError(t, err)
+
+	publicKey, err := signingPublicKey(signingKey)
+	require.NoError(t, err)
+
+	_, err = ReadSigningKey(publicKey, "")
+	require.Error(t, err)
+
+	dir := t.TempDir()
+	repomdXMLPath := filepath.Join(dir, "repomd.xml")
+	signaturePath := filepath.Join(dir, RepomdXMLSignatureFile)
+
+	require.NoError(t, os.WriteFile(repomdXMLPath, []byte("<repomd></repomd>\n"), 0o600))
+	require.NoError(t, signFile(signingKey, repomdXMLPath, signaturePath))
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKey))
+	require.NoError(t, err)
+
+	signature, err := os.ReadFile(signaturePath)
+	require.NoError(t, err)
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader([]byte("<repomd></repomd>\n")), bytes.NewReader(signature))
+	require.NoError(t, err)
+	require.Equal(t, entity.PrimaryKey.KeyId, signer.PrimaryKey.KeyId)
+
+	_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader([]byte("<repomd/>\n")), bytes.NewReader(signature))
+	require.Error(t, err)
+}
+
+func TestEncryptSigningKey(t *testing.T) {
+	entity, err := openpgp.NewEntity("beskar", "", "beskar@example.com", nil)
+	require.NoError(t, err)
+
+	privateKey := new(bytes.Buffer)
+	w, err := armor.Encode(privateKey, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivate(w, nil))
+	require.NoError(t, w.Close())
+
+	require.True(t, isArmoredKey(privateKey.Bytes()))
+
+	encrypted, err := encryptSigningKey(privateKey.Bytes(), "passphrase", []byte("secret"))
+	require.NoError(t, err)
+	require.False(t, isArmoredKey(encrypted))
+	require.NotContains(t, string(encrypted), "PRIVATE KEY")
+
+	key, passphrase, err := decryptSigningKey(encrypted, []byte("secret"))
+	require.NoError(t, err)
+	require.Equal(t, privateKey.Bytes(), key)
+	require.Equal(t, "passphrase", passphrase)
+
+	_, _, err = decryptSigningKey(encrypted, []byte("wrong"))
+	require.Error(t, err)
+}
@@ -0,0 +1,425 @@
+// SPDX-FileCopyrightText: Copyright (c) 2023-2024, CIQ, Inc. All rights reserved
+// SPDX-License-Identifier: Apache-2.0
+
+package yumrepository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yumdb"
+	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yummeta"
+
+	// load sqlite driver
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDatabaseVersion is the version of the yum sqlite databases
+// schema as generated by createrepo_c and sqliterepo_c.
+const sqliteDatabaseVersion = 10
+
+var primaryDatabaseSchema = []string{
+	`CREATE TABLE db_info (dbversion INTEGER, checksum TEXT)`,
+	`CREATE TABLE packages (pkgKey INTEGER PRIMARY KEY, pkgId TEXT, name TEXT, arch TEXT, version TEXT, epoch TEXT, release TEXT, summary TEXT, description TEXT, url TEXT, time_file INTEGER, time_build INTEGER, rpm_license TEXT, rpm_vendor TEXT, rpm_group TEXT, rpm_buildhost TEXT, rpm_sourcerpm TEXT, rpm_header_start INTEGER, rpm_header_end INTEGER, rpm_packager TEXT, size_package INTEGER, size_installed INTEGER, size_archive INTEGER, location_href TEXT, location_base TEXT, checksum_type TEXT)`,
+	`CREATE TABLE files (name TEXT, type TEXT, pkgKey INTEGER)`,
+	`CREATE TABLE requires (name TEXT, flags TEXT, epoch TEXT, version TEXT, release TEXT, pkgKey INTEGER, pre BOOLEAN DEFAULT FALSE)`,
+	`CREATE TABLE provides (name TEXT, flags TEXT, epoch TEXT, version TEXT, release TEXT, pkgKey INTEGER)`,
+	`CREATE TABLE conflicts (name TEXT, flags TEXT, epoch TEXT, version TEXT, release TEXT, pkgKey INTEGER)`,
+	`CREATE TABLE obsoletes (name TEXT, flags TEXT, epoch TEXT, version TEXT, release TEXT, pkgKey INTEGER)`,
+	`CREATE TABLE suggests (name TEXT, flags TEXT, epoch TEXT, version TEXT, release TEXT, pkgKey INTEGER)`,
+	`CREATE TABLE enhances (name TEXT, flags TEXT, epoch TEXT, version TEXT, release TEXT, pkgKey INTEGER)`,
+	`CREATE TABLE recommends (name TEXT, flags TEXT, epoch TEXT, version TEXT, release TEXT, pkgKey INTEGER)`,
+	`CREATE TABLE supplements (name TEXT, flags TEXT, epoch TEXT, version TEXT, release TEXT, pkgKey INTEGER)`,
+	`CREATE INDEX packagename ON packages (name)`,
+	`CREATE INDEX packageId ON packages (pkgId)`,
+	`CREATE INDEX filenames ON files (name)`,
+	`CREATE INDEX pkgfiles ON files (pkgKey)`,
+	`CREATE INDEX pkgrequires ON requires (pkgKey)`,
+	`CREATE INDEX requiresname ON requires (name)`,
+	`CREATE INDEX pkgprovides ON provides (pkgKey)`,
+	`CREATE INDEX providesname ON provides (name)`,
+	`CREATE INDEX pkgconflicts ON conflicts (pkgKey)`,
+	`CREATE INDEX pkgobsoletes ON obsoletes (pkgKey)`,
+	`CREATE INDEX pkgsuggests ON suggests (pkgKey)`,
+	`CREATE INDEX pkgenhances ON enhances (pkgKey)`,
+	`CREATE INDEX pkgrecommends ON recommends (pkgKey)`,
+	`CREATE INDEX pkgsupplements ON supplements (pkgKey)`,
+	`CREATE TRIGGER removals AFTER DELETE ON packages BEGIN
+		DELETE FROM files WHERE pkgKey = old.pkgKey;
+		DELETE FROM requires WHERE pkgKey = old.pkgKey;
+		DELETE FROM provides WHERE pkgKey = old.pkgKey;
+		DELETE FROM conflicts WHERE pkgKey = old.pkgKey;
+		DELETE FROM obsoletes WHERE pkgKey = old.pkgKey;
+		DELETE FROM suggests WHERE pkgKey = old.pkgKey;
+		DELETE FROM enhances WHERE pkgKey = old.pkgKey;
+		DELETE FROM recommends WHERE pkgKey = old.pkgKey;
+		DELETE FROM supplements WHERE pkgKey = old.pkgKey;
+	END`,
+}
+
+var filelistsDatabaseSchema = []string{
+	`CREATE TABLE db_info (dbversion INTEGER, checksum TEXT)`,
+	`CREATE TABLE packages (pkgKey INTEGER PRIMARY KEY, pkgId TEXT)`,
+	`CREATE TABLE filelist (pkgKey INTEGER, dirname TEXT, filenames TEXT, filetypes TEXT)`,
+	`CREATE INDEX keyfile ON filelist (pkgKey)`,
+	`CREATE INDEX pkgId ON packages (pkgId)`,
+	`CREATE INDEX dirnames ON filelist (dirname)`,
+	`CREATE TRIGGER remove_filelist AFTER DELETE ON packages BEGIN
+		DELETE FROM filelist WHERE pkgKey = old.pkgKey;
+	END`,
+}
+
+var otherDatabaseSchema = []string{
+	`CREATE TABLE db_info (dbversion INTEGER, checksum TEXT)`,
+	`CREATE TABLE packages (pkgKey INTEGER PRIMARY KEY, pkgId TEXT)`,
+	`CREATE TABLE changelog (pkgKey INTEGER, author TEXT, date INTEGER, changelog TEXT)`,
+	`CREATE INDEX keychange ON changelog (pkgKey)`,
+	`CREATE INDEX pkgId ON packages (pkgId)`,
+	`CREATE TRIGGER remove_changelogs AFTER DELETE ON packages BEGIN
+		DELETE FROM changelog WHERE pkgKey = old.pkgKey;
+	END`,
+}
+
+// sqliteDB is a yum sqlite database updated within a single transaction.
+type sqliteDB struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// newSQLiteDB opens the database, the schema is created if the database doesn't exist.
+func newSQLiteDB(ctx context.Context, dbPath string, schema []string) (_ *sqliteDB, errFn error) {
+	_, err := os.Stat(dbPath)
+	if err == nil {
+		schema = nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("while opening %s: %w", dbPath, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	defer func() {
+		if errFn != nil {
+			_ = db.Close()
+		}
+	}()
+
+	for _, query := range schema {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("while creating %s schema: %w", dbPath, err)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqliteDB{
+		db: db,
+		tx: tx,
+	}, nil
+}
+
+func (s *sqliteDB) exec(ctx context.Context, query string, args ...any) error {
+	_, err := s.tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// save records the checksum of the uncompressed XML file
+// corresponding to the database and commits the transaction.
+func (s *sqliteDB) save(ctx context.Context, checksum string) error {
+	if err := s.exec(ctx, "DELETE FROM db_info"); err != nil {
+		return errors.Join(err, s.close())
+	}
+	if err := s.exec(ctx, "INSERT INTO db_info (dbversion, checksum) VALUES (?, ?)", sqliteDatabaseVersion, checksum); err != nil {
+		return errors.Join(err, s.close())
+	}
+	if err := s.tx.Commit(); err != nil {
+		return errors.Join(err, s.db.Close())
+	}
+	return s.db.Close()
+}
+
+func (s *sqliteDB) close() error {
+	return errors.Join(s.tx.Rollback(), s.db.Close())
+}
+
+// sqliteDatabases maintains the primary, filelists and other sqlite
+// databases from the package XML metadata.
+type sqliteDatabases struct {
+	dir       string
+	primary   *sqliteDB
+	filelists *sqliteDB
+	other     *sqliteDB
+	pkgKey    int64
+}
+
+func newSQLiteDatabases(ctx context.Context, dir string) (_ *sqliteDatabases, errFn error) {
+	dbs := &sqliteDatabases{
+		dir: dir,
+	}
+	defer func() {
+		if errFn != nil {
+			dbs.close()
+		}
+	}()
+
+	var err error
+
+	dbs.primary, err = newSQLiteDB(ctx, dbs.path(yummeta.PrimaryDatabaseDataType), primaryDatabaseSchema)
+	if err != nil {
+		return nil, err
+	}
+	dbs.filelists, err = newSQLiteDB(ctx, dbs.path(yummeta.FilelistsDatabaseDataType), filelistsDatabaseSchema)
+	if err != nil {
+		return nil, err
+	}
+	dbs.other, err = newSQLiteDB(ctx, dbs.path(yummeta.OtherDatabaseDataType), otherDatabaseSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	// package keys of existing databases are preserved, new packages get the next ones
+	err = dbs.primary.tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(pkgKey), 0) FROM packages").Scan(&dbs.pkgKey)
+	if err != nil {
+		return nil, fmt.Errorf("while reading primary database package keys: %w", err)
+	}
+
+	return dbs, nil
+}
+
+// path returns the path of the database corresponding to the data type.
+func (dbs *sqliteDatabases) path(dataType yummeta.DataType) string {
+	return filepath.Join(dbs.dir, strings.TrimSuffix(yummeta.DataFilePrefix(dataType), ".gz"))
+}
+
+// add inserts the package decoded from its XML metadata into the
+// databases and returns the package key assigned to it.
+func (dbs *sqliteDatabases) add(ctx context.Context, pkg *yumdb.PackageMetadata) (int64, error) {
+	primary := new(yummeta.Package)
+	if err := xml.Unmarshal(pkg.Primary, primary); err != nil {
+		return 0, fmt.Errorf("while decoding primary metadata: %w", err)
+	}
+	filelists := new(yummeta.FilelistsPackage)
+	if err := xml.Unmarshal(pkg.Filelists, filelists); err != nil {
+		return 0, fmt.Errorf("while decoding filelists metadata: %w", err)
+	}
+	other := new(yummeta.OtherPackage)
+	if err := xml.Unmarshal(pkg.Other, other); err != nil {
+		return 0, fmt.Errorf("while decoding other metadata: %w", err)
+	}
+
+	dbs.pkgKey++
+
+	if err := dbs.addPrimary(ctx, primary); err != nil {
+		return 0, fmt.Errorf("while adding package to primary database: %w", err)
+	}
+	if err := dbs.addFilelists(ctx, filelists); err != nil {
+		return 0, fmt.Errorf("while adding package to filelists database: %w", err)
+	}
+	if err := dbs.addOther(ctx, other); err != nil {
+		return 0, fmt.Errorf("while adding package to other database: %w", err)
+	}
+
+	return dbs.pkgKey, nil
+}
+
+// remove deletes the package identified by its key from the databases,
+// the package dependencies, files and changelogs are removed by triggers.
+func (dbs *sqliteDatabases) remove(ctx context.Context, pkgKey int64) error {
+	for _, db := range []*sqliteDB{dbs.primary, dbs.filelists, dbs.other} {
+		if err := db.exec(ctx, "DELETE FROM packages WHERE pkgKey = ?", pkgKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dbs *sqliteDatabases) addPrimary(ctx context.Context, pkg *yummeta.Package) error {
+	err := dbs.primary.exec(
+		ctx,
+		"INSERT INTO packages VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		dbs.pkgKey,
+		pkg.Checksum.Value,
+		pkg.Name,
+		pkg.Arch,
+		pkg.Version.Ver,
+		pkg.Version.Epoch,
+		pkg.Version.Rel,
+		pkg.Summary,
+		pkg.Description,
+		nullString(pkg.URL),
+		pkg.Time.File,
+		pkg.Time.Build,
+		nullString(pkg.Format.License),
+		nullString(pkg.Format.Vendor),
+		nullString(pkg.Format.Group),
+		nullString(pkg.Format.BuildHost),
+		nullString(pkg.Format.SourceRPM),
+		pkg.Format.HeaderRange.Start,
+		pkg.Format.HeaderRange.End,
+		nullString(pkg.Packager),
+		pkg.Size.Package,
+		pkg.Size.Installed,
+		pkg.Size.Archive,
+		pkg.Location.Href,
+		nil,
+		pkg.Checksum.Type,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range pkg.Format.Files {
+		fileType := file.Type
+		if fileType == "" {
+			fileType = "file"
+		}
+		if err := dbs.primary.exec(ctx, "INSERT INTO files VALUES (?, ?, ?)", file.Path, fileType, dbs.pkgKey); err != nil {
+			return err
+		}
+	}
+
+	for _, dependencies := range pkg.Format.Dependencies() {
+		for _, entry := range dependencies.Entries {
+			args := []any{
+				entry.Name,
+				nullString(entry.Flags),
+				nullString(entry.Epoch),
+				nullString(entry.Ver),
+				nullString(entry.Rel),
+				dbs.pkgKey,
+			}
+			placeholders := "?, ?, ?, ?, ?, ?"
+
+			if dependencies.Type == "requires" {
+				pre := "FALSE"
+				if entry.Pre == "1" {
+					pre = "TRUE"
+				}
+				args = append(args, pre)
+				placeholders += ", ?"
+			}
+
+			//nolint:gosec // dependency types are not user input
+			query := fmt.Sprintf("INSERT INTO %s VALUES (%s)", dependencies.Type, placeholders)
+			if err := dbs.primary.exec(ctx, query, args...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (dbs *sqliteDatabases) addFilelists(ctx context.Context, pkg *yummeta.FilelistsPackage) error {
+	if err := dbs.filelists.exec(ctx, "INSERT INTO packages VALUES (?, ?)", dbs.pkgKey, pkg.PkgID); err != nil {
+		return err
+	}
+
+	type directory struct {
+		filenames []string
+		filetypes []byte
+	}
+
+	var dirnames []string
+	directories := make(map[string]*directory)
+
+	for _, file := range pkg.Files {
+		dirname, filename := path.Split(file.Path)
+		if dirname != "/" {
+			dirname = strings.TrimSuffix(dirname, "/")
+		}
+
+		dir, ok := directories[dirname]
+		if !ok {
+			dir = new(directory)
+			directories[dirname] = dir
+			dirnames = append(dirnames, dirname)
+		}
+
+		dir.filenames = append(dir.filenames, filename)
+
+		switch file.Type {
+		case yummeta.PackageFileDir:
+			dir.filetypes = append(dir.filetypes, 'd')
+		case yummeta.PackageFileGhost:
+			dir.filetypes = append(dir.filetypes, 'g')
+		default:
+			dir.filetypes = append(dir.filetypes, 'f')
+		}
+	}
+
+	for _, dirname := range dirnames {
+		dir := directories[dirname]
+		err := dbs.filelists.exec(
+			ctx,
+			"INSERT INTO filelist VALUES (?, ?, ?, ?)",
+			dbs.pkgKey, dirname, strings.Join(dir.filenames, "/"), string(dir.filetypes),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dbs *sqliteDatabases) addOther(ctx context.Context, pkg *yummeta.OtherPackage) error {
+	if err := dbs.other.exec(ctx, "INSERT INTO packages VALUES (?, ?)", dbs.pkgKey, pkg.PkgID); err != nil {
+		return err
+	}
+
+	for _, changelog := range pkg.Changelogs {
+		err := dbs.other.exec(
+			ctx,
+			"INSERT INTO changelog VALUES (?, ?, ?, ?)",
+			dbs.pkgKey, changelog.Author, changelog.Date, changelog.Text,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// save commits the databases with the open checksums of the
+// primary, filelists and other XML files.
+func (dbs *sqliteDatabases) save(ctx context.Context, primaryChecksum, filelistsChecksum, otherChecksum string) error {
+	primary, filelists, other := dbs.primary, dbs.filelists, dbs.other
+	dbs.primary, dbs.filelists, dbs.other = nil, nil, nil
+
+	return errors.Join(
+		primary.save(ctx, primaryChecksum),
+		filelists.save(ctx, filelistsChecksum),
+		other.save(ctx, otherChecksum),
+	)
+}
+
+// close releases the databases not saved.
+func (dbs *sqliteDatabases) close() {
+	for _, db := range []*sqliteDB{dbs.primary, dbs.filelists, dbs.other} {
+		if db != nil {
+			_ = db.close()
+		}
+	}
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
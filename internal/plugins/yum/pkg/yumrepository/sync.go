@@ -16,18 +16,30 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/hashicorp/go-multierror"
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.ciq.dev/beskar/internal/pkg/metrics"
 	"go.ciq.dev/beskar/internal/pkg/sqlite"
+	"go.ciq.dev/beskar/internal/pkg/tracing"
 	"go.ciq.dev/beskar/internal/plugins/yum/pkg/mirror"
 	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yumdb"
 	"go.ciq.dev/beskar/pkg/oras"
 	"go.ciq.dev/beskar/pkg/orasrpm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/semaphore"
 )
 
 const syncMaxDownloads = 10
 
 func (h *Handler) repositorySync(ctx context.Context) (errFn error) {
+	ctx, span := tracing.Start(ctx, "yum.repositorySync", trace.WithAttributes(
+		attribute.String("repository", h.Repository),
+	))
+	defer func() {
+		tracing.End(span, errFn)
+	}()
+
 	reposync := h.updateSyncing(true)
+	syncStart := time.Now()
 
 	defer func() {
 		h.SyncArtifactReset()
@@ -39,6 +51,9 @@ func (h *Handler) repositorySync(ctx context.Context) (errFn error) {
 		} else {
 			reposync.SyncError = ""
 		}
+
+		metrics.ObserveSync("yum", h.Repository, syncStart, reposync.SyncedPackages, reposync.TotalPackages, errFn)
+		h.Params.Webhook.RepositorySynced("yum", h.Repository, syncStart, reposync.SyncedPackages, reposync.TotalPackages, errFn)
 		if err := h.updateReposyncDatabase(dbCtx, reposync); err != nil {
 			if errFn == nil {
 				errFn = err
@@ -200,11 +215,22 @@ func (h *Handler) repositorySync(ctx context.Context) (errFn error) {
 		return err
 	} else if err := packages.Wait(); err != nil {
 		return err
-	} else if !updateMetadata && len(dbPackages) == 0 {
+	}
+
+	// packages not found upstream are kept while they are part of
+	// the snapshots kept by the repository retention policy
+	removedPackages, upstreamRemoval, err := h.mirrorRemovedPackages(dbCtx, dbPackages)
+	if err != nil {
+		return err
+	} else if upstreamRemoval {
+		updateMetadata = true
+	}
+
+	if !updateMetadata && len(removedPackages) == 0 {
 		return nil
 	}
 
-	for pkgID := range dbPackages {
+	for pkgID := range removedPackages {
 		updateMetadata = true
 		pkgID := pkgID
 
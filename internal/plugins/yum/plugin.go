@@ -6,6 +6,7 @@ package yum
 import (
 	"context"
 	_ "embed"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/pprof"
@@ -22,6 +23,7 @@ import (
 	"go.ciq.dev/beskar/internal/pkg/pluginsrv"
 	"go.ciq.dev/beskar/internal/pkg/repository"
 	"go.ciq.dev/beskar/internal/pkg/storage"
+	"go.ciq.dev/beskar/internal/pkg/webhook"
 	"go.ciq.dev/beskar/internal/plugins/yum/pkg/config"
 	"go.ciq.dev/beskar/internal/plugins/yum/pkg/yumrepository"
 	pluginv1 "go.ciq.dev/beskar/pkg/api/plugin/v1"
@@ -29,6 +31,7 @@ import (
 	"go.ciq.dev/beskar/pkg/orasrpm"
 	apiv1 "go.ciq.dev/beskar/pkg/plugins/yum/api/v1"
 	"go.ciq.dev/beskar/pkg/version"
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck
 )
 
 //go:embed embedded/router.rego
@@ -59,6 +62,15 @@ func New(ctx context.Context, beskarYumConfig *config.BeskarYumConfig) (*Plugin,
 
 	ctx = log.SetContextLogger(ctx, logger)
 
+	var signingKey *openpgp.Entity
+
+	if beskarYumConfig.Signing.KeyFile != "" {
+		signingKey, err = yumrepository.ReadSigningKeyFile(beskarYumConfig.Signing.KeyFile, beskarYumConfig.Signing.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("while loading signing key: %w", err)
+		}
+	}
+
 	plugin := &Plugin{
 		ctx: ctx,
 		handlerParams: &repository.HandlerParams{
@@ -67,8 +79,17 @@ func New(ctx context.Context, beskarYumConfig *config.BeskarYumConfig) (*Plugin,
 	}
 	plugin.repositoryManager = repository.NewManager[*yumrepository.Handler](
 		plugin.handlerParams,
-		yumrepository.NewHandler,
+		yumrepository.NewHandlerWithSigningKey(signingKey, beskarYumConfig.Signing.Secret),
+	)
+
+	plugin.handlerParams.Webhook, err = webhook.New(
+		"/beskar/yum",
+		beskarYumConfig.Webhooks,
+		webhook.WithErrorHandler(webhook.LogErrorHandler(logger)),
 	)
+	if err != nil {
+		return nil, err
+	}
 
 	prefix := storage.GetPrefix(beskarYumConfig.Storage)
 
@@ -89,6 +110,7 @@ func New(ctx context.Context, beskarYumConfig *config.BeskarYumConfig) (*Plugin,
 
 	plugin.config.Router = router
 	plugin.config.Gossip = beskarYumConfig.Gossip
+	plugin.config.Tracing = beskarYumConfig.Tracing
 	plugin.config.Info = &pluginv1.Info{
 		Name:    "yum",
 		Version: version.Semver,
@@ -24,6 +24,18 @@ type Page struct {
 	Token string
 }
 
+// Repository retention policy, zero values disable the corresponding rule.
+type RetentionPolicy struct {
+	// Remove files uploaded more than MaxAgeDays days ago.
+	MaxAgeDays int `json:"max_age_days,omitempty"`
+}
+
+// Repository properties/configuration.
+type RepositoryProperties struct {
+	// Retention policy applied periodically to the repository files.
+	Retention *RetentionPolicy `json:"retention,omitempty"`
+}
+
 // Repository logs.
 type RepositoryLog struct {
 	Level   string `json:"level"`
@@ -54,6 +66,16 @@ type Static interface {
 	//kun:success statusCode=200
 	DeleteRepository(ctx context.Context, repository string, deleteFiles bool) (err error)
 
+	// Update static repository properties.
+	//kun:op PUT /repository
+	//kun:success statusCode=200
+	UpdateRepository(ctx context.Context, repository string, properties *RepositoryProperties) (err error)
+
+	// Get static repository properties.
+	//kun:op GET /repository
+	//kun:success statusCode=200
+	GetRepository(ctx context.Context, repository string) (properties *RepositoryProperties, err error)
+
 	// List static repository logs.
 	//kun:op GET /repository/logs
 	//kun:success statusCode=200
@@ -48,6 +48,43 @@ func MakeEndpointOfDeleteRepository(s Static) endpoint.Endpoint {
 	}
 }
 
+type GetRepositoryRequest struct {
+	Repository string `json:"repository"`
+}
+
+// ValidateGetRepositoryRequest creates a validator for GetRepositoryRequest.
+func ValidateGetRepositoryRequest(newSchema func(*GetRepositoryRequest) validating.Schema) httpoption.Validator {
+	return httpoption.FuncValidator(func(value interface{}) error {
+		req := value.(*GetRepositoryRequest)
+		return httpoption.Validate(newSchema(req))
+	})
+}
+
+type GetRepositoryResponse struct {
+	Properties *RepositoryProperties `json:"properties"`
+	Err        error                 `json:"-"`
+}
+
+func (r *GetRepositoryResponse) Body() interface{} { return r }
+
+// Failed implements endpoint.Failer.
+func (r *GetRepositoryResponse) Failed() error { return r.Err }
+
+// MakeEndpointOfGetRepository creates the endpoint for s.GetRepository.
+func MakeEndpointOfGetRepository(s Static) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*GetRepositoryRequest)
+		properties, err := s.GetRepository(
+			ctx,
+			req.Repository,
+		)
+		return &GetRepositoryResponse{
+			Properties: properties,
+			Err:        err,
+		}, nil
+	}
+}
+
 type GetRepositoryFileByNameRequest struct {
 	Repository string `json:"repository"`
 	Name       string `json:"name"`
@@ -240,3 +277,40 @@ func MakeEndpointOfRemoveRepositoryFile(s Static) endpoint.Endpoint {
 		}, nil
 	}
 }
+
+type UpdateRepositoryRequest struct {
+	Repository string                `json:"repository"`
+	Properties *RepositoryProperties `json:"properties"`
+}
+
+// ValidateUpdateRepositoryRequest creates a validator for UpdateRepositoryRequest.
+func ValidateUpdateRepositoryRequest(newSchema func(*UpdateRepositoryRequest) validating.Schema) httpoption.Validator {
+	return httpoption.FuncValidator(func(value interface{}) error {
+		req := value.(*UpdateRepositoryRequest)
+		return httpoption.Validate(newSchema(req))
+	})
+}
+
+type UpdateRepositoryResponse struct {
+	Err error `json:"-"`
+}
+
+func (r *UpdateRepositoryResponse) Body() interface{} { return r }
+
+// Failed implements endpoint.Failer.
+func (r *UpdateRepositoryResponse) Failed() error { return r.Err }
+
+// MakeEndpointOfUpdateRepository creates the endpoint for s.UpdateRepository.
+func MakeEndpointOfUpdateRepository(s Static) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*UpdateRepositoryRequest)
+		err := s.UpdateRepository(
+			ctx,
+			req.Repository,
+			req.Properties,
+		)
+		return &UpdateRepositoryResponse{
+			Err: err,
+		}, nil
+	}
+}
@@ -38,6 +38,20 @@ func NewHTTPRouter(svc Static, codecs httpcodec.Codecs, opts ...httpoption.Optio
 		),
 	)
 
+	codec = codecs.EncodeDecoder("GetRepository")
+	validator = options.RequestValidator("GetRepository")
+	r.Method(
+		"GET", "/repository",
+		kithttp.NewServer(
+			MakeEndpointOfGetRepository(svc),
+			decodeGetRepositoryRequest(codec, validator),
+			httpcodec.MakeResponseEncoder(codec, 200),
+			append(kitOptions,
+				kithttp.ServerErrorEncoder(httpcodec.MakeErrorEncoder(codec)),
+			)...,
+		),
+	)
+
 	codec = codecs.EncodeDecoder("GetRepositoryFileByName")
 	validator = options.RequestValidator("GetRepositoryFileByName")
 	r.Method(
@@ -108,6 +122,20 @@ func NewHTTPRouter(svc Static, codecs httpcodec.Codecs, opts ...httpoption.Optio
 		),
 	)
 
+	codec = codecs.EncodeDecoder("UpdateRepository")
+	validator = options.RequestValidator("UpdateRepository")
+	r.Method(
+		"PUT", "/repository",
+		kithttp.NewServer(
+			MakeEndpointOfUpdateRepository(svc),
+			decodeUpdateRepositoryRequest(codec, validator),
+			httpcodec.MakeResponseEncoder(codec, 200),
+			append(kitOptions,
+				kithttp.ServerErrorEncoder(httpcodec.MakeErrorEncoder(codec)),
+			)...,
+		),
+	)
+
 	return r
 }
 
@@ -127,6 +155,22 @@ func decodeDeleteRepositoryRequest(codec httpcodec.Codec, validator httpoption.V
 	}
 }
 
+func decodeGetRepositoryRequest(codec httpcodec.Codec, validator httpoption.Validator) kithttp.DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		var _req GetRepositoryRequest
+
+		if err := codec.DecodeRequestBody(r, &_req); err != nil {
+			return nil, err
+		}
+
+		if err := validator.Validate(&_req); err != nil {
+			return nil, err
+		}
+
+		return &_req, nil
+	}
+}
+
 func decodeGetRepositoryFileByNameRequest(codec httpcodec.Codec, validator httpoption.Validator) kithttp.DecodeRequestFunc {
 	return func(_ context.Context, r *http.Request) (interface{}, error) {
 		var _req GetRepositoryFileByNameRequest
@@ -206,3 +250,19 @@ func decodeRemoveRepositoryFileRequest(codec httpcodec.Codec, validator httpopti
 		return &_req, nil
 	}
 }
+
+func decodeUpdateRepositoryRequest(codec httpcodec.Codec, validator httpoption.Validator) kithttp.DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		var _req UpdateRepositoryRequest
+
+		if err := codec.DecodeRequestBody(r, &_req); err != nil {
+			return nil, err
+		}
+
+		if err := validator.Validate(&_req); err != nil {
+			return nil, err
+		}
+
+		return &_req, nil
+	}
+}
@@ -41,6 +41,28 @@ paths:
           schema:
             $ref: "#/definitions/DeleteRepositoryRequestBody"
       %s
+    put:
+      description: "Update static repository properties."
+      operationId: "UpdateRepository"
+      tags:
+        - static
+      parameters:
+        - name: body
+          in: body
+          schema:
+            $ref: "#/definitions/UpdateRepositoryRequestBody"
+      %s
+    get:
+      description: "Get static repository properties."
+      operationId: "GetRepository"
+      tags:
+        - static
+      parameters:
+        - name: body
+          in: body
+          schema:
+            $ref: "#/definitions/GetRepositoryRequestBody"
+      %s
   /repository/file:byname:
     get:
       description: "Get file information by name from static repository."
@@ -107,6 +129,8 @@ paths:
 func getResponses(schema oas2.Schema) []oas2.OASResponses {
 	return []oas2.OASResponses{
 		oas2.GetOASResponses(schema, "DeleteRepository", 200, &DeleteRepositoryResponse{}),
+		oas2.GetOASResponses(schema, "UpdateRepository", 200, &UpdateRepositoryResponse{}),
+		oas2.GetOASResponses(schema, "GetRepository", 200, &GetRepositoryResponse{}),
 		oas2.GetOASResponses(schema, "GetRepositoryFileByName", 200, &GetRepositoryFileByNameResponse{}),
 		oas2.GetOASResponses(schema, "GetRepositoryFileByTag", 200, &GetRepositoryFileByTagResponse{}),
 		oas2.GetOASResponses(schema, "ListRepositoryFiles", 200, &ListRepositoryFilesResponse{}),
@@ -124,6 +148,11 @@ func getDefinitions(schema oas2.Schema) map[string]oas2.Definition {
 	}{}))
 	oas2.AddResponseDefinitions(defs, schema, "DeleteRepository", 200, (&DeleteRepositoryResponse{}).Body())
 
+	oas2.AddDefinition(defs, "GetRepositoryRequestBody", reflect.ValueOf(&struct {
+		Repository string `json:"repository"`
+	}{}))
+	oas2.AddResponseDefinitions(defs, schema, "GetRepository", 200, (&GetRepositoryResponse{}).Body())
+
 	oas2.AddDefinition(defs, "GetRepositoryFileByNameRequestBody", reflect.ValueOf(&struct {
 		Repository string `json:"repository"`
 		Name       string `json:"name"`
@@ -154,6 +183,12 @@ func getDefinitions(schema oas2.Schema) map[string]oas2.Definition {
 	}{}))
 	oas2.AddResponseDefinitions(defs, schema, "RemoveRepositoryFile", 200, (&RemoveRepositoryFileResponse{}).Body())
 
+	oas2.AddDefinition(defs, "UpdateRepositoryRequestBody", reflect.ValueOf(&struct {
+		Repository string                `json:"repository"`
+		Properties *RepositoryProperties `json:"properties"`
+	}{}))
+	oas2.AddResponseDefinitions(defs, schema, "UpdateRepository", 200, (&UpdateRepositoryResponse{}).Body())
+
 	return defs
 }
 
@@ -25,6 +25,16 @@ type Page struct {
 	Token string
 }
 
+// Repository retention policy, zero values disable the corresponding rule.
+type RetentionPolicy struct {
+	// Number of most recent EVRs kept per package name and architecture.
+	KeepEVRs int `json:"keep_evrs,omitempty"`
+	// Number of most recent snapshots kept by mirror repositories, a snapshot being
+	// the upstream packages of a mirror synchronization. Packages removed upstream
+	// are deleted once they are not part of the kept snapshots.
+	KeepSnapshots int `json:"keep_snapshots,omitempty"`
+}
+
 // Repository properties/configuration.
 type RepositoryProperties struct {
 	// Configure the repository as a mirror.
@@ -33,6 +43,19 @@ type RepositoryProperties struct {
 	MirrorURLs []string `json:"mirror_urls,omitempty"`
 	// GPG Public Key to check package signatures.
 	GPGKey []byte `json:"gpg_key,omitempty"`
+	// Retention policy applied periodically to the repository packages.
+	Retention *RetentionPolicy `json:"retention,omitempty"`
+	// Armored GPG Private Key to sign repomd.xml, never returned. The key is stored
+	// encrypted with the plugin signing secret. An empty key resets the repository
+	// to the plugin default signing key.
+	SigningKey []byte `json:"signing_key,omitempty"`
+	// Passphrase decrypting the signing key if it's encrypted, never returned.
+	SigningKeyPassphrase string `json:"signing_key_passphrase,omitempty"`
+	// GPG Public Key of the key signing repomd.xml (read only).
+	SigningPublicKey []byte `json:"signing_public_key,omitempty"`
+	// Re-sign uploaded packages with the signing key, packages are verified with
+	// the GPG Public Key first if set and discarded if the verification fails.
+	ResignPackages *bool `json:"resign_packages,omitempty"`
 }
 
 // Repository logs.
@@ -71,6 +94,18 @@ func (pkg RepositoryPackage) RPMName() string {
 	return fmt.Sprintf("%s-%s-%s.%s.rpm", pkg.Name, pkg.Version, pkg.Release, arch)
 }
 
+// Repository module stream or module defaults.
+type RepositoryModule struct {
+	// Document type, either modulemd or modulemd-defaults.
+	Document string `json:"document"`
+	Name     string `json:"name"`
+	// Module stream or default stream for module defaults.
+	Stream  string `json:"stream"`
+	Version uint64 `json:"version,omitempty"`
+	Context string `json:"context,omitempty"`
+	Arch    string `json:"arch,omitempty"`
+}
+
 // Mirror sync status.
 type SyncStatus struct {
 	Syncing        bool   `json:"syncing"`
@@ -154,4 +189,24 @@ type YUM interface { //nolint:interfacebloat
 	//kun:op GET /repository/package:list
 	//kun:success statusCode=200
 	ListRepositoryPackages(ctx context.Context, repository string, page *Page) (repositoryPackages []*RepositoryPackage, err error)
+
+	// Add module streams and defaults from modules.yaml to YUM repository.
+	//kun:op POST /repository/module
+	//kun:success statusCode=200
+	AddRepositoryModules(ctx context.Context, repository string, modules string, replace bool) (err error)
+
+	// Remove module stream from YUM repository.
+	//kun:op DELETE /repository/module
+	//kun:success statusCode=200
+	RemoveRepositoryModule(ctx context.Context, repository string, name string, stream string) (err error)
+
+	// Remove module defaults from YUM repository.
+	//kun:op DELETE /repository/module:defaults
+	//kun:success statusCode=200
+	RemoveRepositoryModuleDefaults(ctx context.Context, repository string, name string) (err error)
+
+	// List module streams and defaults for a YUM repository.
+	//kun:op GET /repository/module:list
+	//kun:success statusCode=200
+	ListRepositoryModules(ctx context.Context, repository string) (repositoryModules []*RepositoryModule, err error)
 }
@@ -11,6 +11,45 @@ import (
 	"github.com/go-kit/kit/endpoint"
 )
 
+type AddRepositoryModulesRequest struct {
+	Repository string `json:"repository"`
+	Modules    string `json:"modules"`
+	Replace    bool   `json:"replace"`
+}
+
+// ValidateAddRepositoryModulesRequest creates a validator for AddRepositoryModulesRequest.
+func ValidateAddRepositoryModulesRequest(newSchema func(*AddRepositoryModulesRequest) validating.Schema) httpoption.Validator {
+	return httpoption.FuncValidator(func(value interface{}) error {
+		req := value.(*AddRepositoryModulesRequest)
+		return httpoption.Validate(newSchema(req))
+	})
+}
+
+type AddRepositoryModulesResponse struct {
+	Err error `json:"-"`
+}
+
+func (r *AddRepositoryModulesResponse) Body() interface{} { return r }
+
+// Failed implements endpoint.Failer.
+func (r *AddRepositoryModulesResponse) Failed() error { return r.Err }
+
+// MakeEndpointOfAddRepositoryModules creates the endpoint for s.AddRepositoryModules.
+func MakeEndpointOfAddRepositoryModules(s YUM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*AddRepositoryModulesRequest)
+		err := s.AddRepositoryModules(
+			ctx,
+			req.Repository,
+			req.Modules,
+			req.Replace,
+		)
+		return &AddRepositoryModulesResponse{
+			Err: err,
+		}, nil
+	}
+}
+
 type CreateRepositoryRequest struct {
 	Repository string                `json:"repository"`
 	Properties *RepositoryProperties `json:"properties"`
@@ -276,6 +315,43 @@ func MakeEndpointOfListRepositoryLogs(s YUM) endpoint.Endpoint {
 	}
 }
 
+type ListRepositoryModulesRequest struct {
+	Repository string `json:"repository"`
+}
+
+// ValidateListRepositoryModulesRequest creates a validator for ListRepositoryModulesRequest.
+func ValidateListRepositoryModulesRequest(newSchema func(*ListRepositoryModulesRequest) validating.Schema) httpoption.Validator {
+	return httpoption.FuncValidator(func(value interface{}) error {
+		req := value.(*ListRepositoryModulesRequest)
+		return httpoption.Validate(newSchema(req))
+	})
+}
+
+type ListRepositoryModulesResponse struct {
+	RepositoryModules []*RepositoryModule `json:"repository_modules"`
+	Err               error               `json:"-"`
+}
+
+func (r *ListRepositoryModulesResponse) Body() interface{} { return r }
+
+// Failed implements endpoint.Failer.
+func (r *ListRepositoryModulesResponse) Failed() error { return r.Err }
+
+// MakeEndpointOfListRepositoryModules creates the endpoint for s.ListRepositoryModules.
+func MakeEndpointOfListRepositoryModules(s YUM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*ListRepositoryModulesRequest)
+		repositoryModules, err := s.ListRepositoryModules(
+			ctx,
+			req.Repository,
+		)
+		return &ListRepositoryModulesResponse{
+			RepositoryModules: repositoryModules,
+			Err:               err,
+		}, nil
+	}
+}
+
 type ListRepositoryPackagesRequest struct {
 	Repository string `json:"repository"`
 	Page       *Page  `json:"page"`
@@ -315,6 +391,82 @@ func MakeEndpointOfListRepositoryPackages(s YUM) endpoint.Endpoint {
 	}
 }
 
+type RemoveRepositoryModuleRequest struct {
+	Repository string `json:"repository"`
+	Name       string `json:"name"`
+	Stream     string `json:"stream"`
+}
+
+// ValidateRemoveRepositoryModuleRequest creates a validator for RemoveRepositoryModuleRequest.
+func ValidateRemoveRepositoryModuleRequest(newSchema func(*RemoveRepositoryModuleRequest) validating.Schema) httpoption.Validator {
+	return httpoption.FuncValidator(func(value interface{}) error {
+		req := value.(*RemoveRepositoryModuleRequest)
+		return httpoption.Validate(newSchema(req))
+	})
+}
+
+type RemoveRepositoryModuleResponse struct {
+	Err error `json:"-"`
+}
+
+func (r *RemoveRepositoryModuleResponse) Body() interface{} { return r }
+
+// Failed implements endpoint.Failer.
+func (r *RemoveRepositoryModuleResponse) Failed() error { return r.Err }
+
+// MakeEndpointOfRemoveRepositoryModule creates the endpoint for s.RemoveRepositoryModule.
+func MakeEndpointOfRemoveRepositoryModule(s YUM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*RemoveRepositoryModuleRequest)
+		err := s.RemoveRepositoryModule(
+			ctx,
+			req.Repository,
+			req.Name,
+			req.Stream,
+		)
+		return &RemoveRepositoryModuleResponse{
+			Err: err,
+		}, nil
+	}
+}
+
+type RemoveRepositoryModuleDefaultsRequest struct {
+	Repository string `json:"repository"`
+	Name       string `json:"name"`
+}
+
+// ValidateRemoveRepositoryModuleDefaultsRequest creates a validator for RemoveRepositoryModuleDefaultsRequest.
+func ValidateRemoveRepositoryModuleDefaultsRequest(newSchema func(*RemoveRepositoryModuleDefaultsRequest) validating.Schema) httpoption.Validator {
+	return httpoption.FuncValidator(func(value interface{}) error {
+		req := value.(*RemoveRepositoryModuleDefaultsRequest)
+		return httpoption.Validate(newSchema(req))
+	})
+}
+
+type RemoveRepositoryModuleDefaultsResponse struct {
+	Err error `json:"-"`
+}
+
+func (r *RemoveRepositoryModuleDefaultsResponse) Body() interface{} { return r }
+
+// Failed implements endpoint.Failer.
+func (r *RemoveRepositoryModuleDefaultsResponse) Failed() error { return r.Err }
+
+// MakeEndpointOfRemoveRepositoryModuleDefaults creates the endpoint for s.RemoveRepositoryModuleDefaults.
+func MakeEndpointOfRemoveRepositoryModuleDefaults(s YUM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*RemoveRepositoryModuleDefaultsRequest)
+		err := s.RemoveRepositoryModuleDefaults(
+			ctx,
+			req.Repository,
+			req.Name,
+		)
+		return &RemoveRepositoryModuleDefaultsResponse{
+			Err: err,
+		}, nil
+	}
+}
+
 type RemoveRepositoryPackageRequest struct {
 	Repository string `json:"repository"`
 	Id         string `json:"id"`
@@ -24,6 +24,20 @@ func NewHTTPRouter(svc YUM, codecs httpcodec.Codecs, opts ...httpoption.Option)
 	var validator httpoption.Validator
 	var kitOptions []kithttp.ServerOption
 
+	codec = codecs.EncodeDecoder("AddRepositoryModules")
+	validator = options.RequestValidator("AddRepositoryModules")
+	r.Method(
+		"POST", "/repository/module",
+		kithttp.NewServer(
+			MakeEndpointOfAddRepositoryModules(svc),
+			decodeAddRepositoryModulesRequest(codec, validator),
+			httpcodec.MakeResponseEncoder(codec, 200),
+			append(kitOptions,
+				kithttp.ServerErrorEncoder(httpcodec.MakeErrorEncoder(codec)),
+			)...,
+		),
+	)
+
 	codec = codecs.EncodeDecoder("CreateRepository")
 	validator = options.RequestValidator("CreateRepository")
 	r.Method(
@@ -122,6 +136,20 @@ func NewHTTPRouter(svc YUM, codecs httpcodec.Codecs, opts ...httpoption.Option)
 		),
 	)
 
+	codec = codecs.EncodeDecoder("ListRepositoryModules")
+	validator = options.RequestValidator("ListRepositoryModules")
+	r.Method(
+		"GET", "/repository/module:list",
+		kithttp.NewServer(
+			MakeEndpointOfListRepositoryModules(svc),
+			decodeListRepositoryModulesRequest(codec, validator),
+			httpcodec.MakeResponseEncoder(codec, 200),
+			append(kitOptions,
+				kithttp.ServerErrorEncoder(httpcodec.MakeErrorEncoder(codec)),
+			)...,
+		),
+	)
+
 	codec = codecs.EncodeDecoder("ListRepositoryPackages")
 	validator = options.RequestValidator("ListRepositoryPackages")
 	r.Method(
@@ -136,6 +164,34 @@ func NewHTTPRouter(svc YUM, codecs httpcodec.Codecs, opts ...httpoption.Option)
 		),
 	)
 
+	codec = codecs.EncodeDecoder("RemoveRepositoryModule")
+	validator = options.RequestValidator("RemoveRepositoryModule")
+	r.Method(
+		"DELETE", "/repository/module",
+		kithttp.NewServer(
+			MakeEndpointOfRemoveRepositoryModule(svc),
+			decodeRemoveRepositoryModuleRequest(codec, validator),
+			httpcodec.MakeResponseEncoder(codec, 200),
+			append(kitOptions,
+				kithttp.ServerErrorEncoder(httpcodec.MakeErrorEncoder(codec)),
+			)...,
+		),
+	)
+
+	codec = codecs.EncodeDecoder("RemoveRepositoryModuleDefaults")
+	validator = options.RequestValidator("RemoveRepositoryModuleDefaults")
+	r.Method(
+		"DELETE", "/repository/module:defaults",
+		kithttp.NewServer(
+			MakeEndpointOfRemoveRepositoryModuleDefaults(svc),
+			decodeRemoveRepositoryModuleDefaultsRequest(codec, validator),
+			httpcodec.MakeResponseEncoder(codec, 200),
+			append(kitOptions,
+				kithttp.ServerErrorEncoder(httpcodec.MakeErrorEncoder(codec)),
+			)...,
+		),
+	)
+
 	codec = codecs.EncodeDecoder("RemoveRepositoryPackage")
 	validator = options.RequestValidator("RemoveRepositoryPackage")
 	r.Method(
@@ -209,6 +265,22 @@ func NewHTTPRouter(svc YUM, codecs httpcodec.Codecs, opts ...httpoption.Option)
 	return r
 }
 
+func decodeAddRepositoryModulesRequest(codec httpcodec.Codec, validator httpoption.Validator) kithttp.DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		var _req AddRepositoryModulesRequest
+
+		if err := codec.DecodeRequestBody(r, &_req); err != nil {
+			return nil, err
+		}
+
+		if err := validator.Validate(&_req); err != nil {
+			return nil, err
+		}
+
+		return &_req, nil
+	}
+}
+
 func decodeCreateRepositoryRequest(codec httpcodec.Codec, validator httpoption.Validator) kithttp.DecodeRequestFunc {
 	return func(_ context.Context, r *http.Request) (interface{}, error) {
 		var _req CreateRepositoryRequest
@@ -321,6 +393,22 @@ func decodeListRepositoryLogsRequest(codec httpcodec.Codec, validator httpoption
 	}
 }
 
+func decodeListRepositoryModulesRequest(codec httpcodec.Codec, validator httpoption.Validator) kithttp.DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		var _req ListRepositoryModulesRequest
+
+		if err := codec.DecodeRequestBody(r, &_req); err != nil {
+			return nil, err
+		}
+
+		if err := validator.Validate(&_req); err != nil {
+			return nil, err
+		}
+
+		return &_req, nil
+	}
+}
+
 func decodeListRepositoryPackagesRequest(codec httpcodec.Codec, validator httpoption.Validator) kithttp.DecodeRequestFunc {
 	return func(_ context.Context, r *http.Request) (interface{}, error) {
 		var _req ListRepositoryPackagesRequest
@@ -337,6 +425,38 @@ func decodeListRepositoryPackagesRequest(codec httpcodec.Codec, validator httpop
 	}
 }
 
+func decodeRemoveRepositoryModuleRequest(codec httpcodec.Codec, validator httpoption.Validator) kithttp.DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		var _req RemoveRepositoryModuleRequest
+
+		if err := codec.DecodeRequestBody(r, &_req); err != nil {
+			return nil, err
+		}
+
+		if err := validator.Validate(&_req); err != nil {
+			return nil, err
+		}
+
+		return &_req, nil
+	}
+}
+
+func decodeRemoveRepositoryModuleDefaultsRequest(codec httpcodec.Codec, validator httpoption.Validator) kithttp.DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		var _req RemoveRepositoryModuleDefaultsRequest
+
+		if err := codec.DecodeRequestBody(r, &_req); err != nil {
+			return nil, err
+		}
+
+		if err := validator.Validate(&_req); err != nil {
+			return nil, err
+		}
+
+		return &_req, nil
+	}
+}
+
 func decodeRemoveRepositoryPackageRequest(codec httpcodec.Codec, validator httpoption.Validator) kithttp.DecodeRequestFunc {
 	return func(_ context.Context, r *http.Request) (interface{}, error) {
 		var _req RemoveRepositoryPackageRequest
@@ -34,6 +34,57 @@ func NewHTTPClient(codecs httpcodec.Codecs, httpClient *http.Client, baseURL str
 	}, nil
 }
 
+func (c *HTTPClient) AddRepositoryModules(ctx context.Context, repository string, modules string, replace bool) (err error) {
+	codec := c.codecs.EncodeDecoder("AddRepositoryModules")
+
+	path := "/repository/module"
+	u := &url.URL{
+		Scheme: c.scheme,
+		Host:   c.host,
+		Path:   c.pathPrefix + path,
+	}
+
+	reqBody := struct {
+		Repository string `json:"repository"`
+		Modules    string `json:"modules"`
+		Replace    bool   `json:"replace"`
+	}{
+		Repository: repository,
+		Modules:    modules,
+		Replace:    replace,
+	}
+	reqBodyReader, headers, err := codec.EncodeRequestBody(&reqBody)
+	if err != nil {
+		return err
+	}
+
+	_req, err := http.NewRequestWithContext(ctx, "POST", u.String(), reqBodyReader)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range headers {
+		_req.Header.Set(k, v)
+	}
+
+	_resp, err := c.httpClient.Do(_req)
+	if err != nil {
+		return err
+	}
+	defer _resp.Body.Close()
+
+	if _resp.StatusCode < http.StatusOK || _resp.StatusCode > http.StatusNoContent {
+		var respErr error
+		err := codec.DecodeFailureResponse(_resp.Body, &respErr)
+		if err == nil {
+			err = respErr
+		}
+		return err
+	}
+
+	return nil
+}
+
 func (c *HTTPClient) CreateRepository(ctx context.Context, repository string, properties *RepositoryProperties) (err error) {
 	codec := c.codecs.EncodeDecoder("CreateRepository")
 
@@ -398,6 +449,58 @@ func (c *HTTPClient) ListRepositoryLogs(ctx context.Context, repository string,
 	return respBody.Logs, nil
 }
 
+func (c *HTTPClient) ListRepositoryModules(ctx context.Context, repository string) (repositoryModules []*RepositoryModule, err error) {
+	codec := c.codecs.EncodeDecoder("ListRepositoryModules")
+
+	path := "/repository/module:list"
+	u := &url.URL{
+		Scheme: c.scheme,
+		Host:   c.host,
+		Path:   c.pathPrefix + path,
+	}
+
+	reqBody := struct {
+		Repository string `json:"repository"`
+	}{
+		Repository: repository,
+	}
+	reqBodyReader, headers, err := codec.EncodeRequestBody(&reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	_req, err := http.NewRequestWithContext(ctx, "GET", u.String(), reqBodyReader)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range headers {
+		_req.Header.Set(k, v)
+	}
+
+	_resp, err := c.httpClient.Do(_req)
+	if err != nil {
+		return nil, err
+	}
+	defer _resp.Body.Close()
+
+	if _resp.StatusCode < http.StatusOK || _resp.StatusCode > http.StatusNoContent {
+		var respErr error
+		err := codec.DecodeFailureResponse(_resp.Body, &respErr)
+		if err == nil {
+			err = respErr
+		}
+		return nil, err
+	}
+
+	respBody := &ListRepositoryModulesResponse{}
+	err = codec.DecodeSuccessResponse(_resp.Body, respBody.Body())
+	if err != nil {
+		return nil, err
+	}
+	return respBody.RepositoryModules, nil
+}
+
 func (c *HTTPClient) ListRepositoryPackages(ctx context.Context, repository string, page *Page) (repositoryPackages []*RepositoryPackage, err error) {
 	codec := c.codecs.EncodeDecoder("ListRepositoryPackages")
 
@@ -452,6 +555,106 @@ func (c *HTTPClient) ListRepositoryPackages(ctx context.Context, repository stri
 	return respBody.RepositoryPackages, nil
 }
 
+func (c *HTTPClient) RemoveRepositoryModule(ctx context.Context, repository string, name string, stream string) (err error) {
+	codec := c.codecs.EncodeDecoder("RemoveRepositoryModule")
+
+	path := "/repository/module"
+	u := &url.URL{
+		Scheme: c.scheme,
+		Host:   c.host,
+		Path:   c.pathPrefix + path,
+	}
+
+	reqBody := struct {
+		Repository string `json:"repository"`
+		Name       string `json:"name"`
+		Stream     string `json:"stream"`
+	}{
+		Repository: repository,
+		Name:       name,
+		Stream:     stream,
+	}
+	reqBodyReader, headers, err := codec.EncodeRequestBody(&reqBody)
+	if err != nil {
+		return err
+	}
+
+	_req, err := http.NewRequestWithContext(ctx, "DELETE", u.String(), reqBodyReader)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range headers {
+		_req.Header.Set(k, v)
+	}
+
+	_resp, err := c.httpClient.Do(_req)
+	if err != nil {
+		return err
+	}
+	defer _resp.Body.Close()
+
+	if _resp.StatusCode < http.StatusOK || _resp.StatusCode > http.StatusNoContent {
+		var respErr error
+		err := codec.DecodeFailureResponse(_resp.Body, &respErr)
+		if err == nil {
+			err = respErr
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *HTTPClient) RemoveRepositoryModuleDefaults(ctx context.Context, repository string, name string) (err error) {
+	codec := c.codecs.EncodeDecoder("RemoveRepositoryModuleDefaults")
+
+	path := "/repository/module:defaults"
+	u := &url.URL{
+		Scheme: c.scheme,
+		Host:   c.host,
+		Path:   c.pathPrefix + path,
+	}
+
+	reqBody := struct {
+		Repository string `json:"repository"`
+		Name       string `json:"name"`
+	}{
+		Repository: repository,
+		Name:       name,
+	}
+	reqBodyReader, headers, err := codec.EncodeRequestBody(&reqBody)
+	if err != nil {
+		return err
+	}
+
+	_req, err := http.NewRequestWithContext(ctx, "DELETE", u.String(), reqBodyReader)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range headers {
+		_req.Header.Set(k, v)
+	}
+
+	_resp, err := c.httpClient.Do(_req)
+	if err != nil {
+		return err
+	}
+	defer _resp.Body.Close()
+
+	if _resp.StatusCode < http.StatusOK || _resp.StatusCode > http.StatusNoContent {
+		var respErr error
+		err := codec.DecodeFailureResponse(_resp.Body, &respErr)
+		if err == nil {
+			err = respErr
+		}
+		return err
+	}
+
+	return nil
+}
+
 func (c *HTTPClient) RemoveRepositoryPackage(ctx context.Context, repository string, id string) (err error) {
 	codec := c.codecs.EncodeDecoder("RemoveRepositoryPackage")
 
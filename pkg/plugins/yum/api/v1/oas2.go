@@ -29,6 +29,29 @@ produces:
 
 	paths = `
 paths:
+  /repository/module:
+    post:
+      description: "Add module streams and defaults from modules.yaml to YUM repository."
+      operationId: "AddRepositoryModules"
+      tags:
+        - yum
+      parameters:
+        - name: body
+          in: body
+          schema:
+            $ref: "#/definitions/AddRepositoryModulesRequestBody"
+      %s
+    delete:
+      description: "Remove module stream from YUM repository."
+      operationId: "RemoveRepositoryModule"
+      tags:
+        - yum
+      parameters:
+        - name: body
+          in: body
+          schema:
+            $ref: "#/definitions/RemoveRepositoryModuleRequestBody"
+      %s
   /repository:
     post:
       description: "Create a YUM repository."
@@ -144,6 +167,18 @@ paths:
           schema:
             $ref: "#/definitions/ListRepositoryLogsRequestBody"
       %s
+  /repository/module:list:
+    get:
+      description: "List module streams and defaults for a YUM repository."
+      operationId: "ListRepositoryModules"
+      tags:
+        - yum
+      parameters:
+        - name: body
+          in: body
+          schema:
+            $ref: "#/definitions/ListRepositoryModulesRequestBody"
+      %s
   /repository/package:list:
     get:
       description: "List RPM packages for a YUM repository."
@@ -156,6 +191,18 @@ paths:
           schema:
             $ref: "#/definitions/ListRepositoryPackagesRequestBody"
       %s
+  /repository/module:defaults:
+    delete:
+      description: "Remove module defaults from YUM repository."
+      operationId: "RemoveRepositoryModuleDefaults"
+      tags:
+        - yum
+      parameters:
+        - name: body
+          in: body
+          schema:
+            $ref: "#/definitions/RemoveRepositoryModuleDefaultsRequestBody"
+      %s
   /repository/sync:
     get:
       description: "Sync YUM repository with an upstream repository."
@@ -185,6 +232,8 @@ paths:
 
 func getResponses(schema oas2.Schema) []oas2.OASResponses {
 	return []oas2.OASResponses{
+		oas2.GetOASResponses(schema, "AddRepositoryModules", 200, &AddRepositoryModulesResponse{}),
+		oas2.GetOASResponses(schema, "RemoveRepositoryModule", 200, &RemoveRepositoryModuleResponse{}),
 		oas2.GetOASResponses(schema, "CreateRepository", 200, &CreateRepositoryResponse{}),
 		oas2.GetOASResponses(schema, "DeleteRepository", 200, &DeleteRepositoryResponse{}),
 		oas2.GetOASResponses(schema, "GetRepository", 200, &GetRepositoryResponse{}),
@@ -195,7 +244,9 @@ func getResponses(schema oas2.Schema) []oas2.OASResponses {
 		oas2.GetOASResponses(schema, "RemoveRepositoryPackageByTag", 200, &RemoveRepositoryPackageByTagResponse{}),
 		oas2.GetOASResponses(schema, "GetRepositorySyncStatus", 200, &GetRepositorySyncStatusResponse{}),
 		oas2.GetOASResponses(schema, "ListRepositoryLogs", 200, &ListRepositoryLogsResponse{}),
+		oas2.GetOASResponses(schema, "ListRepositoryModules", 200, &ListRepositoryModulesResponse{}),
 		oas2.GetOASResponses(schema, "ListRepositoryPackages", 200, &ListRepositoryPackagesResponse{}),
+		oas2.GetOASResponses(schema, "RemoveRepositoryModuleDefaults", 200, &RemoveRepositoryModuleDefaultsResponse{}),
 		oas2.GetOASResponses(schema, "SyncRepository", 200, &SyncRepositoryResponse{}),
 		oas2.GetOASResponses(schema, "SyncRepositoryWithURL", 200, &SyncRepositoryWithURLResponse{}),
 	}
@@ -204,6 +255,13 @@ func getResponses(schema oas2.Schema) []oas2.OASResponses {
 func getDefinitions(schema oas2.Schema) map[string]oas2.Definition {
 	defs := make(map[string]oas2.Definition)
 
+	oas2.AddDefinition(defs, "AddRepositoryModulesRequestBody", reflect.ValueOf(&struct {
+		Repository string `json:"repository"`
+		Modules    string `json:"modules"`
+		Replace    bool   `json:"replace"`
+	}{}))
+	oas2.AddResponseDefinitions(defs, schema, "AddRepositoryModules", 200, (&AddRepositoryModulesResponse{}).Body())
+
 	oas2.AddDefinition(defs, "CreateRepositoryRequestBody", reflect.ValueOf(&struct {
 		Repository string                `json:"repository"`
 		Properties *RepositoryProperties `json:"properties"`
@@ -244,12 +302,30 @@ func getDefinitions(schema oas2.Schema) map[string]oas2.Definition {
 	}{}))
 	oas2.AddResponseDefinitions(defs, schema, "ListRepositoryLogs", 200, (&ListRepositoryLogsResponse{}).Body())
 
+	oas2.AddDefinition(defs, "ListRepositoryModulesRequestBody", reflect.ValueOf(&struct {
+		Repository string `json:"repository"`
+	}{}))
+	oas2.AddResponseDefinitions(defs, schema, "ListRepositoryModules", 200, (&ListRepositoryModulesResponse{}).Body())
+
 	oas2.AddDefinition(defs, "ListRepositoryPackagesRequestBody", reflect.ValueOf(&struct {
 		Repository string `json:"repository"`
 		Page       *Page  `json:"page"`
 	}{}))
 	oas2.AddResponseDefinitions(defs, schema, "ListRepositoryPackages", 200, (&ListRepositoryPackagesResponse{}).Body())
 
+	oas2.AddDefinition(defs, "RemoveRepositoryModuleRequestBody", reflect.ValueOf(&struct {
+		Repository string `json:"repository"`
+		Name       string `json:"name"`
+		Stream     string `json:"stream"`
+	}{}))
+	oas2.AddResponseDefinitions(defs, schema, "RemoveRepositoryModule", 200, (&RemoveRepositoryModuleResponse{}).Body())
+
+	oas2.AddDefinition(defs, "RemoveRepositoryModuleDefaultsRequestBody", reflect.ValueOf(&struct {
+		Repository string `json:"repository"`
+		Name       string `json:"name"`
+	}{}))
+	oas2.AddResponseDefinitions(defs, schema, "RemoveRepositoryModuleDefaults", 200, (&RemoveRepositoryModuleDefaultsResponse{}).Body())
+
 	oas2.AddDefinition(defs, "RemoveRepositoryPackageRequestBody", reflect.ValueOf(&struct {
 		Repository string `json:"repository"`
 		Id         string `json:"id"`